@@ -36,7 +36,7 @@ var (
 // EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
 // NOTE: json tags are required.  Any new fields you add must have json tags for the fields to be serialized.
 
-// AuthenticatorSpec defines the desired state of a single authenticator instance
+// AuthenticatorSpec defines the desired state of a single authenticator instance.
 type AuthenticatorSpec struct {
 	// INSERT ADDITIONAL SPEC FIELDS - desired state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
@@ -47,7 +47,24 @@ type AuthenticatorSpec struct {
 	Enabled bool `json:"enabled"`
 
 	// Interfaces is the list of interfaces to protect under this authenticator instance
-	Interfaces []string `json:"interfaces"`
+	// +optional
+	Interfaces []string `json:"interfaces,omitempty"`
+
+	// InterfaceSelectors select further interfaces to protect by their
+	// hardware, for nodes which name the same ports differently.  The
+	// monitor resolves them on each node, and reports the interfaces it
+	// protects in the AuthenticatorNodeState of the node.  Only identical
+	// selectors, and name patterns matching interfaces named by another
+	// Authenticator, are rejected as overlapping, so selectors of
+	// Authenticators sharing nodes must not select the same hardware.
+	// +optional
+	InterfaceSelectors []InterfaceSelector `json:"interfaceSelectors,omitempty"`
+
+	// InterfaceOverrides override settings of the authenticator for some of
+	// its interfaces.  hostapd gets a separate configuration for each
+	// interface overridden.
+	// +optional
+	InterfaceOverrides []InterfaceOverride `json:"interfaceOverrides,omitempty"`
 
 	// Authentication configures back-end authentication for this authenticator
 	Authentication Auth `json:"authentication"`
@@ -69,6 +86,11 @@ type AuthenticatorSpec struct {
 	// disallow all traffic until authenticated, and then allow all traffic.
 	// +optional
 	TrafficControl *TrafficControl `json:"trafficControl,omitempty"`
+
+	// MACsec enables IEEE 802.1AE MACsec protection, keyed by MKA (IEEE
+	// 802.1X-2010), on the protected interfaces.  If unset, MACsec is not used.
+	// +optional
+	MACsec *MACsec `json:"macsec,omitempty"`
 }
 
 // Auth represents back-end authentication configuration
@@ -80,6 +102,28 @@ type Auth struct {
 	// Radius is the external RADIUS server configuration to use for authentication
 	// +optional
 	Radius *Radius `json:"radius,omitempty"`
+
+	// MAB enables MAC Authentication Bypass for devices which cannot run a
+	// supplicant
+	// +optional
+	MAB *MAB `json:"mab,omitempty"`
+}
+
+// MAB represents a MAC Authentication Bypass configuration.  Source MAC
+// addresses no EAPOL was received from within Timeout are authorized against
+// the MACs list when set, or else against the RADIUS authentication servers.
+type MAB struct {
+	// Timeout is the number of seconds to wait for EAPOL from a source MAC
+	// address before authorizing it with MAB
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:default=30
+	// +optional
+	Timeout int `json:"timeout,omitempty"`
+
+	// MACs is a local list of MAC addresses to authorize
+	// +kubebuilder:validation:items:Pattern=`^([0-9a-fA-F]{2}:){5}[0-9a-fA-F]{2}$`
+	// +optional
+	MACs []string `json:"macs,omitempty"`
 }
 
 // Local represents a local EAP authentication configuration
@@ -115,14 +159,114 @@ type Local struct {
 
 // Radius represents a RADIUS server configuration
 type Radius struct {
-	// AuthServer is the IP address or hostname of the RADIUS authentication server
-	AuthServer string `json:"authServer"`
+	// AuthServer is the IP address or hostname of the RADIUS authentication server.
+	// Deprecated: use AuthServers instead.  When set, it is used as the first
+	// (primary) entry ahead of AuthServers.
+	// +optional
+	AuthServer string `json:"authServer,omitempty"`
 
 	// AuthPort is the TCP Port of the RADIUS authentication server
-	AuthPort int `json:"authPort"`
+	// +optional
+	AuthPort int `json:"authPort,omitempty"`
 
 	// AuthSecret is the name of the Secret that contains the RADIUS authentication server shared secret
-	AuthSecret string `json:"authSecret"`
+	// +optional
+	AuthSecret string `json:"authSecret,omitempty"`
+
+	// AuthSecretKey is the key in the AuthSecret Secret holding the shared secret.
+	// If the key is not specified, it is assumed to be "secret"
+	// +optional
+	AuthSecretKey string `json:"authSecretKey,omitempty"`
+
+	// AuthServers is the ordered list of RADIUS authentication servers.  The
+	// first entry is the primary server; hostapd fails over to the next entry
+	// when the current server stops responding.  There can be at most 10
+	// servers, counting AuthServer.
+	// +kubebuilder:validation:MaxItems=10
+	// +optional
+	AuthServers []RadiusServer `json:"authServers,omitempty"`
+
+	// RetryPrimaryInterval is the number of seconds after a failover before
+	// hostapd tries to return to the primary server (0 = disabled)
+	// +optional
+	RetryPrimaryInterval int `json:"retryPrimaryInterval,omitempty"`
+
+	// DynamicVlan enables VLAN assignment by the RADIUS server through the
+	// Tunnel-Private-Group-ID attribute.  With "optional", supplicants without
+	// an assigned VLAN keep the VF's VLAN; with "required", they are rejected.
+	// +kubebuilder:validation:Enum=disabled;optional;required
+	// +optional
+	DynamicVlan DynamicVlanMode `json:"dynamicVlan,omitempty"`
+
+	// Accounting configures RADIUS accounting for authenticated supplicants
+	// +optional
+	Accounting *RadiusAccounting `json:"accounting,omitempty"`
+
+	// Transport selects how RADIUS messages reach the servers: "udp" (the
+	// default) or "tls" for RADIUS over TLS (RadSec, RFC 6614).  With "tls",
+	// hostapd talks to a local RadSec proxy, the per-server shared secrets are
+	// not used, and server ports default to 2083.  The proxy listens on fixed
+	// loopback ports of the node, so only one Authenticator using "tls" may
+	// run on each node.
+	// +kubebuilder:validation:Enum=udp;tls
+	// +optional
+	Transport RadiusTransport `json:"transport,omitempty"`
+
+	// TLS configures the RadSec client certificate and trust when Transport is "tls"
+	// +optional
+	TLS *RadiusTLS `json:"tls,omitempty"`
+}
+
+type RadiusTransport string
+
+var (
+	RadiusTransportUDP RadiusTransport = "udp"
+	RadiusTransportTLS RadiusTransport = "tls"
+)
+
+// RadiusTLS represents the RadSec client TLS configuration
+type RadiusTLS struct {
+	// ClientCertSecret secret reference containing the RadSec client certificate.
+	// If the key is not specified, it is assumed to be "tls.crt"
+	ClientCertSecret SecretKeyRef `json:"clientCertSecret"`
+	// ClientKeySecret secret reference containing the RadSec client private key.
+	// If the key is not specified, it is assumed to be "tls.key"
+	ClientKeySecret SecretKeyRef `json:"clientKeySecret"`
+	// CaCertSecret secret reference containing the certificate authority used to
+	// verify the RadSec servers.  If the key is not specified, it is assumed to be "ca.crt"
+	CaCertSecret SecretKeyRef `json:"caCertSecret"`
+	// ServerName overrides the name used to verify the server certificates.
+	// By default, the server address is used.
+	// +optional
+	ServerName string `json:"serverName,omitempty"`
+}
+
+// RadiusAccounting represents the RADIUS accounting configuration
+type RadiusAccounting struct {
+	// Servers is the ordered list of RADIUS accounting servers.  The first
+	// entry is the primary server.
+	// +kubebuilder:validation:MaxItems=10
+	Servers []RadiusServer `json:"servers"`
+
+	// InterimInterval is the interval in seconds between Accounting-Interim
+	// updates for each session (0 = disabled; at least 60 otherwise)
+	// +optional
+	InterimInterval int `json:"interimInterval,omitempty"`
+}
+
+// RadiusServer represents a single RADIUS server endpoint
+type RadiusServer struct {
+	// Address is the IP address of the RADIUS server
+	Address string `json:"address"`
+
+	// Port is the UDP port of the RADIUS server.  If not specified, it is
+	// assumed to be 1812 for authentication and 1813 for accounting
+	// +optional
+	Port int `json:"port,omitempty"`
+
+	// Secret references the Secret that contains the shared secret for this server.
+	// If the key is not specified, it is assumed to be "secret"
+	Secret SecretKeyRef `json:"secret"`
 }
 
 type SecretKeyRef struct {
@@ -134,6 +278,23 @@ type SecretKeyRef struct {
 	Key string `json:"key,omitempty"`
 }
 
+// Default keys of the Secrets referenced by an Authenticator, as documented
+// on each reference.  The defaulting webhook fills them in, and the
+// configuration is generated with them for Authenticators it did not default.
+const (
+	DefaultUserFileKey     = "hostapd.eap_user"
+	DefaultCaCertKey       = "1x-ca.pem"
+	DefaultServerCertKey   = "1x-hostapd.example.com.pem"
+	DefaultPrivateKeyKey   = "1x-hostapd.example.com.key"
+	DefaultRadiusClientKey = "hostapd.radius_clients"
+	DefaultRadiusSecretKey = "secret"
+	DefaultRadSecCertKey   = "tls.crt"
+	DefaultRadSecKeyKey    = "tls.key"
+	DefaultRadSecCaCertKey = "ca.crt"
+	DefaultMACsecCakKey    = "cak"
+	DefaultMACsecCknKey    = "ckn"
+)
+
 // Config represents miscelaneous 802.1x and EAP tunable values
 type Config struct {
 	// EapReauthPeriod is the EAP reauthentication period in seconds (default: 3600 seconds; 0 = disable)
@@ -141,11 +302,345 @@ type Config struct {
 	EapReauthPeriod int `json:"eapReauthPeriod"`
 }
 
+type MACsecPolicy string
+
+var (
+	// MACsecPolicyShouldSecure secures the link when the peer supports
+	// MACsec, and allows unsecured traffic from authenticated peers otherwise
+	MACsecPolicyShouldSecure MACsecPolicy = "should-secure"
+	// MACsecPolicyMustSecure only allows MACsec-protected traffic from
+	// authenticated peers
+	MACsecPolicyMustSecure MACsecPolicy = "must-secure"
+)
+
+type MACsecCipherSuite string
+
+var (
+	MACsecCipherSuiteGcmAes128 MACsecCipherSuite = "GCM-AES-128"
+	MACsecCipherSuiteGcmAes256 MACsecCipherSuite = "GCM-AES-256"
+)
+
+// MACsec represents the MACsec and MKA configuration
+type MACsec struct {
+	// Policy is the MACsec policy, "should-secure" or "must-secure"
+	// +kubebuilder:validation:Enum=should-secure;must-secure
+	// +kubebuilder:default=should-secure
+	// +optional
+	Policy MACsecPolicy `json:"policy,omitempty"`
+
+	// CipherSuite is the MACsec cipher suite, "GCM-AES-128" or "GCM-AES-256"
+	// +kubebuilder:validation:Enum=GCM-AES-128;GCM-AES-256
+	// +kubebuilder:default=GCM-AES-128
+	// +optional
+	CipherSuite MACsecCipherSuite `json:"cipherSuite,omitempty"`
+
+	// IntegrityOnly disables encryption, so that MACsec only provides integrity protection
+	// +optional
+	IntegrityOnly bool `json:"integrityOnly,omitempty"`
+
+	// ReplayProtect enables MACsec replay protection
+	// +optional
+	ReplayProtect bool `json:"replayProtect,omitempty"`
+
+	// ReplayWindow is the number of out-of-order frames accepted with replay protection
+	// +optional
+	ReplayWindow int `json:"replayWindow,omitempty"`
+
+	// Priority is the MKA key server priority (0-255, lower is higher
+	// priority).  0 is the highest priority, for the authenticator to be
+	// elected key server.
+	// +kubebuilder:default=255
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=255
+	// +optional
+	Priority *int `json:"priority,omitempty"`
+
+	// PreSharedKey configures a static MKA connectivity association key.  If
+	// unset, the CAK is derived dynamically from the EAP session.
+	// +optional
+	PreSharedKey *MACsecPreSharedKey `json:"preSharedKey,omitempty"`
+}
+
+// MACsecPreSharedKey represents a static MKA CAK/CKN pair stored in a Secret
+type MACsecPreSharedKey struct {
+	// SecretName is the name of the Secret holding the hex-encoded CAK and CKN
+	SecretName string `json:"secretName"`
+
+	// CakKey is the key in the Secret holding the CAK.
+	// If the key is not specified, it is assumed to be "cak"
+	// +optional
+	CakKey string `json:"cakKey,omitempty"`
+
+	// CknKey is the key in the Secret holding the CKN.
+	// If the key is not specified, it is assumed to be "ckn"
+	// +optional
+	CknKey string `json:"cknKey,omitempty"`
+}
+
+type AuthenticationMode string
+
+var (
+	// AuthenticationModePort releases all VFs of an SR-IOV PF once any
+	// supplicant has authenticated on it
+	AuthenticationModePort AuthenticationMode = "port"
+	// AuthenticationModePerVF only releases the VF each authenticated
+	// supplicant is mapped to
+	AuthenticationModePerVF AuthenticationMode = "per-vf"
+)
+
+type DynamicVlanMode string
+
+var (
+	DynamicVlanDisabled DynamicVlanMode = "disabled"
+	DynamicVlanOptional DynamicVlanMode = "optional"
+	DynamicVlanRequired DynamicVlanMode = "required"
+)
+
+// InterfaceSelector selects the network interfaces of a node which match
+// all the fields set.  Virtual interfaces without a device are never
+// selected, and neither are SR-IOV VFs, as they are protected along with
+// their PF.
+type InterfaceSelector struct {
+	// NamePattern is a shell pattern the interface name must match, such as
+	// ens*f0
+	// +optional
+	NamePattern string `json:"namePattern,omitempty"`
+	// PciAddress is the PCI address of the device, such as 0000:3b:00.0, or
+	// a shell pattern for it
+	// +optional
+	PciAddress string `json:"pciAddress,omitempty"`
+	// Vendor is the hexadecimal PCI vendor ID of the device, such as 8086
+	// +kubebuilder:validation:Pattern=`^(0x)?[0-9a-fA-F]{4}$`
+	// +optional
+	Vendor string `json:"vendor,omitempty"`
+	// Device is the hexadecimal PCI device ID of the device, such as 158b
+	// +kubebuilder:validation:Pattern=`^(0x)?[0-9a-fA-F]{4}$`
+	// +optional
+	Device string `json:"device,omitempty"`
+	// Driver is the name of the kernel driver bound to the device, such as
+	// i40e
+	// +optional
+	Driver string `json:"driver,omitempty"`
+	// ResourceName is an SR-IOV network device plugin resource, such as
+	// openshift.io/intel_sriov, selecting the PFs its pfNames and
+	// rootDevices selectors name in the device plugin configuration of the
+	// node
+	// +optional
+	ResourceName string `json:"resourceName,omitempty"`
+}
+
+// InterfaceOverride overrides settings of an Authenticator for one of its
+// interfaces.  Settings left unset are those of the Authenticator.
+type InterfaceOverride struct {
+	// Interface is the name of the interface, listed in interfaces or
+	// resolved from the interface selectors
+	Interface string `json:"interface"`
+
+	// EapReauthPeriod overrides configuration.eapReauthPeriod
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	EapReauthPeriod *int `json:"eapReauthPeriod,omitempty"`
+
+	// DynamicVlan overrides authentication.radius.dynamicVlan, and needs
+	// RADIUS authentication
+	// +kubebuilder:validation:Enum=disabled;optional;required
+	// +optional
+	DynamicVlan DynamicVlanMode `json:"dynamicVlan,omitempty"`
+
+	// UnprotectedPorts overrides trafficControl.unprotectedPorts
+	// +optional
+	UnprotectedPorts *Ports `json:"unprotectedPorts,omitempty"`
+
+	// AuthenticationMode overrides trafficControl.authenticationMode
+	// +kubebuilder:validation:Enum=port;per-vf
+	// +optional
+	AuthenticationMode AuthenticationMode `json:"authenticationMode,omitempty"`
+
+	// GuestVlan overrides trafficControl.guestVlan, 0 to block
+	// unauthenticated VFs instead
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=4094
+	// +optional
+	GuestVlan *int `json:"guestVlan,omitempty"`
+
+	// GuestVlanTimeout overrides trafficControl.guestVlanTimeout
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	GuestVlanTimeout *int `json:"guestVlanTimeout,omitempty"`
+
+	// AuthFailVlan overrides trafficControl.authFailVlan, 0 to block VFs
+	// whose supplicant failed authentication instead
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=4094
+	// +optional
+	AuthFailVlan *int `json:"authFailVlan,omitempty"`
+}
+
+type TrafficControlBackend string
+
+var (
+	// TrafficControlBackendTC enforces authentication with tc filters on a
+	// clsact qdisc
+	TrafficControlBackendTC TrafficControlBackend = "tc"
+	// TrafficControlBackendNftables enforces authentication with a netdev
+	// family nftables table
+	TrafficControlBackendNftables TrafficControlBackend = "nftables"
+)
+
 // TrafficControl represents the traffic control for hostapd.
 type TrafficControl struct {
 	// UnprotectedPorts is a list of ingress destination ports to allow even for unathenticated interfaces
 	// +optional
 	UnprotectedPorts *Ports `json:"unprotectedPorts,omitempty"`
+
+	// Exceptions are further ethertypes and IP traffic to allow even for
+	// unauthenticated interfaces, such as PTP over L2, LLDP, IPv6 neighbour
+	// discovery or DHCP
+	// +optional
+	Exceptions []TrafficException `json:"exceptions,omitempty"`
+
+	// EgressPolicy is "allow" to leave egress traffic alone, or "drop" to
+	// drop all egress traffic but EAPOL and the EgressExceptions until a
+	// supplicant authenticates, and then only allow traffic to it
+	// +kubebuilder:validation:Enum=allow;drop
+	// +kubebuilder:default=allow
+	// +optional
+	EgressPolicy EgressPolicy `json:"egressPolicy,omitempty"`
+
+	// EgressExceptions are the ethertypes and IP traffic to allow to any
+	// destination with the drop egress policy
+	// +optional
+	EgressExceptions []TrafficException `json:"egressExceptions,omitempty"`
+
+	// Backend selects how traffic control is enforced, "tc" or "nftables"
+	// +kubebuilder:validation:Enum=tc;nftables
+	// +kubebuilder:default=tc
+	// +optional
+	Backend TrafficControlBackend `json:"backend,omitempty"`
+
+	// AuthenticationMode is "port" to release all VFs of an SR-IOV PF once
+	// any supplicant has authenticated, or "per-vf" to only release the VF
+	// each supplicant is mapped to
+	// +kubebuilder:validation:Enum=port;per-vf
+	// +kubebuilder:default=port
+	// +optional
+	AuthenticationMode AuthenticationMode `json:"authenticationMode,omitempty"`
+
+	// VFSupplicants maps supplicants to VFs in per-VF mode.  Supplicants not
+	// listed are mapped to the VF with the same MAC address.
+	// +optional
+	VFSupplicants []VFSupplicants `json:"vfSupplicants,omitempty"`
+
+	// GuestVlan is the VLAN SR-IOV VFs are released on when no EAPOL has
+	// been received for them within GuestVlanTimeout, giving devices
+	// without a supplicant access to a restricted network
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=4094
+	// +optional
+	GuestVlan int `json:"guestVlan,omitempty"`
+
+	// GuestVlanTimeout is the number of seconds to wait for EAPOL before
+	// releasing VFs on the guest VLAN, 90 if unset
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	GuestVlanTimeout int `json:"guestVlanTimeout,omitempty"`
+
+	// AuthFailVlan is the VLAN SR-IOV VFs are released on after their
+	// supplicant failed authentication, until it authenticates
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=4094
+	// +optional
+	AuthFailVlan int `json:"authFailVlan,omitempty"`
+
+	// AllowedMacs are source MAC addresses whose traffic is always
+	// allowed, without authentication, such as a PTP grandmaster clock
+	// +kubebuilder:validation:items:Pattern=`^([0-9a-fA-F]{2}:){5}[0-9a-fA-F]{2}$`
+	// +optional
+	AllowedMacs []string `json:"allowedMacs,omitempty"`
+
+	// DeniedMacs are source MAC addresses whose traffic is always dropped,
+	// even after they authenticate.  They take precedence over AllowedMacs.
+	// +kubebuilder:validation:items:Pattern=`^([0-9a-fA-F]{2}:){5}[0-9a-fA-F]{2}$`
+	// +optional
+	DeniedMacs []string `json:"deniedMacs,omitempty"`
+}
+
+// VFSupplicants represents the supplicants behind a VF
+type VFSupplicants struct {
+	// VF is the VF index on each protected PF
+	// +kubebuilder:validation:Minimum=0
+	VF int `json:"vf"`
+
+	// MACs are the supplicant MAC addresses
+	// +kubebuilder:validation:items:Pattern=`^([0-9a-fA-F]{2}:){5}[0-9a-fA-F]{2}$`
+	MACs []string `json:"macs"`
+}
+
+type EgressPolicy string
+
+var (
+	// EgressPolicyAllow does not filter egress traffic
+	EgressPolicyAllow EgressPolicy = "allow"
+	// EgressPolicyDrop only allows egress traffic to authenticated peers
+	EgressPolicyDrop EgressPolicy = "drop"
+)
+
+// IPProtocol is an IP protocol matched by a TrafficException
+// +kubebuilder:validation:Enum=tcp;udp;icmp;icmpv6
+type IPProtocol string
+
+var (
+	IPProtocolTCP    IPProtocol = "tcp"
+	IPProtocolUDP    IPProtocol = "udp"
+	IPProtocolICMP   IPProtocol = "icmp"
+	IPProtocolICMPv6 IPProtocol = "icmpv6"
+)
+
+// TrafficException allows either all frames of an ethertype, or IP traffic
+// matching all of the given fields.  IP traffic is matched for both IPv4 and
+// IPv6, unless the protocol or CIDRs only apply to one of them.
+type TrafficException struct {
+	// EtherType allows all frames of an ethertype, such as 0x88F7 for PTP
+	// over L2 or 0x88CC for LLDP.  The IP fields must be unset.
+	// +kubebuilder:validation:Minimum=1536
+	// +kubebuilder:validation:Maximum=65535
+	// +optional
+	EtherType int `json:"etherType,omitempty"`
+
+	// Protocol is the IP protocol to allow, any if unset
+	// +optional
+	Protocol IPProtocol `json:"protocol,omitempty"`
+
+	// Ports are the tcp or udp destination ports to allow, any if unset
+	// +optional
+	Ports []PortRange `json:"ports,omitempty"`
+
+	// ICMPTypes are the icmp or icmpv6 types (0 to 255) to allow, any if
+	// unset, such as 133 to 137 for IPv6 neighbour discovery
+	// +optional
+	ICMPTypes []int `json:"icmpTypes,omitempty"`
+
+	// SourceCIDRs are the source prefixes to allow, any if unset
+	// +optional
+	SourceCIDRs []string `json:"sourceCIDRs,omitempty"`
+
+	// DestinationCIDRs are the destination prefixes to allow, any if unset
+	// +optional
+	DestinationCIDRs []string `json:"destinationCIDRs,omitempty"`
+}
+
+// PortRange represents a destination port, or a range of ports
+type PortRange struct {
+	// Port is the destination port, or the first port of the range
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	Port int `json:"port"`
+
+	// EndPort is the last port of the range, if any
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	// +optional
+	EndPort int `json:"endPort,omitempty"`
 }
 
 // Port represents a single IP port
@@ -164,9 +659,71 @@ type AuthenticatorStatus struct {
 	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
 
-	// Interfaces is the list of interface status
+	// Interfaces is the list of interface status.
+	// Deprecated: interfaces of the same name on different nodes overwrote
+	// each other here, and are now reported per node by the
+	// AuthenticatorNodeState objects of the authenticator
 	// +optional
 	Interfaces []*Interface `json:"interfaces,omitempty"`
+
+	// ObservedGeneration is the most recent generation of the spec that the
+	// operator has acted on
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// ConfigHash is the SHA-256 hash of the hostapd configuration rendered
+	// for the observed generation
+	// +optional
+	ConfigHash string `json:"configHash,omitempty"`
+
+	// Conditions summarize the state of the authenticator on all nodes
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// NodesReady is the number of nodes on which the authenticator is ready
+	// +optional
+	NodesReady int `json:"nodesReady"`
+
+	// PortsAuthenticated is the number of interfaces, across all nodes,
+	// with at least one authenticated client
+	// +optional
+	PortsAuthenticated int `json:"portsAuthenticated"`
+
+	// RadSec is the list of RadSec server connection status, when the RADIUS
+	// transport is "tls".
+	// Deprecated: RadSec connections are reported per node by the
+	// AuthenticatorNodeState objects of the authenticator
+	// +optional
+	RadSec []*RadSecServer `json:"radSec,omitempty"`
+}
+
+// Authenticator condition types
+const (
+	// ConditionReady is true when the spec is rolled out and the
+	// authenticator is ready on every node it is scheduled on
+	ConditionReady = "Ready"
+	// ConditionProgressing is true while the DaemonSet is rolling out a
+	// change to the spec
+	ConditionProgressing = "Progressing"
+	// ConditionDegraded is true when the configuration could not be rendered,
+	// or an interface is not enabled or a RadSec server is disconnected on
+	// any node
+	ConditionDegraded = "Degraded"
+	// ConditionSecretsResolved is true when every referenced Secret exists
+	// and holds the expected keys
+	ConditionSecretsResolved = "SecretsResolved"
+)
+
+type RadSecServer struct {
+	// Server is the address of the RadSec server
+	Server string `json:"server"`
+	// Connected is true when the TLS connection to the server is established
+	Connected bool `json:"connected"`
+	// LastError is the most recent connection or TLS error for the server
+	// +optional
+	LastError string `json:"lastError,omitempty"`
 }
 
 type Interface struct {
@@ -175,13 +732,138 @@ type Interface struct {
 	// State is the state of the interface. The possible states are Uninitialized,
 	// Disabled, CountryUpdate, ACS, HT Scan, DFS, Enabled or Unknown.
 	State IfState `json:"status"`
-	// AuthenticatedClients is the list of authenticated stations on the interface
+	// AuthenticatedClients is the list of authenticated stations on the interface.
+	// Deprecated: use Clients, which has the session details of each station
 	// +optional
 	AuthenticatedClients []string `json:"authenticatedClients"`
+	// Clients reports how each authenticated station was authenticated, and
+	// the details of its session
+	// +optional
+	Clients []ClientStatus `json:"clients,omitempty"`
+	// ActiveAuthServer is the RADIUS authentication server (address:port)
+	// hostapd is currently using for this interface
+	// +optional
+	ActiveAuthServer string `json:"activeAuthServer,omitempty"`
+	// MACsec is the MKA and secure channel state, when MACsec is enabled
+	// +optional
+	MACsec *MACsecStatus `json:"macsec,omitempty"`
+	// AssignedVlans are the VLANs assigned by the RADIUS server to
+	// authenticated clients
+	// +optional
+	AssignedVlans []AssignedVlan `json:"assignedVlans,omitempty"`
+	// VFs is the port state of each VF of an SR-IOV PF
+	// +optional
+	VFs []VFStatus `json:"vfs,omitempty"`
+	// AllowedMacs are the source MAC addresses always allowed on the
+	// interface
+	// +optional
+	AllowedMacs []string `json:"allowedMacs,omitempty"`
+	// DeniedMacs are the source MAC addresses always dropped on the
+	// interface
+	// +optional
+	DeniedMacs []string `json:"deniedMacs,omitempty"`
+}
+
+type VFPortState string
+
+var (
+	// VFPortStateUnauthorized is a VF blocked on the reserved VLAN
+	VFPortStateUnauthorized VFPortState = "Unauthorized"
+	// VFPortStateAuthorized is a VF released after authentication
+	VFPortStateAuthorized VFPortState = "Authorized"
+	// VFPortStateGuest is a VF released on the guest VLAN
+	VFPortStateGuest VFPortState = "Guest"
+	// VFPortStateAuthFail is a VF released on the auth-fail VLAN
+	VFPortStateAuthFail VFPortState = "AuthFail"
+)
+
+// VFStatus represents the port state of an SR-IOV VF
+type VFStatus struct {
+	// VF is the VF index
+	VF int `json:"vf"`
+	// State is Unauthorized, Authorized, Guest or AuthFail
+	State VFPortState `json:"state"`
+	// Vlan is the VLAN the VF is released on, unless it is Unauthorized
+	// +optional
+	Vlan int `json:"vlan,omitempty"`
+}
+
+type AuthMethod string
+
+var (
+	// AuthMethodEAP is IEEE 802.1X authentication by a supplicant
+	AuthMethodEAP AuthMethod = "eap"
+	// AuthMethodMAB is MAC Authentication Bypass
+	AuthMethodMAB AuthMethod = "mab"
+)
+
+// ClientStatus represents an authenticated client and its session
+type ClientStatus struct {
+	// MAC is the client MAC address
+	MAC string `json:"mac"`
+	// AuthMethod is "eap" or "mab"
+	AuthMethod AuthMethod `json:"authMethod"`
+	// Identity is the EAP identity of the supplicant
+	// +optional
+	Identity string `json:"identity,omitempty"`
+	// EAPMethod is the EAP method negotiated with the authentication
+	// server, such as TLS or PEAP
+	// +optional
+	EAPMethod string `json:"eapMethod,omitempty"`
+	// AuthenticatedAt is when the client was authenticated
+	// +optional
+	AuthenticatedAt *metav1.Time `json:"authenticatedAt,omitempty"`
+	// LastReauthenticatedAt is when the supplicant last reauthenticated
+	// +optional
+	LastReauthenticatedAt *metav1.Time `json:"lastReauthenticatedAt,omitempty"`
+	// SessionTimeout is the number of seconds between reauthentications,
+	// from the RADIUS Session-Timeout or the configured reauth period
+	// +optional
+	SessionTimeout int `json:"sessionTimeout,omitempty"`
+	// PAEState is the state of the authenticator PAE state machine, such as
+	// Authenticated or Held
+	// +optional
+	PAEState string `json:"paeState,omitempty"`
+	// BackendState is the state of the backend authentication state
+	// machine, such as Idle or Request
+	// +optional
+	BackendState string `json:"backendState,omitempty"`
+	// AuthServer is the RADIUS authentication server (address:port) in use
+	// when the client was authenticated
+	// +optional
+	AuthServer string `json:"authServer,omitempty"`
+}
+
+// AssignedVlan represents the VLAN assigned to an authenticated client
+type AssignedVlan struct {
+	// MAC is the client MAC address
+	MAC string `json:"mac"`
+	// Vlan is the VLAN ID from the client's Tunnel-Private-Group-ID
+	Vlan int `json:"vlan"`
+}
+
+type MACsecStatus struct {
+	// KaYStatus is the MKA key agreement entity status, Active or Not-Active
+	// +optional
+	KaYStatus string `json:"kayStatus,omitempty"`
+	// Authenticated is true when MKA has authenticated the peer
+	Authenticated bool `json:"authenticated"`
+	// Secured is true when the MACsec secure channel is established
+	Secured bool `json:"secured"`
+	// Failed is true when MKA failed to establish a secure channel
+	Failed bool `json:"failed"`
+	// KeyServer is true when this authenticator is the MKA key server
+	KeyServer bool `json:"keyServer"`
 }
 
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+//+kubebuilder:printcolumn:name="Nodes Ready",type=integer,JSONPath=`.status.nodesReady`
+//+kubebuilder:printcolumn:name="Ports Authenticated",type=integer,JSONPath=`.status.portsAuthenticated`
+//+kubebuilder:printcolumn:name="Reason",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].reason`,priority=1
+//+kubebuilder:printcolumn:name="Config Hash",type=string,JSONPath=`.status.configHash`,priority=1
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 
 // Authenticator is the Schema for the authenticators API
 type Authenticator struct {
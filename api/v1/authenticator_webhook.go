@@ -0,0 +1,420 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+const (
+	// maxInterfaceNameLength is IFNAMSIZ less the terminating NUL
+	maxInterfaceNameLength = 15
+	maxPort                = 65535
+	// maxRadiusServers is the number of authentication or accounting
+	// servers the RadSec proxy has loopback ports for
+	maxRadiusServers = 10
+)
+
+// SetupWebhookWithManager registers the defaulting and validating webhooks
+// for Authenticators with the manager.
+func (r *Authenticator) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		WithValidator(&authenticatorValidator{Client: mgr.GetClient()}).
+		Complete()
+}
+
+//+kubebuilder:webhook:path=/mutate-eapol-eapol-openshift-io-v1-authenticator,mutating=true,failurePolicy=fail,sideEffects=None,groups=eapol.eapol.openshift.io,resources=authenticators,verbs=create;update,versions=v1,name=mauthenticator.kb.io,admissionReviewVersions=v1
+
+var _ webhook.Defaulter = &Authenticator{}
+
+// Default fills in the keys of referenced Secrets which were left unset.
+func (r *Authenticator) Default() {
+	if local := r.Spec.Authentication.Local; local != nil {
+		defaultSecretKey(local.UserFileSecret, DefaultUserFileKey)
+		defaultSecretKey(local.CaCertSecret, DefaultCaCertKey)
+		defaultSecretKey(local.ServerCertSecret, DefaultServerCertKey)
+		defaultSecretKey(local.PrivateKeySecret, DefaultPrivateKeyKey)
+		defaultSecretKey(local.RadiusClientSecret, DefaultRadiusClientKey)
+	}
+	if radius := r.Spec.Authentication.Radius; radius != nil {
+		if radius.AuthSecret != "" && radius.AuthSecretKey == "" {
+			radius.AuthSecretKey = DefaultRadiusSecretKey
+		}
+		for i := range radius.AuthServers {
+			defaultSecretKey(&radius.AuthServers[i].Secret, DefaultRadiusSecretKey)
+		}
+		if radius.Accounting != nil {
+			for i := range radius.Accounting.Servers {
+				defaultSecretKey(&radius.Accounting.Servers[i].Secret, DefaultRadiusSecretKey)
+			}
+		}
+		if radius.TLS != nil {
+			defaultSecretKey(&radius.TLS.ClientCertSecret, DefaultRadSecCertKey)
+			defaultSecretKey(&radius.TLS.ClientKeySecret, DefaultRadSecKeyKey)
+			defaultSecretKey(&radius.TLS.CaCertSecret, DefaultRadSecCaCertKey)
+		}
+	}
+	if r.Spec.MACsec != nil && r.Spec.MACsec.PreSharedKey != nil {
+		psk := r.Spec.MACsec.PreSharedKey
+		if psk.CakKey == "" {
+			psk.CakKey = DefaultMACsecCakKey
+		}
+		if psk.CknKey == "" {
+			psk.CknKey = DefaultMACsecCknKey
+		}
+	}
+}
+
+func defaultSecretKey(ref *SecretKeyRef, key string) {
+	if ref != nil && ref.Name != "" && ref.Key == "" {
+		ref.Key = key
+	}
+}
+
+//+kubebuilder:webhook:path=/validate-eapol-eapol-openshift-io-v1-authenticator,mutating=false,failurePolicy=fail,sideEffects=None,groups=eapol.eapol.openshift.io,resources=authenticators,verbs=create;update,versions=v1,name=vauthenticator.kb.io,admissionReviewVersions=v1
+
+// authenticatorValidator validates Authenticators, and looks up the other
+// Authenticators to reject interfaces claimed twice on the same node.
+// +kubebuilder:object:generate=false
+type authenticatorValidator struct {
+	Client client.Reader
+}
+
+var _ admission.CustomValidator = &authenticatorValidator{}
+
+// ValidateCreate implements admission.CustomValidator
+func (v *authenticatorValidator) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	return nil, v.validate(ctx, obj)
+}
+
+// ValidateUpdate implements admission.CustomValidator
+func (v *authenticatorValidator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	return nil, v.validate(ctx, newObj)
+}
+
+// ValidateDelete implements admission.CustomValidator
+func (v *authenticatorValidator) ValidateDelete(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+func (v *authenticatorValidator) validate(ctx context.Context, obj runtime.Object) error {
+	a11r, ok := obj.(*Authenticator)
+	if !ok {
+		return fmt.Errorf("expected an Authenticator but got a %T", obj)
+	}
+	errs := a11r.Spec.Validate(field.NewPath("spec"))
+	others := &AuthenticatorList{}
+	err := v.Client.List(ctx, others)
+	if err != nil {
+		return apierrors.NewInternalError(err)
+	}
+	errs = append(errs, a11r.validateInterfaceClaims(others.Items)...)
+	errs = append(errs, a11r.validateRadSecClaims(others.Items)...)
+	if len(errs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(GroupVersion.WithKind("Authenticator").GroupKind(), a11r.Name, errs)
+}
+
+// Validate checks the consistency of an AuthenticatorSpec that the schema
+// cannot express.
+func (s *AuthenticatorSpec) Validate(path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	if len(s.Interfaces) == 0 && len(s.InterfaceSelectors) == 0 {
+		errs = append(errs, field.Required(path.Child("interfaces"), "at least one interface or interface selector is required"))
+	}
+	errs = append(errs, validateInterfaces(s.Interfaces, path.Child("interfaces"))...)
+	for i, selector := range s.InterfaceSelectors {
+		errs = append(errs, selector.validate(path.Child("interfaceSelectors").Index(i))...)
+	}
+	errs = append(errs, s.validateInterfaceOverrides(path.Child("interfaceOverrides"))...)
+	errs = append(errs, s.Authentication.validate(path.Child("authentication"))...)
+	if s.TrafficControl != nil && s.TrafficControl.UnprotectedPorts != nil {
+		portsPath := path.Child("trafficControl", "unprotectedPorts")
+		for i, port := range s.TrafficControl.UnprotectedPorts.Tcp {
+			errs = append(errs, validatePort(port, portsPath.Child("tcp").Index(i))...)
+		}
+		for i, port := range s.TrafficControl.UnprotectedPorts.Udp {
+			errs = append(errs, validatePort(port, portsPath.Child("udp").Index(i))...)
+		}
+	}
+	return errs
+}
+
+func (a *Auth) validate(path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	switch {
+	case a.Local != nil && a.Radius != nil:
+		errs = append(errs, field.Forbidden(path.Child("radius"), "local and radius authentication are mutually exclusive"))
+	case a.Local == nil && a.Radius == nil:
+		errs = append(errs, field.Required(path, "one of local or radius authentication is required"))
+	}
+	if a.Local != nil {
+		localPath := path.Child("local")
+		if a.Local.AuthPort != 0 {
+			errs = append(errs, validatePort(a.Local.AuthPort, localPath.Child("authPort"))...)
+		} else if a.Local.RadiusClientSecret != nil {
+			errs = append(errs, field.Required(localPath.Child("authPort"), "the local RADIUS server needs a port to serve the clients of radiusClientFileSecret"))
+		}
+	}
+	if a.MAB != nil && len(a.MAB.MACs) == 0 && a.Radius == nil {
+		errs = append(errs, field.Required(path.Child("mab", "macs"), "MAB without RADIUS servers needs a list of MAC addresses"))
+	}
+	if a.Radius != nil {
+		radiusPath := path.Child("radius")
+		if a.Radius.AuthServer == "" && len(a.Radius.AuthServers) == 0 {
+			errs = append(errs, field.Required(radiusPath.Child("authServers"), "at least one RADIUS authentication server is required"))
+		}
+		servers := len(a.Radius.AuthServers)
+		if a.Radius.AuthServer != "" {
+			servers++
+		}
+		if servers > maxRadiusServers {
+			errs = append(errs, field.TooMany(radiusPath.Child("authServers"), servers, maxRadiusServers))
+		}
+		if a.Radius.AuthPort != 0 {
+			errs = append(errs, validatePort(a.Radius.AuthPort, radiusPath.Child("authPort"))...)
+		}
+		for i, server := range a.Radius.AuthServers {
+			errs = append(errs, server.validate(radiusPath.Child("authServers").Index(i))...)
+		}
+		if a.Radius.Accounting != nil {
+			for i, server := range a.Radius.Accounting.Servers {
+				errs = append(errs, server.validate(radiusPath.Child("accounting", "servers").Index(i))...)
+			}
+		}
+	}
+	return errs
+}
+
+func (s *RadiusServer) validate(path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	if s.Address == "" {
+		errs = append(errs, field.Required(path.Child("address"), ""))
+	}
+	if s.Port != 0 {
+		errs = append(errs, validatePort(s.Port, path.Child("port"))...)
+	}
+	return errs
+}
+
+func validatePort(port int, path *field.Path) field.ErrorList {
+	if port < 1 || port > maxPort {
+		return field.ErrorList{field.Invalid(path, port, fmt.Sprintf("must be between 1 and %d", maxPort))}
+	}
+	return nil
+}
+
+func validateInterfaces(interfaces []string, path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	seen := map[string]bool{}
+	for i, name := range interfaces {
+		if msg := interfaceNameError(name); msg != "" {
+			errs = append(errs, field.Invalid(path.Index(i), name, msg))
+		} else if seen[name] {
+			errs = append(errs, field.Duplicate(path.Index(i), name))
+		}
+		seen[name] = true
+	}
+	return errs
+}
+
+func (s *InterfaceSelector) validate(path *field.Path) field.ErrorList {
+	if *s == (InterfaceSelector{}) {
+		return field.ErrorList{field.Required(path, "an interface selector must set at least one field")}
+	}
+	var errs field.ErrorList
+	errs = append(errs, validatePattern(s.NamePattern, path.Child("namePattern"))...)
+	errs = append(errs, validatePattern(s.PciAddress, path.Child("pciAddress"))...)
+	return errs
+}
+
+func validatePattern(pattern string, path *field.Path) field.ErrorList {
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return field.ErrorList{field.Invalid(path, pattern, err.Error())}
+	}
+	return nil
+}
+
+// validateInterfaceOverrides checks that each interface is overridden once,
+// and is one of the interfaces unless selectors may resolve it.  The
+// interface also names the files of its configuration.  Only RADIUS servers
+// assign VLANs, so dynamicVlan cannot be overridden with local
+// authentication.
+func (s *AuthenticatorSpec) validateInterfaceOverrides(path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	seen := map[string]bool{}
+	for i, override := range s.InterfaceOverrides {
+		ifacePath := path.Index(i).Child("interface")
+		name := override.Interface
+		if msg := interfaceNameError(name); msg != "" {
+			errs = append(errs, field.Invalid(ifacePath, name, msg))
+		} else if msgs := validation.IsConfigMapKey(name); len(msgs) > 0 {
+			errs = append(errs, field.Invalid(ifacePath, name, strings.Join(msgs, ", ")))
+		} else if seen[name] {
+			errs = append(errs, field.Duplicate(ifacePath, name))
+		} else if len(s.InterfaceSelectors) == 0 && !containsString(s.Interfaces, name) {
+			errs = append(errs, field.NotFound(ifacePath, name))
+		}
+		seen[name] = true
+		if override.DynamicVlan != "" && s.Authentication.Radius == nil {
+			errs = append(errs, field.Forbidden(path.Index(i).Child("dynamicVlan"), "dynamic VLANs need radius authentication"))
+		}
+	}
+	return errs
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// interfaceNameError explains why the kernel would not accept name as a
+// network interface name, or returns "" if it would.
+func interfaceNameError(name string) string {
+	switch {
+	case name == "":
+		return "must not be empty"
+	case len(name) > maxInterfaceNameLength:
+		return fmt.Sprintf("must be no more than %d characters", maxInterfaceNameLength)
+	case name == "." || name == "..":
+		return "must not be . or .."
+	case strings.ContainsAny(name, "/:"):
+		return "must not contain / or :"
+	case strings.IndexFunc(name, unicode.IsSpace) >= 0:
+		return "must not contain whitespace"
+	}
+	return ""
+}
+
+// validateInterfaceClaims rejects interfaces which are already protected by
+// another enabled Authenticator that may run on the same nodes.  Interfaces
+// named twice, identical selectors, and name patterns matching an interface
+// the other Authenticator names are rejected.  Whether other selectors
+// overlap depends on the hardware of the nodes, so it is not checked.
+func (r *Authenticator) validateInterfaceClaims(others []Authenticator) field.ErrorList {
+	if !r.Spec.Enabled {
+		return nil
+	}
+	var errs field.ErrorList
+	path := field.NewPath("spec", "interfaces")
+	selectorsPath := field.NewPath("spec", "interfaceSelectors")
+	for _, other := range others {
+		if other.Namespace == r.Namespace && other.Name == r.Name {
+			continue
+		}
+		if !other.Spec.Enabled || !nodeSelectorsOverlap(r.Spec.NodeSelector, other.Spec.NodeSelector) {
+			continue
+		}
+		claimed := func(path *field.Path, what string) {
+			errs = append(errs, field.Forbidden(path,
+				fmt.Sprintf("%s is already protected by Authenticator %s/%s on nodes matching both node selectors",
+					what, other.Namespace, other.Name)))
+		}
+		for i, name := range r.Spec.Interfaces {
+			if containsString(other.Spec.Interfaces, name) || selectsName(other.Spec.InterfaceSelectors, name) {
+				claimed(path.Index(i), "interface "+name)
+			}
+		}
+		for i, selector := range r.Spec.InterfaceSelectors {
+			for _, otherSelector := range other.Spec.InterfaceSelectors {
+				if selector == otherSelector {
+					claimed(selectorsPath.Index(i), "the interfaces this selector matches")
+					break
+				}
+			}
+			for _, otherName := range other.Spec.Interfaces {
+				if selectsName([]InterfaceSelector{selector}, otherName) {
+					claimed(selectorsPath.Index(i), "interface "+otherName)
+					break
+				}
+			}
+		}
+	}
+	return errs
+}
+
+// validateRadSecClaims rejects RadSec when another enabled Authenticator
+// using RadSec may run on the same nodes, as their proxies would listen on
+// the same loopback ports.
+func (r *Authenticator) validateRadSecClaims(others []Authenticator) field.ErrorList {
+	if !r.Spec.Enabled || !r.Spec.Authentication.Radius.usesRadSec() {
+		return nil
+	}
+	var errs field.ErrorList
+	for _, other := range others {
+		if other.Namespace == r.Namespace && other.Name == r.Name {
+			continue
+		}
+		if !other.Spec.Enabled || !other.Spec.Authentication.Radius.usesRadSec() ||
+			!nodeSelectorsOverlap(r.Spec.NodeSelector, other.Spec.NodeSelector) {
+			continue
+		}
+		errs = append(errs, field.Forbidden(field.NewPath("spec", "authentication", "radius", "transport"),
+			fmt.Sprintf("Authenticator %s/%s already uses RadSec on nodes matching both node selectors",
+				other.Namespace, other.Name)))
+	}
+	return errs
+}
+
+// usesRadSec returns whether the RADIUS servers are reached through the
+// RadSec proxy.
+func (r *Radius) usesRadSec() bool {
+	return r != nil && r.Transport == RadiusTransportTLS
+}
+
+// selectsName returns whether a selector which only has a name pattern
+// matches an interface name.
+func selectsName(selectors []InterfaceSelector, name string) bool {
+	for _, selector := range selectors {
+		if selector == (InterfaceSelector{NamePattern: selector.NamePattern}) {
+			if matched, err := filepath.Match(selector.NamePattern, name); err == nil && matched {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// nodeSelectorsOverlap returns whether a node could match both selectors,
+// which is the case unless they require different values for the same label.
+func nodeSelectorsOverlap(a, b map[string]string) bool {
+	for key, value := range a {
+		if otherValue, ok := b[key]; ok && otherValue != value {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,191 @@
+package v1
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+func newTestA11r(name string) *Authenticator {
+	return &Authenticator{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "default",
+		},
+		Spec: AuthenticatorSpec{
+			Enabled:    true,
+			Interfaces: []string{"eth0"},
+			Authentication: Auth{
+				Radius: &Radius{
+					AuthServers: []RadiusServer{{
+						Address: "192.0.2.10",
+						Secret:  SecretKeyRef{Name: "radius"},
+					}},
+				},
+			},
+		},
+	}
+}
+
+func errorFields(errs field.ErrorList) []string {
+	fields := []string{}
+	for _, err := range errs {
+		fields = append(fields, err.Field)
+	}
+	return fields
+}
+
+var _ = Describe("Authenticator defaulting", func() {
+	It("should fill in the default secret keys", func() {
+		a11r := newTestA11r("auth")
+		a11r.Spec.Authentication.Radius.Accounting = &RadiusAccounting{
+			Servers: []RadiusServer{{Address: "192.0.2.11", Secret: SecretKeyRef{Name: "acct", Key: "shared"}}},
+		}
+		a11r.Spec.MACsec = &MACsec{PreSharedKey: &MACsecPreSharedKey{SecretName: "mka"}}
+		a11r.Default()
+		Expect(a11r.Spec.Authentication.Radius.AuthServers[0].Secret.Key).To(Equal("secret"))
+		Expect(a11r.Spec.Authentication.Radius.Accounting.Servers[0].Secret.Key).To(Equal("shared"))
+		Expect(a11r.Spec.MACsec.PreSharedKey.CakKey).To(Equal("cak"))
+		Expect(a11r.Spec.MACsec.PreSharedKey.CknKey).To(Equal("ckn"))
+	})
+	It("should fill in the default local secret keys", func() {
+		a11r := newTestA11r("auth")
+		a11r.Spec.Authentication = Auth{Local: &Local{
+			UserFileSecret: &SecretKeyRef{Name: "users"},
+			CaCertSecret:   &SecretKeyRef{Name: "certs"},
+		}}
+		a11r.Default()
+		Expect(a11r.Spec.Authentication.Local.UserFileSecret.Key).To(Equal("hostapd.eap_user"))
+		Expect(a11r.Spec.Authentication.Local.CaCertSecret.Key).To(Equal("1x-ca.pem"))
+		Expect(a11r.Spec.Authentication.Local.ServerCertSecret).To(BeNil())
+	})
+})
+
+var _ = Describe("Authenticator validation", func() {
+	var a11r *Authenticator
+	BeforeEach(func() {
+		a11r = newTestA11r("auth")
+	})
+	validate := func() []string {
+		return errorFields(a11r.Spec.Validate(field.NewPath("spec")))
+	}
+
+	It("should accept a valid spec", func() {
+		Expect(validate()).To(BeEmpty())
+	})
+	It("should require exactly one of local and RADIUS authentication", func() {
+		a11r.Spec.Authentication.Local = &Local{AuthPort: 1812}
+		Expect(validate()).To(ConsistOf("spec.authentication.radius"))
+		a11r.Spec.Authentication = Auth{}
+		Expect(validate()).To(ConsistOf("spec.authentication"))
+	})
+	It("should reject ports out of range", func() {
+		a11r.Spec.Authentication.Radius.AuthServers[0].Port = 65536
+		a11r.Spec.TrafficControl = &TrafficControl{UnprotectedPorts: &Ports{Tcp: []int{22}, Udp: []int{0}}}
+		Expect(validate()).To(ConsistOf(
+			"spec.authentication.radius.authServers[0].port",
+			"spec.trafficControl.unprotectedPorts.udp[0]"))
+	})
+	It("should require interfaces with valid names", func() {
+		a11r.Spec.Interfaces = nil
+		Expect(validate()).To(ConsistOf("spec.interfaces"))
+		a11r.Spec.Interfaces = []string{"ens3f0", "a-very-long-name0", "eth/0", "ens3f0", "eth 0"}
+		Expect(validate()).To(ConsistOf(
+			"spec.interfaces[1]", "spec.interfaces[2]", "spec.interfaces[3]", "spec.interfaces[4]"))
+	})
+	It("should accept interface selectors instead of interfaces", func() {
+		a11r.Spec.Interfaces = nil
+		a11r.Spec.InterfaceSelectors = []InterfaceSelector{{Vendor: "8086", Driver: "i40e"}}
+		Expect(validate()).To(BeEmpty())
+		a11r.Spec.InterfaceSelectors = append(a11r.Spec.InterfaceSelectors,
+			InterfaceSelector{}, InterfaceSelector{NamePattern: "ens[3f0"}, InterfaceSelector{PciAddress: "0000:3b:00.*"})
+		Expect(validate()).To(ConsistOf("spec.interfaceSelectors[1]", "spec.interfaceSelectors[2].namePattern"))
+	})
+	It("should only override interfaces of the authenticator once", func() {
+		a11r.Spec.InterfaceOverrides = []InterfaceOverride{{Interface: "eth0"}}
+		Expect(validate()).To(BeEmpty())
+		a11r.Spec.InterfaceOverrides = append(a11r.Spec.InterfaceOverrides,
+			InterfaceOverride{Interface: "eth0"}, InterfaceOverride{Interface: "eth1"}, InterfaceOverride{Interface: "eth@1"})
+		Expect(validate()).To(ConsistOf("spec.interfaceOverrides[1].interface",
+			"spec.interfaceOverrides[2].interface", "spec.interfaceOverrides[3].interface"))
+		a11r.Spec.InterfaceSelectors = []InterfaceSelector{{Driver: "i40e"}}
+		Expect(validate()).To(ConsistOf("spec.interfaceOverrides[1].interface", "spec.interfaceOverrides[3].interface"))
+	})
+	It("should only override the dynamic VLAN mode with RADIUS authentication", func() {
+		a11r.Spec.InterfaceOverrides = []InterfaceOverride{{Interface: "eth0", DynamicVlan: DynamicVlanRequired}}
+		Expect(validate()).To(BeEmpty())
+		a11r.Spec.Authentication = Auth{Local: &Local{}}
+		Expect(validate()).To(ConsistOf("spec.interfaceOverrides[0].dynamicVlan"))
+	})
+	It("should require an auth port for the local RADIUS server clients", func() {
+		a11r.Spec.Authentication = Auth{Local: &Local{RadiusClientSecret: &SecretKeyRef{Name: "clients"}}}
+		Expect(validate()).To(ConsistOf("spec.authentication.local.authPort"))
+		a11r.Spec.Authentication.Local.AuthPort = 1812
+		Expect(validate()).To(BeEmpty())
+	})
+
+	It("should limit the RADIUS servers to the RadSec proxy ports", func() {
+		for len(a11r.Spec.Authentication.Radius.AuthServers) < 10 {
+			a11r.Spec.Authentication.Radius.AuthServers = append(a11r.Spec.Authentication.Radius.AuthServers,
+				RadiusServer{Address: "192.0.2.11", Secret: SecretKeyRef{Name: "radius"}})
+		}
+		Expect(validate()).To(BeEmpty())
+		a11r.Spec.Authentication.Radius.AuthServer = "192.0.2.12"
+		Expect(validate()).To(ConsistOf("spec.authentication.radius.authServers"))
+	})
+	It("should require MAC addresses for MAB without RADIUS servers", func() {
+		a11r.Spec.Authentication.MAB = &MAB{}
+		Expect(validate()).To(BeEmpty())
+		a11r.Spec.Authentication = Auth{Local: &Local{}, MAB: &MAB{}}
+		Expect(validate()).To(ConsistOf("spec.authentication.mab.macs"))
+		a11r.Spec.Authentication.MAB.MACs = []string{"6e:16:06:0e:b7:e2"}
+		Expect(validate()).To(BeEmpty())
+	})
+
+	Context("with another authenticator", func() {
+		var other *Authenticator
+		BeforeEach(func() {
+			other = newTestA11r("other")
+			other.Spec.Interfaces = []string{"eth1", "eth0"}
+		})
+		claims := func() []string {
+			return errorFields(a11r.validateInterfaceClaims([]Authenticator{*a11r, *other}))
+		}
+
+		It("should reject an interface claimed on overlapping nodes", func() {
+			a11r.Spec.NodeSelector = map[string]string{"rack": "a"}
+			Expect(claims()).To(ConsistOf("spec.interfaces[0]"))
+		})
+		It("should accept an interface claimed on disjoint nodes", func() {
+			a11r.Spec.NodeSelector = map[string]string{"rack": "a"}
+			other.Spec.NodeSelector = map[string]string{"rack": "b"}
+			Expect(claims()).To(BeEmpty())
+		})
+		It("should reject interfaces both authenticators select", func() {
+			a11r.Spec.Interfaces = []string{"ens3f0"}
+			a11r.Spec.InterfaceSelectors = []InterfaceSelector{{NamePattern: "eth*"}, {Driver: "i40e"}, {Driver: "ice"}}
+			other.Spec.InterfaceSelectors = []InterfaceSelector{{NamePattern: "ens3*"}, {Driver: "i40e"}}
+			Expect(claims()).To(ConsistOf("spec.interfaces[0]",
+				"spec.interfaceSelectors[0]", "spec.interfaceSelectors[1]"))
+		})
+		It("should accept an interface claimed by a disabled authenticator", func() {
+			other.Spec.Enabled = false
+			Expect(claims()).To(BeEmpty())
+		})
+		It("should reject RadSec used by both authenticators on overlapping nodes", func() {
+			other.Spec.Interfaces = []string{"eth1"}
+			radsecClaims := func() []string {
+				return errorFields(a11r.validateRadSecClaims([]Authenticator{*a11r, *other}))
+			}
+			a11r.Spec.Authentication.Radius.Transport = RadiusTransportTLS
+			Expect(radsecClaims()).To(BeEmpty())
+			other.Spec.Authentication.Radius.Transport = RadiusTransportTLS
+			Expect(radsecClaims()).To(ConsistOf("spec.authentication.radius.transport"))
+			a11r.Spec.NodeSelector = map[string]string{"rack": "a"}
+			other.Spec.NodeSelector = map[string]string{"rack": "b"}
+			Expect(radsecClaims()).To(BeEmpty())
+		})
+	})
+})
@@ -0,0 +1,73 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// AuthenticatorNodeStateSpec identifies the node an AuthenticatorNodeState
+// reports on
+type AuthenticatorNodeStateSpec struct {
+	// Node is the name of the node
+	Node string `json:"node"`
+}
+
+// AuthenticatorNodeStateStatus defines the observed state of an
+// Authenticator on one node
+type AuthenticatorNodeStateStatus struct {
+	// ResolvedInterfaces are the names of the interfaces protected on the
+	// node, resolved from the interfaces and interface selectors
+	// +optional
+	ResolvedInterfaces []string `json:"resolvedInterfaces,omitempty"`
+
+	// Interfaces is the list of interface status on the node
+	// +optional
+	Interfaces []*Interface `json:"interfaces,omitempty"`
+
+	// RadSec is the list of RadSec server connection status of the node,
+	// when the RADIUS transport is "tls"
+	// +optional
+	RadSec []*RadSecServer `json:"radSec,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+
+// AuthenticatorNodeState is the state of an Authenticator on one node.  It is
+// owned by the Authenticator, written only by the authenticator pod on that
+// node, and aggregated into the Authenticator status by the operator.
+type AuthenticatorNodeState struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   AuthenticatorNodeStateSpec   `json:"spec,omitempty"`
+	Status AuthenticatorNodeStateStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// AuthenticatorNodeStateList contains a list of AuthenticatorNodeState
+type AuthenticatorNodeStateList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []AuthenticatorNodeState `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&AuthenticatorNodeState{}, &AuthenticatorNodeStateList{})
+}
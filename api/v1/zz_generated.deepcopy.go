@@ -22,9 +22,25 @@ limitations under the License.
 package v1
 
 import (
-	runtime "k8s.io/apimachinery/pkg/runtime"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AssignedVlan) DeepCopyInto(out *AssignedVlan) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AssignedVlan.
+func (in *AssignedVlan) DeepCopy() *AssignedVlan {
+	if in == nil {
+		return nil
+	}
+	out := new(AssignedVlan)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Auth) DeepCopyInto(out *Auth) {
 	*out = *in
@@ -36,7 +52,12 @@ func (in *Auth) DeepCopyInto(out *Auth) {
 	if in.Radius != nil {
 		in, out := &in.Radius, &out.Radius
 		*out = new(Radius)
-		**out = **in
+		(*in).DeepCopyInto(*out)
+	}
+	if in.MAB != nil {
+		in, out := &in.MAB, &out.MAB
+		*out = new(MAB)
+		(*in).DeepCopyInto(*out)
 	}
 }
 
@@ -109,6 +130,122 @@ func (in *AuthenticatorList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AuthenticatorNodeState) DeepCopyInto(out *AuthenticatorNodeState) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	out.Spec = in.Spec
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AuthenticatorNodeState.
+func (in *AuthenticatorNodeState) DeepCopy() *AuthenticatorNodeState {
+	if in == nil {
+		return nil
+	}
+	out := new(AuthenticatorNodeState)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *AuthenticatorNodeState) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AuthenticatorNodeStateList) DeepCopyInto(out *AuthenticatorNodeStateList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]AuthenticatorNodeState, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AuthenticatorNodeStateList.
+func (in *AuthenticatorNodeStateList) DeepCopy() *AuthenticatorNodeStateList {
+	if in == nil {
+		return nil
+	}
+	out := new(AuthenticatorNodeStateList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *AuthenticatorNodeStateList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AuthenticatorNodeStateSpec) DeepCopyInto(out *AuthenticatorNodeStateSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AuthenticatorNodeStateSpec.
+func (in *AuthenticatorNodeStateSpec) DeepCopy() *AuthenticatorNodeStateSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(AuthenticatorNodeStateSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AuthenticatorNodeStateStatus) DeepCopyInto(out *AuthenticatorNodeStateStatus) {
+	*out = *in
+	if in.ResolvedInterfaces != nil {
+		in, out := &in.ResolvedInterfaces, &out.ResolvedInterfaces
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Interfaces != nil {
+		in, out := &in.Interfaces, &out.Interfaces
+		*out = make([]*Interface, len(*in))
+		for i := range *in {
+			if (*in)[i] != nil {
+				in, out := &(*in)[i], &(*out)[i]
+				*out = new(Interface)
+				(*in).DeepCopyInto(*out)
+			}
+		}
+	}
+	if in.RadSec != nil {
+		in, out := &in.RadSec, &out.RadSec
+		*out = make([]*RadSecServer, len(*in))
+		for i := range *in {
+			if (*in)[i] != nil {
+				in, out := &(*in)[i], &(*out)[i]
+				*out = new(RadSecServer)
+				**out = **in
+			}
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AuthenticatorNodeStateStatus.
+func (in *AuthenticatorNodeStateStatus) DeepCopy() *AuthenticatorNodeStateStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(AuthenticatorNodeStateStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *AuthenticatorSpec) DeepCopyInto(out *AuthenticatorSpec) {
 	*out = *in
@@ -117,6 +254,18 @@ func (in *AuthenticatorSpec) DeepCopyInto(out *AuthenticatorSpec) {
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.InterfaceSelectors != nil {
+		in, out := &in.InterfaceSelectors, &out.InterfaceSelectors
+		*out = make([]InterfaceSelector, len(*in))
+		copy(*out, *in)
+	}
+	if in.InterfaceOverrides != nil {
+		in, out := &in.InterfaceOverrides, &out.InterfaceOverrides
+		*out = make([]InterfaceOverride, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 	in.Authentication.DeepCopyInto(&out.Authentication)
 	if in.Configuration != nil {
 		in, out := &in.Configuration, &out.Configuration
@@ -135,6 +284,11 @@ func (in *AuthenticatorSpec) DeepCopyInto(out *AuthenticatorSpec) {
 		*out = new(TrafficControl)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.MACsec != nil {
+		in, out := &in.MACsec, &out.MACsec
+		*out = new(MACsec)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AuthenticatorSpec.
@@ -161,6 +315,24 @@ func (in *AuthenticatorStatus) DeepCopyInto(out *AuthenticatorStatus) {
 			}
 		}
 	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.RadSec != nil {
+		in, out := &in.RadSec, &out.RadSec
+		*out = make([]*RadSecServer, len(*in))
+		for i := range *in {
+			if (*in)[i] != nil {
+				in, out := &(*in)[i], &(*out)[i]
+				*out = new(RadSecServer)
+				**out = **in
+			}
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AuthenticatorStatus.
@@ -173,6 +345,29 @@ func (in *AuthenticatorStatus) DeepCopy() *AuthenticatorStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClientStatus) DeepCopyInto(out *ClientStatus) {
+	*out = *in
+	if in.AuthenticatedAt != nil {
+		in, out := &in.AuthenticatedAt, &out.AuthenticatedAt
+		*out = (*in).DeepCopy()
+	}
+	if in.LastReauthenticatedAt != nil {
+		in, out := &in.LastReauthenticatedAt, &out.LastReauthenticatedAt
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClientStatus.
+func (in *ClientStatus) DeepCopy() *ClientStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ClientStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Config) DeepCopyInto(out *Config) {
 	*out = *in
@@ -196,6 +391,38 @@ func (in *Interface) DeepCopyInto(out *Interface) {
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.Clients != nil {
+		in, out := &in.Clients, &out.Clients
+		*out = make([]ClientStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.MACsec != nil {
+		in, out := &in.MACsec, &out.MACsec
+		*out = new(MACsecStatus)
+		**out = **in
+	}
+	if in.AssignedVlans != nil {
+		in, out := &in.AssignedVlans, &out.AssignedVlans
+		*out = make([]AssignedVlan, len(*in))
+		copy(*out, *in)
+	}
+	if in.VFs != nil {
+		in, out := &in.VFs, &out.VFs
+		*out = make([]VFStatus, len(*in))
+		copy(*out, *in)
+	}
+	if in.AllowedMacs != nil {
+		in, out := &in.AllowedMacs, &out.AllowedMacs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.DeniedMacs != nil {
+		in, out := &in.DeniedMacs, &out.DeniedMacs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Interface.
@@ -208,6 +435,61 @@ func (in *Interface) DeepCopy() *Interface {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *InterfaceOverride) DeepCopyInto(out *InterfaceOverride) {
+	*out = *in
+	if in.EapReauthPeriod != nil {
+		in, out := &in.EapReauthPeriod, &out.EapReauthPeriod
+		*out = new(int)
+		**out = **in
+	}
+	if in.UnprotectedPorts != nil {
+		in, out := &in.UnprotectedPorts, &out.UnprotectedPorts
+		*out = new(Ports)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.GuestVlan != nil {
+		in, out := &in.GuestVlan, &out.GuestVlan
+		*out = new(int)
+		**out = **in
+	}
+	if in.GuestVlanTimeout != nil {
+		in, out := &in.GuestVlanTimeout, &out.GuestVlanTimeout
+		*out = new(int)
+		**out = **in
+	}
+	if in.AuthFailVlan != nil {
+		in, out := &in.AuthFailVlan, &out.AuthFailVlan
+		*out = new(int)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new InterfaceOverride.
+func (in *InterfaceOverride) DeepCopy() *InterfaceOverride {
+	if in == nil {
+		return nil
+	}
+	out := new(InterfaceOverride)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *InterfaceSelector) DeepCopyInto(out *InterfaceSelector) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new InterfaceSelector.
+func (in *InterfaceSelector) DeepCopy() *InterfaceSelector {
+	if in == nil {
+		return nil
+	}
+	out := new(InterfaceSelector)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Local) DeepCopyInto(out *Local) {
 	*out = *in
@@ -248,6 +530,96 @@ func (in *Local) DeepCopy() *Local {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MAB) DeepCopyInto(out *MAB) {
+	*out = *in
+	if in.MACs != nil {
+		in, out := &in.MACs, &out.MACs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MAB.
+func (in *MAB) DeepCopy() *MAB {
+	if in == nil {
+		return nil
+	}
+	out := new(MAB)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MACsec) DeepCopyInto(out *MACsec) {
+	*out = *in
+	if in.Priority != nil {
+		in, out := &in.Priority, &out.Priority
+		*out = new(int)
+		**out = **in
+	}
+	if in.PreSharedKey != nil {
+		in, out := &in.PreSharedKey, &out.PreSharedKey
+		*out = new(MACsecPreSharedKey)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MACsec.
+func (in *MACsec) DeepCopy() *MACsec {
+	if in == nil {
+		return nil
+	}
+	out := new(MACsec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MACsecPreSharedKey) DeepCopyInto(out *MACsecPreSharedKey) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MACsecPreSharedKey.
+func (in *MACsecPreSharedKey) DeepCopy() *MACsecPreSharedKey {
+	if in == nil {
+		return nil
+	}
+	out := new(MACsecPreSharedKey)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MACsecStatus) DeepCopyInto(out *MACsecStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MACsecStatus.
+func (in *MACsecStatus) DeepCopy() *MACsecStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(MACsecStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PortRange) DeepCopyInto(out *PortRange) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PortRange.
+func (in *PortRange) DeepCopy() *PortRange {
+	if in == nil {
+		return nil
+	}
+	out := new(PortRange)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Ports) DeepCopyInto(out *Ports) {
 	*out = *in
@@ -273,9 +645,39 @@ func (in *Ports) DeepCopy() *Ports {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RadSecServer) DeepCopyInto(out *RadSecServer) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RadSecServer.
+func (in *RadSecServer) DeepCopy() *RadSecServer {
+	if in == nil {
+		return nil
+	}
+	out := new(RadSecServer)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Radius) DeepCopyInto(out *Radius) {
 	*out = *in
+	if in.AuthServers != nil {
+		in, out := &in.AuthServers, &out.AuthServers
+		*out = make([]RadiusServer, len(*in))
+		copy(*out, *in)
+	}
+	if in.Accounting != nil {
+		in, out := &in.Accounting, &out.Accounting
+		*out = new(RadiusAccounting)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.TLS != nil {
+		in, out := &in.TLS, &out.TLS
+		*out = new(RadiusTLS)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Radius.
@@ -288,6 +690,60 @@ func (in *Radius) DeepCopy() *Radius {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RadiusAccounting) DeepCopyInto(out *RadiusAccounting) {
+	*out = *in
+	if in.Servers != nil {
+		in, out := &in.Servers, &out.Servers
+		*out = make([]RadiusServer, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RadiusAccounting.
+func (in *RadiusAccounting) DeepCopy() *RadiusAccounting {
+	if in == nil {
+		return nil
+	}
+	out := new(RadiusAccounting)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RadiusServer) DeepCopyInto(out *RadiusServer) {
+	*out = *in
+	out.Secret = in.Secret
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RadiusServer.
+func (in *RadiusServer) DeepCopy() *RadiusServer {
+	if in == nil {
+		return nil
+	}
+	out := new(RadiusServer)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RadiusTLS) DeepCopyInto(out *RadiusTLS) {
+	*out = *in
+	out.ClientCertSecret = in.ClientCertSecret
+	out.ClientKeySecret = in.ClientKeySecret
+	out.CaCertSecret = in.CaCertSecret
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RadiusTLS.
+func (in *RadiusTLS) DeepCopy() *RadiusTLS {
+	if in == nil {
+		return nil
+	}
+	out := new(RadiusTLS)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *SecretKeyRef) DeepCopyInto(out *SecretKeyRef) {
 	*out = *in
@@ -311,6 +767,37 @@ func (in *TrafficControl) DeepCopyInto(out *TrafficControl) {
 		*out = new(Ports)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.Exceptions != nil {
+		in, out := &in.Exceptions, &out.Exceptions
+		*out = make([]TrafficException, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.EgressExceptions != nil {
+		in, out := &in.EgressExceptions, &out.EgressExceptions
+		*out = make([]TrafficException, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.VFSupplicants != nil {
+		in, out := &in.VFSupplicants, &out.VFSupplicants
+		*out = make([]VFSupplicants, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.AllowedMacs != nil {
+		in, out := &in.AllowedMacs, &out.AllowedMacs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.DeniedMacs != nil {
+		in, out := &in.DeniedMacs, &out.DeniedMacs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TrafficControl.
@@ -322,3 +809,73 @@ func (in *TrafficControl) DeepCopy() *TrafficControl {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TrafficException) DeepCopyInto(out *TrafficException) {
+	*out = *in
+	if in.Ports != nil {
+		in, out := &in.Ports, &out.Ports
+		*out = make([]PortRange, len(*in))
+		copy(*out, *in)
+	}
+	if in.ICMPTypes != nil {
+		in, out := &in.ICMPTypes, &out.ICMPTypes
+		*out = make([]int, len(*in))
+		copy(*out, *in)
+	}
+	if in.SourceCIDRs != nil {
+		in, out := &in.SourceCIDRs, &out.SourceCIDRs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.DestinationCIDRs != nil {
+		in, out := &in.DestinationCIDRs, &out.DestinationCIDRs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TrafficException.
+func (in *TrafficException) DeepCopy() *TrafficException {
+	if in == nil {
+		return nil
+	}
+	out := new(TrafficException)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VFStatus) DeepCopyInto(out *VFStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VFStatus.
+func (in *VFStatus) DeepCopy() *VFStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(VFStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VFSupplicants) DeepCopyInto(out *VFSupplicants) {
+	*out = *in
+	if in.MACs != nil {
+		in, out := &in.MACs, &out.MACs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VFSupplicants.
+func (in *VFSupplicants) DeepCopy() *VFSupplicants {
+	if in == nil {
+		return nil
+	}
+	out := new(VFSupplicants)
+	in.DeepCopyInto(out)
+	return out
+}
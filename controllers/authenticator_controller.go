@@ -21,18 +21,29 @@ import (
 	_ "embed"
 	"fmt"
 	"reflect"
+	"sort"
+	"strings"
 
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	"github.com/go-test/deep"
 	eapolv1 "github.com/openshift-kni/eapol-operator/api/v1"
+	"github.com/openshift-kni/eapol-operator/internal/k8s"
 	"github.com/openshift-kni/eapol-operator/pkg/configgen"
 )
 
@@ -40,19 +51,29 @@ const authenticatorRbacPathController = "./bindata/deployment/authenticator-rbac
 
 var AuthenticatorRbacPath = authenticatorRbacPathController
 
+// reasonConfigRenderFailed is the reason of the Degraded condition of an
+// Authenticator whose configuration cannot be rendered.
+const reasonConfigRenderFailed = "ConfigRenderFailed"
+
 // AuthenticatorReconciler reconciles a Authenticator object
 type AuthenticatorReconciler struct {
 	client.Client
 	rbacResources *resources
 	Scheme        *runtime.Scheme
+	Recorder      record.EventRecorder
 }
 
 //+kubebuilder:rbac:groups=eapol.eapol.openshift.io,resources=authenticators,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=eapol.eapol.openshift.io,resources=authenticators/status,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=eapol.eapol.openshift.io,resources=authenticators/finalizers,verbs=update
+//+kubebuilder:rbac:groups=eapol.eapol.openshift.io,resources=authenticatornodestates,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=eapol.eapol.openshift.io,resources=authenticatornodestates/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=apps,resources=daemonsets,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups="",resources=configmaps,verbs=create;delete;get;update;patch;list;watch
 //+kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+//+kubebuilder:rbac:groups="",resources=nodes,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=pods,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch
 //+kubebuilder:rbac:groups=core,resources=serviceaccounts,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=rbac.authorization.k8s.io,resources=roles,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=rbac.authorization.k8s.io,resources=rolebindings,verbs=get;list;watch;create;update;patch;delete
@@ -82,10 +103,42 @@ func (r *AuthenticatorReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 
 	cfggen := configgen.New(a11r, r.rbacResources.serviceAccount.Name)
 
+	// Refuse to roll out pods that could never start because a
+	// referenced secret is missing
+	err = r.checkSecretRefs(ctx, a11r.Namespace, cfggen.SecretRefs())
+	if err != nil {
+		log.Error(err, "Failed to resolve referenced secret")
+		r.Recorder.Event(a11r, corev1.EventTypeWarning, "SecretNotFound", err.Error())
+		r.setFailedStatus(ctx, a11r, metav1.Condition{
+			Type:    eapolv1.ConditionSecretsResolved,
+			Status:  metav1.ConditionFalse,
+			Reason:  "SecretNotFound",
+			Message: err.Error(),
+		})
+		return ctrl.Result{}, err
+	}
+
+	// Stamp the contents of the secrets only read at startup on the pod
+	// template, so that rotating them rolls out pods which read the new
+	// contents.  The others are reloaded in place.
+	secretsHash, err := r.hashSecretRefs(ctx, a11r.Namespace, cfggen.StartupSecretRefs())
+	if err != nil {
+		log.Error(err, "Failed to hash referenced secrets")
+		return ctrl.Result{}, err
+	}
+	cfggen.SetSecretsHash(secretsHash)
+
 	// Check if the configmap already exists
 	newCm, err := cfggen.ConfigMap()
 	if err != nil {
-		return ctrl.Result{}, fmt.Errorf("failed to generate ConfigMap content: %e", err)
+		err = fmt.Errorf("failed to generate ConfigMap content: %w", err)
+		r.setFailedStatus(ctx, a11r, metav1.Condition{
+			Type:    eapolv1.ConditionDegraded,
+			Status:  metav1.ConditionTrue,
+			Reason:  reasonConfigRenderFailed,
+			Message: err.Error(),
+		})
+		return ctrl.Result{}, err
 	}
 
 	cm := &corev1.ConfigMap{}
@@ -106,13 +159,14 @@ func (r *AuthenticatorReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 		if !reflect.DeepEqual(cm.Data, newCm.Data) {
 			cm.Data = newCm.Data
 			log.Info("Updating ConfigMap")
-			err = r.Update(ctx, newCm)
+			err = r.Update(ctx, cm)
 			if err != nil {
 				log.Error(err, "Failed to update ConfigMap")
 				return ctrl.Result{}, err
 			}
-			// TODO: Signal the DS to restart and/or reload its config?
-			// or does the pod watch for changes and just do it?
+			// The pods are not restarted: the monitor of each pod notices
+			// the kubelet updating the projected config and has hostapd
+			// reload it in place, keeping the sessions it can.
 		}
 	}
 
@@ -134,6 +188,7 @@ func (r *AuthenticatorReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 			log.Error(err, "Failed to create new Daemonset")
 			return ctrl.Result{}, err
 		}
+		ds = newDs
 	} else if err != nil {
 		log.Error(err, "Failed to get Daemonset")
 		return ctrl.Result{}, err
@@ -152,9 +207,296 @@ func (r *AuthenticatorReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 		}
 	}
 
+	err = r.syncStatus(ctx, a11r, ds, configgen.ConfigHash(newCm))
+	if err != nil {
+		log.Error(err, "Failed to update Authenticator status")
+		return ctrl.Result{}, err
+	}
+
 	return ctrl.Result{}, nil
 }
 
+// syncStatus aggregates the node states and the DaemonSet rollout into the
+// Authenticator status.  Changes to the DaemonSet's pods are seen through its
+// status, which is watched as an owned object.
+func (r *AuthenticatorReconciler) syncStatus(ctx context.Context, a11r *eapolv1.Authenticator, ds *appsv1.DaemonSet, configHash string) error {
+	status := a11r.Status.DeepCopy()
+	status.ObservedGeneration = a11r.Generation
+	status.ConfigHash = configHash
+	setCondition(status, a11r.Generation, metav1.Condition{
+		Type:    eapolv1.ConditionSecretsResolved,
+		Status:  metav1.ConditionTrue,
+		Reason:  "SecretsFound",
+		Message: "all referenced secrets hold the expected keys",
+	})
+	err := r.syncNodeStates(ctx, a11r, ds, status)
+	if err != nil {
+		return err
+	}
+	rolloutConditions(status, a11r.Generation, ds)
+	return r.updateStatus(ctx, a11r, status)
+}
+
+// reconcileNodeStates only aggregates the node states into the Authenticator
+// status, as the node agents update them far more often than anything else
+// changes.  An Authenticator whose spec failed to roll out keeps the failure
+// in its status until the full reconciliation succeeds.
+func (r *AuthenticatorReconciler) reconcileNodeStates(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	a11r := &eapolv1.Authenticator{}
+	err := r.Get(ctx, req.NamespacedName, a11r)
+	if err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	if meta.IsStatusConditionFalse(a11r.Status.Conditions, eapolv1.ConditionSecretsResolved) {
+		return ctrl.Result{}, nil
+	}
+	if degraded := meta.FindStatusCondition(a11r.Status.Conditions, eapolv1.ConditionDegraded); degraded != nil && degraded.Reason == reasonConfigRenderFailed {
+		return ctrl.Result{}, nil
+	}
+	ds := &appsv1.DaemonSet{}
+	err = r.Get(ctx, req.NamespacedName, ds)
+	if err != nil {
+		// The full reconciliation creates the DaemonSet
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	status := a11r.Status.DeepCopy()
+	err = r.syncNodeStates(ctx, a11r, ds, status)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{}, r.updateStatus(ctx, a11r, status)
+}
+
+// syncNodeStates deletes the node states of nodes the DaemonSet no longer
+// schedules on, and those not named as the node agents name them, and
+// aggregates the others into status.  The states of nodes
+// whose pod is merely being replaced are kept, so that the status does not
+// flap during a rollout.
+func (r *AuthenticatorReconciler) syncNodeStates(ctx context.Context, a11r *eapolv1.Authenticator, ds *appsv1.DaemonSet, status *eapolv1.AuthenticatorStatus) error {
+	nodes, err := r.scheduledNodes(ctx, ds)
+	if err != nil {
+		return err
+	}
+	nodeStates := &eapolv1.AuthenticatorNodeStateList{}
+	err = r.List(ctx, nodeStates, client.InNamespace(a11r.Namespace), client.MatchingLabels{configgen.AuthName: a11r.Name})
+	if err != nil {
+		return err
+	}
+	var current []eapolv1.AuthenticatorNodeState
+	for _, state := range nodeStates.Items {
+		if !metav1.IsControlledBy(&state, a11r) {
+			continue
+		}
+		// Earlier releases named the states after the authenticator and
+		// node alone
+		if !nodes[state.Spec.Node] || state.Name != k8s.NodeStateName(a11r.Name, state.Spec.Node) {
+			err = r.Delete(ctx, &state)
+			if err != nil && !errors.IsNotFound(err) {
+				return err
+			}
+			continue
+		}
+		current = append(current, state)
+	}
+	aggregateNodeStates(status, a11r.Generation, current)
+	return nil
+}
+
+// scheduledNodes returns the nodes the DaemonSet schedules on: those its node
+// selector matches, unless they are tainted to evict its pods.  The
+// DaemonSet's pods tolerate the taints which only keep new pods off a node.
+func (r *AuthenticatorReconciler) scheduledNodes(ctx context.Context, ds *appsv1.DaemonSet) (map[string]bool, error) {
+	nodeList := &corev1.NodeList{}
+	err := r.List(ctx, nodeList, client.MatchingLabels(ds.Spec.Template.Spec.NodeSelector))
+	if err != nil {
+		return nil, err
+	}
+	nodes := map[string]bool{}
+	for _, node := range nodeList.Items {
+		if !evicts(node.Spec.Taints, ds.Spec.Template.Spec.Tolerations) {
+			nodes[node.Name] = true
+		}
+	}
+	return nodes, nil
+}
+
+// evicts tells whether one of the taints evicts pods with the tolerations.
+func evicts(taints []corev1.Taint, tolerations []corev1.Toleration) bool {
+	for i := range taints {
+		if taints[i].Effect != corev1.TaintEffectNoExecute {
+			continue
+		}
+		tolerated := false
+		for _, toleration := range tolerations {
+			if toleration.ToleratesTaint(&taints[i]) {
+				tolerated = true
+				break
+			}
+		}
+		if !tolerated {
+			return true
+		}
+	}
+	return false
+}
+
+// setFailedStatus records a failure which stops the spec from being rolled
+// out in the given condition, and marks the Authenticator not ready.  A
+// failure to update the status is only logged, so the caller can return the
+// original error.
+func (r *AuthenticatorReconciler) setFailedStatus(ctx context.Context, a11r *eapolv1.Authenticator, failure metav1.Condition) {
+	status := a11r.Status.DeepCopy()
+	status.ObservedGeneration = a11r.Generation
+	setCondition(status, a11r.Generation, failure)
+	setCondition(status, a11r.Generation, metav1.Condition{
+		Type:    eapolv1.ConditionReady,
+		Status:  metav1.ConditionFalse,
+		Reason:  failure.Reason,
+		Message: failure.Message,
+	})
+	err := r.updateStatus(ctx, a11r, status)
+	if err != nil {
+		log.FromContext(ctx).Error(err, "Failed to update Authenticator status")
+	}
+}
+
+func (r *AuthenticatorReconciler) updateStatus(ctx context.Context, a11r *eapolv1.Authenticator, status *eapolv1.AuthenticatorStatus) error {
+	if reflect.DeepEqual(status, &a11r.Status) {
+		return nil
+	}
+	a11r.Status = *status
+	return r.Status().Update(ctx, a11r)
+}
+
+// setCondition sets a condition computed for the given generation of the
+// spec.
+func setCondition(status *eapolv1.AuthenticatorStatus, generation int64, condition metav1.Condition) {
+	condition.ObservedGeneration = generation
+	meta.SetStatusCondition(&status.Conditions, condition)
+}
+
+// rolloutConditions reports whether the DaemonSet is still rolling out the
+// spec, and whether the authenticator is ready on all of its nodes.
+func rolloutConditions(status *eapolv1.AuthenticatorStatus, generation int64, ds *appsv1.DaemonSet) {
+	desired := ds.Status.DesiredNumberScheduled
+	status.NodesReady = int(ds.Status.NumberReady)
+
+	progressing := metav1.Condition{
+		Type:    eapolv1.ConditionProgressing,
+		Status:  metav1.ConditionFalse,
+		Reason:  "RolloutComplete",
+		Message: fmt.Sprintf("%d of %d nodes updated", ds.Status.UpdatedNumberScheduled, desired),
+	}
+	if ds.Status.ObservedGeneration < ds.Generation || ds.Status.UpdatedNumberScheduled < desired || ds.Status.NumberAvailable < desired {
+		progressing.Status = metav1.ConditionTrue
+		progressing.Reason = "RollingOut"
+	}
+	setCondition(status, generation, progressing)
+
+	ready := metav1.Condition{
+		Type:    eapolv1.ConditionReady,
+		Status:  metav1.ConditionTrue,
+		Reason:  "AllNodesReady",
+		Message: fmt.Sprintf("%d of %d nodes ready", status.NodesReady, desired),
+	}
+	if progressing.Status == metav1.ConditionTrue {
+		ready.Status = metav1.ConditionFalse
+		ready.Reason = progressing.Reason
+	} else if desired == 0 || ds.Status.NumberReady < desired {
+		ready.Status = metav1.ConditionFalse
+		ready.Reason = "NodesNotReady"
+	}
+	setCondition(status, generation, ready)
+}
+
+// aggregateNodeStates counts the interfaces with authenticated clients, and
+// reports interfaces and RadSec connections in trouble as degraded.
+func aggregateNodeStates(status *eapolv1.AuthenticatorStatus, generation int64, nodeStates []eapolv1.AuthenticatorNodeState) {
+	status.PortsAuthenticated = 0
+	var problems []string
+	for _, state := range nodeStates {
+		for _, iface := range state.Status.Interfaces {
+			if len(iface.Clients) > 0 {
+				status.PortsAuthenticated++
+			}
+			if iface.State != eapolv1.IfStateEnabled {
+				problems = append(problems, fmt.Sprintf("interface %s on node %s is %s", iface.Name, state.Spec.Node, iface.State))
+			}
+		}
+		for _, server := range state.Status.RadSec {
+			if !server.Connected {
+				problems = append(problems, fmt.Sprintf("RadSec server %s is disconnected on node %s", server.Server, state.Spec.Node))
+			}
+		}
+	}
+	sort.Strings(problems)
+
+	degraded := metav1.Condition{
+		Type:    eapolv1.ConditionDegraded,
+		Status:  metav1.ConditionFalse,
+		Reason:  "AsExpected",
+		Message: "all interfaces are enabled",
+	}
+	if len(problems) > 0 {
+		degraded.Status = metav1.ConditionTrue
+		degraded.Reason = "NodeStateDegraded"
+		degraded.Message = strings.Join(problems, "; ")
+	}
+	setCondition(status, generation, degraded)
+}
+
+func (r *AuthenticatorReconciler) checkSecretRefs(ctx context.Context, namespace string, refs []eapolv1.SecretKeyRef) error {
+	for _, ref := range refs {
+		secret := &corev1.Secret{}
+		err := r.Get(ctx, client.ObjectKey{Namespace: namespace, Name: ref.Name}, secret)
+		if errors.IsNotFound(err) {
+			return fmt.Errorf("secret %s/%s not found", namespace, ref.Name)
+		} else if err != nil {
+			return err
+		}
+		if _, ok := secret.Data[ref.Key]; !ok {
+			return fmt.Errorf("secret %s/%s has no key %q", namespace, ref.Name, ref.Key)
+		}
+	}
+	return nil
+}
+
+// hashSecretRefs hashes the values of the referenced secret keys.  Missing
+// secrets are hashed as such, so that creating them also rolls out new pods.
+func (r *AuthenticatorReconciler) hashSecretRefs(ctx context.Context, namespace string, refs []eapolv1.SecretKeyRef) (string, error) {
+	values := map[eapolv1.SecretKeyRef][]byte{}
+	for _, ref := range refs {
+		secret := &corev1.Secret{}
+		err := r.Get(ctx, client.ObjectKey{Namespace: namespace, Name: ref.Name}, secret)
+		if err != nil && !errors.IsNotFound(err) {
+			return "", err
+		}
+		values[ref] = secret.Data[ref.Key]
+	}
+	return configgen.SecretsHash(values), nil
+}
+
+// authenticatorsForSecret maps a Secret to the Authenticators in its
+// namespace which reference it.
+func (r *AuthenticatorReconciler) authenticatorsForSecret(ctx context.Context, secret client.Object) []reconcile.Request {
+	a11rs := &eapolv1.AuthenticatorList{}
+	err := r.List(ctx, a11rs, client.InNamespace(secret.GetNamespace()))
+	if err != nil {
+		log.FromContext(ctx).Error(err, "Failed to list Authenticators referencing Secret", "secret", secret.GetName())
+		return nil
+	}
+	var requests []reconcile.Request
+	for i := range a11rs.Items {
+		for _, ref := range configgen.New(&a11rs.Items[i], "").SecretRefs() {
+			if ref.Name == secret.GetName() {
+				requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&a11rs.Items[i])})
+				break
+			}
+		}
+	}
+	return requests
+}
+
 func (r *AuthenticatorReconciler) syncRbacResources(ctx context.Context, owner *eapolv1.Authenticator, namespace string) error {
 	_, err := r.getServiceAccount(ctx, namespace)
 	if errors.IsNotFound(err) {
@@ -168,7 +510,9 @@ func (r *AuthenticatorReconciler) syncRbacResources(ctx context.Context, owner *
 	} else if err != nil {
 		return err
 	}
-	_, err = r.getRole(ctx, namespace)
+	// The Role and RoleBinding of an earlier release are updated, so that
+	// the authenticator pods are granted the rules they now need
+	role, err := r.getRole(ctx, namespace)
 	if errors.IsNotFound(err) {
 		r.rbacResources.role.Namespace = namespace
 		r.rbacResources.role.ResourceVersion = ""
@@ -179,12 +523,26 @@ func (r *AuthenticatorReconciler) syncRbacResources(ctx context.Context, owner *
 		}
 	} else if err != nil {
 		return err
+	} else if !equality.Semantic.DeepEqual(role.Rules, r.rbacResources.role.Rules) {
+		role.Rules = r.rbacResources.role.Rules
+		err = r.Update(ctx, role)
+		if err != nil {
+			return fmt.Errorf("error updating authenticator role: %v, err: %v", role, err)
+		}
+	}
+	r.rbacResources.roleBinding.Subjects[0].Namespace = namespace
+	roleBinding, err := r.getRoleBinding(ctx, namespace)
+	if err == nil && roleBinding.RoleRef != r.rbacResources.roleBinding.RoleRef {
+		// The role of a binding cannot be changed, so it is recreated
+		err = r.Delete(ctx, roleBinding)
+		if err != nil && !errors.IsNotFound(err) {
+			return fmt.Errorf("error deleting authenticator role binding: %v, err: %v", roleBinding, err)
+		}
+		err = errors.NewNotFound(rbacv1.Resource("rolebindings"), roleBinding.Name)
 	}
-	_, err = r.getRoleBinding(ctx, namespace)
 	if errors.IsNotFound(err) {
 		r.rbacResources.roleBinding.Namespace = namespace
 		r.rbacResources.roleBinding.ResourceVersion = ""
-		r.rbacResources.roleBinding.Subjects[0].Namespace = namespace
 		err = r.createOwned(ctx, owner, r.rbacResources.roleBinding)
 		if err != nil {
 			return fmt.Errorf("error creating authenticator role binding: %v, err: %v",
@@ -192,6 +550,12 @@ func (r *AuthenticatorReconciler) syncRbacResources(ctx context.Context, owner *
 		}
 	} else if err != nil {
 		return err
+	} else if !equality.Semantic.DeepEqual(roleBinding.Subjects, r.rbacResources.roleBinding.Subjects) {
+		roleBinding.Subjects = r.rbacResources.roleBinding.Subjects
+		err = r.Update(ctx, roleBinding)
+		if err != nil {
+			return fmt.Errorf("error updating authenticator role binding: %v, err: %v", roleBinding, err)
+		}
 	}
 	return nil
 }
@@ -203,13 +567,26 @@ func (r *AuthenticatorReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		return err
 	}
 	r.rbacResources = rbacResources
+	// Node agents report through their AuthenticatorNodeState, which only
+	// needs aggregating into the status of the owning Authenticator
+	err = ctrl.NewControllerManagedBy(mgr).
+		Named("authenticatornodestate").
+		Watches(&eapolv1.AuthenticatorNodeState{}, handler.EnqueueRequestForOwner(
+			mgr.GetScheme(), mgr.GetRESTMapper(), &eapolv1.Authenticator{}, handler.OnlyControllerOwner())).
+		Complete(reconcile.Func(r.reconcileNodeStates))
+	if err != nil {
+		return err
+	}
+	// Status updates of the Authenticator, which the reconcilers make
+	// themselves, do not change its generation.
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&eapolv1.Authenticator{}).
+		For(&eapolv1.Authenticator{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
 		Owns(&appsv1.DaemonSet{}).
 		Owns(&corev1.ConfigMap{}).
 		Owns(&corev1.ServiceAccount{}).
 		Owns(&rbacv1.RoleBinding{}).
 		Owns(&rbacv1.Role{}).
+		Watches(&corev1.Secret{}, handler.EnqueueRequestsFromMapFunc(r.authenticatorsForSecret)).
 		Complete(r)
 }
 
@@ -10,7 +10,9 @@ import (
 
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
@@ -107,7 +109,13 @@ var _ = Describe("Reconcile", func() {
 		Expect(ds.Spec.Template.Spec.Containers[0].VolumeMounts).NotTo(ContainLocaluserVolumeMount())
 
 		By("Updating the Authenticator's authentication type")
-		SetupUserFileAuth(a11r, "local-secret", "")
+		secret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "local-secret", Namespace: a11r.Namespace},
+			Data:       map[string][]byte{"hostapd.eap_user": []byte("user1")},
+		}
+		Expect(k8sClient.Create(ctx, secret)).To(Succeed())
+		defer k8sClient.Delete(ctx, secret)
+		SetupUserFileAuth(a11r, secret.Name, "")
 		Expect(k8sClient.Update(ctx, a11r)).To(Succeed())
 
 		Eventually(func() string {
@@ -121,6 +129,115 @@ var _ = Describe("Reconcile", func() {
 		}).Should(
 			ContainLocaluserProjection("local-secret"))
 	})
+	It("should roll out new pods when a referenced secret changes", func() {
+		secret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "local-users", Namespace: a11r.Namespace},
+			Data:       map[string][]byte{"hostapd.eap_user": []byte("user1")},
+		}
+		Expect(k8sClient.Create(ctx, secret)).To(Succeed())
+		defer k8sClient.Delete(ctx, secret)
+
+		By("Referencing the secret")
+		SetupUserFileAuth(a11r, secret.Name, "")
+		Expect(k8sClient.Update(ctx, a11r)).To(Succeed())
+		ds = &appsv1.DaemonSet{}
+		var hash string
+		Eventually(func() []corev1.VolumeProjection {
+			Expect(k8sClient.Get(ctx, key, ds)).To(Succeed())
+			hash = ds.Spec.Template.Annotations["eapol.openshift.io/secrets-hash"]
+			return ds.Spec.Template.Spec.Volumes[0].Projected.Sources
+		}, timeout, interval).Should(ContainLocaluserProjection(secret.Name))
+		Expect(hash).NotTo(BeEmpty())
+
+		By("Rotating the secret")
+		secret.Data["hostapd.eap_user"] = []byte("user2")
+		Expect(k8sClient.Update(ctx, secret)).To(Succeed())
+		Eventually(func() string {
+			Expect(k8sClient.Get(ctx, key, ds)).To(Succeed())
+			return ds.Spec.Template.Annotations["eapol.openshift.io/secrets-hash"]
+		}, timeout, interval).ShouldNot(Equal(hash))
+	})
+	It("should restore the rules of the authenticator role", func() {
+		By("Waiting for DaemonSet creation")
+		ds = &appsv1.DaemonSet{}
+		Eventually(func() error {
+			return k8sClient.Get(ctx, key, ds)
+		}, timeout, interval).Should(Succeed())
+
+		By("Dropping the node state rules, as an earlier release did not have them")
+		role := &rbacv1.Role{}
+		roleKey := client.ObjectKey{Namespace: a11r.Namespace, Name: "authenticator-role"}
+		Expect(k8sClient.Get(ctx, roleKey, role)).To(Succeed())
+		rules := role.Rules
+		role.Rules = rules[:2]
+		Expect(k8sClient.Update(ctx, role)).To(Succeed())
+
+		Eventually(func() []rbacv1.PolicyRule {
+			Expect(k8sClient.Get(ctx, roleKey, role)).To(Succeed())
+			return role.Rules
+		}, timeout, interval).Should(Equal(rules))
+	})
+	It("should delete the node states of nodes the DaemonSet does not schedule on", func() {
+		By("Waiting for DaemonSet creation")
+		ds = &appsv1.DaemonSet{}
+		Eventually(func() error {
+			return k8sClient.Get(ctx, key, ds)
+		}, timeout, interval).Should(Succeed())
+
+		By("Reporting the state of a node the DaemonSet does not run on")
+		isController := true
+		nodeState := &eapolv1.AuthenticatorNodeState{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      a11r.Name + "-gone",
+				Namespace: a11r.Namespace,
+				Labels:    map[string]string{"authenticator-name": a11r.Name},
+				OwnerReferences: []metav1.OwnerReference{{
+					APIVersion: eapolv1.GroupVersion.String(),
+					Kind:       "Authenticator",
+					Name:       a11r.Name,
+					UID:        a11r.UID,
+					Controller: &isController,
+				}},
+			},
+			Spec: eapolv1.AuthenticatorNodeStateSpec{Node: "gone"},
+		}
+		Expect(k8sClient.Create(ctx, nodeState)).To(Succeed())
+
+		Eventually(func() bool {
+			return errors.IsNotFound(k8sClient.Get(ctx, client.ObjectKeyFromObject(nodeState), nodeState))
+		}, timeout, interval).Should(BeTrue())
+		Eventually(func() bool {
+			Expect(k8sClient.Get(ctx, key, a11r)).To(Succeed())
+			return meta.IsStatusConditionFalse(a11r.Status.Conditions, eapolv1.ConditionReady)
+		}, timeout, interval).Should(BeTrue())
+		Expect(a11r.Status.PortsAuthenticated).To(BeZero())
+	})
+	It("should report the observed generation and unresolved secrets in the status", func() {
+		By("Waiting for the rendered configuration")
+		Eventually(func() string {
+			Expect(k8sClient.Get(ctx, key, a11r)).To(Succeed())
+			return a11r.Status.ConfigHash
+		}, timeout, interval).ShouldNot(BeEmpty())
+		Expect(a11r.Status.ObservedGeneration).To(Equal(a11r.Generation))
+		Expect(meta.IsStatusConditionTrue(a11r.Status.Conditions, eapolv1.ConditionSecretsResolved)).To(BeTrue())
+
+		By("Referencing a RADIUS secret which does not exist")
+		a11r.Spec.Authentication.Radius = &eapolv1.Radius{
+			AuthServer: "192.0.2.10",
+			AuthSecret: "missing-secret",
+		}
+		Expect(k8sClient.Update(ctx, a11r)).To(Succeed())
+
+		Eventually(func() bool {
+			Expect(k8sClient.Get(ctx, key, a11r)).To(Succeed())
+			return meta.IsStatusConditionFalse(a11r.Status.Conditions, eapolv1.ConditionSecretsResolved)
+		}, timeout, interval).Should(BeTrue())
+		Expect(a11r.Status.ObservedGeneration).To(Equal(a11r.Generation))
+		ready := meta.FindStatusCondition(a11r.Status.Conditions, eapolv1.ConditionReady)
+		Expect(ready).NotTo(BeNil())
+		Expect(ready.Status).To(Equal(metav1.ConditionFalse))
+		Expect(ready.Reason).To(Equal("SecretNotFound"))
+	})
 	It("should disable the daemonset when configured to so so", func() {
 		By("Waiting for object creations")
 		cm = &corev1.ConfigMap{}
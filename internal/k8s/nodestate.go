@@ -0,0 +1,110 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8s
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+
+	eapolv1 "github.com/openshift-kni/eapol-operator/api/v1"
+	"github.com/openshift-kni/eapol-operator/pkg/configgen"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// nodeStateMutex serializes the node state updates of the interface monitors
+// and RadSec proxy of a node, which would otherwise conflict.
+var nodeStateMutex sync.Mutex
+
+// maxNodeStatePrefixLength leaves room in an object name for the hash of
+// the authenticator and node names
+const maxNodeStatePrefixLength = validation.DNS1123SubdomainMaxLength - nodeStateHashLength - 1
+
+const nodeStateHashLength = 10
+
+// NodeStateName returns the name of the AuthenticatorNodeState of an
+// authenticator on a node.  The joined names are suffixed with their hash, as
+// joining them alone would give different pairs the same name, and truncated
+// to fit.
+func NodeStateName(authName, nodeName string) string {
+	hash := sha256.Sum256([]byte(authName + "/" + nodeName))
+	prefix := authName + "-" + nodeName
+	if len(prefix) > maxNodeStatePrefixLength {
+		prefix = strings.TrimRight(prefix[:maxNodeStatePrefixLength], "-.")
+	}
+	return prefix + "-" + hex.EncodeToString(hash[:])[:nodeStateHashLength]
+}
+
+// UpdateNodeState applies update to the status of the AuthenticatorNodeState
+// of an authenticator on a node, creating it owned by the authenticator first
+// if needed.
+func UpdateNodeState(c client.Client, authNsName types.NamespacedName, nodeName string,
+	update func(status *eapolv1.AuthenticatorNodeStateStatus)) error {
+	nodeStateMutex.Lock()
+	defer nodeStateMutex.Unlock()
+	key := types.NamespacedName{Namespace: authNsName.Namespace, Name: NodeStateName(authNsName.Name, nodeName)}
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		state := &eapolv1.AuthenticatorNodeState{}
+		err := c.Get(context.Background(), key, state)
+		if errors.IsNotFound(err) {
+			state, err = createNodeState(c, authNsName, key.Name, nodeName)
+		}
+		if err != nil {
+			return err
+		}
+		if state.Spec.Node != nodeName || state.Labels[configgen.AuthName] != authNsName.Name {
+			return fmt.Errorf("AuthenticatorNodeState %s is the state of authenticator %q on node %q",
+				key, state.Labels[configgen.AuthName], state.Spec.Node)
+		}
+		update(&state.Status)
+		return c.Status().Update(context.Background(), state, &client.SubResourceUpdateOptions{})
+	})
+}
+
+func createNodeState(c client.Client, authNsName types.NamespacedName, name, nodeName string) (*eapolv1.AuthenticatorNodeState, error) {
+	authObj := &eapolv1.Authenticator{}
+	err := c.Get(context.Background(), authNsName, authObj)
+	if err != nil {
+		return nil, err
+	}
+	isController := true
+	state := &eapolv1.AuthenticatorNodeState{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: authNsName.Namespace,
+			Labels:    map[string]string{configgen.AuthName: authNsName.Name},
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion: eapolv1.GroupVersion.String(),
+				Kind:       "Authenticator",
+				Name:       authObj.Name,
+				UID:        authObj.UID,
+				Controller: &isController,
+			}},
+		},
+		Spec: eapolv1.AuthenticatorNodeStateSpec{Node: nodeName},
+	}
+	err = c.Create(context.Background(), state)
+	return state, err
+}
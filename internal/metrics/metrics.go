@@ -34,4 +34,26 @@ var (
 		Name: "auth_failure_total",
 		Help: "total failed authentications for wpa supplicants",
 	}
+
+	HostapdUp = metric{
+		Name: "up",
+		Help: "whether hostapd is running with its control interfaces created",
+	}
+
+	HostapdRestarts = metric{
+		Name: "restarts_total",
+		Help: "total restarts of hostapd after it exited",
+	}
+
+	RadSecSubsystem = "radsec"
+
+	RadSecConnected = metric{
+		Name: "connected",
+		Help: "whether the TLS connection to the RadSec server is established",
+	}
+
+	RadSecErrors = metric{
+		Name: "errors_total",
+		Help: "total connection and TLS errors for the RadSec server",
+	}
 )
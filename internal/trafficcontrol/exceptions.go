@@ -0,0 +1,172 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package trafficcontrol
+
+import (
+	"fmt"
+	"net"
+
+	eapolv1 "github.com/openshift-kni/eapol-operator/api/v1"
+	"golang.org/x/sys/unix"
+)
+
+// IPRule matches unauthenticated IPv4 or IPv6 traffic to allow.  Unset
+// fields match anything.
+type IPRule struct {
+	IPv6     bool
+	Protocol uint8
+	SrcNet   *net.IPNet
+	DstNet   *net.IPNet
+	// Ports are tcp or udp destination port ranges
+	Ports []PortRange
+	// ICMPTypes are icmp or icmpv6 types
+	ICMPTypes []uint8
+}
+
+type PortRange struct {
+	Start uint16
+	End   uint16
+}
+
+// ParseExceptions converts traffic exceptions to the ethertypes and IP
+// rules to allow, with one IP rule for each family and pair of CIDRs.
+func ParseExceptions(exceptions []eapolv1.TrafficException) ([]uint16, []IPRule, error) {
+	var (
+		etherTypes []uint16
+		ipRules    []IPRule
+	)
+	for _, exception := range exceptions {
+		if exception.EtherType != 0 {
+			etherTypes = append(etherTypes, uint16(exception.EtherType))
+			continue
+		}
+		rules, err := exceptionIPRules(exception)
+		if err != nil {
+			return nil, nil, err
+		}
+		ipRules = append(ipRules, rules...)
+	}
+	return etherTypes, ipRules, nil
+}
+
+func exceptionIPRules(exception eapolv1.TrafficException) ([]IPRule, error) {
+	base := IPRule{}
+	families := []bool{false, true}
+	switch exception.Protocol {
+	case "":
+	case eapolv1.IPProtocolTCP:
+		base.Protocol = unix.IPPROTO_TCP
+	case eapolv1.IPProtocolUDP:
+		base.Protocol = unix.IPPROTO_UDP
+	case eapolv1.IPProtocolICMP:
+		base.Protocol = unix.IPPROTO_ICMP
+		families = []bool{false}
+	case eapolv1.IPProtocolICMPv6:
+		base.Protocol = unix.IPPROTO_ICMPV6
+		families = []bool{true}
+	default:
+		return nil, fmt.Errorf("unsupported protocol %q", exception.Protocol)
+	}
+	if len(exception.Ports) > 0 && base.Protocol != unix.IPPROTO_TCP && base.Protocol != unix.IPPROTO_UDP {
+		return nil, fmt.Errorf("ports require the tcp or udp protocol")
+	}
+	if len(exception.ICMPTypes) > 0 && base.Protocol != unix.IPPROTO_ICMP && base.Protocol != unix.IPPROTO_ICMPV6 {
+		return nil, fmt.Errorf("icmp types require the icmp or icmpv6 protocol")
+	}
+	for _, port := range exception.Ports {
+		end := port.EndPort
+		if end == 0 {
+			end = port.Port
+		}
+		if port.Port < 1 || end < port.Port || end > 0xffff {
+			return nil, fmt.Errorf("invalid port range %d-%d", port.Port, end)
+		}
+		base.Ports = append(base.Ports, PortRange{Start: uint16(port.Port), End: uint16(end)})
+	}
+	for _, icmpType := range exception.ICMPTypes {
+		if icmpType < 0 || icmpType > 0xff {
+			return nil, fmt.Errorf("invalid icmp type %d", icmpType)
+		}
+		base.ICMPTypes = append(base.ICMPTypes, uint8(icmpType))
+	}
+	srcNets, err := parseCIDRs(exception.SourceCIDRs)
+	if err != nil {
+		return nil, err
+	}
+	dstNets, err := parseCIDRs(exception.DestinationCIDRs)
+	if err != nil {
+		return nil, err
+	}
+	var rules []IPRule
+	for _, ipv6 := range families {
+		for _, srcNet := range srcNets {
+			if srcNet != nil && isIPv6(srcNet) != ipv6 {
+				continue
+			}
+			for _, dstNet := range dstNets {
+				if dstNet != nil && isIPv6(dstNet) != ipv6 {
+					continue
+				}
+				rule := base
+				rule.IPv6 = ipv6
+				rule.SrcNet = srcNet
+				rule.DstNet = dstNet
+				rules = append(rules, rule)
+			}
+		}
+	}
+	if len(rules) == 0 {
+		return nil, fmt.Errorf("no address family matches both the protocol and CIDRs")
+	}
+	return rules, nil
+}
+
+// parseCIDRs returns the prefixes, or a single nil prefix matching any
+// address when there are none.
+func parseCIDRs(cidrs []string) ([]*net.IPNet, error) {
+	if len(cidrs) == 0 {
+		return []*net.IPNet{nil}, nil
+	}
+	var nets []*net.IPNet
+	for _, cidr := range cidrs {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+func isIPv6(ipNet *net.IPNet) bool {
+	return ipNet.IP.To4() == nil
+}
+
+// portBlocks splits a port range into the value and mask pairs which match
+// it, for classifiers without range matches.
+func portBlocks(r PortRange) [][2]uint16 {
+	var blocks [][2]uint16
+	for start := uint32(r.Start); start <= uint32(r.End); {
+		size := uint32(1)
+		for size < 0x10000 && start&(size*2-1) == 0 && start+size*2-1 <= uint32(r.End) {
+			size *= 2
+		}
+		blocks = append(blocks, [2]uint16{uint16(start), uint16(^(size - 1))})
+		start += size
+	}
+	return blocks
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package trafficcontrol
+
+import (
+	"net"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	eapolv1 "github.com/openshift-kni/eapol-operator/api/v1"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+var _ = Describe("traffic exceptions", func() {
+	It("separates ethertypes from IP rules", func() {
+		etherTypes, ipRules, err := ParseExceptions([]eapolv1.TrafficException{
+			{EtherType: 0x88f7},
+			{EtherType: 0x88cc},
+			{Protocol: eapolv1.IPProtocolICMPv6, ICMPTypes: []int{133, 134, 135, 136, 137}},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(etherTypes).To(Equal([]uint16{0x88f7, 0x88cc}))
+		Expect(ipRules).To(Equal([]IPRule{{IPv6: true, Protocol: unix.IPPROTO_ICMPV6,
+			ICMPTypes: []uint8{133, 134, 135, 136, 137}}}))
+	})
+
+	It("matches both families unless the CIDRs select one", func() {
+		_, ipRules, err := ParseExceptions([]eapolv1.TrafficException{{
+			Protocol: eapolv1.IPProtocolUDP,
+			Ports:    []eapolv1.PortRange{{Port: 67}, {Port: 33434, EndPort: 33534}},
+		}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ipRules).To(HaveLen(2))
+		Expect(ipRules[0].IPv6).To(BeFalse())
+		Expect(ipRules[1].IPv6).To(BeTrue())
+		Expect(ipRules[0].Ports).To(Equal([]PortRange{{67, 67}, {33434, 33534}}))
+
+		_, ipRules, err = ParseExceptions([]eapolv1.TrafficException{{
+			SourceCIDRs:      []string{"192.0.2.0/24", "2001:db8::/32"},
+			DestinationCIDRs: []string{"198.51.100.1/32"},
+		}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ipRules).To(HaveLen(1))
+		Expect(ipRules[0].IPv6).To(BeFalse())
+		Expect(ipRules[0].SrcNet.String()).To(Equal("192.0.2.0/24"))
+		Expect(ipRules[0].DstNet.String()).To(Equal("198.51.100.1/32"))
+	})
+
+	It("rejects inconsistent exceptions", func() {
+		for _, exception := range []eapolv1.TrafficException{
+			{Ports: []eapolv1.PortRange{{Port: 80}}},
+			{Protocol: eapolv1.IPProtocolTCP, ICMPTypes: []int{8}},
+			{Protocol: eapolv1.IPProtocolTCP, Ports: []eapolv1.PortRange{{Port: 90, EndPort: 80}}},
+			{Protocol: eapolv1.IPProtocolICMP, SourceCIDRs: []string{"2001:db8::/32"}},
+			{SourceCIDRs: []string{"192.0.2.0"}},
+		} {
+			_, _, err := ParseExceptions([]eapolv1.TrafficException{exception})
+			Expect(err).To(HaveOccurred(), "%+v", exception)
+		}
+	})
+
+	It("splits port ranges into masked blocks", func() {
+		Expect(portBlocks(PortRange{80, 80})).To(Equal([][2]uint16{{80, 0xffff}}))
+		Expect(portBlocks(PortRange{1024, 2047})).To(Equal([][2]uint16{{1024, 0xfc00}}))
+		Expect(portBlocks(PortRange{33434, 33534})).To(Equal([][2]uint16{
+			{33434, 0xfffe}, {33436, 0xfffc}, {33440, 0xffe0}, {33472, 0xffe0},
+			{33504, 0xfff0}, {33520, 0xfff8}, {33528, 0xfffc}, {33532, 0xfffe}, {33534, 0xffff},
+		}))
+		Expect(portBlocks(PortRange{1, 0xffff})).To(HaveLen(16))
+	})
+
+	It("builds u32 keys for each port block and ICMP type", func() {
+		_, srcNet, _ := net.ParseCIDR("192.0.2.0/24")
+		Expect(ipRuleKeys(IPRule{Protocol: unix.IPPROTO_UDP, SrcNet: srcNet,
+			Ports: []PortRange{{68, 69}}})).To(Equal([][]netlink.TcU32Key{{
+			{Off: 8, Mask: 0x00ff0000, Val: unix.IPPROTO_UDP << 16},
+			{Off: 12, Mask: 0xffffff00, Val: 0xc0000200},
+			{Off: 20, Mask: 0xfffe, Val: 68},
+		}}))
+		Expect(ipRuleKeys(IPRule{Protocol: unix.IPPROTO_UDP, Ports: []PortRange{{67, 67}, {68, 68}}})).To(HaveLen(2))
+
+		_, dstNet, _ := net.ParseCIDR("ff02::/16")
+		Expect(ipRuleKeys(IPRule{IPv6: true, Protocol: unix.IPPROTO_ICMPV6, DstNet: dstNet,
+			ICMPTypes: []uint8{135}})).To(Equal([][]netlink.TcU32Key{{
+			{Off: 4, Mask: 0x0000ff00, Val: unix.IPPROTO_ICMPV6 << 8},
+			{Off: 24, Mask: 0xffff0000, Val: 0xff020000},
+			{Off: 40, Mask: 0xff000000, Val: 135 << 24},
+		}}))
+
+		// Any IPv4 traffic
+		Expect(ipRuleKeys(IPRule{})).To(Equal([][]netlink.TcU32Key{{{}}}))
+	})
+})
@@ -0,0 +1,379 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package trafficcontrol
+
+import (
+	"net"
+	"reflect"
+	"sync"
+)
+
+// FakeInterface is the set of rules a FakeTrafficController holds for one
+// interface.
+type FakeInterface struct {
+	EAPOL       bool
+	AllowAll    bool
+	TcpPorts    []int
+	UdpPorts    []int
+	Macs        map[string]FakeMacRule
+	AllowedMacs []string
+	DeniedMacs  []string
+	EtherTypes  []uint16
+	IPRules     []IPRule
+	// Egress rules
+	EgressDrop       bool
+	EgressEtherTypes []uint16
+	EgressIPRules    []IPRule
+	EgressMacs       map[string]bool
+}
+
+type FakeMacRule struct {
+	Allow   bool
+	EthType uint16
+}
+
+// Allows returns whether frames from a MAC address pass the rules, in the
+// order the kernel evaluates them: static denials and allowances first, then
+// the MAC address rules and the allow-all rule.
+func (i *FakeInterface) Allows(mac string) bool {
+	for _, denied := range i.DeniedMacs {
+		if denied == mac {
+			return false
+		}
+	}
+	for _, allowed := range i.AllowedMacs {
+		if allowed == mac {
+			return true
+		}
+	}
+	if rule, ok := i.Macs[mac]; ok {
+		return rule.Allow
+	}
+	return i.AllowAll
+}
+
+// FakeTrafficController records rules in memory instead of programming the
+// kernel, for unit tests which cannot run as root.  Unlike the kernel, it
+// accepts rules for interfaces which were not initialized.
+type FakeTrafficController struct {
+	mutex      sync.Mutex
+	interfaces map[string]*FakeInterface
+	failures   map[string]error
+}
+
+func NewFakeTrafficController() *FakeTrafficController {
+	return &FakeTrafficController{interfaces: make(map[string]*FakeInterface), failures: make(map[string]error)}
+}
+
+// Fail makes the rules which are then added to or removed from the ports,
+// exceptions and static MAC addresses of an interface fail with err, until
+// it is called again with a nil err.
+func (t *FakeTrafficController) Fail(ifName string, err error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if err == nil {
+		delete(t.failures, ifName)
+	} else {
+		t.failures[ifName] = err
+	}
+}
+
+func (t *FakeTrafficController) Init(ifName string) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.interfaces[ifName] = &FakeInterface{Macs: make(map[string]FakeMacRule)}
+	return nil
+}
+
+func (t *FakeTrafficController) Reset(ifName string) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	delete(t.interfaces, ifName)
+	return nil
+}
+
+func (t *FakeTrafficController) AllowEAPOL(ifName string) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	iface := t.iface(ifName)
+	iface.EAPOL = true
+	return nil
+}
+
+func (t *FakeTrafficController) AllowPort(ifName, protocol string, port int) error {
+	if _, err := ipProtocol(protocol); err != nil {
+		return err
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if err := t.failures[ifName]; err != nil {
+		return err
+	}
+	iface := t.iface(ifName)
+	if protocol == tcpProtoStr {
+		iface.TcpPorts = append(iface.TcpPorts, port)
+	} else {
+		iface.UdpPorts = append(iface.UdpPorts, port)
+	}
+	return nil
+}
+
+func (t *FakeTrafficController) AllowEtherType(ifName string, ethType uint16) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if err := t.failures[ifName]; err != nil {
+		return err
+	}
+	iface := t.iface(ifName)
+	iface.EtherTypes = append(iface.EtherTypes, ethType)
+	return nil
+}
+
+func (t *FakeTrafficController) AllowIP(ifName string, rule IPRule) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if err := t.failures[ifName]; err != nil {
+		return err
+	}
+	iface := t.iface(ifName)
+	iface.IPRules = append(iface.IPRules, rule)
+	return nil
+}
+
+func (t *FakeTrafficController) RemovePort(ifName, protocol string, port int) error {
+	if _, err := ipProtocol(protocol); err != nil {
+		return err
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if err := t.failures[ifName]; err != nil {
+		return err
+	}
+	iface := t.iface(ifName)
+	if protocol == tcpProtoStr {
+		iface.TcpPorts = without(iface.TcpPorts, port)
+	} else {
+		iface.UdpPorts = without(iface.UdpPorts, port)
+	}
+	return nil
+}
+
+func (t *FakeTrafficController) RemoveEtherType(ifName string, ethType uint16) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if err := t.failures[ifName]; err != nil {
+		return err
+	}
+	iface := t.iface(ifName)
+	iface.EtherTypes = without(iface.EtherTypes, ethType)
+	return nil
+}
+
+func (t *FakeTrafficController) RemoveIP(ifName string, rule IPRule) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if err := t.failures[ifName]; err != nil {
+		return err
+	}
+	iface := t.iface(ifName)
+	iface.IPRules = without(iface.IPRules, rule)
+	return nil
+}
+
+func (t *FakeTrafficController) AllowMac(ifName string, mac net.HardwareAddr, ethType uint16) error {
+	return t.setMacRule(ifName, mac, FakeMacRule{Allow: true, EthType: ethType})
+}
+
+func (t *FakeTrafficController) DenyMac(ifName string, mac net.HardwareAddr, ethType uint16) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	iface := t.iface(ifName)
+	delete(iface.Macs, mac.String())
+	return nil
+}
+
+func (t *FakeTrafficController) AllowAll(ifName string, allow bool) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	iface := t.iface(ifName)
+	iface.AllowAll = allow
+	return nil
+}
+
+func (t *FakeTrafficController) AllowStaticMac(ifName string, mac net.HardwareAddr) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if err := t.failures[ifName]; err != nil {
+		return err
+	}
+	iface := t.iface(ifName)
+	iface.AllowedMacs = append(iface.AllowedMacs, mac.String())
+	return nil
+}
+
+func (t *FakeTrafficController) DenyStaticMac(ifName string, mac net.HardwareAddr) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if err := t.failures[ifName]; err != nil {
+		return err
+	}
+	iface := t.iface(ifName)
+	iface.DeniedMacs = append(iface.DeniedMacs, mac.String())
+	return nil
+}
+
+func (t *FakeTrafficController) RemoveStaticMac(ifName string, mac net.HardwareAddr) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if err := t.failures[ifName]; err != nil {
+		return err
+	}
+	iface := t.iface(ifName)
+	iface.AllowedMacs = without(iface.AllowedMacs, mac.String())
+	iface.DeniedMacs = without(iface.DeniedMacs, mac.String())
+	return nil
+}
+
+func (t *FakeTrafficController) InitEgress(ifName string) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	iface := t.iface(ifName)
+	iface.EgressDrop = true
+	iface.EgressEtherTypes = nil
+	iface.EgressIPRules = nil
+	iface.EgressMacs = make(map[string]bool)
+	return nil
+}
+
+func (t *FakeTrafficController) AllowEgressEtherType(ifName string, ethType uint16) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if err := t.failures[ifName]; err != nil {
+		return err
+	}
+	iface := t.iface(ifName)
+	iface.EgressEtherTypes = append(iface.EgressEtherTypes, ethType)
+	return nil
+}
+
+func (t *FakeTrafficController) AllowEgressIP(ifName string, rule IPRule) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if err := t.failures[ifName]; err != nil {
+		return err
+	}
+	iface := t.iface(ifName)
+	iface.EgressIPRules = append(iface.EgressIPRules, rule)
+	return nil
+}
+
+func (t *FakeTrafficController) RemoveEgressEtherType(ifName string, ethType uint16) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if err := t.failures[ifName]; err != nil {
+		return err
+	}
+	iface := t.iface(ifName)
+	iface.EgressEtherTypes = without(iface.EgressEtherTypes, ethType)
+	return nil
+}
+
+func (t *FakeTrafficController) RemoveEgressIP(ifName string, rule IPRule) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if err := t.failures[ifName]; err != nil {
+		return err
+	}
+	iface := t.iface(ifName)
+	iface.EgressIPRules = without(iface.EgressIPRules, rule)
+	return nil
+}
+
+func (t *FakeTrafficController) AllowEgressMac(ifName string, mac net.HardwareAddr) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	iface := t.iface(ifName)
+	t.setEgressMac(iface, mac, true)
+	return nil
+}
+
+func (t *FakeTrafficController) DenyEgressMac(ifName string, mac net.HardwareAddr) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	iface := t.iface(ifName)
+	t.setEgressMac(iface, mac, false)
+	return nil
+}
+
+func (t *FakeTrafficController) setEgressMac(iface *FakeInterface, mac net.HardwareAddr, allow bool) {
+	if iface.EgressMacs == nil {
+		iface.EgressMacs = make(map[string]bool)
+	}
+	iface.EgressMacs[mac.String()] = allow
+}
+
+// Interface returns a copy of the rules held for an interface, or nil if it
+// has not been initialized.
+func (t *FakeTrafficController) Interface(ifName string) *FakeInterface {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	iface, ok := t.interfaces[ifName]
+	if !ok {
+		return nil
+	}
+	ifCopy := *iface
+	ifCopy.Macs = make(map[string]FakeMacRule, len(iface.Macs))
+	for mac, rule := range iface.Macs {
+		ifCopy.Macs[mac] = rule
+	}
+	if iface.EgressMacs != nil {
+		ifCopy.EgressMacs = make(map[string]bool, len(iface.EgressMacs))
+		for mac, allow := range iface.EgressMacs {
+			ifCopy.EgressMacs[mac] = allow
+		}
+	}
+	return &ifCopy
+}
+
+func (t *FakeTrafficController) setMacRule(ifName string, mac net.HardwareAddr, rule FakeMacRule) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	iface := t.iface(ifName)
+	iface.Macs[mac.String()] = rule
+	return nil
+}
+
+func (t *FakeTrafficController) iface(ifName string) *FakeInterface {
+	iface, ok := t.interfaces[ifName]
+	if !ok {
+		iface = &FakeInterface{Macs: make(map[string]FakeMacRule)}
+		t.interfaces[ifName] = iface
+	}
+	return iface
+}
+
+// without returns a copy of the rules but those equal to rule, or nil if
+// none are left.
+func without[T any](rules []T, rule T) []T {
+	var kept []T
+	for _, r := range rules {
+		if !reflect.DeepEqual(r, rule) {
+			kept = append(kept, r)
+		}
+	}
+	return kept
+}
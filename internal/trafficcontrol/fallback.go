@@ -0,0 +1,198 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package trafficcontrol
+
+// Fallback is the network an unauthenticated VF is released on instead of
+// being blocked.
+type Fallback int
+
+const (
+	FallbackNone Fallback = iota
+	// FallbackGuest is the guest VLAN, for VFs no EAPOL was received for
+	FallbackGuest
+	// FallbackAuthFail is the auth-fail VLAN, for VFs whose supplicant
+	// failed authentication
+	FallbackAuthFail
+)
+
+// VF port states, as reported in the Authenticator status
+const (
+	VFStateUnauthorized = "Unauthorized"
+	VFStateAuthorized   = "Authorized"
+	VFStateGuest        = "Guest"
+	VFStateAuthFail     = "AuthFail"
+)
+
+// EAPStarted records EAP activity for the VFs of a supplicant.  Such VFs are
+// no longer eligible for the guest VLAN, and any on it are blocked until the
+// supplicant either authenticates or fails.  VFs on the auth-fail VLAN stay
+// there while the supplicant retries.
+func (pf *PFInfo) EAPStarted(mac string) (bool, error) {
+	vfs, err := pf.vfsForMac(mac)
+	if err != nil {
+		return false, err
+	}
+	changed := false
+	for _, vf := range vfs {
+		vf.eapSeen = true
+		if vf.Fallback != FallbackGuest {
+			continue
+		}
+		changed = true
+		vf.Fallback = FallbackNone
+		if err := vf.ConfigureVlanState(); err != nil {
+			return changed, err
+		}
+	}
+	return changed, nil
+}
+
+// EAPFailed moves the VFs of a supplicant which failed authentication onto
+// the auth-fail VLAN, if one is configured.
+func (pf *PFInfo) EAPFailed(mac string) (bool, error) {
+	if pf.AuthFailVlan == 0 {
+		return false, nil
+	}
+	vfs, err := pf.vfsForMac(mac)
+	if err != nil {
+		return false, err
+	}
+	changed := false
+	for _, vf := range vfs {
+		vf.eapSeen = true
+		if vf.Fallback == FallbackAuthFail {
+			continue
+		}
+		changed = true
+		vf.Fallback = FallbackAuthFail
+		if err := vf.ConfigureVlanState(); err != nil {
+			return changed, err
+		}
+	}
+	return changed, nil
+}
+
+// GuestTimeout moves the VFs no EAPOL was received for onto the guest VLAN,
+// if one is configured.
+func (pf *PFInfo) GuestTimeout() (bool, error) {
+	if pf.GuestVlan == 0 {
+		return false, nil
+	}
+	changed := false
+	for _, vf := range pf.VFs {
+		if vf.eapSeen || vf.Fallback != FallbackNone || vf.authenticated() {
+			continue
+		}
+		changed = true
+		vf.Fallback = FallbackGuest
+		if err := vf.ConfigureVlanState(); err != nil {
+			return changed, err
+		}
+	}
+	return changed, nil
+}
+
+// ResetFallback blocks VFs on a fallback VLAN again and forgets any EAP
+// activity, for when the link went down and another device may be attached
+// once it is back up.
+func (pf *PFInfo) ResetFallback() error {
+	for _, vf := range pf.VFs {
+		vf.eapSeen = false
+		if vf.Fallback == FallbackNone {
+			continue
+		}
+		vf.Fallback = FallbackNone
+		if err := vf.ConfigureVlanState(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetFallbackVlans replaces the guest and auth-fail VLANs.  Unauthenticated
+// VFs on a fallback VLAN are moved onto the new one, or blocked if it is
+// unset, while authenticated VFs are left alone.
+func (pf *PFInfo) SetFallbackVlans(guestVlan, authFailVlan int) error {
+	pf.GuestVlan = guestVlan
+	pf.AuthFailVlan = authFailVlan
+	for _, vf := range pf.VFs {
+		if vf.Fallback == FallbackNone || vf.authenticated() {
+			continue
+		}
+		if vf.fallbackVlan() == 0 {
+			vf.Fallback = FallbackNone
+		}
+		if err := vf.ConfigureVlanState(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// clearFallback takes the VFs of an authenticated supplicant off the
+// auth-fail VLAN for good, so that they are blocked once it is
+// deauthenticated.  Their VLAN is reconfigured as they are released.
+func (pf *PFInfo) clearFallback(mac string) error {
+	vfs, err := pf.vfsForMac(mac)
+	if err != nil {
+		return err
+	}
+	for _, vf := range vfs {
+		vf.eapSeen = true
+		vf.Fallback = FallbackNone
+	}
+	return nil
+}
+
+// State returns the port state of the VF and the VLAN it is released on.
+func (vf *VFInfo) State() (string, int) {
+	if vf.authenticated() {
+		return VFStateAuthorized, vf.vlan()
+	}
+	vlan := vf.fallbackVlan()
+	switch {
+	case vlan == 0:
+		return VFStateUnauthorized, 0
+	case vf.Fallback == FallbackGuest:
+		return VFStateGuest, vlan
+	}
+	return VFStateAuthFail, vlan
+}
+
+func (vf *VFInfo) fallbackVlan() int {
+	switch vf.Fallback {
+	case FallbackGuest:
+		return vf.Parent.GuestVlan
+	case FallbackAuthFail:
+		return vf.Parent.AuthFailVlan
+	}
+	return 0
+}
+
+// setAllowAll opens the VF's network device to traffic from any source, or
+// closes it again.  VFs without a network device in the host namespace have
+// no rules to change.
+func (vf *VFInfo) setAllowAll(allow bool) error {
+	if vf.allowAll == allow || vf.NetDev == "" || vf.Parent.TrafficCtl == nil {
+		return nil
+	}
+	if err := vf.Parent.TrafficCtl.AllowAll(vf.NetDev, allow); err != nil {
+		return err
+	}
+	vf.allowAll = allow
+	return nil
+}
@@ -0,0 +1,191 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package trafficcontrol
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/k8snetworkplumbingwg/sriov-cni/pkg/utils"
+	mocks_utils "github.com/k8snetworkplumbingwg/sriov-cni/pkg/utils/mocks"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/stretchr/testify/mock"
+	"github.com/vishvananda/netlink"
+)
+
+var _ = Describe("fallback vlans", func() {
+	const supplicant = "6e:16:06:0e:b7:e2"
+	var (
+		mocked   *mocks_utils.NetlinkManager
+		fakeLink *utils.FakeLink
+		fakeTC   *FakeTrafficController
+		pfInfo   *PFInfo
+		t        GinkgoTInterface
+	)
+	BeforeEach(func() {
+		t = GinkgoT()
+		mocked = &mocks_utils.NetlinkManager{}
+		fakeTC = NewFakeTrafficController()
+		fakeLink = &utils.FakeLink{LinkAttrs: netlink.LinkAttrs{
+			Index: 1000,
+			Name:  pfName,
+			Vfs:   []netlink.VfInfo{{ID: 0, Vlan: 200}},
+		}}
+		pfInfo = &PFInfo{Name: pfName, AuthenticatedAddrs: map[string]interface{}{},
+			VFs: map[int]*VFInfo{}, NetLinkMgr: mocked, TrafficCtl: fakeTC,
+			StationVlans: map[string]int{}, GuestVlan: 10, AuthFailVlan: 20}
+		pfInfo.VFs[0] = &VFInfo{Parent: pfInfo, Index: 0, Vlan: 200, NetDev: "vf0",
+			AuthenticatedAddrs: map[string]interface{}{}}
+		mocked.On("LinkByName", pfName).Return(fakeLink, nil)
+	})
+
+	expectVlan := func(vlan int, state uint32) {
+		mocked.On("LinkSetVfVlan", fakeLink, 0, vlan).Return(nil).Once()
+		mocked.On("LinkSetVfState", fakeLink, 0, state).Return(nil).Once()
+	}
+
+	It("moves VFs without EAPOL to the guest vlan until EAP starts", func() {
+		expectVlan(10, netlink.VF_LINK_STATE_AUTO)
+		changed, err := pfInfo.GuestTimeout()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(changed).To(BeTrue())
+		Expect(fakeTC.Interface("vf0").AllowAll).To(BeTrue())
+		state, vlan := pfInfo.VFs[0].State()
+		Expect(state).To(Equal(VFStateGuest))
+		Expect(vlan).To(Equal(10))
+
+		expectVlan(ReservedVlan, netlink.VF_LINK_STATE_DISABLE)
+		changed, err = pfInfo.EAPStarted(supplicant)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(changed).To(BeTrue())
+		Expect(fakeTC.Interface("vf0").AllowAll).To(BeFalse())
+		state, _ = pfInfo.VFs[0].State()
+		Expect(state).To(Equal(VFStateUnauthorized))
+
+		changed, err = pfInfo.GuestTimeout()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(changed).To(BeFalse())
+		mocked.AssertExpectations(t)
+	})
+
+	It("moves the VFs of a failed supplicant to the auth-fail vlan until it authenticates", func() {
+		expectVlan(20, netlink.VF_LINK_STATE_AUTO)
+		changed, err := pfInfo.EAPFailed(supplicant)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(changed).To(BeTrue())
+		state, vlan := pfInfo.VFs[0].State()
+		Expect(state).To(Equal(VFStateAuthFail))
+		Expect(vlan).To(Equal(20))
+
+		// Retries leave the VF on the auth-fail vlan
+		changed, err = pfInfo.EAPStarted(supplicant)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(changed).To(BeFalse())
+
+		expectVlan(200, netlink.VF_LINK_STATE_AUTO)
+		pfInfo.AuthenticatedAddrs[supplicant] = nil
+		Expect(AllowTrafficFromMac(pfInfo, supplicant, mocked)).To(Succeed())
+		Expect(fakeTC.Interface("vf0").AllowAll).To(BeFalse())
+		state, vlan = pfInfo.VFs[0].State()
+		Expect(state).To(Equal(VFStateAuthorized))
+		Expect(vlan).To(Equal(200))
+
+		expectVlan(ReservedVlan, netlink.VF_LINK_STATE_DISABLE)
+		delete(pfInfo.AuthenticatedAddrs, supplicant)
+		Expect(DenyTrafficFromMac(pfInfo, supplicant, mocked)).To(Succeed())
+		state, _ = pfInfo.VFs[0].State()
+		Expect(state).To(Equal(VFStateUnauthorized))
+		mocked.AssertExpectations(t)
+	})
+
+	It("lets a deauthenticated supplicant through on the auth-fail vlan", func() {
+		// Lay out the PF with the network device of its VF, which gets the
+		// MAC address rules too
+		dir := GinkgoT().TempDir()
+		DeferCleanup(func(dir string) { sysClassNet = dir }, sysClassNet)
+		sysClassNet = dir
+		Expect(os.MkdirAll(filepath.Join(dir, pfName, "device", "virtfn0", "net", "vf0"), 0755)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(dir, pfName, "device", "sriov_numvfs"), []byte("1\n"), 0644)).To(Succeed())
+		mocked.On("LinkByName", "vf0").Return(&utils.FakeLink{LinkAttrs: netlink.LinkAttrs{Name: "vf0"}}, nil)
+
+		expectVlan(200, netlink.VF_LINK_STATE_AUTO)
+		pfInfo.AuthenticatedAddrs[supplicant] = nil
+		Expect(AllowTrafficFromMac(pfInfo, supplicant, mocked)).To(Succeed())
+		Expect(fakeTC.Interface("vf0").Allows(supplicant)).To(BeTrue())
+
+		expectVlan(ReservedVlan, netlink.VF_LINK_STATE_DISABLE)
+		delete(pfInfo.AuthenticatedAddrs, supplicant)
+		Expect(DenyTrafficFromMac(pfInfo, supplicant, mocked)).To(Succeed())
+		Expect(fakeTC.Interface("vf0").Allows(supplicant)).To(BeFalse())
+
+		expectVlan(20, netlink.VF_LINK_STATE_AUTO)
+		changed, err := pfInfo.EAPFailed(supplicant)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(changed).To(BeTrue())
+		Expect(fakeTC.Interface("vf0").Allows(supplicant)).To(BeTrue())
+		mocked.AssertExpectations(t)
+	})
+
+	It("blocks VFs on a fallback vlan again when reset", func() {
+		expectVlan(20, netlink.VF_LINK_STATE_AUTO)
+		_, err := pfInfo.EAPFailed(supplicant)
+		Expect(err).NotTo(HaveOccurred())
+
+		expectVlan(ReservedVlan, netlink.VF_LINK_STATE_DISABLE)
+		Expect(pfInfo.ResetFallback()).To(Succeed())
+		Expect(fakeTC.Interface("vf0").AllowAll).To(BeFalse())
+
+		// EAP activity was forgotten along with the fallback
+		expectVlan(10, netlink.VF_LINK_STATE_AUTO)
+		changed, err := pfInfo.GuestTimeout()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(changed).To(BeTrue())
+		mocked.AssertExpectations(t)
+	})
+
+	It("moves VFs on a fallback vlan when it changes", func() {
+		expectVlan(10, netlink.VF_LINK_STATE_AUTO)
+		_, err := pfInfo.GuestTimeout()
+		Expect(err).NotTo(HaveOccurred())
+
+		expectVlan(30, netlink.VF_LINK_STATE_AUTO)
+		Expect(pfInfo.SetFallbackVlans(30, 20)).To(Succeed())
+		state, vlan := pfInfo.VFs[0].State()
+		Expect(state).To(Equal(VFStateGuest))
+		Expect(vlan).To(Equal(30))
+
+		expectVlan(ReservedVlan, netlink.VF_LINK_STATE_DISABLE)
+		Expect(pfInfo.SetFallbackVlans(0, 20)).To(Succeed())
+		Expect(fakeTC.Interface("vf0").AllowAll).To(BeFalse())
+		state, _ = pfInfo.VFs[0].State()
+		Expect(state).To(Equal(VFStateUnauthorized))
+		mocked.AssertExpectations(t)
+	})
+
+	It("keeps VFs blocked when no fallback vlans are configured", func() {
+		pfInfo.GuestVlan = 0
+		pfInfo.AuthFailVlan = 0
+		changed, err := pfInfo.GuestTimeout()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(changed).To(BeFalse())
+		changed, err = pfInfo.EAPFailed(supplicant)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(changed).To(BeFalse())
+		mocked.AssertNotCalled(t, "LinkSetVfVlan", mock.Anything, mock.Anything, mock.Anything)
+	})
+})
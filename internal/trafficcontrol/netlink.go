@@ -0,0 +1,684 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package trafficcontrol
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// Filter priorities, lower is matched first.  Egress filters use the same
+// priorities as their ingress counterparts.
+const (
+	staticDenyPriority  = 8000
+	staticAllowPriority = 8500
+	macPriority         = 9000
+	allowAllPriority    = 9500
+	// Each allowed ethertype needs its own priority, as all filters of a
+	// priority match the same protocol
+	etherTypePriority    = 9900
+	maxEtherTypePriority = 9997
+	ipv6PortPriority     = 9998
+	ipv4PortPriority     = 9999
+	eapolPriority        = 10000
+	dropPriority         = 10001
+
+	// u32KeyMask masks the bucket and node of a u32 filter handle out of
+	// its hash table.  The root hash table has a single bucket.
+	u32KeyMask = 0xfffff
+	u32MaxNode = 0xfff
+
+	// allowAllHandle is the handle of the single allow-all rule
+	allowAllHandle = 1
+)
+
+// NetlinkTrafficController programs clsact ingress filters through netlink.
+type NetlinkTrafficController struct {
+	mutex sync.Mutex
+	// macHandles holds the u32 filter handle the kernel gave each MAC
+	// address rule per interface, so that a later rule for the same
+	// address replaces it.
+	// Handles are freed along with the rules.
+	macHandles map[string]map[string]uint32
+	// egressMacHandles holds the handles of the egress MAC address rules
+	egressMacHandles map[string]map[string]uint32
+	// etherTypes and egressEtherTypes hold the priority of each allowed
+	// ethertype per interface
+	etherTypes       map[string]map[uint16]uint16
+	egressEtherTypes map[string]map[uint16]uint16
+}
+
+func NewNetlinkTrafficController() *NetlinkTrafficController {
+	return &NetlinkTrafficController{
+		macHandles:       make(map[string]map[string]uint32),
+		egressMacHandles: make(map[string]map[string]uint32),
+		etherTypes:       make(map[string]map[uint16]uint16),
+		egressEtherTypes: make(map[string]map[uint16]uint16),
+	}
+}
+
+func (t *NetlinkTrafficController) Init(ifName string) error {
+	if err := t.Reset(ifName); err != nil {
+		return err
+	}
+	link, err := netlink.LinkByName(ifName)
+	if err != nil {
+		return err
+	}
+	err = netlink.QdiscAdd(&netlink.GenericQdisc{
+		QdiscAttrs: netlink.QdiscAttrs{
+			LinkIndex: link.Attrs().Index,
+			Handle:    netlink.MakeHandle(0xffff, 0),
+			Parent:    netlink.HANDLE_CLSACT,
+		},
+		QdiscType: "clsact",
+	})
+	if err != nil {
+		return fmt.Errorf("failed to add clsact qdisc to %s: %w", ifName, err)
+	}
+	return netlink.FilterAdd(&netlink.MatchAll{
+		FilterAttrs: ingressFilterAttrs(link, dropPriority, unix.ETH_P_ALL),
+		Actions:     gactActions(netlink.TC_ACT_SHOT),
+	})
+}
+
+func (t *NetlinkTrafficController) Reset(ifName string) error {
+	t.mutex.Lock()
+	delete(t.macHandles, ifName)
+	delete(t.egressMacHandles, ifName)
+	delete(t.etherTypes, ifName)
+	delete(t.egressEtherTypes, ifName)
+	t.mutex.Unlock()
+	link, err := netlink.LinkByName(ifName)
+	if err != nil {
+		return err
+	}
+	// Either qdisc may not exist, so failures to delete are ignored
+	netlink.QdiscDel(&netlink.Ingress{QdiscAttrs: netlink.QdiscAttrs{
+		LinkIndex: link.Attrs().Index,
+		Handle:    netlink.MakeHandle(0xffff, 0),
+		Parent:    netlink.HANDLE_INGRESS,
+	}})
+	netlink.QdiscDel(&netlink.GenericQdisc{
+		QdiscAttrs: netlink.QdiscAttrs{
+			LinkIndex: link.Attrs().Index,
+			Handle:    netlink.MakeHandle(0xffff, 0),
+			Parent:    netlink.HANDLE_CLSACT,
+		},
+		QdiscType: "clsact",
+	})
+	return nil
+}
+
+func (t *NetlinkTrafficController) AllowEAPOL(ifName string) error {
+	link, err := netlink.LinkByName(ifName)
+	if err != nil {
+		return err
+	}
+	return netlink.FilterAdd(&netlink.MatchAll{
+		FilterAttrs: ingressFilterAttrs(link, eapolPriority, unix.ETH_P_PAE),
+		Actions:     gactActions(netlink.TC_ACT_OK),
+	})
+}
+
+func (t *NetlinkTrafficController) AllowPort(ifName, protocol string, port int) error {
+	proto, err := ipProtocol(protocol)
+	if err != nil {
+		return err
+	}
+	link, err := netlink.LinkByName(ifName)
+	if err != nil {
+		return err
+	}
+	err = netlink.FilterAdd(&netlink.U32{
+		FilterAttrs: ingressFilterAttrs(link, ipv4PortPriority, unix.ETH_P_IP),
+		Sel:         u32Sel(portKeys(proto, port, false)...),
+		Actions:     gactActions(netlink.TC_ACT_OK),
+	})
+	if err != nil {
+		return err
+	}
+	return netlink.FilterAdd(&netlink.U32{
+		FilterAttrs: ingressFilterAttrs(link, ipv6PortPriority, unix.ETH_P_IPV6),
+		Sel:         u32Sel(portKeys(proto, port, true)...),
+		Actions:     gactActions(netlink.TC_ACT_OK),
+	})
+}
+
+func (t *NetlinkTrafficController) RemovePort(ifName, protocol string, port int) error {
+	proto, err := ipProtocol(protocol)
+	if err != nil {
+		return err
+	}
+	link, err := netlink.LinkByName(ifName)
+	if err != nil {
+		return err
+	}
+	err = deleteU32(link, netlink.HANDLE_MIN_INGRESS, ipv4PortPriority, unix.ETH_P_IP, portKeys(proto, port, false))
+	if err != nil {
+		return err
+	}
+	return deleteU32(link, netlink.HANDLE_MIN_INGRESS, ipv6PortPriority, unix.ETH_P_IPV6, portKeys(proto, port, true))
+}
+
+// portKeys matches the protocol and destination port of IPv4 or IPv6
+// traffic.  Both assume there are no IPv4 options or IPv6 extension headers,
+// like the "ip dport" and "ip6 dport" matches of tc.
+func portKeys(proto uint8, port int, ipv6 bool) []netlink.TcU32Key {
+	if ipv6 {
+		return []netlink.TcU32Key{
+			{Off: 4, Mask: 0x0000ff00, Val: uint32(proto) << 8},
+			{Off: 40, Mask: 0x0000ffff, Val: uint32(port)},
+		}
+	}
+	return []netlink.TcU32Key{
+		{Off: 8, Mask: 0x00ff0000, Val: uint32(proto) << 16},
+		{Off: 20, Mask: 0x0000ffff, Val: uint32(port)},
+	}
+}
+
+func (t *NetlinkTrafficController) AllowEtherType(ifName string, ethType uint16) error {
+	return t.allowEtherType(ifName, ethType, netlink.HANDLE_MIN_INGRESS, t.etherTypes)
+}
+
+func (t *NetlinkTrafficController) AllowIP(ifName string, rule IPRule) error {
+	return allowIP(ifName, rule, netlink.HANDLE_MIN_INGRESS)
+}
+
+func (t *NetlinkTrafficController) RemoveEtherType(ifName string, ethType uint16) error {
+	return t.removeEtherType(ifName, ethType, netlink.HANDLE_MIN_INGRESS, t.etherTypes)
+}
+
+func (t *NetlinkTrafficController) RemoveIP(ifName string, rule IPRule) error {
+	return removeIP(ifName, rule, netlink.HANDLE_MIN_INGRESS)
+}
+
+func (t *NetlinkTrafficController) InitEgress(ifName string) error {
+	link, err := netlink.LinkByName(ifName)
+	if err != nil {
+		return err
+	}
+	err = netlink.FilterAdd(&netlink.MatchAll{
+		FilterAttrs: filterAttrs(link, netlink.HANDLE_MIN_EGRESS, dropPriority, unix.ETH_P_ALL),
+		Actions:     gactActions(netlink.TC_ACT_SHOT),
+	})
+	if err != nil {
+		return err
+	}
+	return netlink.FilterAdd(&netlink.MatchAll{
+		FilterAttrs: filterAttrs(link, netlink.HANDLE_MIN_EGRESS, eapolPriority, unix.ETH_P_PAE),
+		Actions:     gactActions(netlink.TC_ACT_OK),
+	})
+}
+
+func (t *NetlinkTrafficController) AllowEgressEtherType(ifName string, ethType uint16) error {
+	return t.allowEtherType(ifName, ethType, netlink.HANDLE_MIN_EGRESS, t.egressEtherTypes)
+}
+
+func (t *NetlinkTrafficController) AllowEgressIP(ifName string, rule IPRule) error {
+	return allowIP(ifName, rule, netlink.HANDLE_MIN_EGRESS)
+}
+
+func (t *NetlinkTrafficController) RemoveEgressEtherType(ifName string, ethType uint16) error {
+	return t.removeEtherType(ifName, ethType, netlink.HANDLE_MIN_EGRESS, t.egressEtherTypes)
+}
+
+func (t *NetlinkTrafficController) RemoveEgressIP(ifName string, rule IPRule) error {
+	return removeIP(ifName, rule, netlink.HANDLE_MIN_EGRESS)
+}
+
+func (t *NetlinkTrafficController) AllowEgressMac(ifName string, mac net.HardwareAddr) error {
+	if len(mac) != 6 {
+		return fmt.Errorf("unsupported MAC address %s", mac)
+	}
+	link, err := netlink.LinkByName(ifName)
+	if err != nil {
+		return err
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return addMacRule(link, netlink.HANDLE_MIN_EGRESS, unix.ETH_P_ALL, dstMacSel(mac), t.egressMacHandles, ifName, mac.String())
+}
+
+// DenyEgressMac deletes the egress rule of a MAC address and frees its
+// handle.
+func (t *NetlinkTrafficController) DenyEgressMac(ifName string, mac net.HardwareAddr) error {
+	link, err := netlink.LinkByName(ifName)
+	if err != nil {
+		return err
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return deleteMacRule(link, netlink.HANDLE_MIN_EGRESS, unix.ETH_P_ALL, t.egressMacHandles, ifName, mac.String())
+}
+
+// allowEtherType adds a filter for an ethertype at the first priority no
+// other ethertype of the interface uses.
+func (t *NetlinkTrafficController) allowEtherType(ifName string, ethType uint16, parent uint32,
+	all map[string]map[uint16]uint16) error {
+	link, err := netlink.LinkByName(ifName)
+	if err != nil {
+		return err
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	priorities, ok := all[ifName]
+	if !ok {
+		priorities = make(map[uint16]uint16)
+		all[ifName] = priorities
+	}
+	used := make(map[uint16]bool, len(priorities))
+	for _, priority := range priorities {
+		used[priority] = true
+	}
+	priority := uint16(etherTypePriority)
+	for used[priority] {
+		priority++
+	}
+	if priority > maxEtherTypePriority {
+		return fmt.Errorf("too many ethertype rules on %s", ifName)
+	}
+	err = netlink.FilterAdd(&netlink.MatchAll{
+		FilterAttrs: filterAttrs(link, parent, priority, ethType),
+		Actions:     gactActions(netlink.TC_ACT_OK),
+	})
+	if err != nil {
+		return err
+	}
+	priorities[ethType] = priority
+	return nil
+}
+
+// removeEtherType deletes the priority holding the filter of an ethertype.
+func (t *NetlinkTrafficController) removeEtherType(ifName string, ethType uint16, parent uint32,
+	all map[string]map[uint16]uint16) error {
+	link, err := netlink.LinkByName(ifName)
+	if err != nil {
+		return err
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	priority, ok := all[ifName][ethType]
+	if !ok {
+		return nil
+	}
+	// Without a handle, the kernel deletes every filter of the priority
+	err = netlink.FilterDel(&netlink.MatchAll{FilterAttrs: filterAttrs(link, parent, priority, ethType)})
+	if err != nil && !errors.Is(err, unix.ENOENT) {
+		return err
+	}
+	delete(all[ifName], ethType)
+	return nil
+}
+
+// allowIP adds a u32 filter for each combination of destination port block
+// and ICMP type, sharing the priority of the unprotected port filters of the
+// same family.  Like those, the selectors assume there are no IPv4 options or
+// IPv6 extension headers.
+func allowIP(ifName string, rule IPRule, parent uint32) error {
+	link, err := netlink.LinkByName(ifName)
+	if err != nil {
+		return err
+	}
+	priority, protocol := uint16(ipv4PortPriority), uint16(unix.ETH_P_IP)
+	if rule.IPv6 {
+		priority, protocol = ipv6PortPriority, unix.ETH_P_IPV6
+	}
+	for _, keys := range ipRuleKeys(rule) {
+		err := netlink.FilterAdd(&netlink.U32{
+			FilterAttrs: filterAttrs(link, parent, priority, protocol),
+			Sel:         u32Sel(keys...),
+			Actions:     gactActions(netlink.TC_ACT_OK),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeIP deletes the filters allowIP added for a rule.
+func removeIP(ifName string, rule IPRule, parent uint32) error {
+	link, err := netlink.LinkByName(ifName)
+	if err != nil {
+		return err
+	}
+	priority, protocol := uint16(ipv4PortPriority), uint16(unix.ETH_P_IP)
+	if rule.IPv6 {
+		priority, protocol = ipv6PortPriority, unix.ETH_P_IPV6
+	}
+	for _, keys := range ipRuleKeys(rule) {
+		if err := deleteU32(link, parent, priority, protocol, keys); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteU32 deletes the u32 filters of a priority which match exactly the
+// given keys, as the kernel allocated their handles.
+func deleteU32(link netlink.Link, parent uint32, priority, protocol uint16, keys []netlink.TcU32Key) error {
+	filters, err := netlink.FilterList(link, parent)
+	if err != nil {
+		return err
+	}
+	for _, filter := range filters {
+		u32, ok := filter.(*netlink.U32)
+		if !ok || u32.Priority != priority || u32.Protocol != protocol || u32.Sel == nil ||
+			!sameU32Keys(u32.Sel.Keys, keys) {
+			continue
+		}
+		err := netlink.FilterDel(u32)
+		if err != nil && !errors.Is(err, unix.ENOENT) {
+			return err
+		}
+	}
+	return nil
+}
+
+func sameU32Keys(a, b []netlink.TcU32Key) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Off != b[i].Off || a[i].Mask != b[i].Mask || a[i].Val != b[i].Val {
+			return false
+		}
+	}
+	return true
+}
+
+// AllowMac matches the source MAC address with u32, replacing any earlier
+// rule for the same address.
+func (t *NetlinkTrafficController) AllowMac(ifName string, mac net.HardwareAddr, ethType uint16) error {
+	if len(mac) != 6 {
+		return fmt.Errorf("unsupported MAC address %s", mac)
+	}
+	link, err := netlink.LinkByName(ifName)
+	if err != nil {
+		return err
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return addMacRule(link, netlink.HANDLE_MIN_INGRESS, ethType, srcMacSel(mac), t.macHandles, ifName, mac.String())
+}
+
+// DenyMac deletes the rule of a MAC address and frees its handle, so that its
+// traffic falls through to the allow-all rule or the drop rule.
+func (t *NetlinkTrafficController) DenyMac(ifName string, mac net.HardwareAddr, ethType uint16) error {
+	link, err := netlink.LinkByName(ifName)
+	if err != nil {
+		return err
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return deleteMacRule(link, netlink.HANDLE_MIN_INGRESS, ethType, t.macHandles, ifName, mac.String())
+}
+
+func (t *NetlinkTrafficController) AllowAll(ifName string, allow bool) error {
+	link, err := netlink.LinkByName(ifName)
+	if err != nil {
+		return err
+	}
+	attrs := ingressFilterAttrs(link, allowAllPriority, unix.ETH_P_ALL)
+	attrs.Handle = allowAllHandle
+	filter := &netlink.MatchAll{FilterAttrs: attrs, Actions: gactActions(netlink.TC_ACT_OK)}
+	if allow {
+		return netlink.FilterReplace(filter)
+	}
+	err = netlink.FilterDel(filter)
+	if errors.Is(err, unix.ENOENT) {
+		return nil
+	}
+	return err
+}
+
+func (t *NetlinkTrafficController) AllowStaticMac(ifName string, mac net.HardwareAddr) error {
+	return addStaticMacRule(ifName, mac, staticAllowPriority, netlink.TC_ACT_OK)
+}
+
+func (t *NetlinkTrafficController) DenyStaticMac(ifName string, mac net.HardwareAddr) error {
+	return addStaticMacRule(ifName, mac, staticDenyPriority, netlink.TC_ACT_SHOT)
+}
+
+func (t *NetlinkTrafficController) RemoveStaticMac(ifName string, mac net.HardwareAddr) error {
+	if len(mac) != 6 {
+		return fmt.Errorf("unsupported MAC address %s", mac)
+	}
+	link, err := netlink.LinkByName(ifName)
+	if err != nil {
+		return err
+	}
+	for _, priority := range []uint16{staticDenyPriority, staticAllowPriority} {
+		err := deleteU32(link, netlink.HANDLE_MIN_INGRESS, priority, unix.ETH_P_ALL, srcMacSel(mac).Keys)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addStaticMacRule adds a rule for a source MAC address, letting the kernel
+// allocate its handle as static rules are never replaced.
+func addStaticMacRule(ifName string, mac net.HardwareAddr, priority uint16, action netlink.TcAct) error {
+	if len(mac) != 6 {
+		return fmt.Errorf("unsupported MAC address %s", mac)
+	}
+	link, err := netlink.LinkByName(ifName)
+	if err != nil {
+		return err
+	}
+	return netlink.FilterAdd(&netlink.U32{
+		FilterAttrs: ingressFilterAttrs(link, priority, unix.ETH_P_ALL),
+		Sel:         srcMacSel(mac),
+		Actions:     gactActions(action),
+	})
+}
+
+// addMacRule adds the rule of a MAC address, or replaces its earlier rule.
+// The kernel gives the u32 filters of each priority their own root hash
+// table, numbered in creation order, so a new rule is only given a node, and
+// its full handle is read back once the kernel added it to the table of the
+// MAC address priority.
+func addMacRule(link netlink.Link, parent uint32, ethType uint16, sel *netlink.TcU32Sel, all map[string]map[string]uint32, ifName, mac string) error {
+	handles, ok := all[ifName]
+	if !ok {
+		handles = make(map[string]uint32)
+		all[ifName] = handles
+	}
+	attrs := filterAttrs(link, parent, macPriority, ethType)
+	filter := &netlink.U32{FilterAttrs: attrs, Sel: sel, Actions: gactActions(netlink.TC_ACT_OK)}
+	if handle, ok := handles[mac]; ok {
+		filter.Handle = handle
+		return netlink.FilterReplace(filter)
+	}
+	node, err := freeMacNode(handles, ifName)
+	if err != nil {
+		return err
+	}
+	filter.Handle = node
+	err = netlink.FilterAdd(filter)
+	if err != nil {
+		return err
+	}
+	handle, err := macRuleHandle(link, parent, node)
+	if err != nil {
+		return err
+	}
+	handles[mac] = handle
+	return nil
+}
+
+// macRuleHandle returns the full handle of the MAC address rule at a node.
+func macRuleHandle(link netlink.Link, parent, node uint32) (uint32, error) {
+	filters, err := netlink.FilterList(link, parent)
+	if err != nil {
+		return 0, err
+	}
+	for _, filter := range filters {
+		attrs := filter.Attrs()
+		if _, ok := filter.(*netlink.U32); ok && attrs.Priority == macPriority && attrs.Handle&u32KeyMask == node {
+			return attrs.Handle, nil
+		}
+	}
+	return 0, fmt.Errorf("MAC address rule %x not found on %s", node, link.Attrs().Name)
+}
+
+// deleteMacRule deletes the rule of a MAC address and frees its handle.
+func deleteMacRule(link netlink.Link, parent uint32, ethType uint16, all map[string]map[string]uint32, ifName, mac string) error {
+	handle, ok := all[ifName][mac]
+	if !ok {
+		return nil
+	}
+	attrs := filterAttrs(link, parent, macPriority, ethType)
+	attrs.Handle = handle
+	err := netlink.FilterDel(&netlink.U32{FilterAttrs: attrs})
+	if err != nil && !errors.Is(err, unix.ENOENT) {
+		return err
+	}
+	delete(all[ifName], mac)
+	return nil
+}
+
+// dstMacSel matches the destination MAC address, at the same negative
+// offsets from the network header as tc's "ether dst" match.
+func dstMacSel(mac net.HardwareAddr) *netlink.TcU32Sel {
+	return u32Sel(
+		netlink.TcU32Key{Off: -16, Mask: 0x0000ffff, Val: uint32(mac[0])<<8 | uint32(mac[1])},
+		netlink.TcU32Key{Off: -12, Mask: 0xffffffff,
+			Val: uint32(mac[2])<<24 | uint32(mac[3])<<16 | uint32(mac[4])<<8 | uint32(mac[5])},
+	)
+}
+
+// srcMacSel matches the source MAC address at the same negative offsets from
+// the network header as tc's "ether src" match.
+func srcMacSel(mac net.HardwareAddr) *netlink.TcU32Sel {
+	return u32Sel(
+		netlink.TcU32Key{Off: -8, Mask: 0xffffffff,
+			Val: uint32(mac[0])<<24 | uint32(mac[1])<<16 | uint32(mac[2])<<8 | uint32(mac[3])},
+		netlink.TcU32Key{Off: -4, Mask: 0xffff0000,
+			Val: uint32(mac[4])<<24 | uint32(mac[5])<<16},
+	)
+}
+
+// freeMacNode returns the lowest node of the root hash table which no MAC
+// address rule of an interface uses.
+func freeMacNode(handles map[string]uint32, ifName string) (uint32, error) {
+	used := make(map[uint32]bool, len(handles))
+	for _, handle := range handles {
+		used[handle&u32KeyMask] = true
+	}
+	node := uint32(1)
+	for used[node] {
+		node++
+	}
+	if node > u32MaxNode {
+		return 0, fmt.Errorf("too many MAC address rules on %s", ifName)
+	}
+	return node, nil
+}
+
+// ipRuleKeys returns the u32 keys of each filter needed for an IP rule.
+func ipRuleKeys(rule IPRule) [][]netlink.TcU32Key {
+	var keys []netlink.TcU32Key
+	protoKey, srcOff, dstOff, l4Off := netlink.TcU32Key{Off: 8, Mask: 0x00ff0000, Val: uint32(rule.Protocol) << 16}, 12, 16, 20
+	if rule.IPv6 {
+		protoKey, srcOff, dstOff, l4Off = netlink.TcU32Key{Off: 4, Mask: 0x0000ff00, Val: uint32(rule.Protocol) << 8}, 8, 24, 40
+	}
+	if rule.Protocol != 0 {
+		keys = append(keys, protoKey)
+	}
+	keys = append(keys, prefixKeys(rule.SrcNet, srcOff)...)
+	keys = append(keys, prefixKeys(rule.DstNet, dstOff)...)
+	var l4Keys []netlink.TcU32Key
+	for _, r := range rule.Ports {
+		for _, block := range portBlocks(r) {
+			l4Keys = append(l4Keys, netlink.TcU32Key{Off: int32(l4Off), Mask: uint32(block[1]), Val: uint32(block[0])})
+		}
+	}
+	for _, icmpType := range rule.ICMPTypes {
+		l4Keys = append(l4Keys, netlink.TcU32Key{Off: int32(l4Off), Mask: 0xff000000, Val: uint32(icmpType) << 24})
+	}
+	if len(l4Keys) == 0 {
+		if len(keys) == 0 {
+			// u32 needs at least one key, so match any version
+			keys = append(keys, netlink.TcU32Key{})
+		}
+		return [][]netlink.TcU32Key{keys}
+	}
+	var filters [][]netlink.TcU32Key
+	for _, l4Key := range l4Keys {
+		filters = append(filters, append(append([]netlink.TcU32Key{}, keys...), l4Key))
+	}
+	return filters
+}
+
+// prefixKeys matches an address prefix at an offset, one 32-bit word at a
+// time.
+func prefixKeys(ipNet *net.IPNet, off int) []netlink.TcU32Key {
+	if ipNet == nil {
+		return nil
+	}
+	ip := ipNet.IP.To4()
+	if ip == nil {
+		ip = ipNet.IP.To16()
+	}
+	var keys []netlink.TcU32Key
+	for i := 0; i+4 <= len(ip) && i+4 <= len(ipNet.Mask); i += 4 {
+		mask := binary.BigEndian.Uint32(ipNet.Mask[i : i+4])
+		if mask == 0 {
+			break
+		}
+		keys = append(keys, netlink.TcU32Key{Off: int32(off + i), Mask: mask, Val: binary.BigEndian.Uint32(ip[i:i+4]) & mask})
+	}
+	return keys
+}
+
+func ingressFilterAttrs(link netlink.Link, priority, protocol uint16) netlink.FilterAttrs {
+	return filterAttrs(link, netlink.HANDLE_MIN_INGRESS, priority, protocol)
+}
+
+func filterAttrs(link netlink.Link, parent uint32, priority, protocol uint16) netlink.FilterAttrs {
+	return netlink.FilterAttrs{
+		LinkIndex: link.Attrs().Index,
+		Parent:    parent,
+		Priority:  priority,
+		Protocol:  protocol,
+	}
+}
+
+func u32Sel(keys ...netlink.TcU32Key) *netlink.TcU32Sel {
+	return &netlink.TcU32Sel{
+		Flags: netlink.TC_U32_TERMINAL,
+		Nkeys: uint8(len(keys)),
+		Keys:  keys,
+	}
+}
+
+// gactActions returns a gact action with no index, so that the kernel
+// allocates one per rule.  gact indexes are shared by all interfaces in the
+// network namespace, so a fixed index would bind unrelated rules to the same
+// action instance.
+func gactActions(action netlink.TcAct) []netlink.Action {
+	return []netlink.Action{&netlink.GenericAction{ActionAttrs: netlink.ActionAttrs{Action: action}}}
+}
@@ -0,0 +1,85 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package trafficcontrol
+
+import (
+	"net"
+	"runtime"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
+	"golang.org/x/sys/unix"
+)
+
+var _ = Describe("NetlinkTrafficController", func() {
+	// macRules returns the handles of the MAC address rules of lo
+	macRules := func() []uint32 {
+		link, err := netlink.LinkByName("lo")
+		Expect(err).NotTo(HaveOccurred())
+		filters, err := netlink.FilterList(link, netlink.HANDLE_MIN_INGRESS)
+		Expect(err).NotTo(HaveOccurred())
+		var handles []uint32
+		for _, filter := range filters {
+			if filter.Attrs().Priority == macPriority && filter.Attrs().Handle&u32KeyMask != 0 {
+				handles = append(handles, filter.Attrs().Handle)
+			}
+		}
+		return handles
+	}
+	It("allows MAC addresses once unprotected ports are allowed", func() {
+		// The filters are programmed in a network namespace of their own,
+		// which the locked thread runs in
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
+		origin, err := netns.Get()
+		Expect(err).NotTo(HaveOccurred())
+		defer origin.Close()
+		ns, err := netns.New()
+		if err != nil {
+			Skip("cannot create a network namespace: " + err.Error())
+		}
+		defer ns.Close()
+		defer netns.Set(origin)
+		lo, err := netlink.LinkByName("lo")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(netlink.LinkSetUp(lo)).To(Succeed())
+
+		tc := NewNetlinkTrafficController()
+		if err := tc.Init("lo"); err != nil {
+			Skip("cannot program tc filters: " + err.Error())
+		}
+		// The port filters take the first root hash table
+		Expect(tc.AllowPort("lo", "tcp", 22)).To(Succeed())
+		mac := net.HardwareAddr{0x6e, 0x16, 0x06, 0x0e, 0xb7, 0xe2}
+		Expect(tc.AllowMac("lo", mac, unix.ETH_P_ALL)).To(Succeed())
+		handles := macRules()
+		Expect(handles).To(HaveLen(1))
+		Expect(handles[0] & u32KeyMask).To(Equal(uint32(1)))
+
+		By("replacing the rule of the same address")
+		Expect(tc.AllowMac("lo", mac, unix.ETH_P_ALL)).To(Succeed())
+		Expect(macRules()).To(Equal(handles))
+
+		By("deleting the rule and allowing the address again")
+		Expect(tc.DenyMac("lo", mac, unix.ETH_P_ALL)).To(Succeed())
+		Expect(macRules()).To(BeEmpty())
+		Expect(tc.AllowMac("lo", mac, unix.ETH_P_ALL)).To(Succeed())
+		Expect(macRules()).To(HaveLen(1))
+	})
+})
@@ -0,0 +1,483 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package trafficcontrol
+
+import (
+	"fmt"
+	"net"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// nftTable is the netdev family table holding the ingress chain and MAC
+// address sets of every protected interface.
+const nftTable = "netdev eapol"
+
+// NftablesTrafficController enforces authentication with an nftables netdev
+// ingress chain per interface, which drops everything but EAPOL, unprotected
+// ports and traffic from the addresses in the interface's sets of
+// authenticated MAC addresses.  Statically denied and allowed addresses are
+// matched first, in that order.  Chains and sets are named by interface index,
+// as interface names are not valid nftables identifiers.
+//
+// With egress control, an egress chain per interface drops everything but
+// EAPOL, the egress exceptions and traffic to its set of authenticated peers.
+// The egress hook needs Linux 5.16 or later.
+//
+// Rules are removed by flushing their chain and adding back the fixed rules
+// and the remaining rules in the same transaction, so that traffic the other
+// rules allow is never dropped in between.
+type NftablesTrafficController struct {
+	run       func(script string) error
+	linkIndex func(ifName string) (int, error)
+	mutex     sync.Mutex
+	// rules holds the rules added to each chain after its fixed rules
+	rules map[string][]string
+}
+
+func NewNftablesTrafficController() *NftablesTrafficController {
+	return &NftablesTrafficController{run: runNft, linkIndex: linkIndexByName}
+}
+
+func (t *NftablesTrafficController) Init(ifName string) error {
+	index, err := t.index(ifName)
+	if err != nil {
+		return err
+	}
+	script := resetNftScript(ifName, index) + strings.Join(append([]string{
+		fmt.Sprintf("add set %s allowed_%d { type ether_addr; }", nftTable, index),
+		fmt.Sprintf("add set %s macsec_%d { type ether_addr; }", nftTable, index),
+		fmt.Sprintf("add set %s static_denied_%d { type ether_addr; }", nftTable, index),
+		fmt.Sprintf("add set %s static_allowed_%d { type ether_addr; }", nftTable, index),
+		fmt.Sprintf("add chain %s ingress_%d { type filter hook ingress device \"%s\" priority 0; policy drop; }",
+			nftTable, index, ifName),
+	}, ingressNftRules(index)...), "\n") + "\n"
+	if err := t.run(script); err != nil {
+		return err
+	}
+	t.setRules(ingressChain(index), nil)
+	return nil
+}
+
+// ingressNftRules returns the fixed rules of an ingress chain.
+func ingressNftRules(index int) []string {
+	return []string{
+		fmt.Sprintf("add rule %s ingress_%d ether saddr @static_denied_%d drop", nftTable, index, index),
+		fmt.Sprintf("add rule %s ingress_%d ether saddr @static_allowed_%d accept", nftTable, index, index),
+		fmt.Sprintf("add rule %s ingress_%d ether saddr @allowed_%d accept", nftTable, index, index),
+		fmt.Sprintf("add rule %s ingress_%d ether type 0x%04x ether saddr @macsec_%d accept",
+			nftTable, index, unix.ETH_P_MACSEC, index),
+	}
+}
+
+// egressNftRules returns the fixed rules of an egress chain.
+func egressNftRules(index int) []string {
+	return []string{
+		fmt.Sprintf("add rule %s egress_%d ether daddr @egress_allowed_%d accept", nftTable, index, index),
+		fmt.Sprintf("add rule %s egress_%d ether type 0x%04x accept", nftTable, index, unix.ETH_P_PAE),
+	}
+}
+
+func (t *NftablesTrafficController) Reset(ifName string) error {
+	index, err := t.index(ifName)
+	if err != nil {
+		return err
+	}
+	if err := t.run(resetNftScript(ifName, index)); err != nil {
+		return err
+	}
+	// Kernels without the egress hook fail to reset it, and never had an
+	// egress chain to remove, so this is done separately and errors ignored.
+	t.run(resetEgressNftScript(ifName, index))
+	t.mutex.Lock()
+	delete(t.rules, ingressChain(index))
+	delete(t.rules, egressChain(index))
+	t.mutex.Unlock()
+	return nil
+}
+
+func (t *NftablesTrafficController) AllowEAPOL(ifName string) error {
+	index, err := t.index(ifName)
+	if err != nil {
+		return err
+	}
+	return t.addRule(ingressChain(index), fmt.Sprintf("ether type 0x%04x accept", unix.ETH_P_PAE))
+}
+
+func (t *NftablesTrafficController) AllowPort(ifName, protocol string, port int) error {
+	if _, err := ipProtocol(protocol); err != nil {
+		return err
+	}
+	index, err := t.index(ifName)
+	if err != nil {
+		return err
+	}
+	// Matches both IPv4 and IPv6
+	return t.addRule(ingressChain(index), fmt.Sprintf("%s dport %d accept", protocol, port))
+}
+
+func (t *NftablesTrafficController) AllowEtherType(ifName string, ethType uint16) error {
+	index, err := t.index(ifName)
+	if err != nil {
+		return err
+	}
+	return t.addRule(ingressChain(index), fmt.Sprintf("ether type 0x%04x accept", ethType))
+}
+
+func (t *NftablesTrafficController) AllowIP(ifName string, rule IPRule) error {
+	index, err := t.index(ifName)
+	if err != nil {
+		return err
+	}
+	return t.addRule(ingressChain(index), ipRuleExpr(rule)+" accept")
+}
+
+func (t *NftablesTrafficController) RemovePort(ifName, protocol string, port int) error {
+	if _, err := ipProtocol(protocol); err != nil {
+		return err
+	}
+	index, err := t.index(ifName)
+	if err != nil {
+		return err
+	}
+	return t.removeRule(ingressChain(index), fmt.Sprintf("%s dport %d accept", protocol, port), ingressNftRules(index))
+}
+
+func (t *NftablesTrafficController) RemoveEtherType(ifName string, ethType uint16) error {
+	index, err := t.index(ifName)
+	if err != nil {
+		return err
+	}
+	return t.removeRule(ingressChain(index), fmt.Sprintf("ether type 0x%04x accept", ethType), ingressNftRules(index))
+}
+
+func (t *NftablesTrafficController) RemoveIP(ifName string, rule IPRule) error {
+	index, err := t.index(ifName)
+	if err != nil {
+		return err
+	}
+	return t.removeRule(ingressChain(index), ipRuleExpr(rule)+" accept", ingressNftRules(index))
+}
+
+func (t *NftablesTrafficController) InitEgress(ifName string) error {
+	index, err := t.index(ifName)
+	if err != nil {
+		return err
+	}
+	script := resetEgressNftScript(ifName, index) + strings.Join(append([]string{
+		fmt.Sprintf("add set %s egress_allowed_%d { type ether_addr; }", nftTable, index),
+		fmt.Sprintf("add chain %s egress_%d { type filter hook egress device \"%s\" priority 0; policy drop; }",
+			nftTable, index, ifName),
+	}, egressNftRules(index)...), "\n") + "\n"
+	if err := t.run(script); err != nil {
+		return err
+	}
+	t.setRules(egressChain(index), nil)
+	return nil
+}
+
+func (t *NftablesTrafficController) AllowEgressEtherType(ifName string, ethType uint16) error {
+	index, err := t.index(ifName)
+	if err != nil {
+		return err
+	}
+	return t.addRule(egressChain(index), fmt.Sprintf("ether type 0x%04x accept", ethType))
+}
+
+func (t *NftablesTrafficController) AllowEgressIP(ifName string, rule IPRule) error {
+	index, err := t.index(ifName)
+	if err != nil {
+		return err
+	}
+	return t.addRule(egressChain(index), ipRuleExpr(rule)+" accept")
+}
+
+func (t *NftablesTrafficController) RemoveEgressEtherType(ifName string, ethType uint16) error {
+	index, err := t.index(ifName)
+	if err != nil {
+		return err
+	}
+	return t.removeRule(egressChain(index), fmt.Sprintf("ether type 0x%04x accept", ethType), egressNftRules(index))
+}
+
+func (t *NftablesTrafficController) RemoveEgressIP(ifName string, rule IPRule) error {
+	index, err := t.index(ifName)
+	if err != nil {
+		return err
+	}
+	return t.removeRule(egressChain(index), ipRuleExpr(rule)+" accept", egressNftRules(index))
+}
+
+func (t *NftablesTrafficController) AllowEgressMac(ifName string, mac net.HardwareAddr) error {
+	index, err := t.index(ifName)
+	if err != nil {
+		return err
+	}
+	return t.run(fmt.Sprintf("add element %s egress_allowed_%d { %s }\n", nftTable, index, mac))
+}
+
+func (t *NftablesTrafficController) DenyEgressMac(ifName string, mac net.HardwareAddr) error {
+	index, err := t.index(ifName)
+	if err != nil {
+		return err
+	}
+	return t.run(fmt.Sprintf("add element %s egress_allowed_%d { %s }\ndelete element %s egress_allowed_%d { %s }\n",
+		nftTable, index, mac, nftTable, index, mac))
+}
+
+func (t *NftablesTrafficController) AllowMac(ifName string, mac net.HardwareAddr, ethType uint16) error {
+	set, err := t.macSet(ifName, ethType)
+	if err != nil {
+		return err
+	}
+	return t.run(fmt.Sprintf("add element %s %s { %s }\n", nftTable, set, mac))
+}
+
+// DenyMac removes the address from the set, so that its traffic falls
+// through to the chain's drop policy.
+func (t *NftablesTrafficController) DenyMac(ifName string, mac net.HardwareAddr, ethType uint16) error {
+	set, err := t.macSet(ifName, ethType)
+	if err != nil {
+		return err
+	}
+	// Deleting an element that is not in the set fails, so add it first
+	// within the same transaction.
+	return t.run(fmt.Sprintf("add element %s %s { %s }\ndelete element %s %s { %s }\n",
+		nftTable, set, mac, nftTable, set, mac))
+}
+
+func (t *NftablesTrafficController) AllowStaticMac(ifName string, mac net.HardwareAddr) error {
+	index, err := t.index(ifName)
+	if err != nil {
+		return err
+	}
+	return t.run(fmt.Sprintf("add element %s static_allowed_%d { %s }\n", nftTable, index, mac))
+}
+
+func (t *NftablesTrafficController) DenyStaticMac(ifName string, mac net.HardwareAddr) error {
+	index, err := t.index(ifName)
+	if err != nil {
+		return err
+	}
+	return t.run(fmt.Sprintf("add element %s static_denied_%d { %s }\n", nftTable, index, mac))
+}
+
+// RemoveStaticMac removes the address from both static sets, adding it
+// first as DenyMac does.
+func (t *NftablesTrafficController) RemoveStaticMac(ifName string, mac net.HardwareAddr) error {
+	index, err := t.index(ifName)
+	if err != nil {
+		return err
+	}
+	var script strings.Builder
+	for _, set := range []string{"static_denied", "static_allowed"} {
+		fmt.Fprintf(&script, "add element %s %s_%d { %s }\ndelete element %s %s_%d { %s }\n",
+			nftTable, set, index, mac, nftTable, set, index, mac)
+	}
+	return t.run(script.String())
+}
+
+// AllowAll switches the policy of the interface chain, leaving its sets in
+// place for when it is switched back.
+func (t *NftablesTrafficController) AllowAll(ifName string, allow bool) error {
+	index, err := t.index(ifName)
+	if err != nil {
+		return err
+	}
+	policy := "drop"
+	if allow {
+		policy = "accept"
+	}
+	return t.run(fmt.Sprintf("add chain %s ingress_%d { type filter hook ingress device \"%s\" priority 0; policy %s; }\n",
+		nftTable, index, ifName, policy))
+}
+
+// addRule appends a rule to a chain.
+func (t *NftablesTrafficController) addRule(chain, rule string) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if err := t.run(fmt.Sprintf("add rule %s %s %s\n", nftTable, chain, rule)); err != nil {
+		return err
+	}
+	if t.rules == nil {
+		t.rules = make(map[string][]string)
+	}
+	t.rules[chain] = append(t.rules[chain], rule)
+	return nil
+}
+
+// removeRule rebuilds a chain from its fixed rules and its added rules but
+// the removed one.
+func (t *NftablesTrafficController) removeRule(chain, rule string, fixed []string) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	var remaining []string
+	found := false
+	for _, added := range t.rules[chain] {
+		if added == rule && !found {
+			found = true
+			continue
+		}
+		remaining = append(remaining, added)
+	}
+	if !found {
+		return nil
+	}
+	lines := append([]string{fmt.Sprintf("flush chain %s %s", nftTable, chain)}, fixed...)
+	for _, added := range remaining {
+		lines = append(lines, fmt.Sprintf("add rule %s %s %s", nftTable, chain, added))
+	}
+	if err := t.run(strings.Join(lines, "\n") + "\n"); err != nil {
+		return err
+	}
+	t.rules[chain] = remaining
+	return nil
+}
+
+func (t *NftablesTrafficController) setRules(chain string, rules []string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.rules == nil {
+		t.rules = make(map[string][]string)
+	}
+	t.rules[chain] = rules
+}
+
+func ingressChain(index int) string {
+	return fmt.Sprintf("ingress_%d", index)
+}
+
+func egressChain(index int) string {
+	return fmt.Sprintf("egress_%d", index)
+}
+
+// index resolves the interface index, refusing names which cannot be quoted
+// in an nft script.
+func (t *NftablesTrafficController) index(ifName string) (int, error) {
+	if strings.ContainsAny(ifName, "\"\\") {
+		return 0, fmt.Errorf("unsupported interface name %q", ifName)
+	}
+	return t.linkIndex(ifName)
+}
+
+func (t *NftablesTrafficController) macSet(ifName string, ethType uint16) (string, error) {
+	index, err := t.index(ifName)
+	if err != nil {
+		return "", err
+	}
+	switch ethType {
+	case unix.ETH_P_ALL:
+		return fmt.Sprintf("allowed_%d", index), nil
+	case unix.ETH_P_MACSEC:
+		return fmt.Sprintf("macsec_%d", index), nil
+	}
+	return "", fmt.Errorf("unsupported ethertype 0x%04x", ethType)
+}
+
+// ipRuleExpr returns the nft match expression of an IP rule.
+func ipRuleExpr(rule IPRule) string {
+	family, icmp := "ip", "icmp"
+	if rule.IPv6 {
+		family, icmp = "ip6", "icmpv6"
+	}
+	exprs := []string{"meta protocol " + family}
+	if rule.SrcNet != nil {
+		exprs = append(exprs, fmt.Sprintf("%s saddr %s", family, rule.SrcNet))
+	}
+	if rule.DstNet != nil {
+		exprs = append(exprs, fmt.Sprintf("%s daddr %s", family, rule.DstNet))
+	}
+	if rule.Protocol != 0 {
+		exprs = append(exprs, fmt.Sprintf("meta l4proto %d", rule.Protocol))
+	}
+	if len(rule.Ports) > 0 {
+		var ports []string
+		for _, r := range rule.Ports {
+			if r.Start == r.End {
+				ports = append(ports, fmt.Sprintf("%d", r.Start))
+			} else {
+				ports = append(ports, fmt.Sprintf("%d-%d", r.Start, r.End))
+			}
+		}
+		exprs = append(exprs, fmt.Sprintf("th dport { %s }", strings.Join(ports, ", ")))
+	}
+	if len(rule.ICMPTypes) > 0 {
+		var types []string
+		for _, icmpType := range rule.ICMPTypes {
+			types = append(types, fmt.Sprintf("%d", icmpType))
+		}
+		exprs = append(exprs, fmt.Sprintf("%s type { %s }", icmp, strings.Join(types, ", ")))
+	}
+	return strings.Join(exprs, " ")
+}
+
+// resetNftScript removes the chain and sets of an interface.  Deleting an
+// object that does not exist fails, so each one is added before it is
+// deleted, all in one transaction.
+func resetNftScript(ifName string, index int) string {
+	return strings.Join([]string{
+		fmt.Sprintf("add table %s", nftTable),
+		fmt.Sprintf("add chain %s ingress_%d { type filter hook ingress device \"%s\" priority 0; }",
+			nftTable, index, ifName),
+		fmt.Sprintf("flush chain %s ingress_%d", nftTable, index),
+		fmt.Sprintf("delete chain %s ingress_%d", nftTable, index),
+		fmt.Sprintf("add set %s allowed_%d { type ether_addr; }", nftTable, index),
+		fmt.Sprintf("delete set %s allowed_%d", nftTable, index),
+		fmt.Sprintf("add set %s macsec_%d { type ether_addr; }", nftTable, index),
+		fmt.Sprintf("delete set %s macsec_%d", nftTable, index),
+		fmt.Sprintf("add set %s static_denied_%d { type ether_addr; }", nftTable, index),
+		fmt.Sprintf("delete set %s static_denied_%d", nftTable, index),
+		fmt.Sprintf("add set %s static_allowed_%d { type ether_addr; }", nftTable, index),
+		fmt.Sprintf("delete set %s static_allowed_%d", nftTable, index),
+	}, "\n") + "\n"
+}
+
+// resetEgressNftScript removes the egress chain and set of an interface, the
+// same way as resetNftScript.
+func resetEgressNftScript(ifName string, index int) string {
+	return strings.Join([]string{
+		fmt.Sprintf("add table %s", nftTable),
+		fmt.Sprintf("add chain %s egress_%d { type filter hook egress device \"%s\" priority 0; }",
+			nftTable, index, ifName),
+		fmt.Sprintf("flush chain %s egress_%d", nftTable, index),
+		fmt.Sprintf("delete chain %s egress_%d", nftTable, index),
+		fmt.Sprintf("add set %s egress_allowed_%d { type ether_addr; }", nftTable, index),
+		fmt.Sprintf("delete set %s egress_allowed_%d", nftTable, index),
+	}, "\n") + "\n"
+}
+
+func runNft(script string) error {
+	cmd := exec.Command("nft", "-f", "-")
+	cmd.Stdin = strings.NewReader(script)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("nft failed: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func linkIndexByName(ifName string) (int, error) {
+	link, err := netlink.LinkByName(ifName)
+	if err != nil {
+		return 0, err
+	}
+	return link.Attrs().Index, nil
+}
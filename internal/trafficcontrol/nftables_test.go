@@ -0,0 +1,183 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package trafficcontrol
+
+import (
+	"fmt"
+	"net"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"golang.org/x/sys/unix"
+)
+
+var _ = Describe("nftables", func() {
+	var (
+		nft     *NftablesTrafficController
+		scripts []string
+		mac     net.HardwareAddr
+	)
+	BeforeEach(func() {
+		scripts = nil
+		nft = &NftablesTrafficController{
+			run: func(script string) error {
+				scripts = append(scripts, script)
+				return nil
+			},
+			linkIndex: func(ifName string) (int, error) {
+				if ifName != pfName {
+					return 0, fmt.Errorf("link %s not found", ifName)
+				}
+				return 7, nil
+			},
+		}
+		var err error
+		mac, err = net.ParseMAC("6e:16:06:0e:b7:e2")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("replaces the interface chain with a drop policy chain", func() {
+		Expect(nft.Init(pfName)).To(Succeed())
+		Expect(scripts).To(HaveLen(1))
+		Expect(scripts[0]).To(ContainSubstring("flush chain netdev eapol ingress_7\ndelete chain netdev eapol ingress_7\n"))
+		Expect(scripts[0]).To(ContainSubstring(
+			"add chain netdev eapol ingress_7 { type filter hook ingress device \"enp175s0f1\" priority 0; policy drop; }\n"))
+		Expect(scripts[0]).To(ContainSubstring("add rule netdev eapol ingress_7 ether saddr @allowed_7 accept\n"))
+		Expect(scripts[0]).To(ContainSubstring("add rule netdev eapol ingress_7 ether type 0x88e5 ether saddr @macsec_7 accept\n"))
+		// Static rules are matched ahead of the authenticated addresses
+		Expect(scripts[0]).To(ContainSubstring("add rule netdev eapol ingress_7 ether saddr @static_denied_7 drop\n" +
+			"add rule netdev eapol ingress_7 ether saddr @static_allowed_7 accept\n" +
+			"add rule netdev eapol ingress_7 ether saddr @allowed_7 accept\n"))
+	})
+
+	It("allows ethertypes and IP traffic", func() {
+		_, srcNet, _ := net.ParseCIDR("192.0.2.0/24")
+		Expect(nft.AllowEtherType(pfName, 0x88f7)).To(Succeed())
+		Expect(nft.AllowIP(pfName, IPRule{Protocol: unix.IPPROTO_UDP, SrcNet: srcNet,
+			Ports: []PortRange{{67, 67}, {33434, 33534}}})).To(Succeed())
+		Expect(nft.AllowIP(pfName, IPRule{IPv6: true, Protocol: unix.IPPROTO_ICMPV6,
+			ICMPTypes: []uint8{135, 136}})).To(Succeed())
+		Expect(scripts).To(Equal([]string{
+			"add rule netdev eapol ingress_7 ether type 0x88f7 accept\n",
+			"add rule netdev eapol ingress_7 meta protocol ip ip saddr 192.0.2.0/24 meta l4proto 17 th dport { 67, 33434-33534 } accept\n",
+			"add rule netdev eapol ingress_7 meta protocol ip6 meta l4proto 58 icmpv6 type { 135, 136 } accept\n",
+		}))
+	})
+
+	It("replaces the egress chain and opens it per peer", func() {
+		Expect(nft.InitEgress(pfName)).To(Succeed())
+		Expect(nft.AllowEgressEtherType(pfName, 0x88cc)).To(Succeed())
+		Expect(nft.AllowEgressMac(pfName, mac)).To(Succeed())
+		Expect(nft.DenyEgressMac(pfName, mac)).To(Succeed())
+		Expect(scripts).To(HaveLen(4))
+		Expect(scripts[0]).To(ContainSubstring("flush chain netdev eapol egress_7\ndelete chain netdev eapol egress_7\n"))
+		Expect(scripts[0]).To(ContainSubstring(
+			"add chain netdev eapol egress_7 { type filter hook egress device \"enp175s0f1\" priority 0; policy drop; }\n" +
+				"add rule netdev eapol egress_7 ether daddr @egress_allowed_7 accept\n" +
+				"add rule netdev eapol egress_7 ether type 0x888e accept\n"))
+		Expect(scripts[1:]).To(Equal([]string{
+			"add rule netdev eapol egress_7 ether type 0x88cc accept\n",
+			"add element netdev eapol egress_allowed_7 { 6e:16:06:0e:b7:e2 }\n",
+			"add element netdev eapol egress_allowed_7 { 6e:16:06:0e:b7:e2 }\n" +
+				"delete element netdev eapol egress_allowed_7 { 6e:16:06:0e:b7:e2 }\n",
+		}))
+	})
+
+	It("removes a rule by rebuilding its chain", func() {
+		Expect(nft.Init(pfName)).To(Succeed())
+		Expect(nft.AllowEAPOL(pfName)).To(Succeed())
+		Expect(nft.AllowPort(pfName, tcpProtoStr, 80)).To(Succeed())
+		Expect(nft.AllowPort(pfName, tcpProtoStr, 443)).To(Succeed())
+		scripts = nil
+		Expect(nft.RemovePort(pfName, tcpProtoStr, 80)).To(Succeed())
+		// Removing a rule which is not there is a no-op
+		Expect(nft.RemoveEtherType(pfName, 0x88f7)).To(Succeed())
+		Expect(scripts).To(Equal([]string{
+			"flush chain netdev eapol ingress_7\n" +
+				"add rule netdev eapol ingress_7 ether saddr @static_denied_7 drop\n" +
+				"add rule netdev eapol ingress_7 ether saddr @static_allowed_7 accept\n" +
+				"add rule netdev eapol ingress_7 ether saddr @allowed_7 accept\n" +
+				"add rule netdev eapol ingress_7 ether type 0x88e5 ether saddr @macsec_7 accept\n" +
+				"add rule netdev eapol ingress_7 ether type 0x888e accept\n" +
+				"add rule netdev eapol ingress_7 tcp dport 443 accept\n",
+		}))
+	})
+
+	It("removes static addresses from both sets", func() {
+		Expect(nft.RemoveStaticMac(pfName, mac)).To(Succeed())
+		Expect(scripts).To(Equal([]string{
+			"add element netdev eapol static_denied_7 { 6e:16:06:0e:b7:e2 }\n" +
+				"delete element netdev eapol static_denied_7 { 6e:16:06:0e:b7:e2 }\n" +
+				"add element netdev eapol static_allowed_7 { 6e:16:06:0e:b7:e2 }\n" +
+				"delete element netdev eapol static_allowed_7 { 6e:16:06:0e:b7:e2 }\n",
+		}))
+	})
+
+	It("adds static addresses to their sets", func() {
+		Expect(nft.AllowStaticMac(pfName, mac)).To(Succeed())
+		Expect(nft.DenyStaticMac(pfName, mac)).To(Succeed())
+		Expect(scripts).To(Equal([]string{
+			"add element netdev eapol static_allowed_7 { 6e:16:06:0e:b7:e2 }\n",
+			"add element netdev eapol static_denied_7 { 6e:16:06:0e:b7:e2 }\n",
+		}))
+	})
+
+	It("allows EAPOL and unprotected ports", func() {
+		Expect(nft.AllowEAPOL(pfName)).To(Succeed())
+		Expect(nft.AllowPort(pfName, tcpProtoStr, 80)).To(Succeed())
+		Expect(nft.AllowPort(pfName, "sctp", 38412)).NotTo(Succeed())
+		Expect(scripts).To(Equal([]string{
+			"add rule netdev eapol ingress_7 ether type 0x888e accept\n",
+			"add rule netdev eapol ingress_7 tcp dport 80 accept\n",
+		}))
+	})
+
+	It("adds and deletes authenticated addresses from the sets", func() {
+		Expect(nft.AllowMac(pfName, mac, unix.ETH_P_ALL)).To(Succeed())
+		Expect(nft.DenyMac(pfName, mac, unix.ETH_P_MACSEC)).To(Succeed())
+		Expect(scripts).To(Equal([]string{
+			"add element netdev eapol allowed_7 { 6e:16:06:0e:b7:e2 }\n",
+			"add element netdev eapol macsec_7 { 6e:16:06:0e:b7:e2 }\ndelete element netdev eapol macsec_7 { 6e:16:06:0e:b7:e2 }\n",
+		}))
+	})
+
+	It("switches the chain policy to allow all traffic", func() {
+		Expect(nft.AllowAll(pfName, true)).To(Succeed())
+		Expect(nft.AllowAll(pfName, false)).To(Succeed())
+		Expect(scripts).To(Equal([]string{
+			"add chain netdev eapol ingress_7 { type filter hook ingress device \"enp175s0f1\" priority 0; policy accept; }\n",
+			"add chain netdev eapol ingress_7 { type filter hook ingress device \"enp175s0f1\" priority 0; policy drop; }\n",
+		}))
+	})
+
+	It("refuses interface names it cannot quote", func() {
+		Expect(nft.Init("eth\"0")).NotTo(Succeed())
+		Expect(nft.Reset("missing")).NotTo(Succeed())
+		Expect(scripts).To(BeEmpty())
+	})
+
+	It("selects the backend by name", func() {
+		tc, err := NewTrafficController("")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tc).To(BeAssignableToTypeOf(&NetlinkTrafficController{}))
+		tc, err = NewTrafficController(NftablesBackend)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tc).To(BeAssignableToTypeOf(&NftablesTrafficController{}))
+		_, err = NewTrafficController("iptables")
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,220 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package trafficcontrol
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	eapolv1 "github.com/openshift-kni/eapol-operator/api/v1"
+)
+
+// defaultResourcePrefix is the prefix of SR-IOV network device plugin
+// resources which do not set one
+const defaultResourcePrefix = "intel.com"
+
+// ResolveInterfaces returns the interfaces named, followed by the other
+// interfaces of the node any selector matches, in name order.
+// devicePluginConfig is the SR-IOV network device plugin configuration the
+// resource names of selectors are looked up in.
+func ResolveInterfaces(names []string, selectors []eapolv1.InterfaceSelector, devicePluginConfig string) ([]string, error) {
+	interfaces := append([]string{}, names...)
+	if len(selectors) == 0 {
+		return interfaces, nil
+	}
+	entries, err := os.ReadDir(sysClassNet)
+	if err != nil {
+		return nil, err
+	}
+	var resources map[string][]string
+	for _, selector := range selectors {
+		if selector.ResourceName != "" {
+			resources, err = readDevicePluginResources(devicePluginConfig)
+			if err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+	var selected []string
+	for _, entry := range entries {
+		ifName := entry.Name()
+		// Skip bonding_masters
+		if entry.Type().IsRegular() || containsString(interfaces, ifName) || IsSriovVF(ifName) {
+			continue
+		}
+		dev := readNetDevice(ifName)
+		// Virtual interfaces such as lo, veths and bridges have no device
+		if dev.pciAddress == "" {
+			continue
+		}
+		for _, selector := range selectors {
+			if dev.matches(selector, resources) {
+				selected = append(selected, ifName)
+				break
+			}
+		}
+	}
+	sort.Strings(selected)
+	return append(interfaces, selected...), nil
+}
+
+// netDevice is the hardware of a network interface as sysfs reports it.
+// Virtual interfaces have none.
+type netDevice struct {
+	name       string
+	pciAddress string
+	vendor     string
+	device     string
+	driver     string
+}
+
+func readNetDevice(ifName string) *netDevice {
+	dev := &netDevice{name: ifName}
+	deviceDir := filepath.Join(sysClassNet, ifName, "device")
+	if path, err := filepath.EvalSymlinks(deviceDir); err == nil {
+		dev.pciAddress = filepath.Base(path)
+	}
+	dev.vendor = readHexID(filepath.Join(deviceDir, "vendor"))
+	dev.device = readHexID(filepath.Join(deviceDir, "device"))
+	if path, err := filepath.EvalSymlinks(filepath.Join(deviceDir, "driver")); err == nil {
+		dev.driver = filepath.Base(path)
+	}
+	return dev
+}
+
+func (dev *netDevice) matches(selector eapolv1.InterfaceSelector, resources map[string][]string) bool {
+	if selector.NamePattern != "" && !matchPattern(selector.NamePattern, dev.name) {
+		return false
+	}
+	if selector.PciAddress != "" && !matchPattern(selector.PciAddress, dev.pciAddress) {
+		return false
+	}
+	if selector.Vendor != "" && normalizeHexID(selector.Vendor) != dev.vendor {
+		return false
+	}
+	if selector.Device != "" && normalizeHexID(selector.Device) != dev.device {
+		return false
+	}
+	if selector.Driver != "" && selector.Driver != dev.driver {
+		return false
+	}
+	if selector.ResourceName != "" {
+		pfs := resources[selector.ResourceName]
+		if !containsString(pfs, dev.name) && (dev.pciAddress == "" || !containsString(pfs, dev.pciAddress)) {
+			return false
+		}
+	}
+	return true
+}
+
+func matchPattern(pattern, name string) bool {
+	matched, err := filepath.Match(pattern, name)
+	return err == nil && matched
+}
+
+// readHexID reads a sysfs ID file such as "0x8086", returning "" if there
+// is none.
+func readHexID(file string) string {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return ""
+	}
+	return normalizeHexID(string(data))
+}
+
+func normalizeHexID(id string) string {
+	id = strings.ToLower(strings.TrimSpace(id))
+	return strings.TrimPrefix(id, "0x")
+}
+
+// devicePluginResource is the part of an SR-IOV network device plugin
+// resource which selects PFs.
+type devicePluginResource struct {
+	ResourceName   string          `json:"resourceName"`
+	ResourcePrefix string          `json:"resourcePrefix"`
+	Selectors      json.RawMessage `json:"selectors"`
+}
+
+type devicePluginSelectors struct {
+	PfNames     []string `json:"pfNames"`
+	RootDevices []string `json:"rootDevices"`
+}
+
+// readDevicePluginResources maps each resource of the SR-IOV network device
+// plugin configuration, with and without its prefix, to the PF names and
+// PCI addresses its selectors name.  A missing configuration has no
+// resources.
+func readDevicePluginResources(configFile string) (map[string][]string, error) {
+	data, err := os.ReadFile(configFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var config struct {
+		ResourceList []devicePluginResource `json:"resourceList"`
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("invalid device plugin configuration %s: %w", configFile, err)
+	}
+	resources := map[string][]string{}
+	for _, resource := range config.ResourceList {
+		// Newer device plugins take a list of selectors
+		var selectorsList []devicePluginSelectors
+		if trimmed := bytes.TrimSpace(resource.Selectors); len(trimmed) > 0 && trimmed[0] == '[' {
+			err = json.Unmarshal(trimmed, &selectorsList)
+		} else if len(trimmed) > 0 {
+			selectorsList = make([]devicePluginSelectors, 1)
+			err = json.Unmarshal(trimmed, &selectorsList[0])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid selectors of resource %s: %w", resource.ResourceName, err)
+		}
+		var pfs []string
+		for _, selectors := range selectorsList {
+			for _, pfName := range selectors.PfNames {
+				// Strip the VF range of "ens1f0#0-3"
+				pfs = append(pfs, strings.SplitN(pfName, "#", 2)[0])
+			}
+			pfs = append(pfs, selectors.RootDevices...)
+		}
+		prefix := resource.ResourcePrefix
+		if prefix == "" {
+			prefix = defaultResourcePrefix
+		}
+		resources[resource.ResourceName] = append(resources[resource.ResourceName], pfs...)
+		resources[prefix+"/"+resource.ResourceName] = append(resources[prefix+"/"+resource.ResourceName], pfs...)
+	}
+	return resources, nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,92 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package trafficcontrol
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	eapolv1 "github.com/openshift-kni/eapol-operator/api/v1"
+)
+
+var _ = Describe("Interface selectors", func() {
+	var devicePluginConfig string
+	// addNetDevice lays out the sysfs entries of a network interface on a
+	// PCI device
+	addNetDevice := func(ifName, pciAddress, vendor, device, driver string) {
+		devices := filepath.Join(sysClassNet, "..", "devices")
+		pciDir := filepath.Join(devices, pciAddress)
+		Expect(os.MkdirAll(pciDir, 0755)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(pciDir, "vendor"), []byte("0x"+vendor+"\n"), 0644)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(pciDir, "device"), []byte("0x"+device+"\n"), 0644)).To(Succeed())
+		Expect(os.MkdirAll(filepath.Join(devices, "drivers", driver), 0755)).To(Succeed())
+		Expect(os.Symlink(filepath.Join(devices, "drivers", driver), filepath.Join(pciDir, "driver"))).To(Succeed())
+		Expect(os.MkdirAll(filepath.Join(sysClassNet, ifName), 0755)).To(Succeed())
+		Expect(os.Symlink(pciDir, filepath.Join(sysClassNet, ifName, "device"))).To(Succeed())
+	}
+	BeforeEach(func() {
+		dir := GinkgoT().TempDir()
+		DeferCleanup(func(dir string) { sysClassNet = dir }, sysClassNet)
+		sysClassNet = filepath.Join(dir, "net")
+		addNetDevice("ens3f0", "0000:3b:00.0", "8086", "158b", "i40e")
+		addNetDevice("ens3f1", "0000:3b:00.1", "8086", "158b", "i40e")
+		addNetDevice("ens5f0np0", "0000:5e:00.0", "15b3", "1017", "mlx5_core")
+		addNetDevice("ens3f0v0", "0000:3b:02.0", "8086", "154c", "iavf")
+		Expect(os.MkdirAll(filepath.Join(sysClassNet, "ens3f0v0", "device", "physfn"), 0755)).To(Succeed())
+		Expect(os.MkdirAll(filepath.Join(sysClassNet, "lo"), 0755)).To(Succeed())
+		Expect(os.MkdirAll(filepath.Join(sysClassNet, "ens3br0"), 0755)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(sysClassNet, "bonding_masters"), nil, 0644)).To(Succeed())
+		devicePluginConfig = filepath.Join(dir, "config.json")
+	})
+	resolve := func(names []string, selectors ...eapolv1.InterfaceSelector) []string {
+		interfaces, err := ResolveInterfaces(names, selectors, devicePluginConfig)
+		Expect(err).NotTo(HaveOccurred())
+		return interfaces
+	}
+	It("keeps the named interfaces without selectors", func() {
+		Expect(resolve([]string{"eth1", "eth0"})).To(Equal([]string{"eth1", "eth0"}))
+	})
+	It("selects interfaces by name pattern and PCI address", func() {
+		Expect(resolve(nil, eapolv1.InterfaceSelector{NamePattern: "ens*f0*"})).To(Equal([]string{"ens3f0", "ens5f0np0"}))
+		Expect(resolve(nil, eapolv1.InterfaceSelector{NamePattern: "*"})).To(Equal([]string{"ens3f0", "ens3f1", "ens5f0np0"}))
+		Expect(resolve(nil, eapolv1.InterfaceSelector{PciAddress: "0000:3b:00.1"})).To(Equal([]string{"ens3f1"}))
+	})
+	It("selects interfaces by vendor, device and driver", func() {
+		Expect(resolve(nil, eapolv1.InterfaceSelector{Vendor: "0x8086", Device: "158B"})).To(Equal([]string{"ens3f0", "ens3f1"}))
+		Expect(resolve(nil, eapolv1.InterfaceSelector{Driver: "mlx5_core"})).To(Equal([]string{"ens5f0np0"}))
+		Expect(resolve(nil, eapolv1.InterfaceSelector{Driver: "iavf"})).To(BeEmpty())
+	})
+	It("requires every field of a selector to match", func() {
+		Expect(resolve(nil, eapolv1.InterfaceSelector{Driver: "i40e", NamePattern: "*f1"})).To(Equal([]string{"ens3f1"}))
+	})
+	It("adds the interfaces any selector matches to the named ones", func() {
+		Expect(resolve([]string{"ens3f1"},
+			eapolv1.InterfaceSelector{Driver: "i40e"},
+			eapolv1.InterfaceSelector{Vendor: "15b3"})).To(Equal([]string{"ens3f1", "ens3f0", "ens5f0np0"}))
+	})
+	It("selects the PFs of an SR-IOV device plugin resource", func() {
+		Expect(os.WriteFile(devicePluginConfig, []byte(`{"resourceList": [
+			{"resourceName": "intel_sriov", "selectors": {"pfNames": ["ens3f0#0-3"]}},
+			{"resourceName": "mlx_sriov", "resourcePrefix": "openshift.io",
+			 "selectors": [{"rootDevices": ["0000:5e:00.0"]}]}]}`), 0644)).To(Succeed())
+		Expect(resolve(nil, eapolv1.InterfaceSelector{ResourceName: "intel.com/intel_sriov"})).To(Equal([]string{"ens3f0"}))
+		Expect(resolve(nil, eapolv1.InterfaceSelector{ResourceName: "openshift.io/mlx_sriov"})).To(Equal([]string{"ens5f0np0"}))
+		Expect(resolve(nil, eapolv1.InterfaceSelector{ResourceName: "openshift.io/other"})).To(BeEmpty())
+	})
+})
@@ -38,22 +38,60 @@ type PFInfo struct {
 	AuthenticatedAddrs map[string]interface{}
 	VFs                map[int]*VFInfo
 	NetLinkMgr         utils.NetlinkManager
+	TrafficCtl         TrafficController
+	// MACsecRequired restricts authenticated supplicants to MACsec frames
+	MACsecRequired bool
+	// EgressDrop only allows egress traffic to authenticated supplicants
+	EgressDrop bool
+	// PerVF releases only the VF a supplicant is mapped to, rather than all
+	// VFs once any supplicant has authenticated on the PF
+	PerVF bool
+	// VFSupplicants maps supplicant MAC addresses to VF indexes in per-VF
+	// mode.  Other supplicants are mapped to the VF with the same MAC address.
+	VFSupplicants map[string]int
+	// StationVlans are the VLANs assigned to supplicants by the RADIUS server
+	StationVlans map[string]int
+	// GuestVlan and AuthFailVlan release unauthenticated VFs onto a
+	// restricted network instead of blocking them, when set
+	GuestVlan    int
+	AuthFailVlan int
 }
 
 type VFInfo struct {
 	Parent *PFInfo
 	Index  int
 	Vlan   int
+	// AuthenticatedAddrs are the supplicants authenticated for this VF in
+	// per-VF mode
+	AuthenticatedAddrs map[string]interface{}
+	// AssignedVlan overrides Vlan while the supplicant AssignedBy is
+	// authenticated
+	AssignedVlan int
+	AssignedBy   string
+	// NetDev is the VF's network device in the host namespace, if any
+	NetDev   string
+	Fallback Fallback
+	eapSeen  bool
+	allowAll bool
 }
 
+// HandlePfEventForVlanChange records the VLAN a VF was changed to as its
+// original VLAN.  The reserved VLAN of a blocked VF, and the fallback VLAN an
+// unauthenticated VF is parked on, are not changes.
 func (pf *PFInfo) HandlePfEventForVlanChange(logger log.Logger) error {
 	pfLink, err := pf.NetLinkMgr.LinkByName(pf.Name)
 	if err != nil {
 		return err
 	}
 	for _, vf := range pfLink.Attrs().Vfs {
-		if vfInfo, ok := pf.VFs[vf.ID]; ok && vf.Vlan != ReservedVlan &&
-			vfInfo.Vlan != vf.Vlan {
+		vfInfo, ok := pf.VFs[vf.ID]
+		if !ok || vf.Vlan == ReservedVlan {
+			continue
+		}
+		if vfInfo.Fallback != FallbackNone && !vfInfo.authenticated() && vf.Vlan == vfInfo.fallbackVlan() {
+			continue
+		}
+		if vfInfo.vlan() != vf.Vlan {
 			vfInfo.Vlan = vf.Vlan
 			level.Info(logger).Log("interface", "event", pf.Name, "vlan changed", vfInfo)
 			err := vfInfo.ConfigureVlanState()
@@ -65,6 +103,148 @@ func (pf *PFInfo) HandlePfEventForVlanChange(logger log.Logger) error {
 	return nil
 }
 
+// ReleaseVFs restores the original vlan and state of all VFs, whatever
+// their authentication state.
+func (pf *PFInfo) ReleaseVFs() error {
+	pf.Authenticated = true
+	pf.PerVF = false
+	return pf.ConfigureVlanStateForVFs()
+}
+
+// AssignVlan applies the VLAN assigned to a supplicant to the VFs it
+// releases: all VFs in port mode, or its own VF in per-VF mode.
+func (pf *PFInfo) AssignVlan(mac string, vlan int) error {
+	vfs, err := pf.vfsForMac(mac)
+	if err != nil {
+		return err
+	}
+	pf.StationVlans[mac] = vlan
+	for _, vf := range vfs {
+		vf.AssignedVlan = vlan
+		vf.AssignedBy = mac
+		if err := vf.ConfigureVlanState(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RestoreVlan restores the original VLAN of the VFs a supplicant's VLAN was
+// assigned to.  VFs which are no longer authenticated are left disabled.
+func (pf *PFInfo) RestoreVlan(mac string) error {
+	if _, ok := pf.StationVlans[mac]; !ok {
+		return nil
+	}
+	delete(pf.StationVlans, mac)
+	for _, vf := range pf.VFs {
+		if vf.AssignedBy != mac {
+			continue
+		}
+		vf.AssignedVlan = 0
+		vf.AssignedBy = ""
+		if !vf.authenticated() {
+			continue
+		}
+		if err := vf.ConfigureVlanState(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetVFSupplicants replaces the mapping of supplicants to VFs in per-VF mode.
+// The supplicants which are authenticated keep their session and are moved
+// to the VF they are now mapped to.
+func (pf *PFInfo) SetVFSupplicants(supplicants map[string]int) error {
+	pf.VFSupplicants = supplicants
+	if !pf.PerVF {
+		return nil
+	}
+	return pf.remapSupplicants()
+}
+
+// SetPerVF switches between port and per-VF authentication.  The
+// supplicants which are authenticated keep their session, releasing all VFs
+// in port mode or the VF each is mapped to in per-VF mode.
+func (pf *PFInfo) SetPerVF(perVF bool) error {
+	if pf.PerVF == perVF {
+		return nil
+	}
+	pf.PerVF = perVF
+	return pf.remapSupplicants()
+}
+
+// remapSupplicants tracks the authenticated supplicants and their assigned
+// VLANs on the VFs they are mapped to, and reconfigures the VFs accordingly.
+func (pf *PFInfo) remapSupplicants() error {
+	for _, vf := range pf.VFs {
+		vf.AuthenticatedAddrs = make(map[string]interface{})
+		vf.AssignedVlan = 0
+		vf.AssignedBy = ""
+	}
+	if pf.PerVF {
+		for mac := range pf.AuthenticatedAddrs {
+			vf, err := pf.vfForMac(mac)
+			if err != nil {
+				return err
+			}
+			if vf != nil {
+				vf.AuthenticatedAddrs[mac] = nil
+			}
+		}
+	} else {
+		pf.Authenticated = len(pf.AuthenticatedAddrs) > 0
+	}
+	for mac, vlan := range pf.StationVlans {
+		vfs, err := pf.vfsForMac(mac)
+		if err != nil {
+			return err
+		}
+		for _, vf := range vfs {
+			vf.AssignedVlan = vlan
+			vf.AssignedBy = mac
+		}
+	}
+	return pf.ConfigureVlanStateForVFs()
+}
+
+func (pf *PFInfo) vfsForMac(mac string) ([]*VFInfo, error) {
+	if pf.PerVF {
+		vf, err := pf.vfForMac(mac)
+		if err != nil || vf == nil {
+			return nil, err
+		}
+		return []*VFInfo{vf}, nil
+	}
+	var vfs []*VFInfo
+	for _, vf := range pf.VFs {
+		vfs = append(vfs, vf)
+	}
+	return vfs, nil
+}
+
+// vfForMac returns the VF a supplicant is mapped to in per-VF mode, or nil
+// when the supplicant is not behind any VF.
+func (pf *PFInfo) vfForMac(mac string) (*VFInfo, error) {
+	if index, ok := pf.VFSupplicants[mac]; ok {
+		vf, ok := pf.VFs[index]
+		if !ok {
+			return nil, fmt.Errorf("vf %d of %s mapped to supplicant %s does not exist", index, pf.Name, mac)
+		}
+		return vf, nil
+	}
+	pfLink, err := pf.NetLinkMgr.LinkByName(pf.Name)
+	if err != nil {
+		return nil, err
+	}
+	for _, vf := range pfLink.Attrs().Vfs {
+		if vf.Mac.String() == mac {
+			return pf.VFs[vf.ID], nil
+		}
+	}
+	return nil, nil
+}
+
 func (pf *PFInfo) ConfigureVlanStateForVFs() error {
 	for _, vfInfo := range pf.VFs {
 		err := vfInfo.ConfigureVlanState()
@@ -84,19 +264,44 @@ func (vf *VFInfo) ConfigureVlanState() error {
 		vlan  int
 		state uint32
 	)
-	if !vf.Parent.Authenticated {
+	fallbackVlan := vf.fallbackVlan()
+	if vf.authenticated() {
+		state = netlink.VF_LINK_STATE_AUTO
+		vlan = vf.vlan()
+	} else if fallbackVlan != 0 {
+		state = netlink.VF_LINK_STATE_AUTO
+		vlan = fallbackVlan
+	} else {
 		// Use reserved vlan value 4095 when PF is in unauthenticated state.
 		vlan = ReservedVlan
 		state = netlink.VF_LINK_STATE_DISABLE
-	} else {
-		state = netlink.VF_LINK_STATE_AUTO
-		vlan = vf.Vlan
 	}
 	err = vf.Parent.NetLinkMgr.LinkSetVfVlan(pfLink, vf.Index, vlan)
 	if err != nil {
 		return err
 	}
-	return vf.Parent.NetLinkMgr.LinkSetVfState(pfLink, vf.Index, state)
+	err = vf.Parent.NetLinkMgr.LinkSetVfState(pfLink, vf.Index, state)
+	if err != nil {
+		return err
+	}
+	// Devices on a fallback VLAN have no authenticated address to allow
+	return vf.setAllowAll(!vf.authenticated() && fallbackVlan != 0)
+}
+
+// vlan is the VLAN the VF is released with, which is the one assigned to its
+// supplicant by the RADIUS server if any.
+func (vf *VFInfo) vlan() int {
+	if vf.AssignedVlan != 0 {
+		return vf.AssignedVlan
+	}
+	return vf.Vlan
+}
+
+func (vf *VFInfo) authenticated() bool {
+	if vf.Parent.PerVF {
+		return len(vf.AuthenticatedAddrs) > 0
+	}
+	return vf.Parent.Authenticated
 }
 
 func GetSriovPFInfo(ifName string, nLinkMgr utils.NetlinkManager) (*PFInfo, error) {
@@ -105,9 +310,11 @@ func GetSriovPFInfo(ifName string, nLinkMgr utils.NetlinkManager) (*PFInfo, erro
 		return nil, err
 	}
 	pf := &PFInfo{Name: ifName, Authenticated: false, VFs: map[int]*VFInfo{},
-		AuthenticatedAddrs: make(map[string]interface{}), NetLinkMgr: nLinkMgr}
+		AuthenticatedAddrs: make(map[string]interface{}), NetLinkMgr: nLinkMgr,
+		StationVlans: make(map[string]int)}
 	for _, vf := range pfLink.Attrs().Vfs {
-		pf.VFs[vf.ID] = &VFInfo{Parent: pf, Index: vf.ID, Vlan: vf.Vlan}
+		pf.VFs[vf.ID] = &VFInfo{Parent: pf, Index: vf.ID, Vlan: vf.Vlan,
+			AuthenticatedAddrs: make(map[string]interface{}), NetDev: vfNetDev(ifName, vf.ID)}
 	}
 	return pf, nil
 }
@@ -146,6 +353,17 @@ func GetSriovVFs(ifName string, nLinkMgr utils.NetlinkManager) ([]string, error)
 	return vfNames, nil
 }
 
+// vfNetDev returns the network device of a VF, or an empty string if it is
+// bound to a userspace driver or was moved to another network namespace.
+func vfNetDev(pfName string, index int) string {
+	vfNetDir := filepath.Join(sysClassNet, pfName, "device", fmt.Sprintf("virtfn%d", index), "net")
+	vfNetDirInfo, err := ioutil.ReadDir(vfNetDir)
+	if err != nil || len(vfNetDirInfo) == 0 {
+		return ""
+	}
+	return vfNetDirInfo[0].Name()
+}
+
 func IsSriovPF(ifName string) bool {
 	ifPfDir := filepath.Join(sysClassNet, ifName, "device", "sriov_numvfs")
 	if _, err := os.Stat(ifPfDir); err != nil {
@@ -154,6 +372,12 @@ func IsSriovPF(ifName string) bool {
 	return true
 }
 
+// IsSriovVF returns whether an interface is the network device of an SR-IOV
+// VF.
+func IsSriovVF(ifName string) bool {
+	return dirExists(filepath.Join(sysClassNet, ifName, "device", "physfn"))
+}
+
 func GetAssociatedInterfaces(ifName string, nLinkMgr utils.NetlinkManager) ([]string, error) {
 	interfaces := []string{ifName}
 	if IsSriovPF(ifName) {
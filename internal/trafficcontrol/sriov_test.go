@@ -115,6 +115,30 @@ var _ = Describe("Sriov", func() {
 			Expect(err).NotTo(HaveOccurred())
 			mocked.AssertExpectations(t)
 		})
+		It("Ignores the guest vlan a VF is parked on", func() {
+			fakeMac, err := net.ParseMAC("6e:16:06:0e:b7:e9")
+			Expect(err).NotTo(HaveOccurred())
+			mocked := &mocks_utils.NetlinkManager{}
+			pfInfo := &PFInfo{Name: pfName, GuestVlan: 300, NetLinkMgr: mocked}
+			pfInfo.VFs = map[int]*VFInfo{0: {Index: 0, Vlan: 200, Fallback: FallbackGuest, Parent: pfInfo}}
+			fakeLink := &utils.FakeLink{LinkAttrs: netlink.LinkAttrs{
+				Index:        1000,
+				Name:         pfName,
+				HardwareAddr: fakeMac,
+				Vfs:          []netlink.VfInfo{{ID: 0, Vlan: 300}},
+			}}
+			mocked.On("LinkByName", mock.AnythingOfType("string")).Return(fakeLink, nil)
+			err = pfInfo.HandlePfEventForVlanChange(logger)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(pfInfo.VFs[0].Vlan).To(Equal(200))
+			mocked.AssertNotCalled(t, "LinkSetVfVlan", mock.Anything, mock.Anything, mock.Anything)
+
+			By("releasing the VF on its original vlan")
+			mocked.On("LinkSetVfVlan", fakeLink, 0, 200).Return(nil)
+			mocked.On("LinkSetVfState", fakeLink, 0, netlink.VF_LINK_STATE_AUTO).Return(nil)
+			Expect(pfInfo.ReleaseVFs()).To(Succeed())
+			mocked.AssertExpectations(t)
+		})
 	})
 
 	Context("Validate Sriov PF/VF specific functions", func() {
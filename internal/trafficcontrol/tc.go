@@ -17,13 +17,16 @@ limitations under the License.
 package trafficcontrol
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
-	"os/exec"
-	"strconv"
+	"net"
+	"reflect"
 
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
 	"github.com/k8snetworkplumbingwg/sriov-cni/pkg/utils"
+	"golang.org/x/sys/unix"
 )
 
 var (
@@ -32,44 +35,146 @@ var (
 	udpProtoStr = "udp"
 )
 
+const (
+	TCBackend       = "tc"
+	NftablesBackend = "nftables"
+)
+
+// TrafficController programs the ingress rules which gate traffic on an
+// interface by authentication state.
+type TrafficController interface {
+	// Init replaces any existing ingress rules on ifName with a rule
+	// dropping all traffic.
+	Init(ifName string) error
+	// Reset removes all ingress rules from ifName.
+	Reset(ifName string) error
+	// AllowEAPOL allows EAPOL frames from any source.
+	AllowEAPOL(ifName string) error
+	// AllowPort allows IPv4 and IPv6 traffic of the given protocol ("tcp"
+	// or "udp") to a destination port from any source.
+	AllowPort(ifName, protocol string, port int) error
+	// AllowEtherType allows frames of an ethertype from any source.
+	AllowEtherType(ifName string, ethType uint16) error
+	// AllowIP allows IPv4 or IPv6 traffic matching a rule from any source.
+	AllowIP(ifName string, rule IPRule) error
+	// RemovePort removes the rules allowing traffic to an unprotected port.
+	RemovePort(ifName, protocol string, port int) error
+	// RemoveEtherType removes the rule allowing an ethertype.
+	RemoveEtherType(ifName string, ethType uint16) error
+	// RemoveIP removes the rules allowing IP traffic matching a rule.
+	RemoveIP(ifName string, rule IPRule) error
+	// AllowMac allows frames of the given ethertype (ETH_P_ALL for any)
+	// from a MAC address.
+	AllowMac(ifName string, mac net.HardwareAddr, ethType uint16) error
+	// DenyMac removes the rule AllowMac added for a MAC address, so that
+	// its frames are dropped unless AllowAll is set.
+	DenyMac(ifName string, mac net.HardwareAddr, ethType uint16) error
+	// AllowAll allows traffic from any source while allow is true, for VFs
+	// released on a guest or auth-fail VLAN.
+	AllowAll(ifName string, allow bool) error
+	// AllowStaticMac always allows frames from a MAC address, ahead of the
+	// per-supplicant rules.
+	AllowStaticMac(ifName string, mac net.HardwareAddr) error
+	// DenyStaticMac always drops frames from a MAC address, ahead of all
+	// other rules.
+	DenyStaticMac(ifName string, mac net.HardwareAddr) error
+	// RemoveStaticMac removes the rules always allowing or dropping frames
+	// from a MAC address.
+	RemoveStaticMac(ifName string, mac net.HardwareAddr) error
+	// InitEgress adds egress rules to an initialized interface, dropping
+	// all traffic but EAPOL.
+	InitEgress(ifName string) error
+	// AllowEgressEtherType allows egress frames of an ethertype to any
+	// destination.
+	AllowEgressEtherType(ifName string, ethType uint16) error
+	// AllowEgressIP allows egress IPv4 or IPv6 traffic matching a rule to
+	// any destination.
+	AllowEgressIP(ifName string, rule IPRule) error
+	// RemoveEgressEtherType removes the rule allowing egress frames of an
+	// ethertype.
+	RemoveEgressEtherType(ifName string, ethType uint16) error
+	// RemoveEgressIP removes the rules allowing egress IP traffic matching a
+	// rule.
+	RemoveEgressIP(ifName string, rule IPRule) error
+	// AllowEgressMac allows egress frames to a MAC address.
+	AllowEgressMac(ifName string, mac net.HardwareAddr) error
+	// DenyEgressMac removes the rule allowing egress frames to a MAC
+	// address.
+	DenyEgressMac(ifName string, mac net.HardwareAddr) error
+}
+
+// NewTrafficController returns the TrafficController for a backend, with
+// tc being the default.
+func NewTrafficController(backend string) (TrafficController, error) {
+	switch backend {
+	case "", TCBackend:
+		return NewNetlinkTrafficController(), nil
+	case NftablesBackend:
+		return NewNftablesTrafficController(), nil
+	}
+	return nil, fmt.Errorf("unsupported traffic control backend %q", backend)
+}
+
 func AllowTrafficFromMac(pf *PFInfo, macAddress string, nLinkMgr utils.NetlinkManager) error {
-	// Restore the original vlan and state on the VF when first client
-	// gets authenticated.
-	if len(pf.AuthenticatedAddrs) == 1 {
+	mac, err := net.ParseMAC(macAddress)
+	if err != nil {
+		return err
+	}
+	err = pf.clearFallback(mac.String())
+	if err != nil {
+		return err
+	}
+	if pf.PerVF {
+		err = setVFAuthenticated(pf, mac.String(), true)
+		if err != nil {
+			return err
+		}
+	} else if len(pf.AuthenticatedAddrs) == 1 {
+		// Restore the original vlan and state on the VF when first client
+		// gets authenticated.
 		pf.Authenticated = true
 		err := pf.ConfigureVlanStateForVFs()
 		if err != nil {
 			return err
 		}
 	}
-	if _, err := exec.LookPath("tc"); err != nil {
-		return err
-	}
 	interfaces, err := GetAssociatedInterfaces(pf.Name, nLinkMgr)
 	if err != nil {
 		return err
 	}
 	for _, iface := range interfaces {
-		cmd := exec.Command("bash", "-c", fmt.Sprintf("tc filter replace dev %s ingress pref 9000 protocol all flower src_mac %s action ok", iface, macAddress))
-		err := cmd.Run()
+		err := pf.TrafficCtl.AllowMac(iface, mac, pf.macProtocol())
 		if err != nil {
 			return err
 		}
 	}
+	if pf.EgressDrop {
+		return pf.TrafficCtl.AllowEgressMac(pf.Name, mac)
+	}
 	return nil
 }
 
 func DenyTrafficFromMac(pf *PFInfo, macAddress string, nLinkMgr utils.NetlinkManager) error {
-	// When no clients authenticated on PF, then move its VFs into
-	// deauthenticated state.
-	if len(pf.AuthenticatedAddrs) == 0 {
+	mac, err := net.ParseMAC(macAddress)
+	if err != nil {
+		return err
+	}
+	if pf.PerVF {
+		err = setVFAuthenticated(pf, mac.String(), false)
+		if err != nil {
+			return err
+		}
+	} else if len(pf.AuthenticatedAddrs) == 0 {
+		// When no clients authenticated on PF, then move its VFs into
+		// deauthenticated state.
 		pf.Authenticated = false
 		err := pf.ConfigureVlanStateForVFs()
 		if err != nil {
 			return err
 		}
 	}
-	if _, err := exec.LookPath("tc"); err != nil {
+	err = pf.RestoreVlan(mac.String())
+	if err != nil {
 		return err
 	}
 	interfaces, err := GetAssociatedInterfaces(pf.Name, nLinkMgr)
@@ -77,96 +182,336 @@ func DenyTrafficFromMac(pf *PFInfo, macAddress string, nLinkMgr utils.NetlinkMan
 		return err
 	}
 	for _, iface := range interfaces {
-		cmd := exec.Command("bash", "-c", fmt.Sprintf("tc filter replace dev %s ingress pref 9000 protocol all flower src_mac %s action drop", iface, macAddress))
-		err := cmd.Run()
+		err := pf.TrafficCtl.DenyMac(iface, mac, pf.macProtocol())
 		if err != nil {
 			return err
 		}
 	}
+	if pf.EgressDrop {
+		return pf.TrafficCtl.DenyEgressMac(pf.Name, mac)
+	}
 	return nil
 }
 
-func InitInterfaceForEAPTraffic(logger log.Logger, ifName string, unprotectTcpPorts, unprotectUdpPorts []int) error {
-	if err := ResetInterface(logger, ifName); err != nil {
+// setVFAuthenticated tracks a supplicant on the VF it is mapped to, releasing
+// the VF when its first supplicant authenticates and disabling it again when
+// its last supplicant is deauthenticated.
+func setVFAuthenticated(pf *PFInfo, mac string, authenticated bool) error {
+	vf, err := pf.vfForMac(mac)
+	if err != nil || vf == nil {
 		return err
 	}
-	cmd := exec.Command("bash", "-c", fmt.Sprintf("tc qdisc add dev %s clsact || return $?", ifName))
-	err := cmd.Run()
-	if err != nil {
+	_, wasAuthenticated := vf.AuthenticatedAddrs[mac]
+	if authenticated == wasAuthenticated {
+		return nil
+	}
+	if authenticated {
+		vf.AuthenticatedAddrs[mac] = nil
+		if len(vf.AuthenticatedAddrs) > 1 {
+			return nil
+		}
+	} else {
+		delete(vf.AuthenticatedAddrs, mac)
+		if len(vf.AuthenticatedAddrs) > 0 {
+			return nil
+		}
+	}
+	return vf.ConfigureVlanState()
+}
+
+// InterfaceConfig is the traffic allowed or denied on an interface
+// regardless of authentication.
+type InterfaceConfig struct {
+	UnprotectedTcpPorts []int
+	UnprotectedUdpPorts []int
+	AllowedMacs         []net.HardwareAddr
+	DeniedMacs          []net.HardwareAddr
+	EtherTypes          []uint16
+	IPRules             []IPRule
+	// EgressDrop drops egress traffic but EAPOL, the egress exceptions and
+	// traffic to authenticated peers
+	EgressDrop       bool
+	EgressEtherTypes []uint16
+	EgressIPRules    []IPRule
+}
+
+// InitInterfaceForEAPTraffic drops all traffic on an interface but the
+// configured exceptions.  VFs only get the static MAC address rules, as the
+// exceptions and egress rules are enforced on their PF.
+func InitInterfaceForEAPTraffic(logger log.Logger, tc TrafficController, ifName string, config InterfaceConfig) error {
+	if err := tc.Init(ifName); err != nil {
 		return err
 	}
-	cmd = exec.Command("bash", "-c", fmt.Sprintf("tc filter add dev %s ingress pref 10001 protocol all matchall action drop index 101 || return $?", ifName))
-	err = cmd.Run()
-	if err != nil {
+	for _, mac := range config.DeniedMacs {
+		if err := tc.DenyStaticMac(ifName, mac); err != nil {
+			return err
+		}
+	}
+	for _, mac := range config.AllowedMacs {
+		if err := tc.AllowStaticMac(ifName, mac); err != nil {
+			return err
+		}
+	}
+	if IsSriovVF(ifName) {
+		return nil
+	}
+	if err := tc.AllowEAPOL(ifName); err != nil {
 		return err
 	}
-	if !IsSriovPF(ifName) {
+	UnprotectPorts(logger, tc, ifName, tcpProtoStr, config.UnprotectedTcpPorts)
+	UnprotectPorts(logger, tc, ifName, udpProtoStr, config.UnprotectedUdpPorts)
+	AllowExceptions(logger, tc, ifName, config.EtherTypes, config.IPRules)
+	if !config.EgressDrop {
 		return nil
 	}
-	cmd = exec.Command("bash", "-c", fmt.Sprintf("tc filter add dev %s ingress pref 10000 protocol 0x888e matchall action ok index 100 || return $?", ifName))
-	err = cmd.Run()
-	if err != nil {
+	if err := tc.InitEgress(ifName); err != nil {
 		return err
 	}
-	if len(unprotectTcpPorts) > 0 {
-		err = UnprotectPorts(logger, ifName, tcpProtoStr, unprotectTcpPorts)
+	AllowEgressExceptions(logger, tc, ifName, config.EgressEtherTypes, config.EgressIPRules)
+	return nil
+}
+
+// UpdateInterfaceConfig changes the traffic allowed or denied on an
+// interface initialized with old to config, only adding and removing the
+// rules which differ so that the traffic both allow is never interrupted.
+// The egress policy itself cannot change, only its exceptions.  It returns
+// the configuration the rules now implement, which differs from config by
+// the rules which could not be added or removed, so that updating it to
+// config again retries them.
+func UpdateInterfaceConfig(logger log.Logger, tc TrafficController, ifName string, old, config InterfaceConfig) (InterfaceConfig, error) {
+	applied := config
+	var errs []error
+	// A MAC address may move between the static lists, and removing its
+	// rule removes it from both
+	_, removedDenied := diffRules(old.DeniedMacs, config.DeniedMacs, sameMac)
+	_, removedAllowed := diffRules(old.AllowedMacs, config.AllowedMacs, sameMac)
+	var stuckMacs []net.HardwareAddr
+	for _, mac := range append(removedDenied, removedAllowed...) {
+		if err := tc.RemoveStaticMac(ifName, mac); err != nil {
+			errs = append(errs, err)
+			stuckMacs = append(stuckMacs, mac)
+			if containsRule(removedDenied, mac, sameMac) {
+				applied.DeniedMacs = append(applied.DeniedMacs, mac)
+			} else {
+				applied.AllowedMacs = append(applied.AllowedMacs, mac)
+			}
+		}
+	}
+	for _, mac := range config.DeniedMacs {
+		if !containsRule(old.DeniedMacs, mac, sameMac) || containsRule(removedAllowed, mac, sameMac) {
+			if err := tc.DenyStaticMac(ifName, mac); err != nil {
+				errs = append(errs, err)
+				applied.DeniedMacs = withoutRules(applied.DeniedMacs, []net.HardwareAddr{mac}, sameMac)
+			}
+		}
+	}
+	for _, mac := range config.AllowedMacs {
+		if !containsRule(old.AllowedMacs, mac, sameMac) || containsRule(removedDenied, mac, sameMac) {
+			if err := tc.AllowStaticMac(ifName, mac); err != nil {
+				errs = append(errs, err)
+				applied.AllowedMacs = withoutRules(applied.AllowedMacs, []net.HardwareAddr{mac}, sameMac)
+			}
+		}
+	}
+	if IsSriovVF(ifName) {
+		return applied, errors.Join(errs...)
+	}
+	for _, protocol := range []string{tcpProtoStr, udpProtoStr} {
+		oldPorts, ports, appliedPorts := old.UnprotectedTcpPorts, config.UnprotectedTcpPorts, &applied.UnprotectedTcpPorts
+		if protocol == udpProtoStr {
+			oldPorts, ports, appliedPorts = old.UnprotectedUdpPorts, config.UnprotectedUdpPorts, &applied.UnprotectedUdpPorts
+		}
+		added, removed := diffRules(oldPorts, ports, sameRule[int])
+		failed := UnprotectPorts(logger, tc, ifName, protocol, added)
+		*appliedPorts = withoutRules(*appliedPorts, failed, sameRule[int])
+		for _, port := range removed {
+			if err := tc.RemovePort(ifName, protocol, port); err != nil {
+				level.Error(logger).Log("op", "protect port", "ifName", ifName, "protocol", protocol, "port", port, "error", err)
+				*appliedPorts = append(*appliedPorts, port)
+			}
+		}
+	}
+	addedEtherTypes, removedEtherTypes := diffRules(old.EtherTypes, config.EtherTypes, sameRule[uint16])
+	addedIPRules, removedIPRules := diffRules(old.IPRules, config.IPRules, sameRule[IPRule])
+	failedEtherTypes, failedIPRules := AllowExceptions(logger, tc, ifName, addedEtherTypes, addedIPRules)
+	applied.EtherTypes = withoutRules(applied.EtherTypes, failedEtherTypes, sameRule[uint16])
+	applied.IPRules = withoutRules(applied.IPRules, failedIPRules, sameRule[IPRule])
+	failedEtherTypes, failedIPRules = RemoveExceptions(logger, tc, ifName, removedEtherTypes, removedIPRules)
+	applied.EtherTypes = append(applied.EtherTypes, failedEtherTypes...)
+	applied.IPRules = append(applied.IPRules, failedIPRules...)
+	if old.EgressDrop && config.EgressDrop {
+		addedEtherTypes, removedEtherTypes = diffRules(old.EgressEtherTypes, config.EgressEtherTypes, sameRule[uint16])
+		addedIPRules, removedIPRules = diffRules(old.EgressIPRules, config.EgressIPRules, sameRule[IPRule])
+		failedEtherTypes, failedIPRules = AllowEgressExceptions(logger, tc, ifName, addedEtherTypes, addedIPRules)
+		applied.EgressEtherTypes = withoutRules(applied.EgressEtherTypes, failedEtherTypes, sameRule[uint16])
+		applied.EgressIPRules = withoutRules(applied.EgressIPRules, failedIPRules, sameRule[IPRule])
+		failedEtherTypes, failedIPRules = RemoveEgressExceptions(logger, tc, ifName, removedEtherTypes, removedIPRules)
+		applied.EgressEtherTypes = append(applied.EgressEtherTypes, failedEtherTypes...)
+		applied.EgressIPRules = append(applied.EgressIPRules, failedIPRules...)
+	}
+	if !reflect.DeepEqual(applied, config) && len(errs) == 0 {
+		errs = append(errs, fmt.Errorf("some rules of %s could not be updated", ifName))
+	}
+	return applied, errors.Join(errs...)
+}
+
+// UnprotectPorts allows traffic to the given ports, logging rather than
+// failing on ports which could not be unprotected, which it returns.
+func UnprotectPorts(logger log.Logger, tc TrafficController, ifName string, protocol string, ports []int) (failed []int) {
+	for _, port := range ports {
+		err := tc.AllowPort(ifName, protocol, port)
 		if err != nil {
-			return err
+			level.Error(logger).Log("op", "unprotect port", "ifName", ifName, "protocol", protocol, "port", port, "error", err)
+			failed = append(failed, port)
 		}
 	}
-	if len(unprotectUdpPorts) > 0 {
-		err = UnprotectPorts(logger, ifName, udpProtoStr, unprotectUdpPorts)
+	return failed
+}
+
+// AllowExceptions allows the given ethertypes and IP traffic, logging rather
+// than failing on exceptions which could not be allowed, which it returns.
+func AllowExceptions(logger log.Logger, tc TrafficController, ifName string, etherTypes []uint16, ipRules []IPRule) (failedEtherTypes []uint16, failedIPRules []IPRule) {
+	for _, ethType := range etherTypes {
+		err := tc.AllowEtherType(ifName, ethType)
 		if err != nil {
-			return err
+			level.Error(logger).Log("op", "allow ethertype", "ifName", ifName, "ethertype", fmt.Sprintf("0x%04x", ethType), "error", err)
+			failedEtherTypes = append(failedEtherTypes, ethType)
 		}
 	}
-	unprotectPorts := append(unprotectTcpPorts, unprotectUdpPorts...)
-	if len(unprotectPorts) > 0 {
-		err = UnprotectIPv6Ports(logger, ifName, unprotectPorts)
+	for _, rule := range ipRules {
+		err := tc.AllowIP(ifName, rule)
 		if err != nil {
-			return err
+			level.Error(logger).Log("op", "allow ip", "ifName", ifName, "rule", fmt.Sprintf("%+v", rule), "error", err)
+			failedIPRules = append(failedIPRules, rule)
 		}
 	}
-	return nil
+	return failedEtherTypes, failedIPRules
 }
 
-func ResetInterface(logger log.Logger, ifName string) error {
-	if _, err := exec.LookPath("tc"); err != nil {
-		return err
+// RemoveExceptions removes the rules allowing the given ethertypes and IP
+// traffic, logging rather than failing on rules which could not be removed,
+// which it returns.
+func RemoveExceptions(logger log.Logger, tc TrafficController, ifName string, etherTypes []uint16, ipRules []IPRule) (failedEtherTypes []uint16, failedIPRules []IPRule) {
+	for _, ethType := range etherTypes {
+		err := tc.RemoveEtherType(ifName, ethType)
+		if err != nil {
+			level.Error(logger).Log("op", "remove ethertype", "ifName", ifName, "ethertype", fmt.Sprintf("0x%04x", ethType), "error", err)
+			failedEtherTypes = append(failedEtherTypes, ethType)
+		}
 	}
-	cmd := exec.Command("bash", "-c", fmt.Sprintf("tc qdisc del dev %s ingress >/dev/null 2>&1 || true", ifName))
-	err := cmd.Run()
-	if err != nil {
-		return err
+	for _, rule := range ipRules {
+		err := tc.RemoveIP(ifName, rule)
+		if err != nil {
+			level.Error(logger).Log("op", "remove ip", "ifName", ifName, "rule", fmt.Sprintf("%+v", rule), "error", err)
+			failedIPRules = append(failedIPRules, rule)
+		}
 	}
-	cmd = exec.Command("bash", "-c", fmt.Sprintf("tc qdisc del dev %s clsact >/dev/null 2>&1 || true", ifName))
-	return cmd.Run()
+	return failedEtherTypes, failedIPRules
 }
 
-func UnprotectPorts(logger log.Logger, ifName string, protocol string, ports []int) error {
-	if _, err := exec.LookPath("tc"); err != nil {
-		return err
+// AllowEgressExceptions allows the given ethertypes and IP traffic to any
+// destination, logging rather than failing on exceptions which could not be
+// allowed, which it returns.
+func AllowEgressExceptions(logger log.Logger, tc TrafficController, ifName string, etherTypes []uint16, ipRules []IPRule) (failedEtherTypes []uint16, failedIPRules []IPRule) {
+	for _, ethType := range etherTypes {
+		err := tc.AllowEgressEtherType(ifName, ethType)
+		if err != nil {
+			level.Error(logger).Log("op", "allow egress ethertype", "ifName", ifName, "ethertype", fmt.Sprintf("0x%04x", ethType), "error", err)
+			failedEtherTypes = append(failedEtherTypes, ethType)
+		}
 	}
-	for _, port := range ports {
-		cmd := exec.Command("bash", "-c", fmt.Sprintf("tc filter add dev %s ingress pref 9999 protocol ip u32 match %s dst %s 0xffff action ok index 99", ifName, protocol, strconv.Itoa(port)))
-		err := cmd.Run()
+	for _, rule := range ipRules {
+		err := tc.AllowEgressIP(ifName, rule)
 		if err != nil {
-			level.Error(logger).Log("op", "tc filter add", "ifName", ifName, "protocol", protocol, "port", port, "error", err)
+			level.Error(logger).Log("op", "allow egress ip", "ifName", ifName, "rule", fmt.Sprintf("%+v", rule), "error", err)
+			failedIPRules = append(failedIPRules, rule)
 		}
 	}
-	return nil
+	return failedEtherTypes, failedIPRules
 }
 
-func UnprotectIPv6Ports(logger log.Logger, ifName string, ports []int) error {
-	if _, err := exec.LookPath("tc"); err != nil {
-		return err
+// RemoveEgressExceptions removes the rules allowing the given ethertypes and
+// IP traffic to any destination, logging rather than failing on rules which
+// could not be removed, which it returns.
+func RemoveEgressExceptions(logger log.Logger, tc TrafficController, ifName string, etherTypes []uint16, ipRules []IPRule) (failedEtherTypes []uint16, failedIPRules []IPRule) {
+	for _, ethType := range etherTypes {
+		err := tc.RemoveEgressEtherType(ifName, ethType)
+		if err != nil {
+			level.Error(logger).Log("op", "remove egress ethertype", "ifName", ifName, "ethertype", fmt.Sprintf("0x%04x", ethType), "error", err)
+			failedEtherTypes = append(failedEtherTypes, ethType)
+		}
 	}
-	for _, port := range ports {
-		cmd := exec.Command("bash", "-c", fmt.Sprintf("tc filter add dev %s ingress pref 9999 protocol ipv6 u32 match ip6 dport %s 0xffff action ok index 100", ifName, strconv.Itoa(port)))
-		err := cmd.Run()
+	for _, rule := range ipRules {
+		err := tc.RemoveEgressIP(ifName, rule)
 		if err != nil {
-			level.Error(logger).Log("op", "tc filter add", "ifName", ifName, "protocol", "ipv6", "port", port, "error", err)
+			level.Error(logger).Log("op", "remove egress ip", "ifName", ifName, "rule", fmt.Sprintf("%+v", rule), "error", err)
+			failedIPRules = append(failedIPRules, rule)
 		}
 	}
-	return nil
+	return failedEtherTypes, failedIPRules
+}
+
+// diffRules returns the rules only in config, and those only in old.
+func diffRules[T any](old, config []T, same func(a, b T) bool) (added, removed []T) {
+	for _, rule := range config {
+		if !containsRule(old, rule, same) {
+			added = append(added, rule)
+		}
+	}
+	for _, rule := range old {
+		if !containsRule(config, rule, same) {
+			removed = append(removed, rule)
+		}
+	}
+	return added, removed
+}
+
+// withoutRules returns the rules which are not in removed.
+func withoutRules[T any](rules, removed []T, same func(a, b T) bool) []T {
+	if len(removed) == 0 {
+		return rules
+	}
+	var kept []T
+	for _, rule := range rules {
+		if !containsRule(removed, rule, same) {
+			kept = append(kept, rule)
+		}
+	}
+	return kept
+}
+
+func containsRule[T any](rules []T, rule T, same func(a, b T) bool) bool {
+	for _, r := range rules {
+		if same(r, rule) {
+			return true
+		}
+	}
+	return false
+}
+
+func sameRule[T any](a, b T) bool {
+	return reflect.DeepEqual(a, b)
+}
+
+func sameMac(a, b net.HardwareAddr) bool {
+	return bytes.Equal(a, b)
+}
+
+// macProtocol is the ethertype matched by the per-supplicant rules, which
+// only pass protected frames when MACsec is required.
+func (pf *PFInfo) macProtocol() uint16 {
+	if pf.MACsecRequired {
+		return unix.ETH_P_MACSEC
+	}
+	return unix.ETH_P_ALL
+}
+
+func ipProtocol(protocol string) (uint8, error) {
+	switch protocol {
+	case tcpProtoStr:
+		return unix.IPPROTO_TCP, nil
+	case udpProtoStr:
+		return unix.IPPROTO_UDP, nil
+	}
+	return 0, fmt.Errorf("unsupported protocol %q", protocol)
 }
@@ -18,23 +18,28 @@ package trafficcontrol
 
 import (
 	"net"
+	"os"
+	"path/filepath"
 
+	"github.com/go-kit/log"
 	"github.com/k8snetworkplumbingwg/sriov-cni/pkg/utils"
 	mocks_utils "github.com/k8snetworkplumbingwg/sriov-cni/pkg/utils/mocks"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"github.com/openshift-kni/eapol-operator/internal/logging"
 	"github.com/stretchr/testify/mock"
 	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
 )
 
 var _ = Describe("tc", func() {
 	var (
-		//logger log.Logger
-		t GinkgoTInterface
+		logger log.Logger
+		t      GinkgoTInterface
 	)
 	BeforeEach(func() {
 		var err error
-		//logger, err = logging.Init("info")
+		logger, err = logging.Init("info")
 		Expect(err).NotTo(HaveOccurred())
 		t = GinkgoT()
 	})
@@ -47,10 +52,11 @@ var _ = Describe("tc", func() {
 			fakeMac, err := net.ParseMAC("6e:16:06:0e:b7:e1")
 			Expect(err).NotTo(HaveOccurred())
 			mocked := &mocks_utils.NetlinkManager{}
+			fakeTC := NewFakeTrafficController()
 			pfInfo := &PFInfo{Name: pfName, Authenticated: true, AuthenticatedAddrs: map[string]interface{}{"6e:16:06:0e:b7:e2": nil},
 				VFs: map[int]*VFInfo{0: {Index: 0, Vlan: 200,
 					Parent: &PFInfo{Name: pfName, Authenticated: true, NetLinkMgr: mocked}}},
-				NetLinkMgr: mocked}
+				NetLinkMgr: mocked, TrafficCtl: fakeTC}
 			fakeLink := &utils.FakeLink{LinkAttrs: netlink.LinkAttrs{
 				Index:        1000,
 				Name:         pfName,
@@ -61,21 +67,32 @@ var _ = Describe("tc", func() {
 			mocked.On("LinkSetVfVlan", fakeLink, 0, 200).Return(nil)
 			mocked.On("LinkSetVfState", fakeLink, 0, netlink.VF_LINK_STATE_AUTO).Return(nil)
 			err = AllowTrafficFromMac(pfInfo, "6e:16:06:0e:b7:e2", mocked)
-			if err != nil {
-				// Ignore if the error occurred while running tc command.
-				Expect(err.Error()).To(Equal("exit status 1"))
-			}
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeTC.Interface(pfName).Macs).To(Equal(map[string]FakeMacRule{
+				"6e:16:06:0e:b7:e2": {Allow: true, EthType: unix.ETH_P_ALL},
+			}))
 			mocked.AssertExpectations(t)
 		})
 
+		It("opens and closes egress traffic to a peer", func() {
+			fakeTC := NewFakeTrafficController()
+			pfInfo := &PFInfo{Name: pfName, AuthenticatedAddrs: map[string]interface{}{},
+				VFs: map[int]*VFInfo{}, TrafficCtl: fakeTC, EgressDrop: true}
+			Expect(AllowTrafficFromMac(pfInfo, "6e:16:06:0e:b7:e2", nil)).To(Succeed())
+			Expect(fakeTC.Interface(pfName).EgressMacs).To(Equal(map[string]bool{"6e:16:06:0e:b7:e2": true}))
+			Expect(DenyTrafficFromMac(pfInfo, "6e:16:06:0e:b7:e2", nil)).To(Succeed())
+			Expect(fakeTC.Interface(pfName).EgressMacs).To(Equal(map[string]bool{"6e:16:06:0e:b7:e2": false}))
+		})
+
 		It("deny traffic on a mac address", func() {
 			fakeMac, err := net.ParseMAC("6e:16:06:0e:b7:e1")
 			Expect(err).NotTo(HaveOccurred())
 			mocked := &mocks_utils.NetlinkManager{}
+			fakeTC := NewFakeTrafficController()
 			pfInfo := &PFInfo{Name: pfName, Authenticated: true,
 				VFs: map[int]*VFInfo{0: {Index: 0, Vlan: 200,
 					Parent: &PFInfo{Name: pfName, Authenticated: false, NetLinkMgr: mocked}}},
-				NetLinkMgr: mocked}
+				NetLinkMgr: mocked, TrafficCtl: fakeTC, MACsecRequired: true}
 			fakeLink := &utils.FakeLink{LinkAttrs: netlink.LinkAttrs{
 				Index:        1000,
 				Name:         pfName,
@@ -86,11 +103,266 @@ var _ = Describe("tc", func() {
 			mocked.On("LinkSetVfVlan", fakeLink, 0, ReservedVlan).Return(nil)
 			mocked.On("LinkSetVfState", fakeLink, 0, netlink.VF_LINK_STATE_DISABLE).Return(nil)
 			err = DenyTrafficFromMac(pfInfo, "6e:16:06:0e:b7:e2", mocked)
-			if err != nil {
-				// Ignore if the error occurred while running tc command.
-				Expect(err.Error()).To(Equal("exit status 1"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeTC.Interface(pfName).Macs).To(BeEmpty())
+			mocked.AssertExpectations(t)
+		})
+
+		It("rejects a malformed mac address", func() {
+			mocked := &mocks_utils.NetlinkManager{}
+			fakeTC := NewFakeTrafficController()
+			pfInfo := &PFInfo{Name: pfName, AuthenticatedAddrs: map[string]interface{}{},
+				NetLinkMgr: mocked, TrafficCtl: fakeTC}
+			err := DenyTrafficFromMac(pfInfo, "6e:16:06:0e:b7:e2 action ok", mocked)
+			Expect(err).To(HaveOccurred())
+			Expect(fakeTC.Interface(pfName)).To(BeNil())
+			mocked.AssertExpectations(t)
+		})
+	})
+
+	Context("Validating per-VF authentication", func() {
+		var (
+			mocked   *mocks_utils.NetlinkManager
+			fakeLink *utils.FakeLink
+			pfInfo   *PFInfo
+		)
+		BeforeEach(func() {
+			vf0Mac, err := net.ParseMAC("6e:16:06:0e:b7:e2")
+			Expect(err).NotTo(HaveOccurred())
+			mocked = &mocks_utils.NetlinkManager{}
+			fakeLink = &utils.FakeLink{LinkAttrs: netlink.LinkAttrs{
+				Index: 1000,
+				Name:  pfName,
+				Vfs:   []netlink.VfInfo{{ID: 0, Vlan: 200, Mac: vf0Mac}, {ID: 1, Vlan: 300}},
+			}}
+			pfInfo = &PFInfo{Name: pfName, AuthenticatedAddrs: map[string]interface{}{},
+				VFs: map[int]*VFInfo{}, NetLinkMgr: mocked, TrafficCtl: NewFakeTrafficController(),
+				PerVF: true, VFSupplicants: map[string]int{"6e:16:06:0e:b7:e3": 1}}
+			for _, vf := range fakeLink.Vfs {
+				pfInfo.VFs[vf.ID] = &VFInfo{Parent: pfInfo, Index: vf.ID, Vlan: vf.Vlan,
+					AuthenticatedAddrs: map[string]interface{}{}}
 			}
+			mocked.On("LinkByName", mock.AnythingOfType("string")).Return(fakeLink, nil)
+		})
+
+		It("only releases the VF with the supplicant's MAC address", func() {
+			mocked.On("LinkSetVfVlan", fakeLink, 0, 200).Return(nil)
+			mocked.On("LinkSetVfState", fakeLink, 0, netlink.VF_LINK_STATE_AUTO).Return(nil)
+			pfInfo.AuthenticatedAddrs["6e:16:06:0e:b7:e2"] = nil
+			Expect(AllowTrafficFromMac(pfInfo, "6e:16:06:0e:b7:e2", mocked)).To(Succeed())
+			mocked.AssertExpectations(t)
+			mocked.AssertNotCalled(t, "LinkSetVfVlan", fakeLink, 1, mock.Anything)
+
+			mocked.On("LinkSetVfVlan", fakeLink, 0, ReservedVlan).Return(nil)
+			mocked.On("LinkSetVfState", fakeLink, 0, netlink.VF_LINK_STATE_DISABLE).Return(nil)
+			delete(pfInfo.AuthenticatedAddrs, "6e:16:06:0e:b7:e2")
+			Expect(DenyTrafficFromMac(pfInfo, "6e:16:06:0e:b7:e2", mocked)).To(Succeed())
+			mocked.AssertExpectations(t)
+		})
+
+		It("releases the VF a supplicant is mapped to once", func() {
+			mocked.On("LinkSetVfVlan", fakeLink, 1, 300).Return(nil).Once()
+			mocked.On("LinkSetVfState", fakeLink, 1, netlink.VF_LINK_STATE_AUTO).Return(nil).Once()
+			Expect(AllowTrafficFromMac(pfInfo, "6E:16:06:0E:B7:E3", mocked)).To(Succeed())
+			Expect(AllowTrafficFromMac(pfInfo, "6e:16:06:0e:b7:e3", mocked)).To(Succeed())
+			Expect(pfInfo.VFs[1].AuthenticatedAddrs).To(HaveKey("6e:16:06:0e:b7:e3"))
+			mocked.AssertExpectations(t)
+		})
+
+		It("moves an authenticated supplicant to the VF it is mapped to", func() {
+			mocked.On("LinkSetVfVlan", fakeLink, 1, 300).Return(nil).Once()
+			mocked.On("LinkSetVfState", fakeLink, 1, netlink.VF_LINK_STATE_AUTO).Return(nil).Once()
+			pfInfo.AuthenticatedAddrs["6e:16:06:0e:b7:e3"] = nil
+			Expect(AllowTrafficFromMac(pfInfo, "6e:16:06:0e:b7:e3", mocked)).To(Succeed())
+			mocked.AssertExpectations(t)
+
+			mocked.On("LinkSetVfVlan", fakeLink, 0, 200).Return(nil).Once()
+			mocked.On("LinkSetVfState", fakeLink, 0, netlink.VF_LINK_STATE_AUTO).Return(nil).Once()
+			mocked.On("LinkSetVfVlan", fakeLink, 1, ReservedVlan).Return(nil).Once()
+			mocked.On("LinkSetVfState", fakeLink, 1, netlink.VF_LINK_STATE_DISABLE).Return(nil).Once()
+			Expect(pfInfo.SetVFSupplicants(map[string]int{"6e:16:06:0e:b7:e3": 0})).To(Succeed())
+			Expect(pfInfo.VFs[0].AuthenticatedAddrs).To(HaveKey("6e:16:06:0e:b7:e3"))
+			Expect(pfInfo.VFs[1].AuthenticatedAddrs).To(BeEmpty())
+			mocked.AssertExpectations(t)
+		})
+
+		It("keeps authenticated supplicants when switching to port mode and back", func() {
+			mocked.On("LinkSetVfVlan", fakeLink, 1, 300).Return(nil).Once()
+			mocked.On("LinkSetVfState", fakeLink, 1, netlink.VF_LINK_STATE_AUTO).Return(nil).Once()
+			pfInfo.AuthenticatedAddrs["6e:16:06:0e:b7:e3"] = nil
+			Expect(AllowTrafficFromMac(pfInfo, "6e:16:06:0e:b7:e3", mocked)).To(Succeed())
 			mocked.AssertExpectations(t)
+
+			mocked.On("LinkSetVfVlan", fakeLink, 0, 200).Return(nil).Once()
+			mocked.On("LinkSetVfState", fakeLink, 0, netlink.VF_LINK_STATE_AUTO).Return(nil).Once()
+			mocked.On("LinkSetVfVlan", fakeLink, 1, 300).Return(nil).Once()
+			mocked.On("LinkSetVfState", fakeLink, 1, netlink.VF_LINK_STATE_AUTO).Return(nil).Once()
+			Expect(pfInfo.SetPerVF(false)).To(Succeed())
+			Expect(pfInfo.Authenticated).To(BeTrue())
+			mocked.AssertExpectations(t)
+
+			mocked.On("LinkSetVfVlan", fakeLink, 0, ReservedVlan).Return(nil).Once()
+			mocked.On("LinkSetVfState", fakeLink, 0, netlink.VF_LINK_STATE_DISABLE).Return(nil).Once()
+			mocked.On("LinkSetVfVlan", fakeLink, 1, 300).Return(nil).Once()
+			mocked.On("LinkSetVfState", fakeLink, 1, netlink.VF_LINK_STATE_AUTO).Return(nil).Once()
+			Expect(pfInfo.SetPerVF(true)).To(Succeed())
+			Expect(pfInfo.VFs[1].AuthenticatedAddrs).To(HaveKey("6e:16:06:0e:b7:e3"))
+			mocked.AssertExpectations(t)
+		})
+
+		It("does not release any VF for other supplicants", func() {
+			Expect(AllowTrafficFromMac(pfInfo, "6e:16:06:0e:b7:e4", mocked)).To(Succeed())
+			mocked.AssertNotCalled(t, "LinkSetVfVlan", mock.Anything, mock.Anything, mock.Anything)
+		})
+	})
+
+	Context("Validating interface initialization", func() {
+		It("allows EAPOL and unprotected traffic on a plain interface", func() {
+			fakeTC := NewFakeTrafficController()
+			ipRule := IPRule{IPv6: true, Protocol: unix.IPPROTO_ICMPV6, ICMPTypes: []uint8{135, 136}}
+			err := InitInterfaceForEAPTraffic(logger, fakeTC, pfName, InterfaceConfig{
+				UnprotectedTcpPorts: []int{80},
+				UnprotectedUdpPorts: []int{53},
+				EtherTypes:          []uint16{0x88f7},
+				IPRules:             []IPRule{ipRule},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			// The test interface is not an SR-IOV VF
+			Expect(fakeTC.Interface(pfName)).To(Equal(&FakeInterface{
+				EAPOL:      true,
+				TcpPorts:   []int{80},
+				UdpPorts:   []int{53},
+				Macs:       map[string]FakeMacRule{},
+				EtherTypes: []uint16{0x88f7},
+				IPRules:    []IPRule{ipRule},
+			}))
+			Expect(fakeTC.Reset(pfName)).To(Succeed())
+			Expect(fakeTC.Interface(pfName)).To(BeNil())
+		})
+
+		It("only drops traffic on a VF", func() {
+			defer func(dir string) { sysClassNet = dir }(sysClassNet)
+			sysClassNet = GinkgoT().TempDir()
+			Expect(os.MkdirAll(filepath.Join(sysClassNet, "vf0", "device", "physfn"), 0755)).To(Succeed())
+			fakeTC := NewFakeTrafficController()
+			err := InitInterfaceForEAPTraffic(logger, fakeTC, "vf0", InterfaceConfig{
+				UnprotectedTcpPorts: []int{80},
+				EtherTypes:          []uint16{0x88f7},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeTC.Interface("vf0")).To(Equal(&FakeInterface{Macs: map[string]FakeMacRule{}}))
+		})
+
+		It("always allows and denies static MACs", func() {
+			fakeTC := NewFakeTrafficController()
+			allowed, _ := net.ParseMAC("6e:16:06:0e:b7:e2")
+			denied, _ := net.ParseMAC("6e:16:06:0e:b7:e3")
+			err := InitInterfaceForEAPTraffic(logger, fakeTC, pfName, InterfaceConfig{
+				AllowedMacs: []net.HardwareAddr{allowed},
+				DeniedMacs:  []net.HardwareAddr{denied},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeTC.Interface(pfName).AllowedMacs).To(Equal([]string{"6e:16:06:0e:b7:e2"}))
+			Expect(fakeTC.Interface(pfName).DeniedMacs).To(Equal([]string{"6e:16:06:0e:b7:e3"}))
+		})
+
+		It("drops egress traffic but EAPOL and the egress exceptions", func() {
+			fakeTC := NewFakeTrafficController()
+			ipRule := IPRule{Protocol: unix.IPPROTO_UDP, Ports: []PortRange{{67, 68}}}
+			err := InitInterfaceForEAPTraffic(logger, fakeTC, pfName, InterfaceConfig{
+				EgressDrop:       true,
+				EgressEtherTypes: []uint16{0x88cc},
+				EgressIPRules:    []IPRule{ipRule},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			iface := fakeTC.Interface(pfName)
+			Expect(iface.EgressDrop).To(BeTrue())
+			Expect(iface.EgressEtherTypes).To(Equal([]uint16{0x88cc}))
+			Expect(iface.EgressIPRules).To(Equal([]IPRule{ipRule}))
+			Expect(iface.EgressMacs).To(BeEmpty())
+		})
+
+		It("updates only the rules which changed", func() {
+			fakeTC := NewFakeTrafficController()
+			ipRule := IPRule{IPv6: true, Protocol: unix.IPPROTO_ICMPV6, ICMPTypes: []uint8{135, 136}}
+			egressRule := IPRule{Protocol: unix.IPPROTO_UDP, Ports: []PortRange{{67, 68}}}
+			moved, _ := net.ParseMAC("6e:16:06:0e:b7:e2")
+			denied, _ := net.ParseMAC("6e:16:06:0e:b7:e3")
+			old := InterfaceConfig{
+				UnprotectedTcpPorts: []int{80, 443},
+				UnprotectedUdpPorts: []int{53},
+				AllowedMacs:         []net.HardwareAddr{moved},
+				DeniedMacs:          []net.HardwareAddr{denied},
+				EtherTypes:          []uint16{0x88f7},
+				IPRules:             []IPRule{ipRule},
+				EgressDrop:          true,
+				EgressEtherTypes:    []uint16{0x88cc},
+			}
+			Expect(InitInterfaceForEAPTraffic(logger, fakeTC, pfName, old)).To(Succeed())
+			config := InterfaceConfig{
+				UnprotectedTcpPorts: []int{443, 8443},
+				DeniedMacs:          []net.HardwareAddr{denied, moved},
+				EtherTypes:          []uint16{0x88f7, 0x88cc},
+				EgressDrop:          true,
+				EgressIPRules:       []IPRule{egressRule},
+			}
+			applied, err := UpdateInterfaceConfig(logger, fakeTC, pfName, old, config)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(applied).To(Equal(config))
+			iface := fakeTC.Interface(pfName)
+			Expect(iface.TcpPorts).To(Equal([]int{443, 8443}))
+			Expect(iface.UdpPorts).To(BeEmpty())
+			Expect(iface.AllowedMacs).To(BeEmpty())
+			Expect(iface.DeniedMacs).To(Equal([]string{"6e:16:06:0e:b7:e3", "6e:16:06:0e:b7:e2"}))
+			Expect(iface.EtherTypes).To(Equal([]uint16{0x88f7, 0x88cc}))
+			Expect(iface.IPRules).To(BeEmpty())
+			Expect(iface.EgressEtherTypes).To(BeEmpty())
+			Expect(iface.EgressIPRules).To(Equal([]IPRule{egressRule}))
+		})
+
+		It("returns the rules which failed to update", func() {
+			fakeTC := NewFakeTrafficController()
+			old := InterfaceConfig{UnprotectedTcpPorts: []int{80}, EtherTypes: []uint16{0x88f7}}
+			Expect(InitInterfaceForEAPTraffic(logger, fakeTC, pfName, old)).To(Succeed())
+			fakeTC.Fail(pfName, unix.ENOBUFS)
+			applied, err := UpdateInterfaceConfig(logger, fakeTC, pfName, old, InterfaceConfig{
+				UnprotectedTcpPorts: []int{443},
+				EtherTypes:          []uint16{0x88cc},
+			})
+			Expect(err).To(HaveOccurred())
+			Expect(applied).To(Equal(old))
+
+			fakeTC.Fail(pfName, nil)
+			_, err = UpdateInterfaceConfig(logger, fakeTC, pfName, applied, InterfaceConfig{UnprotectedTcpPorts: []int{443}})
+			Expect(err).NotTo(HaveOccurred())
+			iface := fakeTC.Interface(pfName)
+			Expect(iface.TcpPorts).To(Equal([]int{443}))
+			Expect(iface.EtherTypes).To(BeEmpty())
+		})
+
+		It("skips ports of an unsupported protocol", func() {
+			fakeTC := NewFakeTrafficController()
+			Expect(fakeTC.Init(pfName)).To(Succeed())
+			UnprotectPorts(logger, fakeTC, pfName, "sctp", []int{38412})
+			UnprotectPorts(logger, fakeTC, pfName, tcpProtoStr, []int{80, 443})
+			Expect(fakeTC.Interface(pfName).TcpPorts).To(Equal([]int{80, 443}))
+		})
+	})
+
+	Context("MAC address rule handles", func() {
+		It("reuses the nodes of deleted rules", func() {
+			handles := map[string]uint32{}
+			for i := 0; i < u32MaxNode; i++ {
+				node, err := freeMacNode(handles, pfName)
+				Expect(err).NotTo(HaveOccurred())
+				// The kernel gives the node a hash table
+				handles[net.HardwareAddr{0x6e, 0x16, 0, 0, byte(i >> 8), byte(i)}.String()] = 0x801<<20 | node
+			}
+			_, err := freeMacNode(handles, pfName)
+			Expect(err).To(HaveOccurred())
+
+			delete(handles, "6e:16:00:00:00:07")
+			Expect(freeMacNode(handles, pfName)).To(Equal(uint32(8)))
 		})
 	})
 })
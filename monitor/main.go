@@ -17,6 +17,9 @@ limitations under the License.
 package main
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"net"
@@ -33,14 +36,21 @@ import (
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
 	"github.com/k8snetworkplumbingwg/sriov-cni/pkg/utils"
+	eapolv1 "github.com/openshift-kni/eapol-operator/api/v1"
 	"github.com/openshift-kni/eapol-operator/internal/k8s"
 	"github.com/openshift-kni/eapol-operator/internal/logging"
 	"github.com/openshift-kni/eapol-operator/internal/trafficcontrol"
 	"github.com/openshift-kni/eapol-operator/pkg/hostap"
+	"github.com/openshift-kni/eapol-operator/pkg/mab"
 	"github.com/openshift-kni/eapol-operator/pkg/netlink"
+	"github.com/openshift-kni/eapol-operator/pkg/radsec"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
+// defaultGuestVlanTimeout is the number of seconds to wait for EAPOL before
+// using the guest VLAN, three times the default EAP request period
+const defaultGuestVlanTimeout = 90
+
 func main() {
 	var (
 		interfaces          = flag.String("interfaces", os.Getenv("IFACES"), "Interfaces on which hostapd to listen on")
@@ -48,8 +58,36 @@ func main() {
 		unprotectedUdpPorts = flag.String("unprotected-udp-ports", os.Getenv("UNPROTECTED_UDP_PORTS"), "list of unprotected udp ports")
 		logLevel            = flag.String("log-level", "info", fmt.Sprintf("log level. must be one of: [%s]", logging.Levels.String()))
 		host                = flag.String("host", os.Getenv("AUTHENTICATOR_HOST"), "HTTP host address")
+		nodeName            = flag.String("node-name", os.Getenv("NODE_NAME"), "name of the node the status is reported under, the host name by default")
 		port                = flag.Int("port", 7472, "HTTP listening port")
 		enablePprof         = flag.Bool("enable-pprof", false, "Enable pprof profiling")
+		radsecUpstreams     = flag.String("radsec-upstreams", os.Getenv("RADSEC_UPSTREAMS"), "list of local-addr=radsec-server pairs to proxy")
+		radsecCert          = flag.String("radsec-cert", os.Getenv("RADSEC_CERT"), "RadSec client certificate file")
+		radsecKey           = flag.String("radsec-key", os.Getenv("RADSEC_KEY"), "RadSec client private key file")
+		radsecCa            = flag.String("radsec-ca", os.Getenv("RADSEC_CA"), "RadSec server certificate authority file")
+		radsecServerName    = flag.String("radsec-server-name", os.Getenv("RADSEC_SERVER_NAME"), "name to verify RadSec server certificates against")
+		macsecPolicy        = flag.String("macsec-policy", os.Getenv("MACSEC_POLICY"), "MACsec policy, empty when MACsec is disabled")
+		authMode            = flag.String("authentication-mode", os.Getenv("AUTHENTICATION_MODE"), "port or per-vf authentication of SR-IOV ports")
+		vfSupplicants       = flag.String("vf-supplicants", os.Getenv("VF_SUPPLICANTS"), "list of supplicant-mac=vf pairs for per-vf authentication")
+		tcBackend           = flag.String("traffic-control-backend", os.Getenv("TRAFFIC_CONTROL_BACKEND"), "traffic control backend, tc or nftables")
+		guestVlanArg        = flag.String("guest-vlan", os.Getenv("GUEST_VLAN"), "vlan for VFs no EAPOL was received for, empty to block them")
+		guestVlanTimeoutArg = flag.String("guest-vlan-timeout", os.Getenv("GUEST_VLAN_TIMEOUT"), "seconds to wait for EAPOL before using the guest vlan")
+		authFailVlanArg     = flag.String("auth-fail-vlan", os.Getenv("AUTH_FAIL_VLAN"), "vlan for VFs whose supplicant failed authentication, empty to block them")
+		allowedMacsArg      = flag.String("allowed-macs", os.Getenv("ALLOWED_MACS"), "list of source MAC addresses always allowed")
+		deniedMacsArg       = flag.String("denied-macs", os.Getenv("DENIED_MACS"), "list of source MAC addresses always denied")
+		exceptionsArg       = flag.String("traffic-exceptions", os.Getenv("TRAFFIC_EXCEPTIONS"), "JSON list of ethertypes and IP traffic allowed without authentication")
+		egressPolicy        = flag.String("egress-policy", os.Getenv("EGRESS_POLICY"), "egress policy, drop to only allow egress traffic to authenticated peers")
+		egressExceptionsArg = flag.String("egress-exceptions", os.Getenv("EGRESS_EXCEPTIONS"), "JSON list of ethertypes and IP traffic allowed to egress to any destination")
+		mabTimeoutArg       = flag.String("mab-timeout", os.Getenv("MAB_TIMEOUT"), "seconds to wait for EAPOL before MAC authentication bypass, empty to disable it")
+		mabMacs             = flag.String("mab-macs", os.Getenv("MAB_MACS"), "list of MAC addresses allowed by MAC authentication bypass")
+		mabRadiusServers    = flag.String("mab-radius-servers", os.Getenv("MAB_RADIUS_SERVERS"), "list of radius-server=secret-file pairs for MAC authentication bypass")
+		configFile          = flag.String("config", os.Getenv("CONFIG"), "projected hostapd configuration file")
+		secretsDir          = flag.String("secrets-dir", os.Getenv("SECRETS_DIR"), "directory of the secrets substituted into the hostapd configuration")
+		runtimeConfig       = flag.String("runtime-config", os.Getenv("RUNTIME_CONFIG"), "hostapd configuration file rendered from the projected one, empty to never reload hostapd")
+		hostapdCommand      = flag.String("hostapd", os.Getenv("HOSTAPD"), "hostapd binary run and restarted by the monitor, empty when hostapd runs on its own")
+		selectorsArg        = flag.String("interface-selectors", os.Getenv("INTERFACE_SELECTORS"), "JSON list of selectors of further interfaces to protect")
+		devicePluginConfig  = flag.String("sriov-device-plugin-config", os.Getenv("SRIOV_DEVICE_PLUGIN_CONFIG"), "SR-IOV network device plugin configuration the resource names of interface selectors are looked up in")
+		trafficPolicy       = flag.String("traffic-policy", os.Getenv("TRAFFIC_POLICY"), "JSON traffic policy file applied live, overriding the ports, MACs, exceptions, authentication mode, vf supplicants and fallback vlan flags")
 	)
 	flag.Parse()
 
@@ -59,11 +97,30 @@ func main() {
 		os.Exit(1)
 	}
 
-	if interfaces == nil || *interfaces == "" {
-		level.Error(logger).Log("op", "startup", "error", "IFACES env variable must be set", "msg", "missing configuration")
+	if *interfaces == "" && *selectorsArg == "" {
+		level.Error(logger).Log("op", "startup", "error", "IFACES or INTERFACE_SELECTORS env variable must be set", "msg", "missing configuration")
+		os.Exit(1)
+	}
+	var selectors []eapolv1.InterfaceSelector
+	if *selectorsArg != "" {
+		if err = json.Unmarshal([]byte(*selectorsArg), &selectors); err != nil {
+			level.Error(logger).Log("op", "startup", "error", "INTERFACE_SELECTORS env variable must be set properly", "msg", "incorrect configuration")
+			os.Exit(1)
+		}
+	}
+	ifaces, err := trafficcontrol.ResolveInterfaces(parseStringsArgs(interfaces), selectors, *devicePluginConfig)
+	if err != nil {
+		level.Error(logger).Log("op", "startup", "interface", "selectors", "error", err)
 		os.Exit(1)
 	}
-	ifaces := parseStringsArgs(interfaces)
+	level.Info(logger).Log("op", "startup", "interfaces", strings.Join(ifaces, ","))
+	if *nodeName == "" {
+		*nodeName, err = os.Hostname()
+		if err != nil {
+			level.Error(logger).Log("op", "startup", "error", err, "msg", "unknown node name")
+			os.Exit(1)
+		}
+	}
 
 	allowedTcpPorts, err := parseIntArgs(unprotectedTcpPorts)
 	if err != nil {
@@ -75,6 +132,60 @@ func main() {
 		level.Error(logger).Log("op", "startup", "error", "UNPROTECTED_UDP_PORTS env variable must be set properly", "msg", "incorrect configuration")
 		os.Exit(1)
 	}
+	supplicantVFs, err := parseVFSupplicants(*vfSupplicants)
+	if err != nil {
+		level.Error(logger).Log("op", "startup", "error", err, "msg", "incorrect configuration")
+		os.Exit(1)
+	}
+	allowedMacs, err := parseMacArgs(*allowedMacsArg)
+	if err != nil {
+		level.Error(logger).Log("op", "startup", "error", "ALLOWED_MACS env variable must be set properly", "msg", "incorrect configuration")
+		os.Exit(1)
+	}
+	deniedMacs, err := parseMacArgs(*deniedMacsArg)
+	if err != nil {
+		level.Error(logger).Log("op", "startup", "error", "DENIED_MACS env variable must be set properly", "msg", "incorrect configuration")
+		os.Exit(1)
+	}
+	guestVlan, err := parseIntArg(*guestVlanArg, 0)
+	if err != nil {
+		level.Error(logger).Log("op", "startup", "error", "GUEST_VLAN env variable must be set properly", "msg", "incorrect configuration")
+		os.Exit(1)
+	}
+	guestVlanTimeout, err := parseIntArg(*guestVlanTimeoutArg, defaultGuestVlanTimeout)
+	if err != nil {
+		level.Error(logger).Log("op", "startup", "error", "GUEST_VLAN_TIMEOUT env variable must be set properly", "msg", "incorrect configuration")
+		os.Exit(1)
+	}
+	authFailVlan, err := parseIntArg(*authFailVlanArg, 0)
+	if err != nil {
+		level.Error(logger).Log("op", "startup", "error", "AUTH_FAIL_VLAN env variable must be set properly", "msg", "incorrect configuration")
+		os.Exit(1)
+	}
+	etherTypes, ipRules, err := parseExceptions(*exceptionsArg)
+	if err != nil {
+		level.Error(logger).Log("op", "startup", "error", err, "msg", "incorrect configuration")
+		os.Exit(1)
+	}
+	egressEtherTypes, egressIPRules, err := parseExceptions(*egressExceptionsArg)
+	if err != nil {
+		level.Error(logger).Log("op", "startup", "error", err, "msg", "incorrect configuration")
+		os.Exit(1)
+	}
+	egressDrop := eapolv1.EgressPolicy(*egressPolicy) == eapolv1.EgressPolicyDrop
+	mabTimeout, err := parseIntArg(*mabTimeoutArg, 0)
+	if err != nil {
+		level.Error(logger).Log("op", "startup", "error", "MAB_TIMEOUT env variable must be set properly", "msg", "incorrect configuration")
+		os.Exit(1)
+	}
+	var mabAuthorizer mab.Authorizer
+	if mabTimeout > 0 {
+		mabAuthorizer, err = newMabAuthorizer(*mabMacs, *mabRadiusServers)
+		if err != nil {
+			level.Error(logger).Log("op", "startup", "mab", "authorizer", "error", err, "msg", "incorrect configuration")
+			os.Exit(1)
+		}
+	}
 	authObjKey, err := k8s.GetAuthNamespacedName()
 	if err != nil {
 		level.Error(logger).Log("op", "startup", "auth", "retrieval failed", "error", err)
@@ -103,6 +214,17 @@ func main() {
 		os.Exit(1)
 	}
 
+	err = k8s.UpdateNodeState(k8Client, *authObjKey, *nodeName, func(status *eapolv1.AuthenticatorNodeStateStatus) {
+		status.ResolvedInterfaces = ifaces
+	})
+	if err != nil {
+		level.Error(logger).Log("op", "startup", "k8s", "update node state", "error", err)
+	}
+	if len(ifaces) == 0 {
+		level.Error(logger).Log("op", "startup", "error", "no interface matches the interface selectors", "msg", "missing configuration")
+		os.Exit(1)
+	}
+
 	// register prometheus http handler
 	go func() {
 		err = registerPromHandler(*host, *port, *enablePprof)
@@ -111,13 +233,92 @@ func main() {
 		}
 	}()
 
+	var radsecProxy *radsec.Proxy
+	if *radsecUpstreams != "" {
+		radsecProxy, err = startRadsecProxy(logger, *radsecUpstreams, *radsecCert, *radsecKey, *radsecCa, *radsecServerName,
+			func(proxy *radsec.Proxy) {
+				proxy.Client = k8Client
+				proxy.AuthNsName = authObjKey
+				proxy.NodeName = *nodeName
+				proxy.Recorder = eventRecorder
+			})
+		if err != nil {
+			level.Error(logger).Log("op", "startup", "radsec", "proxy", "error", err)
+			os.Exit(1)
+		}
+	}
+
 	nLinkMgr := &utils.MyNetlink{}
-	err = initInterfaces(logger, ifaces, allowedTcpPorts, allowedUdpPorts, nLinkMgr)
+	trafficCtl, err := trafficcontrol.NewTrafficController(*tcBackend)
+	if err != nil {
+		level.Error(logger).Log("op", "startup", "error", err, "msg", "incorrect configuration")
+		os.Exit(1)
+	}
+	policyReloader := &hostap.PolicyReloader{
+		Logger:     logger,
+		PolicyFile: *trafficPolicy,
+		Config: trafficcontrol.InterfaceConfig{
+			UnprotectedTcpPorts: allowedTcpPorts,
+			UnprotectedUdpPorts: allowedUdpPorts,
+			AllowedMacs:         allowedMacs,
+			DeniedMacs:          deniedMacs,
+			EtherTypes:          etherTypes,
+			IPRules:             ipRules,
+			EgressDrop:          egressDrop,
+			EgressEtherTypes:    egressEtherTypes,
+			EgressIPRules:       egressIPRules,
+		},
+		Settings: hostap.MonitorSettings{
+			AuthenticationMode: eapolv1.AuthenticationMode(*authMode),
+			VFSupplicants:      supplicantVFs,
+			GuestVlan:          guestVlan,
+			GuestVlanTimeout:   time.Duration(guestVlanTimeout) * time.Second,
+			AuthFailVlan:       authFailVlan,
+		},
+		Interfaces: ifaces,
+		TrafficCtl: trafficCtl,
+		LinkMgr:    nLinkMgr,
+	}
+	if *trafficPolicy != "" {
+		if err = policyReloader.Load(); err != nil {
+			level.Error(logger).Log("op", "startup", "policy", *trafficPolicy, "error", err, "msg", "incorrect configuration")
+			os.Exit(1)
+		}
+	}
+	err = initInterfaces(logger, ifaces, policyReloader.InterfaceConfig, nLinkMgr, trafficCtl)
 	if err != nil {
 		level.Error(logger).Log("op", "startup", "init", "interface", "error", err)
 		os.Exit(1)
 	}
 
+	var supervisor *hostap.Supervisor
+	if *hostapdCommand != "" {
+		if *configFile == "" || *runtimeConfig == "" {
+			level.Error(logger).Log("op", "startup", "error", "CONFIG and RUNTIME_CONFIG env variables must be set to run hostapd", "msg", "missing configuration")
+			os.Exit(1)
+		}
+		supervisor = &hostap.Supervisor{
+			Logger:            logger,
+			Command:           *hostapdCommand,
+			Interfaces:        ifaces,
+			ConfigFile:        *configFile,
+			SecretsDir:        *secretsDir,
+			RuntimeConfigFile: *runtimeConfig,
+		}
+		if err = supervisor.Start(); err != nil {
+			level.Error(logger).Log("op", "startup", "hostapd", *hostapdCommand, "error", err)
+			os.Exit(1)
+		}
+		// The monitors connect to the control interfaces hostapd creates
+		if !waitHostapd(logger, supervisor, sigs) {
+			supervisor.Stop()
+			if err = resetInterfaces(ifaces, nLinkMgr, trafficCtl); err != nil {
+				level.Error(logger).Log("op", "shutdown", "reset", "interfaces", "error", err)
+			}
+			os.Exit(0)
+		}
+	}
+
 	ifEventHandler := netlink.LinkEventHandler{Logger: logger}
 	ifEventHandler.Start()
 
@@ -127,9 +328,23 @@ func main() {
 		intfMonitor := hostap.NewInterfaceMonitor(logger, intf, func(intfMonitor *hostap.InterfaceMonitor) {
 			intfMonitor.Client = k8Client
 			intfMonitor.AuthNsName = authObjKey
+			intfMonitor.NodeName = *nodeName
 			intfMonitor.IfEventHandler = ifEventHandler
 			intfMonitor.Recorder = eventRecorder
 			intfMonitor.LinkMgr = nLinkMgr
+			intfMonitor.TrafficCtl = trafficCtl
+			intfMonitor.MACsecPolicy = eapolv1.MACsecPolicy(*macsecPolicy)
+			settings := policyReloader.InterfaceSettings(intf)
+			intfMonitor.AuthenticationMode = settings.AuthenticationMode
+			intfMonitor.VFSupplicants = settings.VFSupplicants
+			intfMonitor.GuestVlan = settings.GuestVlan
+			intfMonitor.GuestVlanTimeout = settings.GuestVlanTimeout
+			intfMonitor.AuthFailVlan = settings.AuthFailVlan
+			intfMonitor.AllowedMacs = policyReloader.InterfaceConfig(intf).AllowedMacs
+			intfMonitor.DeniedMacs = policyReloader.InterfaceConfig(intf).DeniedMacs
+			intfMonitor.MABAuthorizer = mabAuthorizer
+			intfMonitor.MABTimeout = time.Duration(mabTimeout) * time.Second
+			intfMonitor.EgressDrop = egressDrop
 		})
 		err = intfMonitor.StartMonitor()
 		if err != nil {
@@ -138,21 +353,69 @@ func main() {
 		}
 		monitors = append(monitors, intfMonitor)
 	}
+	if supervisor != nil {
+		supervisor.SetMonitors(monitors)
+	}
+
+	var reloader *hostap.ConfigReloader
+	if *runtimeConfig != "" && *configFile != "" {
+		reloader = &hostap.ConfigReloader{
+			Logger:            logger,
+			ConfigFile:        *configFile,
+			SecretsDir:        *secretsDir,
+			RuntimeConfigFile: *runtimeConfig,
+			Monitors:          monitors,
+		}
+		reloader.Start()
+	}
+	if *trafficPolicy != "" {
+		policyReloader.Monitors = monitors
+		policyReloader.Start()
+	}
 
 	go func() {
-		<-sigs
+		for sig := range sigs {
+			if sig != syscall.SIGHUP {
+				break
+			}
+			// SIGHUP reloads the configuration right away rather than
+			// on the next poll
+			level.Info(logger).Log("op", "reload", "msg", "reloading configuration")
+			if reloader != nil {
+				if _, err := reloader.Reload(); err != nil {
+					level.Error(logger).Log("op", "reload", "config", *configFile, "error", err)
+				}
+			}
+			if *trafficPolicy != "" {
+				if _, err := policyReloader.Reload(); err != nil {
+					level.Error(logger).Log("op", "reload", "policy", *trafficPolicy, "error", err)
+				}
+			}
+		}
 		level.Info(logger).Log("op", "shutdown", "msg", "starting shutdown")
 		done <- true
 	}()
 	// Capture signals to cleanup before exiting
 	<-done
 	close(done)
+	if supervisor != nil {
+		supervisor.Stop()
+	}
+	if reloader != nil {
+		reloader.Stop()
+	}
+	if *trafficPolicy != "" {
+		policyReloader.Stop()
+	}
 	for _, monitor := range monitors {
 		monitor.StopMonitor()
 	}
 	ifEventHandler.StopHandler()
+	if radsecProxy != nil {
+		radsecProxy.Stop()
+	}
 
-	err = resetInterfaces(logger, ifaces, nLinkMgr)
+	err = resetInterfaces(ifaces, nLinkMgr, trafficCtl)
 	if err != nil {
 		level.Error(logger).Log("op", "shutdown", "reset", "interfaces", "error", err)
 	}
@@ -160,7 +423,8 @@ func main() {
 	level.Info(logger).Log("op", "shutdown", "msg", "done")
 }
 
-func initInterfaces(logger log.Logger, interfaces []string, unprotectedTcpPorts, unprotectedUdpPorts []int, nLinkMgr utils.NetlinkManager) error {
+func initInterfaces(logger log.Logger, interfaces []string, config func(string) trafficcontrol.InterfaceConfig, nLinkMgr utils.NetlinkManager,
+	trafficCtl trafficcontrol.TrafficController) error {
 	if interfaces == nil {
 		return nil
 	}
@@ -171,7 +435,7 @@ func initInterfaces(logger log.Logger, interfaces []string, unprotectedTcpPorts,
 			return err
 		}
 		for _, linkName := range pfvfs {
-			err = trafficcontrol.InitInterfaceForEAPTraffic(logger, linkName, unprotectedTcpPorts, unprotectedUdpPorts)
+			err = trafficcontrol.InitInterfaceForEAPTraffic(logger, trafficCtl, linkName, config(iface))
 			if err != nil {
 				return err
 			}
@@ -180,6 +444,53 @@ func initInterfaces(logger log.Logger, interfaces []string, unprotectedTcpPorts,
 	return nil
 }
 
+// waitHostapd waits for hostapd to first create its control interfaces,
+// returning false if the monitor is shut down first.
+func waitHostapd(logger log.Logger, supervisor *hostap.Supervisor, sigs chan os.Signal) bool {
+	for {
+		select {
+		case <-supervisor.Up():
+			return true
+		case sig := <-sigs:
+			// There is nothing to reload yet
+			if sig != syscall.SIGHUP {
+				level.Info(logger).Log("op", "shutdown", "msg", "shutting down before hostapd started")
+				return false
+			}
+		}
+	}
+}
+
+func startRadsecProxy(logger log.Logger, upstreamsArg, certFile, keyFile, caFile, serverName string, opts ...radsec.Opts) (*radsec.Proxy, error) {
+	var upstreams []radsec.Upstream
+	for _, pair := range parseStringsArgs(&upstreamsArg) {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid radsec upstream %q", pair)
+		}
+		upstreams = append(upstreams, radsec.Upstream{Listen: parts[0], Server: parts[1]})
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	caPem, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	caPool := x509.NewCertPool()
+	if !caPool.AppendCertsFromPEM(caPem) {
+		return nil, fmt.Errorf("no certificates found in %s", caFile)
+	}
+	proxy := radsec.NewProxy(logger, upstreams, &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      caPool,
+		ServerName:   serverName,
+		MinVersion:   tls.VersionTLS12,
+	}, opts...)
+	return proxy, proxy.Start()
+}
+
 func registerPromHandler(host string, port int, enablePprof bool) error {
 	mux := http.NewServeMux()
 	mux.Handle("/metrics", promhttp.Handler())
@@ -198,7 +509,7 @@ func registerPromHandler(host string, port int, enablePprof bool) error {
 	return server.ListenAndServe()
 }
 
-func resetInterfaces(logger log.Logger, interfaces []string, nLinkMgr utils.NetlinkManager) error {
+func resetInterfaces(interfaces []string, nLinkMgr utils.NetlinkManager, trafficCtl trafficcontrol.TrafficController) error {
 	if interfaces == nil {
 		return nil
 	}
@@ -208,7 +519,7 @@ func resetInterfaces(logger log.Logger, interfaces []string, nLinkMgr utils.Netl
 			return err
 		}
 		for _, linkName := range pfvfs {
-			err = trafficcontrol.ResetInterface(logger, linkName)
+			err = trafficCtl.Reset(linkName)
 			if err != nil {
 				return err
 			}
@@ -217,6 +528,85 @@ func resetInterfaces(logger log.Logger, interfaces []string, nLinkMgr utils.Netl
 	return nil
 }
 
+// parseVFSupplicants parses a list of supplicant-mac=vf pairs, normalizing
+// the MAC addresses to the form hostapd reports them in.
+func parseVFSupplicants(arg string) (map[string]int, error) {
+	supplicants := map[string]int{}
+	for _, pair := range parseStringsArgs(&arg) {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid vf supplicant %q", pair)
+		}
+		mac, err := net.ParseMAC(parts[0])
+		if err != nil {
+			return nil, err
+		}
+		vf, err := strconv.Atoi(parts[1])
+		if err != nil {
+			return nil, err
+		}
+		supplicants[mac.String()] = vf
+	}
+	return supplicants, nil
+}
+
+// newMabAuthorizer authorizes MAB against the local MAC list if there is
+// one, and otherwise against the RADIUS servers.  Each server is paired with
+// the file holding its shared secret, which is read on every authorization as
+// the kubelet updates it when the Secret is rotated, while servers without a
+// pair are RadSec proxy listeners and use its fixed shared secret.
+func newMabAuthorizer(macsArg, serversArg string) (mab.Authorizer, error) {
+	if macsArg != "" {
+		return mab.NewLocalAuthorizer(parseStringsArgs(&macsArg))
+	}
+	var servers []mab.RadiusServer
+	for _, entry := range parseStringsArgs(&serversArg) {
+		parts := strings.SplitN(entry, "=", 2)
+		server := mab.RadiusServer{Address: parts[0], Secret: radsec.SharedSecret}
+		if len(parts) == 2 {
+			server.Secret = ""
+			server.SecretFile = parts[1]
+		}
+		servers = append(servers, server)
+	}
+	if len(servers) == 0 {
+		return nil, fmt.Errorf("no MAC addresses or RADIUS servers to authorize MAB against")
+	}
+	return mab.NewRadiusAuthorizer(servers), nil
+}
+
+// parseExceptions parses the JSON list of traffic exceptions.
+func parseExceptions(arg string) ([]uint16, []trafficcontrol.IPRule, error) {
+	if arg == "" {
+		return nil, nil, nil
+	}
+	var exceptions []eapolv1.TrafficException
+	if err := json.Unmarshal([]byte(arg), &exceptions); err != nil {
+		return nil, nil, fmt.Errorf("invalid traffic exceptions: %w", err)
+	}
+	return trafficcontrol.ParseExceptions(exceptions)
+}
+
+func parseMacArgs(arg string) ([]net.HardwareAddr, error) {
+	var macs []net.HardwareAddr
+	for _, macStr := range parseStringsArgs(&arg) {
+		mac, err := net.ParseMAC(macStr)
+		if err != nil {
+			return nil, err
+		}
+		macs = append(macs, mac)
+	}
+	return macs, nil
+}
+
+// parseIntArg parses a single integer, which is def when unset.
+func parseIntArg(arg string, def int) (int, error) {
+	if arg == "" {
+		return def, nil
+	}
+	return strconv.Atoi(arg)
+}
+
 func parseIntArgs(arg *string) ([]int, error) {
 	var argSlice []int
 	if arg == nil || *arg == "" {
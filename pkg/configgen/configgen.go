@@ -18,9 +18,15 @@ package configgen
 
 import (
 	"bytes"
+	"crypto/sha256"
 	_ "embed"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"html/template"
+	"net"
+	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -33,28 +39,58 @@ import (
 )
 
 const (
-	AppId                   = "authenticator.eapol"
-	AuthNamespace           = "authenticator-namespace"
-	AuthName                = "authenticator-name"
-	AuthenticatorMountPath  = "/config/auth"
-	configFile              = "hostapd.conf"
-	userFile                = "hostapd.eap_user"
-	caFile                  = "1x-ca.pem"
-	certFile                = "1x-hostapd.example.com.pem"
-	privateKeyFile          = "1x-hostapd.example.com.key"
-	radiusClientFile        = "hostapd.radius_clients"
+	AppId                  = "authenticator.eapol"
+	AuthNamespace          = "authenticator-namespace"
+	AuthName               = "authenticator-name"
+	AuthenticatorMountPath = "/config/auth"
+	configFile             = "hostapd.conf"
+	trafficPolicyFile      = "traffic-policy.json"
+	userFile               = "hostapd.eap_user"
+	caFile                 = "1x-ca.pem"
+	certFile               = "1x-hostapd.example.com.pem"
+	privateKeyFile         = "1x-hostapd.example.com.key"
+	radiusClientFile       = "hostapd.radius_clients"
+	secretsDir             = "secrets"
+	radiusAuthPort         = 1812
+	radiusAcctPort         = 1813
+	radsecDir              = "radsec"
+	radsecPort             = 2083
+	// The RadSec proxy listens on a loopback port per server, the webhook
+	// allowing at most 10 servers of each kind and a single Authenticator
+	// using RadSec per node
+	radsecAuthListenPort = 18120
+	radsecAcctListenPort = 18130
+	radsecMABListenPort  = 18140
+	radsecCertFile       = "tls.crt"
+	radsecKeyFile        = "tls.key"
+	radsecCaFile         = "ca.crt"
+	// radsecSharedSecret is the fixed RADIUS shared secret used over RadSec (RFC 6614)
+	radsecSharedSecret      = "radsec"
+	mkaCakFile              = "mka-cak"
+	mkaCknFile              = "mka-ckn"
+	defaultMABTimeout       = 30
+	defaultMKAPriority      = 255
 	configMountPath         = "/config"
 	configVolumeName        = "config-volume"
 	socketsMountPath        = "/var/run/hostapd"
 	socketsVolumeName       = "sockets-volume"
 	authenticatorVolumeName = "authenticator-volume"
+	runtimeMountPath        = "/run/eapol"
+	runtimeVolumeName       = "runtime-volume"
+	devicePluginConfigDir   = "/etc/pcidp"
+	devicePluginConfigFile  = "config.json"
+	devicePluginVolumeName  = "device-plugin-volume"
 	defaultImage            = "quay.io/openshift-kni/eapol-authenticator:latest"
 	disabledSelector        = "no-node"
 	disabledReason          = "Disabled_via_config"
-	mainCommand             = "/bin/hostapd-start.sh"
 	monitorCommand          = "/bin/hostapd-monitor"
+	hostapdCommand          = "/usr/sbin/hostapd"
 )
 
+// SecretsHashAnnotation is the pod template annotation holding the hash of the
+// Secrets only read at startup, so that changing them rolls out new pods
+const SecretsHashAnnotation = "eapol.openshift.io/secrets-hash"
+
 /* Defaults to avoid excessive reconciliations: */
 var defaultFileMode int32 = 420
 var terminationGracePeriod int64 = 30
@@ -67,6 +103,7 @@ var maxUnavailable = intstr.FromInt(1)
 type ConfigGenerator struct {
 	a11r           *eapolv1.Authenticator
 	serviceAccount string
+	secretsHash    string
 }
 
 func New(a11r *eapolv1.Authenticator, serviceAccount string) *ConfigGenerator {
@@ -79,28 +116,222 @@ func New(a11r *eapolv1.Authenticator, serviceAccount string) *ConfigGenerator {
 //go:embed data/hostapd.conf.tmpl
 var hostapdConfTemplate string
 
-func (g *ConfigGenerator) ConfigMap() (*corev1.ConfigMap, error) {
-	var buffer bytes.Buffer
-	tmpl, err := template.New(configFile).Parse(hostapdConfTemplate)
-	if err != nil {
-		return nil, err
+// templateData is the hostapd.conf template input: the Authenticator spec plus
+// values derived from it.
+type templateData struct {
+	eapolv1.AuthenticatorSpec
+	RadiusAuthServers []radiusServer
+	RadiusAcctServers []radiusServer
+	MACsecConfig      *macsecConfig
+	// ConfigID identifies the settings authenticated sessions depend on
+	ConfigID string
+}
+
+// macsecConfig is the MACsec spec translated to hostapd option values.
+type macsecConfig struct {
+	IntegrityOnly  int
+	ReplayProtect  int
+	ReplayWindow   int
+	CsIndex        int
+	Priority       int
+	CakPlaceholder string
+	CknPlaceholder string
+}
+
+// radiusServer is a RADIUS server with its defaults resolved and its shared
+// secret replaced by a placeholder for the monitor to substitute.  With
+// the TLS transport, hostapd talks to a loopback RadSec proxy instead, which
+// relays to Upstream.
+type radiusServer struct {
+	Address  string
+	Port     int
+	Upstream string
+	// secretName is the file name of the projected shared secret, if any
+	secretName string
+	secret     *eapolv1.SecretKeyRef
+}
+
+func (s radiusServer) SecretPlaceholder() string {
+	if s.Upstream != "" {
+		return radsecSharedSecret
 	}
-	err = tmpl.Execute(&buffer, g.a11r.Spec)
-	if err != nil {
-		return nil, err
+	if s.secretName == "" {
+		return ""
 	}
+	return fmt.Sprintf("$SECRET{%s}", s.secretName)
+}
+
+func (g *ConfigGenerator) ConfigMap() (*corev1.ConfigMap, error) {
 	cm := &corev1.ConfigMap{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      g.a11r.Name,
 			Namespace: g.a11r.Namespace,
 		},
-		Data: map[string]string{
-			configFile: buffer.String(),
-		},
+		Data: map[string]string{},
+	}
+	if err := g.render(cm.Data, ""); err != nil {
+		return nil, err
+	}
+	// Overridden interfaces get their own hostapd configuration and traffic
+	// policy, which the monitor prefers to the shared ones
+	for _, override := range g.a11r.Spec.InterfaceOverrides {
+		if err := g.forInterface(override).render(cm.Data, override.Interface); err != nil {
+			return nil, err
+		}
 	}
 	return cm, nil
 }
 
+// render adds the hostapd configuration and traffic policy to data, under
+// the keys of ifName if set.
+func (g *ConfigGenerator) render(data map[string]string, ifName string) error {
+	var buffer bytes.Buffer
+	tmpl, err := template.New(configFile).Parse(hostapdConfTemplate)
+	if err != nil {
+		return err
+	}
+	configID, err := g.sessionConfigID()
+	if err != nil {
+		return err
+	}
+	err = tmpl.Execute(&buffer, templateData{
+		AuthenticatorSpec: g.a11r.Spec,
+		RadiusAuthServers: g.radiusAuthServers(),
+		RadiusAcctServers: g.radiusAcctServers(),
+		MACsecConfig:      g.macsecConfig(),
+		ConfigID:          configID,
+	})
+	if err != nil {
+		return err
+	}
+	trafficPolicy, err := json.Marshal(g.trafficPolicy())
+	if err != nil {
+		return err
+	}
+	data[InterfaceFile(configFile, ifName)] = buffer.String()
+	data[InterfaceFile(trafficPolicyFile, ifName)] = string(trafficPolicy)
+	return nil
+}
+
+// InterfaceFile returns the name of the file holding the configuration of
+// an overridden interface, such as hostapd-ens3f0.conf for hostapd.conf, or
+// file itself for an empty ifName.
+func InterfaceFile(file, ifName string) string {
+	if ifName == "" {
+		return file
+	}
+	ext := filepath.Ext(file)
+	return strings.TrimSuffix(file, ext) + "-" + ifName + ext
+}
+
+// forInterface returns a generator for the Authenticator with the settings
+// of an interface override applied.
+func (g *ConfigGenerator) forInterface(override eapolv1.InterfaceOverride) *ConfigGenerator {
+	a11r := g.a11r.DeepCopy()
+	spec := &a11r.Spec
+	spec.Interfaces = []string{override.Interface}
+	if override.EapReauthPeriod != nil {
+		if spec.Configuration == nil {
+			spec.Configuration = &eapolv1.Config{}
+		}
+		spec.Configuration.EapReauthPeriod = *override.EapReauthPeriod
+	}
+	if override.DynamicVlan != "" && spec.Authentication.Radius != nil {
+		spec.Authentication.Radius.DynamicVlan = override.DynamicVlan
+	}
+	if override.UnprotectedPorts != nil {
+		if spec.TrafficControl == nil {
+			spec.TrafficControl = &eapolv1.TrafficControl{}
+		}
+		spec.TrafficControl.UnprotectedPorts = override.UnprotectedPorts.DeepCopy()
+	}
+	if override.AuthenticationMode != "" || override.GuestVlan != nil || override.GuestVlanTimeout != nil || override.AuthFailVlan != nil {
+		if spec.TrafficControl == nil {
+			spec.TrafficControl = &eapolv1.TrafficControl{}
+		}
+		if override.AuthenticationMode != "" {
+			spec.TrafficControl.AuthenticationMode = override.AuthenticationMode
+		}
+		if override.GuestVlan != nil {
+			spec.TrafficControl.GuestVlan = *override.GuestVlan
+		}
+		if override.GuestVlanTimeout != nil {
+			spec.TrafficControl.GuestVlanTimeout = *override.GuestVlanTimeout
+		}
+		if override.AuthFailVlan != nil {
+			spec.TrafficControl.AuthFailVlan = *override.AuthFailVlan
+		}
+	}
+	return New(a11r, g.serviceAccount)
+}
+
+// sessionConfigID identifies the settings which authenticated sessions
+// depend on.  When hostapd reloads a configuration with the same config_id,
+// it keeps its stations, so changing other settings such as the
+// reauthentication period or the accounting servers does not force
+// supplicants to authenticate again.
+func (g *ConfigGenerator) sessionConfigID() (string, error) {
+	auth := g.a11r.Spec.Authentication.DeepCopy()
+	// MAB is implemented by the monitor
+	auth.MAB = nil
+	if auth.Radius != nil {
+		auth.Radius.Accounting = nil
+		auth.Radius.RetryPrimaryInterval = 0
+	}
+	data, err := json.Marshal(struct {
+		Authentication *eapolv1.Auth
+		MACsec         *eapolv1.MACsec
+	}{auth, g.a11r.Spec.MACsec})
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8]), nil
+}
+
+// ConfigHash returns the SHA-256 hash of the rendered contents of a
+// ConfigMap, in key order.
+func ConfigHash(cm *corev1.ConfigMap) string {
+	keys := make([]string, 0, len(cm.Data))
+	for key := range cm.Data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	hash := sha256.New()
+	for _, key := range keys {
+		fmt.Fprintf(hash, "%s\x00%s\x00", key, cm.Data[key])
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// SecretsHash returns the SHA-256 hash of Secret values, keyed by Secret
+// name and key.  A nil value stands for a missing Secret or key.
+func SecretsHash(values map[eapolv1.SecretKeyRef][]byte) string {
+	refs := make([]eapolv1.SecretKeyRef, 0, len(values))
+	for ref := range values {
+		refs = append(refs, ref)
+	}
+	sort.Slice(refs, func(i, j int) bool {
+		if refs[i].Name != refs[j].Name {
+			return refs[i].Name < refs[j].Name
+		}
+		return refs[i].Key < refs[j].Key
+	})
+	hash := sha256.New()
+	for _, ref := range refs {
+		value := values[ref]
+		fmt.Fprintf(hash, "%s\x00%s\x00%t\x00%d\x00", ref.Name, ref.Key, value != nil, len(value))
+		hash.Write(value)
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// SetSecretsHash sets the hash of the referenced Secrets to stamp on the pod
+// template, from SecretsHash.
+func (g *ConfigGenerator) SetSecretsHash(hash string) {
+	g.secretsHash = hash
+}
+
 func (g *ConfigGenerator) Daemonset() *appsv1.DaemonSet {
 	nodeSelector := g.a11r.Spec.NodeSelector
 	if !g.a11r.Spec.Enabled {
@@ -112,21 +343,19 @@ func (g *ConfigGenerator) Daemonset() *appsv1.DaemonSet {
 	}
 	ls := map[string]string{"app": AppId, AuthNamespace: g.a11r.Namespace,
 		AuthName: g.a11r.Name}
+	// Project every key of the ConfigMap, so that the configurations of
+	// interfaces overridden later appear without a rollout
 	projectedConfigVolumes := []corev1.VolumeProjection{{
 		ConfigMap: &corev1.ConfigMapProjection{
 			LocalObjectReference: corev1.LocalObjectReference{
 				Name: g.a11r.Name,
 			},
-			Items: []corev1.KeyToPath{{
-				Key:  configFile,
-				Path: configFile,
-			}},
 		},
 	}}
 	if g.a11r.Spec.Authentication.Local != nil && g.a11r.Spec.Authentication.Local.UserFileSecret != nil {
 		secretKey := g.a11r.Spec.Authentication.Local.UserFileSecret.Key
 		if secretKey == "" {
-			secretKey = userFile
+			secretKey = eapolv1.DefaultUserFileKey
 		}
 		projectedConfigVolumes = append(projectedConfigVolumes, corev1.VolumeProjection{
 			Secret: &corev1.SecretProjection{
@@ -142,6 +371,9 @@ func (g *ConfigGenerator) Daemonset() *appsv1.DaemonSet {
 	}
 	projectedConfigVolumes = g.appendCertVolume(projectedConfigVolumes)
 	projectedConfigVolumes = g.appendRadiusClientVolume(projectedConfigVolumes)
+	projectedConfigVolumes = g.appendRadiusSecretVolume(projectedConfigVolumes)
+	projectedConfigVolumes = g.appendRadsecVolume(projectedConfigVolumes)
+	projectedConfigVolumes = g.appendMACsecVolume(projectedConfigVolumes)
 	image := g.a11r.Spec.Image
 	if image == "" {
 		image = defaultImage
@@ -160,6 +392,9 @@ func (g *ConfigGenerator) Daemonset() *appsv1.DaemonSet {
 			}, {
 				Name:      authenticatorVolumeName,
 				MountPath: AuthenticatorMountPath,
+			}, {
+				Name:      runtimeVolumeName,
+				MountPath: runtimeMountPath,
 			}},
 			SecurityContext: &corev1.SecurityContext{
 				Capabilities: &corev1.Capabilities{
@@ -178,7 +413,68 @@ func (g *ConfigGenerator) Daemonset() *appsv1.DaemonSet {
 
 	ifaces := strings.Join(g.a11r.Spec.Interfaces, ",")
 
-	unprotectedTcpList, unprotectedUdpList := g.parsePorts()
+	// The monitor runs hostapd and renders the projected config into the
+	// runtime copy hostapd reads, when starting hostapd and whenever the
+	// kubelet updates the projection, before reloading hostapd.
+	configEnv := []corev1.EnvVar{{
+		Name:  "CONFIG",
+		Value: fmt.Sprintf("%s/%s", configMountPath, configFile),
+	}, {
+		Name:  "RUNTIME_CONFIG",
+		Value: fmt.Sprintf("%s/%s", runtimeMountPath, configFile),
+	}}
+	if g.hasRadiusSharedSecrets() || len(g.MACsecSecretRefs()) > 0 {
+		configEnv = append(configEnv, corev1.EnvVar{
+			Name:  "SECRETS_DIR",
+			Value: fmt.Sprintf("%s/%s", configMountPath, secretsDir),
+		})
+	}
+
+	// The traffic policy is passed in the ConfigMap rather than the
+	// environment, so that the monitor applies changes to it without the
+	// pods being rolled out.
+	monitorEnv := []corev1.EnvVar{{
+		Name:  "IFACES",
+		Value: ifaces,
+	}, {
+		Name:  "HOSTAPD",
+		Value: hostapdCommand,
+	}, {
+		Name:  "TRAFFIC_POLICY",
+		Value: fmt.Sprintf("%s/%s", configMountPath, trafficPolicyFile),
+	}, {
+		Name:      "AUTHENTICATOR_HOST",
+		ValueFrom: &corev1.EnvVarSource{FieldRef: &corev1.ObjectFieldSelector{FieldPath: "status.hostIP"}},
+	}, {
+		Name:      "NODE_NAME",
+		ValueFrom: &corev1.EnvVarSource{FieldRef: &corev1.ObjectFieldSelector{FieldPath: "spec.nodeName"}},
+	}}
+	if g.a11r.Spec.TrafficControl != nil && g.a11r.Spec.TrafficControl.Backend != "" {
+		monitorEnv = append(monitorEnv, corev1.EnvVar{
+			Name:  "TRAFFIC_CONTROL_BACKEND",
+			Value: string(g.a11r.Spec.TrafficControl.Backend),
+		})
+	}
+	monitorEnv = append(monitorEnv, configEnv...)
+	monitorEnv = append(monitorEnv, g.interfaceSelectorsEnv()...)
+	monitorEnv = append(monitorEnv, g.egressEnv()...)
+	monitorEnv = append(monitorEnv, g.mabEnv()...)
+	monitorEnv = append(monitorEnv, g.radsecEnv()...)
+	if g.a11r.Spec.MACsec != nil {
+		policy := g.a11r.Spec.MACsec.Policy
+		if policy == "" {
+			policy = eapolv1.MACsecPolicyShouldSecure
+		}
+		monitorEnv = append(monitorEnv, corev1.EnvVar{
+			Name:  "MACSEC_POLICY",
+			Value: string(policy),
+		})
+	}
+
+	var podAnnotations map[string]string
+	if g.secretsHash != "" {
+		podAnnotations = map[string]string{SecretsHashAnnotation: g.secretsHash}
+	}
 
 	ds := &appsv1.DaemonSet{
 		ObjectMeta: metav1.ObjectMeta{
@@ -192,41 +488,15 @@ func (g *ConfigGenerator) Daemonset() *appsv1.DaemonSet {
 			},
 			Template: corev1.PodTemplateSpec{
 				ObjectMeta: metav1.ObjectMeta{
-					Labels: ls,
+					Labels:      ls,
+					Annotations: podAnnotations,
 				},
 				Spec: corev1.PodSpec{
 					NodeSelector:       nodeSelector,
 					HostNetwork:        true,
 					ServiceAccountName: g.serviceAccount,
 					Containers: []corev1.Container{
-						container("hostapd", mainCommand,
-							[]corev1.EnvVar{{
-								Name:  "IFACES",
-								Value: ifaces,
-							}, {
-								Name:  "UNPROTECTED_TCP_PORTS",
-								Value: unprotectedTcpList,
-							}, {
-								Name:  "UNPROTECTED_UDP_PORTS",
-								Value: unprotectedUdpList,
-							}, {
-								Name:  "CONFIG",
-								Value: fmt.Sprintf("%s/%s", configMountPath, configFile),
-							}}),
-						container("hostapd-monitor", monitorCommand,
-							[]corev1.EnvVar{{
-								Name:  "IFACES",
-								Value: ifaces,
-							}, {
-								Name:  "UNPROTECTED_TCP_PORTS",
-								Value: unprotectedTcpList,
-							}, {
-								Name:  "UNPROTECTED_UDP_PORTS",
-								Value: unprotectedUdpList,
-							}, {
-								Name:      "AUTHENTICATOR_HOST",
-								ValueFrom: &corev1.EnvVarSource{FieldRef: &corev1.ObjectFieldSelector{FieldPath: "status.hostIP"}},
-							}}),
+						container("hostapd-monitor", monitorCommand, monitorEnv),
 					},
 					Volumes: []corev1.Volume{{
 						Name: configVolumeName,
@@ -248,6 +518,13 @@ func (g *ConfigGenerator) Daemonset() *appsv1.DaemonSet {
 						VolumeSource: corev1.VolumeSource{DownwardAPI: &corev1.DownwardAPIVolumeSource{
 							Items: []corev1.DownwardAPIVolumeFile{{Path: "labels",
 								FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.labels"}}}}},
+					}, {
+						// The runtime config holds the substituted secrets,
+						// so keep it in memory
+						Name: runtimeVolumeName,
+						VolumeSource: corev1.VolumeSource{
+							EmptyDir: &corev1.EmptyDirVolumeSource{Medium: corev1.StorageMediumMemory},
+						},
 					}},
 					/* Defaults to avoid excessive reconciliations: */
 					RestartPolicy:                 "Always",
@@ -271,14 +548,70 @@ func (g *ConfigGenerator) Daemonset() *appsv1.DaemonSet {
 		},
 	}
 
+	g.appendDevicePluginVolume(ds)
+
 	return ds
 }
 
+// interfaceSelectorsEnv passes the interface selectors as JSON to the
+// monitor, which resolves them on its node.
+func (g *ConfigGenerator) interfaceSelectorsEnv() []corev1.EnvVar {
+	if len(g.a11r.Spec.InterfaceSelectors) == 0 {
+		return nil
+	}
+	selectors, _ := json.Marshal(g.a11r.Spec.InterfaceSelectors)
+	env := []corev1.EnvVar{{
+		Name:  "INTERFACE_SELECTORS",
+		Value: string(selectors),
+	}}
+	if g.hasResourceNameSelectors() {
+		env = append(env, corev1.EnvVar{
+			Name:  "SRIOV_DEVICE_PLUGIN_CONFIG",
+			Value: fmt.Sprintf("%s/%s", devicePluginConfigDir, devicePluginConfigFile),
+		})
+	}
+	return env
+}
+
+func (g *ConfigGenerator) hasResourceNameSelectors() bool {
+	for _, selector := range g.a11r.Spec.InterfaceSelectors {
+		if selector.ResourceName != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// appendDevicePluginVolume mounts the SR-IOV network device plugin
+// configuration of the node into the monitor, to resolve the resource names
+// of interface selectors.
+func (g *ConfigGenerator) appendDevicePluginVolume(ds *appsv1.DaemonSet) {
+	if !g.hasResourceNameSelectors() {
+		return
+	}
+	podSpec := &ds.Spec.Template.Spec
+	/* Defaults to avoid excessive reconciliations: */
+	hostPathType := corev1.HostPathUnset
+	/* -------------------------------------------- */
+	podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+		Name: devicePluginVolumeName,
+		VolumeSource: corev1.VolumeSource{
+			HostPath: &corev1.HostPathVolumeSource{Path: devicePluginConfigDir, Type: &hostPathType},
+		},
+	})
+	monitor := &podSpec.Containers[0]
+	monitor.VolumeMounts = append(monitor.VolumeMounts, corev1.VolumeMount{
+		Name:      devicePluginVolumeName,
+		MountPath: devicePluginConfigDir,
+		ReadOnly:  true,
+	})
+}
+
 func (g *ConfigGenerator) appendCertVolume(volumes []corev1.VolumeProjection) []corev1.VolumeProjection {
 	if g.a11r.Spec.Authentication.Local != nil && g.a11r.Spec.Authentication.Local.CaCertSecret != nil {
 		caSecretKey := g.a11r.Spec.Authentication.Local.CaCertSecret.Key
 		if caSecretKey == "" {
-			caSecretKey = caFile
+			caSecretKey = eapolv1.DefaultCaCertKey
 		}
 		volumes = append(volumes, corev1.VolumeProjection{
 			Secret: &corev1.SecretProjection{
@@ -295,7 +628,7 @@ func (g *ConfigGenerator) appendCertVolume(volumes []corev1.VolumeProjection) []
 	if g.a11r.Spec.Authentication.Local != nil && g.a11r.Spec.Authentication.Local.ServerCertSecret != nil {
 		certSecretKey := g.a11r.Spec.Authentication.Local.ServerCertSecret.Key
 		if certSecretKey == "" {
-			certSecretKey = certFile
+			certSecretKey = eapolv1.DefaultServerCertKey
 		}
 		volumes = append(volumes, corev1.VolumeProjection{
 			Secret: &corev1.SecretProjection{
@@ -312,7 +645,7 @@ func (g *ConfigGenerator) appendCertVolume(volumes []corev1.VolumeProjection) []
 	if g.a11r.Spec.Authentication.Local != nil && g.a11r.Spec.Authentication.Local.PrivateKeySecret != nil {
 		privateKeySecretKey := g.a11r.Spec.Authentication.Local.PrivateKeySecret.Key
 		if privateKeySecretKey == "" {
-			privateKeySecretKey = privateKeyFile
+			privateKeySecretKey = eapolv1.DefaultPrivateKeyKey
 		}
 		volumes = append(volumes, corev1.VolumeProjection{
 			Secret: &corev1.SecretProjection{
@@ -333,7 +666,7 @@ func (g *ConfigGenerator) appendRadiusClientVolume(volumes []corev1.VolumeProjec
 	if g.a11r.Spec.Authentication.Local != nil && g.a11r.Spec.Authentication.Local.RadiusClientSecret != nil {
 		radiusClientSecretKey := g.a11r.Spec.Authentication.Local.RadiusClientSecret.Key
 		if radiusClientSecretKey == "" {
-			radiusClientSecretKey = radiusClientFile
+			radiusClientSecretKey = eapolv1.DefaultRadiusClientKey
 		}
 		volumes = append(volumes, corev1.VolumeProjection{
 			Secret: &corev1.SecretProjection{
@@ -350,23 +683,425 @@ func (g *ConfigGenerator) appendRadiusClientVolume(volumes []corev1.VolumeProjec
 	return volumes
 }
 
-func (g *ConfigGenerator) parsePorts() (string, string) {
-	if g.a11r.Spec.TrafficControl == nil || g.a11r.Spec.TrafficControl.UnprotectedPorts == nil {
-		return "", ""
+func (g *ConfigGenerator) appendRadiusSecretVolume(volumes []corev1.VolumeProjection) []corev1.VolumeProjection {
+	for _, server := range append(g.radiusAuthServers(), g.radiusAcctServers()...) {
+		if server.secret == nil {
+			continue
+		}
+		volumes = append(volumes, corev1.VolumeProjection{
+			Secret: &corev1.SecretProjection{
+				LocalObjectReference: corev1.LocalObjectReference{
+					Name: server.secret.Name,
+				},
+				Items: []corev1.KeyToPath{{
+					Key:  server.secret.Key,
+					Path: fmt.Sprintf("%s/%s", secretsDir, server.secretName),
+				}},
+			},
+		})
+	}
+	return volumes
+}
+
+// SecretRefs returns all the Secrets projected into the authenticator pod,
+// with default keys filled in.
+func (g *ConfigGenerator) SecretRefs() []eapolv1.SecretKeyRef {
+	refs := g.localSecretRefs()
+	refs = append(refs, g.RadiusSecretRefs()...)
+	return append(refs, g.MACsecSecretRefs()...)
+}
+
+// StartupSecretRefs returns the Secrets whose contents are only read when
+// the authenticator pod starts: the local authentication server files and the
+// RadSec client certificates.  Shared secrets and MKA keys are rendered into
+// the configuration the monitor reloads instead.
+func (g *ConfigGenerator) StartupSecretRefs() []eapolv1.SecretKeyRef {
+	refs := g.localSecretRefs()
+	for _, item := range g.radsecItems() {
+		refs = append(refs, item.ref)
+	}
+	return refs
+}
+
+// localSecretRefs returns the Secrets referenced by the local authentication
+// server configuration, with default keys filled in.
+func (g *ConfigGenerator) localSecretRefs() []eapolv1.SecretKeyRef {
+	local := g.a11r.Spec.Authentication.Local
+	if local == nil {
+		return nil
+	}
+	var refs []eapolv1.SecretKeyRef
+	for _, item := range []struct {
+		ref        *eapolv1.SecretKeyRef
+		defaultKey string
+	}{
+		{local.UserFileSecret, eapolv1.DefaultUserFileKey},
+		{local.CaCertSecret, eapolv1.DefaultCaCertKey},
+		{local.ServerCertSecret, eapolv1.DefaultServerCertKey},
+		{local.PrivateKeySecret, eapolv1.DefaultPrivateKeyKey},
+		{local.RadiusClientSecret, eapolv1.DefaultRadiusClientKey},
+	} {
+		if item.ref == nil {
+			continue
+		}
+		ref := *item.ref
+		if ref.Key == "" {
+			ref.Key = item.defaultKey
+		}
+		refs = append(refs, ref)
+	}
+	return refs
+}
+
+// RadiusSecretRefs returns the Secrets referenced by the RADIUS
+// configuration, with default keys filled in.  The secret contents are
+// projected into the authenticator pod and shared secrets are substituted into
+// hostapd.conf at startup, so they never appear in the generated ConfigMap.
+func (g *ConfigGenerator) RadiusSecretRefs() []eapolv1.SecretKeyRef {
+	var refs []eapolv1.SecretKeyRef
+	for _, server := range append(g.radiusAuthServers(), g.radiusAcctServers()...) {
+		if server.secret != nil {
+			refs = append(refs, *server.secret)
+		}
+	}
+	for _, item := range g.radsecItems() {
+		refs = append(refs, item.ref)
+	}
+	return refs
+}
+
+func (g *ConfigGenerator) hasRadiusSharedSecrets() bool {
+	for _, server := range append(g.radiusAuthServers(), g.radiusAcctServers()...) {
+		if server.secret != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *ConfigGenerator) radsecEnabled() bool {
+	radius := g.a11r.Spec.Authentication.Radius
+	return radius != nil && radius.Transport == eapolv1.RadiusTransportTLS
+}
+
+type radsecItem struct {
+	ref  eapolv1.SecretKeyRef
+	path string
+}
+
+// radsecItems returns the RadSec client TLS secrets and where they are projected.
+func (g *ConfigGenerator) radsecItems() []radsecItem {
+	if !g.radsecEnabled() || g.a11r.Spec.Authentication.Radius.TLS == nil {
+		return nil
+	}
+	tlsConfig := g.a11r.Spec.Authentication.Radius.TLS
+	var items []radsecItem
+	for _, item := range []struct {
+		ref        eapolv1.SecretKeyRef
+		defaultKey string
+		file       string
+	}{
+		{tlsConfig.ClientCertSecret, eapolv1.DefaultRadSecCertKey, radsecCertFile},
+		{tlsConfig.ClientKeySecret, eapolv1.DefaultRadSecKeyKey, radsecKeyFile},
+		{tlsConfig.CaCertSecret, eapolv1.DefaultRadSecCaCertKey, radsecCaFile},
+	} {
+		if item.ref.Key == "" {
+			item.ref.Key = item.defaultKey
+		}
+		items = append(items, radsecItem{ref: item.ref, path: fmt.Sprintf("%s/%s", radsecDir, item.file)})
+	}
+	return items
+}
+
+func (g *ConfigGenerator) appendRadsecVolume(volumes []corev1.VolumeProjection) []corev1.VolumeProjection {
+	for _, item := range g.radsecItems() {
+		volumes = append(volumes, corev1.VolumeProjection{
+			Secret: &corev1.SecretProjection{
+				LocalObjectReference: corev1.LocalObjectReference{
+					Name: item.ref.Name,
+				},
+				Items: []corev1.KeyToPath{{
+					Key:  item.ref.Key,
+					Path: item.path,
+				}},
+			},
+		})
+	}
+	return volumes
+}
+
+// radsecEnv returns the monitor environment that configures its RadSec proxy.
+func (g *ConfigGenerator) radsecEnv() []corev1.EnvVar {
+	if !g.radsecEnabled() {
+		return nil
+	}
+	upstreams := []string{}
+	servers := append(g.radiusAuthServers(), g.radiusAcctServers()...)
+	for _, server := range append(servers, g.mabRadiusServers()...) {
+		upstreams = append(upstreams, fmt.Sprintf("%s=%s",
+			net.JoinHostPort(server.Address, strconv.Itoa(server.Port)), server.Upstream))
+	}
+	env := []corev1.EnvVar{{
+		Name:  "RADSEC_UPSTREAMS",
+		Value: strings.Join(upstreams, ","),
+	}, {
+		Name:  "RADSEC_CERT",
+		Value: fmt.Sprintf("%s/%s/%s", configMountPath, radsecDir, radsecCertFile),
+	}, {
+		Name:  "RADSEC_KEY",
+		Value: fmt.Sprintf("%s/%s/%s", configMountPath, radsecDir, radsecKeyFile),
+	}, {
+		Name:  "RADSEC_CA",
+		Value: fmt.Sprintf("%s/%s/%s", configMountPath, radsecDir, radsecCaFile),
+	}}
+	if tlsConfig := g.a11r.Spec.Authentication.Radius.TLS; tlsConfig != nil && tlsConfig.ServerName != "" {
+		env = append(env, corev1.EnvVar{
+			Name:  "RADSEC_SERVER_NAME",
+			Value: tlsConfig.ServerName,
+		})
+	}
+	return env
+}
+
+// radiusAuthServers returns the ordered RADIUS authentication servers, with
+// the deprecated single-server fields first when set.
+func (g *ConfigGenerator) radiusAuthServers() []radiusServer {
+	return g.radiusAuthServersListening(radsecAuthListenPort)
+}
+
+// mabRadiusServers returns the RADIUS authentication servers queried for MAC
+// Authentication Bypass.  Over RadSec they get loopback proxy listeners of
+// their own, as the proxy tells replies apart by RADIUS identifier, which the
+// monitor and hostapd allocate independently.
+func (g *ConfigGenerator) mabRadiusServers() []radiusServer {
+	mab := g.a11r.Spec.Authentication.MAB
+	if mab == nil || len(mab.MACs) > 0 {
+		return nil
+	}
+	return g.radiusAuthServersListening(radsecMABListenPort)
+}
+
+func (g *ConfigGenerator) radiusAuthServersListening(listenPort int) []radiusServer {
+	radius := g.a11r.Spec.Authentication.Radius
+	if radius == nil {
+		return nil
 	}
-	tcp := strings.Builder{}
-	for _, tcpPort := range g.a11r.Spec.TrafficControl.UnprotectedPorts.Tcp {
-		if tcp.Len() > 0 {
-			tcp.WriteRune(' ')
+	servers := radiusServers{prefix: "auth", defaultPort: radiusAuthPort,
+		tls: g.radsecEnabled(), listenPort: listenPort}
+	if radius.AuthServer != "" {
+		servers.add(radius.AuthServer, radius.AuthPort, &eapolv1.SecretKeyRef{Name: radius.AuthSecret, Key: radius.AuthSecretKey})
+	}
+	for i := range radius.AuthServers {
+		servers.add(radius.AuthServers[i].Address, radius.AuthServers[i].Port, &radius.AuthServers[i].Secret)
+	}
+	return servers.list
+}
+
+// radiusAcctServers returns the ordered RADIUS accounting servers.
+func (g *ConfigGenerator) radiusAcctServers() []radiusServer {
+	radius := g.a11r.Spec.Authentication.Radius
+	if radius == nil || radius.Accounting == nil {
+		return nil
+	}
+	servers := radiusServers{prefix: "acct", defaultPort: radiusAcctPort,
+		tls: g.radsecEnabled(), listenPort: radsecAcctListenPort}
+	for i := range radius.Accounting.Servers {
+		server := &radius.Accounting.Servers[i]
+		servers.add(server.Address, server.Port, &server.Secret)
+	}
+	return servers.list
+}
+
+// radiusServers builds a list of radiusServer with defaults resolved and
+// unique projected secret file names, or unique loopback RadSec proxy ports
+// when tls is set.
+type radiusServers struct {
+	prefix      string
+	defaultPort int
+	tls         bool
+	listenPort  int
+	list        []radiusServer
+}
+
+func (s *radiusServers) add(address string, port int, secret *eapolv1.SecretKeyRef) {
+	server := radiusServer{Address: address, Port: port}
+	if s.tls {
+		if port == 0 {
+			port = radsecPort
 		}
-		tcp.WriteString(strconv.Itoa(tcpPort))
+		server.Upstream = net.JoinHostPort(address, strconv.Itoa(port))
+		server.Address = "127.0.0.1"
+		server.Port = s.listenPort + len(s.list)
+		s.list = append(s.list, server)
+		return
+	}
+	if server.Port == 0 {
+		server.Port = s.defaultPort
 	}
-	udp := strings.Builder{}
-	for _, udpPort := range g.a11r.Spec.TrafficControl.UnprotectedPorts.Udp {
-		if udp.Len() > 0 {
-			udp.WriteRune(' ')
+	if secret != nil && secret.Name != "" {
+		server.secret = &eapolv1.SecretKeyRef{Name: secret.Name, Key: secret.Key}
+		if server.secret.Key == "" {
+			server.secret.Key = eapolv1.DefaultRadiusSecretKey
 		}
-		udp.WriteString(strconv.Itoa(udpPort))
+		server.secretName = fmt.Sprintf("%s-%d", s.prefix, len(s.list))
+	}
+	s.list = append(s.list, server)
+}
+
+// trafficPolicy returns the traffic control settings the monitor applies
+// without restarting: the unprotected ports, the static MAC addresses, the
+// traffic exceptions, the authentication mode, the supplicant to VF mapping
+// and the fallback VLANs.
+func (g *ConfigGenerator) trafficPolicy() *eapolv1.TrafficControl {
+	policy := &eapolv1.TrafficControl{}
+	tc := g.a11r.Spec.TrafficControl
+	if tc == nil {
+		return policy
 	}
-	return tcp.String(), udp.String()
+	if tc.UnprotectedPorts != nil {
+		policy.UnprotectedPorts = tc.UnprotectedPorts.DeepCopy()
+	}
+	policy.AllowedMacs = tc.AllowedMacs
+	policy.DeniedMacs = tc.DeniedMacs
+	policy.Exceptions = tc.Exceptions
+	policy.AuthenticationMode = tc.AuthenticationMode
+	policy.VFSupplicants = tc.VFSupplicants
+	policy.GuestVlan = tc.GuestVlan
+	if tc.GuestVlan != 0 {
+		policy.GuestVlanTimeout = tc.GuestVlanTimeout
+	}
+	policy.AuthFailVlan = tc.AuthFailVlan
+	if tc.EgressPolicy == eapolv1.EgressPolicyDrop {
+		policy.EgressExceptions = tc.EgressExceptions
+	}
+	return policy
+}
+
+// egressEnv passes the drop egress policy to the monitor.  Its exceptions
+// are part of the traffic policy.
+func (g *ConfigGenerator) egressEnv() []corev1.EnvVar {
+	tc := g.a11r.Spec.TrafficControl
+	if tc == nil || tc.EgressPolicy != eapolv1.EgressPolicyDrop {
+		return nil
+	}
+	return []corev1.EnvVar{{
+		Name:  "EGRESS_POLICY",
+		Value: string(tc.EgressPolicy),
+	}}
+}
+
+// mabEnv passes MAC Authentication Bypass to the monitor, along with either
+// the local MAC list or the RADIUS authentication servers and their projected
+// shared secret files.  Servers reached through the RadSec proxy have no
+// secret file, as they use its fixed shared secret.
+func (g *ConfigGenerator) mabEnv() []corev1.EnvVar {
+	mab := g.a11r.Spec.Authentication.MAB
+	if mab == nil {
+		return nil
+	}
+	timeout := mab.Timeout
+	if timeout == 0 {
+		timeout = defaultMABTimeout
+	}
+	env := []corev1.EnvVar{{
+		Name:  "MAB_TIMEOUT",
+		Value: strconv.Itoa(timeout),
+	}}
+	if len(mab.MACs) > 0 {
+		macs := make([]string, len(mab.MACs))
+		for i, mac := range mab.MACs {
+			macs[i] = strings.ToLower(mac)
+		}
+		return append(env, corev1.EnvVar{
+			Name:  "MAB_MACS",
+			Value: strings.Join(macs, ","),
+		})
+	}
+	var servers []string
+	for _, server := range g.mabRadiusServers() {
+		address := net.JoinHostPort(server.Address, strconv.Itoa(server.Port))
+		switch {
+		case server.Upstream != "":
+			servers = append(servers, address)
+		case server.secretName != "":
+			servers = append(servers, fmt.Sprintf("%s=%s/%s/%s", address, configMountPath, secretsDir, server.secretName))
+		default:
+			servers = append(servers, address+"=")
+		}
+	}
+	return append(env, corev1.EnvVar{
+		Name:  "MAB_RADIUS_SERVERS",
+		Value: strings.Join(servers, ","),
+	})
+}
+
+func (g *ConfigGenerator) macsecConfig() *macsecConfig {
+	macsec := g.a11r.Spec.MACsec
+	if macsec == nil {
+		return nil
+	}
+	config := &macsecConfig{
+		ReplayWindow: macsec.ReplayWindow,
+		Priority:     defaultMKAPriority,
+	}
+	if macsec.Priority != nil {
+		config.Priority = *macsec.Priority
+	}
+	if macsec.IntegrityOnly {
+		config.IntegrityOnly = 1
+	}
+	if macsec.ReplayProtect {
+		config.ReplayProtect = 1
+	}
+	if macsec.CipherSuite == eapolv1.MACsecCipherSuiteGcmAes256 {
+		config.CsIndex = 1
+	}
+	if macsec.PreSharedKey != nil {
+		config.CakPlaceholder = fmt.Sprintf("$SECRET{%s}", mkaCakFile)
+		config.CknPlaceholder = fmt.Sprintf("$SECRET{%s}", mkaCknFile)
+	}
+	return config
+}
+
+// MACsecSecretRefs returns the Secrets holding a static MKA CAK and CKN, with
+// default keys filled in.  Like RADIUS shared secrets, they are substituted
+// into hostapd.conf at startup.
+func (g *ConfigGenerator) MACsecSecretRefs() []eapolv1.SecretKeyRef {
+	macsec := g.a11r.Spec.MACsec
+	if macsec == nil || macsec.PreSharedKey == nil {
+		return nil
+	}
+	cakKey := macsec.PreSharedKey.CakKey
+	if cakKey == "" {
+		cakKey = eapolv1.DefaultMACsecCakKey
+	}
+	cknKey := macsec.PreSharedKey.CknKey
+	if cknKey == "" {
+		cknKey = eapolv1.DefaultMACsecCknKey
+	}
+	return []eapolv1.SecretKeyRef{
+		{Name: macsec.PreSharedKey.SecretName, Key: cakKey},
+		{Name: macsec.PreSharedKey.SecretName, Key: cknKey},
+	}
+}
+
+func (g *ConfigGenerator) appendMACsecVolume(volumes []corev1.VolumeProjection) []corev1.VolumeProjection {
+	refs := g.MACsecSecretRefs()
+	if len(refs) == 0 {
+		return volumes
+	}
+	return append(volumes, corev1.VolumeProjection{
+		Secret: &corev1.SecretProjection{
+			LocalObjectReference: corev1.LocalObjectReference{
+				Name: refs[0].Name,
+			},
+			Items: []corev1.KeyToPath{{
+				Key:  refs[0].Key,
+				Path: fmt.Sprintf("%s/%s", secretsDir, mkaCakFile),
+			}, {
+				Key:  refs[1].Key,
+				Path: fmt.Sprintf("%s/%s", secretsDir, mkaCknFile),
+			}},
+		},
+	})
 }
@@ -1,6 +1,7 @@
 package configgen
 
 import (
+	"regexp"
 	"strings"
 
 	. "github.com/onsi/ginkgo"
@@ -9,6 +10,7 @@ import (
 
 	eapolv1 "github.com/openshift-kni/eapol-operator/api/v1"
 	. "github.com/openshift-kni/eapol-operator/internal/testutils"
+	corev1 "k8s.io/api/core/v1"
 )
 
 var _ = Describe("Daemonset", func() {
@@ -67,9 +69,14 @@ var _ = Describe("Daemonset", func() {
 	It("should contain one monitoring container per defined interface", func() {
 		cfggen.a11r.Spec.Interfaces = []string{"iface1"}
 		ds := cfggen.Daemonset()
-		Expect(ds.Spec.Template.Spec.Containers).To(ContainElements(
+		Expect(ds.Spec.Template.Spec.Containers).To(ConsistOf(
 			MatchFields(IgnoreExtras, Fields{
-				"Name": Equal("hostapd-monitor"),
+				"Name":    Equal("hostapd-monitor"),
+				"Command": Equal([]string{"/bin/hostapd-monitor"}),
+				"Env": ContainElement(MatchFields(IgnoreExtras, Fields{
+					"Name":  Equal("HOSTAPD"),
+					"Value": Equal("/usr/sbin/hostapd"),
+				})),
 			}),
 		))
 		cfggen.a11r.Spec.Interfaces = []string{"iface2", "iface3"}
@@ -80,74 +87,367 @@ var _ = Describe("Daemonset", func() {
 			}),
 		))
 	})
-	It("should not contain unprotected port lists if not provided", func() {
+	It("should project the RADIUS shared secret when configured", func() {
+		cfggen.a11r.Spec.Authentication.Radius = &eapolv1.Radius{
+			AuthServer: "1.1.1.1",
+			AuthPort:   1812,
+			AuthSecret: "radius-secret",
+		}
 		ds := cfggen.Daemonset()
-		Expect(ds.Spec.Template.Spec.Containers[0].Env).To(ContainElements(
+		Expect(ds.Spec.Template.Spec.Volumes[0].Projected.Sources).To(ContainLocaluserProjection("radius-secret"))
+		Expect(ds.Spec.Template.Spec.Containers[0].Env).To(ContainElement(
+			MatchFields(IgnoreExtras, Fields{
+				"Name":  Equal("SECRETS_DIR"),
+				"Value": Equal("/config/secrets"),
+			}),
+		))
+	})
+	It("should not project a RADIUS shared secret when not configured", func() {
+		ds := cfggen.Daemonset()
+		Expect(ds.Spec.Template.Spec.Containers[0].Env).NotTo(ContainElement(
+			MatchFields(IgnoreExtras, Fields{
+				"Name": Equal("SECRETS_DIR"),
+			}),
+		))
+	})
+	It("should list every referenced secret with default keys", func() {
+		SetupUserFileAuth(cfggen.a11r, "users", "")
+		cfggen.a11r.Spec.Authentication.Local.CaCertSecret = &eapolv1.SecretKeyRef{Name: "certs", Key: "ca"}
+		cfggen.a11r.Spec.MACsec = &eapolv1.MACsec{
+			PreSharedKey: &eapolv1.MACsecPreSharedKey{SecretName: "mka"},
+		}
+		Expect(cfggen.SecretRefs()).To(ConsistOf(
+			eapolv1.SecretKeyRef{Name: "users", Key: "hostapd.eap_user"},
+			eapolv1.SecretKeyRef{Name: "certs", Key: "ca"},
+			eapolv1.SecretKeyRef{Name: "mka", Key: "cak"},
+			eapolv1.SecretKeyRef{Name: "mka", Key: "ckn"},
+		))
+		Expect(cfggen.StartupSecretRefs()).To(ConsistOf(
+			eapolv1.SecretKeyRef{Name: "users", Key: "hostapd.eap_user"},
+			eapolv1.SecretKeyRef{Name: "certs", Key: "ca"},
+		))
+	})
+	It("should have both containers render the runtime config in memory", func() {
+		ds := cfggen.Daemonset()
+		for _, container := range ds.Spec.Template.Spec.Containers {
+			Expect(container.Env).To(ContainElement(
+				MatchFields(IgnoreExtras, Fields{
+					"Name":  Equal("RUNTIME_CONFIG"),
+					"Value": Equal("/run/eapol/hostapd.conf"),
+				}),
+			))
+			Expect(container.VolumeMounts).To(ContainElement(
+				MatchFields(IgnoreExtras, Fields{
+					"Name":      Equal("runtime-volume"),
+					"MountPath": Equal("/run/eapol"),
+				}),
+			))
+		}
+		Expect(ds.Spec.Template.Spec.Volumes).To(ContainElement(
+			MatchFields(IgnoreExtras, Fields{
+				"Name": Equal("runtime-volume"),
+				"VolumeSource": MatchFields(IgnoreExtras, Fields{
+					"EmptyDir": PointTo(MatchFields(IgnoreExtras, Fields{
+						"Medium": Equal(corev1.StorageMediumMemory),
+					})),
+				}),
+			}),
+		))
+	})
+	It("should stamp the secrets hash on the pod template", func() {
+		Expect(cfggen.Daemonset().Spec.Template.Annotations).To(BeEmpty())
+		ref := eapolv1.SecretKeyRef{Name: "users", Key: "hostapd.eap_user"}
+		hash := SecretsHash(map[eapolv1.SecretKeyRef][]byte{ref: []byte("user1")})
+		Expect(SecretsHash(map[eapolv1.SecretKeyRef][]byte{ref: []byte("user2")})).NotTo(Equal(hash))
+		Expect(SecretsHash(map[eapolv1.SecretKeyRef][]byte{ref: nil})).NotTo(Equal(
+			SecretsHash(map[eapolv1.SecretKeyRef][]byte{ref: {}})))
+		cfggen.SetSecretsHash(hash)
+		Expect(cfggen.Daemonset().Spec.Template.Annotations).To(HaveKeyWithValue(SecretsHashAnnotation, hash))
+	})
+	It("should project the MKA pre-shared key when configured", func() {
+		cfggen.a11r.Spec.MACsec = &eapolv1.MACsec{
+			Policy:       eapolv1.MACsecPolicyMustSecure,
+			PreSharedKey: &eapolv1.MACsecPreSharedKey{SecretName: "mka"},
+		}
+		ds := cfggen.Daemonset()
+		Expect(ds.Spec.Template.Spec.Volumes[0].Projected.Sources).To(ContainLocaluserProjection("mka"))
+		Expect(ds.Spec.Template.Spec.Containers[0].Env).To(ContainElement(
+			MatchFields(IgnoreExtras, Fields{
+				"Name":  Equal("SECRETS_DIR"),
+				"Value": Equal("/config/secrets"),
+			}),
+		))
+		Expect(ds.Spec.Template.Spec.Containers[0].Env).To(ContainElement(
 			MatchFields(IgnoreExtras, Fields{
-				"Name":  Equal("UNPROTECTED_TCP_PORTS"),
-				"Value": Equal(""),
+				"Name":  Equal("MACSEC_POLICY"),
+				"Value": Equal("must-secure"),
 			}),
+		))
+	})
+	It("should select the traffic control backend when configured", func() {
+		ds := cfggen.Daemonset()
+		Expect(ds.Spec.Template.Spec.Containers[0].Env).NotTo(ContainElement(
 			MatchFields(IgnoreExtras, Fields{
-				"Name":  Equal("UNPROTECTED_UDP_PORTS"),
-				"Value": Equal(""),
+				"Name": Equal("TRAFFIC_CONTROL_BACKEND"),
+			}),
+		))
+		cfggen.a11r.Spec.TrafficControl = &eapolv1.TrafficControl{Backend: eapolv1.TrafficControlBackendNftables}
+		ds = cfggen.Daemonset()
+		Expect(ds.Spec.Template.Spec.Containers[0].Env).To(ContainElement(
+			MatchFields(IgnoreExtras, Fields{
+				"Name":  Equal("TRAFFIC_CONTROL_BACKEND"),
+				"Value": Equal("nftables"),
 			}),
 		))
 	})
-	It("should contain unprotected port lists when provided", func() {
+	It("should not pass the authentication mode and VLANs in the environment", func() {
+		vlan := 30
 		cfggen.a11r.Spec.TrafficControl = &eapolv1.TrafficControl{
-			UnprotectedPorts: &eapolv1.Ports{
-				Tcp: []int{53, 80},
-				Udp: []int{53, 319},
+			AuthenticationMode: eapolv1.AuthenticationModePerVF,
+			VFSupplicants:      []eapolv1.VFSupplicants{{VF: 0, MACs: []string{"6e:16:06:0e:b7:e2"}}},
+			GuestVlan:          10,
+			GuestVlanTimeout:   30,
+			AuthFailVlan:       20,
+		}
+		cfggen.a11r.Spec.InterfaceOverrides = []eapolv1.InterfaceOverride{
+			{Interface: "eth1", AuthenticationMode: eapolv1.AuthenticationModePort, GuestVlan: &vlan},
+		}
+		ds := cfggen.Daemonset()
+		Expect(ds.Spec.Template.Spec.Containers[0].Env).NotTo(ContainElement(
+			MatchFields(IgnoreExtras, Fields{
+				"Name": Or(Equal("AUTHENTICATION_MODE"), Equal("VF_SUPPLICANTS"), Equal("GUEST_VLAN"),
+					Equal("GUEST_VLAN_TIMEOUT"), Equal("AUTH_FAIL_VLAN"), Equal("INTERFACE_OVERRIDES")),
+			}),
+		))
+	})
+	It("should only pass the egress policy when dropping", func() {
+		cfggen.a11r.Spec.TrafficControl = &eapolv1.TrafficControl{EgressPolicy: eapolv1.EgressPolicyAllow}
+		ds := cfggen.Daemonset()
+		Expect(ds.Spec.Template.Spec.Containers[0].Env).NotTo(ContainElement(
+			MatchFields(IgnoreExtras, Fields{"Name": Equal("EGRESS_POLICY")}),
+		))
+		cfggen.a11r.Spec.TrafficControl = &eapolv1.TrafficControl{EgressPolicy: eapolv1.EgressPolicyDrop}
+		ds = cfggen.Daemonset()
+		Expect(ds.Spec.Template.Spec.Containers[0].Env).To(ContainElement(
+			MatchFields(IgnoreExtras, Fields{
+				"Name":  Equal("EGRESS_POLICY"),
+				"Value": Equal("drop"),
+			}),
+		))
+	})
+	It("should pass the interface selectors to the monitor", func() {
+		ds := cfggen.Daemonset()
+		Expect(ds.Spec.Template.Spec.Containers[0].Env).NotTo(ContainElement(
+			MatchFields(IgnoreExtras, Fields{"Name": Equal("INTERFACE_SELECTORS")}),
+		))
+		cfggen.a11r.Spec.InterfaceSelectors = []eapolv1.InterfaceSelector{{Vendor: "8086", Driver: "i40e"}}
+		ds = cfggen.Daemonset()
+		Expect(ds.Spec.Template.Spec.Containers[0].Env).To(ContainElement(
+			MatchFields(IgnoreExtras, Fields{
+				"Name":  Equal("INTERFACE_SELECTORS"),
+				"Value": Equal(`[{"vendor":"8086","driver":"i40e"}]`),
+			}),
+		))
+		Expect(ds.Spec.Template.Spec.Volumes).NotTo(ContainElement(
+			MatchFields(IgnoreExtras, Fields{"Name": Equal("device-plugin-volume")}),
+		))
+	})
+	It("should mount the device plugin configuration for resource name selectors", func() {
+		cfggen.a11r.Spec.InterfaceSelectors = []eapolv1.InterfaceSelector{{ResourceName: "openshift.io/intel_sriov"}}
+		ds := cfggen.Daemonset()
+		Expect(ds.Spec.Template.Spec.Volumes).To(ContainElement(
+			MatchFields(IgnoreExtras, Fields{
+				"Name": Equal("device-plugin-volume"),
+				"VolumeSource": MatchFields(IgnoreExtras, Fields{
+					"HostPath": PointTo(MatchFields(IgnoreExtras, Fields{"Path": Equal("/etc/pcidp")})),
+				}),
+			}),
+		))
+		Expect(ds.Spec.Template.Spec.Containers[0].VolumeMounts).To(ContainElement(
+			MatchFields(IgnoreExtras, Fields{"Name": Equal("device-plugin-volume")}),
+		))
+		Expect(ds.Spec.Template.Spec.Containers[0].Env).To(ContainElement(
+			MatchFields(IgnoreExtras, Fields{
+				"Name":  Equal("SRIOV_DEVICE_PLUGIN_CONFIG"),
+				"Value": Equal("/etc/pcidp/config.json"),
+			}),
+		))
+	})
+	It("should pass the traffic policy as a file", func() {
+		ds := cfggen.Daemonset()
+		Expect(ds.Spec.Template.Spec.Volumes[0].Projected.Sources[0].ConfigMap.Items).To(BeEmpty())
+		Expect(ds.Spec.Template.Spec.Containers[0].Env).To(ContainElement(
+			MatchFields(IgnoreExtras, Fields{
+				"Name":  Equal("TRAFFIC_POLICY"),
+				"Value": Equal("/config/traffic-policy.json"),
+			}),
+		))
+	})
+	It("should not pass the traffic policy in the environment", func() {
+		cfggen.a11r.Spec.TrafficControl = &eapolv1.TrafficControl{
+			UnprotectedPorts: &eapolv1.Ports{Tcp: []int{53}},
+			AllowedMacs:      []string{"6e:16:06:0e:b7:e2"},
+			Exceptions:       []eapolv1.TrafficException{{EtherType: 0x88f7}},
+		}
+		ds := cfggen.Daemonset()
+		for _, container := range ds.Spec.Template.Spec.Containers {
+			Expect(container.Env).NotTo(ContainElement(
+				MatchFields(IgnoreExtras, Fields{
+					"Name": BeElementOf("UNPROTECTED_TCP_PORTS", "UNPROTECTED_UDP_PORTS",
+						"ALLOWED_MACS", "DENIED_MACS", "TRAFFIC_EXCEPTIONS", "EGRESS_EXCEPTIONS"),
+				}),
+			))
+		}
+	})
+	It("should pass the RADIUS servers for MAB", func() {
+		cfggen.a11r.Spec.Authentication.Radius = &eapolv1.Radius{
+			AuthServers: []eapolv1.RadiusServer{
+				{Address: "10.0.0.1", Secret: eapolv1.SecretKeyRef{Name: "radius"}},
+				{Address: "10.0.0.2", Port: 1645},
+			},
+		}
+		cfggen.a11r.Spec.Authentication.MAB = &eapolv1.MAB{}
+		ds := cfggen.Daemonset()
+		Expect(ds.Spec.Template.Spec.Containers[0].Env).To(ContainElements(
+			MatchFields(IgnoreExtras, Fields{
+				"Name":  Equal("MAB_TIMEOUT"),
+				"Value": Equal("30"),
+			}),
+			MatchFields(IgnoreExtras, Fields{
+				"Name":  Equal("MAB_RADIUS_SERVERS"),
+				"Value": Equal("10.0.0.1:1812=/config/secrets/auth-0,10.0.0.2:1645="),
+			}),
+		))
+	})
+	It("should pass the local MAC list for MAB", func() {
+		cfggen.a11r.Spec.Authentication.MAB = &eapolv1.MAB{Timeout: 10, MACs: []string{"6E:16:06:0E:B7:E2"}}
+		ds := cfggen.Daemonset()
+		Expect(ds.Spec.Template.Spec.Containers[0].Env).To(ContainElements(
+			MatchFields(IgnoreExtras, Fields{
+				"Name":  Equal("MAB_TIMEOUT"),
+				"Value": Equal("10"),
+			}),
+			MatchFields(IgnoreExtras, Fields{
+				"Name":  Equal("MAB_MACS"),
+				"Value": Equal("6e:16:06:0e:b7:e2"),
+			}),
+		))
+		Expect(ds.Spec.Template.Spec.Containers[0].Env).NotTo(ContainElement(
+			MatchFields(IgnoreExtras, Fields{
+				"Name": Equal("MAB_RADIUS_SERVERS"),
+			}),
+		))
+	})
+	It("should configure the RadSec proxy when the TLS transport is used", func() {
+		cfggen.a11r.Spec.Authentication.Radius = &eapolv1.Radius{
+			AuthServers: []eapolv1.RadiusServer{{Address: "10.0.0.1"}},
+			Transport:   eapolv1.RadiusTransportTLS,
+			TLS: &eapolv1.RadiusTLS{
+				ClientCertSecret: eapolv1.SecretKeyRef{Name: "radsec"},
+				ClientKeySecret:  eapolv1.SecretKeyRef{Name: "radsec"},
+				CaCertSecret:     eapolv1.SecretKeyRef{Name: "radsec-ca", Key: "ca.pem"},
 			},
 		}
 		ds := cfggen.Daemonset()
+		Expect(ds.Spec.Template.Spec.Volumes[0].Projected.Sources).To(ContainLocaluserProjection("radsec-ca"))
+		Expect(ds.Spec.Template.Spec.Containers[0].Env).NotTo(ContainElement(
+			MatchFields(IgnoreExtras, Fields{
+				"Name": Equal("SECRETS_DIR"),
+			}),
+		))
+		Expect(ds.Spec.Template.Spec.Containers[0].Env).To(ContainElements(
+			MatchFields(IgnoreExtras, Fields{
+				"Name":  Equal("RADSEC_UPSTREAMS"),
+				"Value": Equal("127.0.0.1:18120=10.0.0.1:2083"),
+			}),
+			MatchFields(IgnoreExtras, Fields{
+				"Name":  Equal("RADSEC_CA"),
+				"Value": Equal("/config/radsec/ca.crt"),
+			}),
+		))
+		Expect(cfggen.RadiusSecretRefs()).To(Equal([]eapolv1.SecretKeyRef{
+			{Name: "radsec", Key: "tls.crt"},
+			{Name: "radsec", Key: "tls.key"},
+			{Name: "radsec-ca", Key: "ca.pem"},
+		}))
+	})
+	It("should give MAB its own RadSec proxy listeners", func() {
+		cfggen.a11r.Spec.Authentication.Radius = &eapolv1.Radius{
+			AuthServers: []eapolv1.RadiusServer{{Address: "10.0.0.1"}, {Address: "10.0.0.2"}},
+			Transport:   eapolv1.RadiusTransportTLS,
+		}
+		cfggen.a11r.Spec.Authentication.MAB = &eapolv1.MAB{}
+		ds := cfggen.Daemonset()
 		Expect(ds.Spec.Template.Spec.Containers[0].Env).To(ContainElements(
 			MatchFields(IgnoreExtras, Fields{
-				"Name":  Equal("UNPROTECTED_TCP_PORTS"),
-				"Value": Equal("53 80"),
+				"Name": Equal("RADSEC_UPSTREAMS"),
+				"Value": Equal("127.0.0.1:18120=10.0.0.1:2083,127.0.0.1:18121=10.0.0.2:2083," +
+					"127.0.0.1:18140=10.0.0.1:2083,127.0.0.1:18141=10.0.0.2:2083"),
 			}),
 			MatchFields(IgnoreExtras, Fields{
-				"Name":  Equal("UNPROTECTED_UDP_PORTS"),
-				"Value": Equal("53 319"),
+				"Name":  Equal("MAB_RADIUS_SERVERS"),
+				"Value": Equal("127.0.0.1:18140,127.0.0.1:18141"),
 			}),
 		))
 	})
 })
 
-var _ = Describe("parsePorts", func() {
+var _ = Describe("trafficPolicy", func() {
 	var cfggen *ConfigGenerator
 	BeforeEach(func() {
 		cfggen = New(NewA11r(), "")
 	})
-	It("should produce empty results if no TrafficControl provided", func() {
-		tcp, udp := cfggen.parsePorts()
-		Expect(tcp).To(BeEmpty())
-		Expect(udp).To(BeEmpty())
+	It("should be empty if no TrafficControl provided", func() {
+		Expect(cfggen.trafficPolicy()).To(Equal(&eapolv1.TrafficControl{}))
 	})
-	It("should produce empty results if no UnprotectedPorts provided", func() {
-		cfggen.a11r.Spec.TrafficControl = &eapolv1.TrafficControl{}
-		tcp, udp := cfggen.parsePorts()
-		Expect(tcp).To(BeEmpty())
-		Expect(udp).To(BeEmpty())
-	})
-	It("should produce empty results if no port list provided", func() {
+	It("should only keep the settings applied live", func() {
 		cfggen.a11r.Spec.TrafficControl = &eapolv1.TrafficControl{
-			UnprotectedPorts: &eapolv1.Ports{},
+			UnprotectedPorts: &eapolv1.Ports{
+				Tcp: []int{53, 80},
+				Udp: []int{53, 319},
+			},
+			AllowedMacs:      []string{"6e:16:06:0e:b7:e2"},
+			DeniedMacs:       []string{"6e:16:06:0e:b7:e4"},
+			Exceptions:       []eapolv1.TrafficException{{EtherType: 0x88f7}},
+			EgressPolicy:     eapolv1.EgressPolicyDrop,
+			EgressExceptions: []eapolv1.TrafficException{{EtherType: 0x88cc}},
+			Backend:          eapolv1.TrafficControlBackendNftables,
+			GuestVlan:        100,
 		}
-		tcp, udp := cfggen.parsePorts()
-		Expect(tcp).To(BeEmpty())
-		Expect(udp).To(BeEmpty())
-	})
-	It("should separate ports by protocol", func() {
-		cfggen.a11r.Spec.TrafficControl = &eapolv1.TrafficControl{
+		Expect(cfggen.trafficPolicy()).To(Equal(&eapolv1.TrafficControl{
 			UnprotectedPorts: &eapolv1.Ports{
 				Tcp: []int{53, 80},
 				Udp: []int{53, 319},
 			},
+			AllowedMacs:      []string{"6e:16:06:0e:b7:e2"},
+			DeniedMacs:       []string{"6e:16:06:0e:b7:e4"},
+			Exceptions:       []eapolv1.TrafficException{{EtherType: 0x88f7}},
+			EgressExceptions: []eapolv1.TrafficException{{EtherType: 0x88cc}},
+			GuestVlan:        100,
+		}))
+	})
+	It("should keep the authentication mode, supplicant to VF mapping and fallback VLANs", func() {
+		supplicants := []eapolv1.VFSupplicants{{VF: 3, MACs: []string{"6e:16:06:0e:b7:e4"}}}
+		cfggen.a11r.Spec.TrafficControl = &eapolv1.TrafficControl{
+			AuthenticationMode: eapolv1.AuthenticationModePerVF,
+			VFSupplicants:      supplicants,
+			GuestVlanTimeout:   30,
+			AuthFailVlan:       20,
 		}
-		tcp, udp := cfggen.parsePorts()
-		Expect(tcp).To(Equal("53 80"))
-		Expect(udp).To(Equal("53 319"))
+		// The timeout only applies with a guest VLAN
+		Expect(cfggen.trafficPolicy()).To(Equal(&eapolv1.TrafficControl{
+			AuthenticationMode: eapolv1.AuthenticationModePerVF,
+			VFSupplicants:      supplicants,
+			AuthFailVlan:       20,
+		}))
+		cfggen.a11r.Spec.TrafficControl.GuestVlan = 10
+		Expect(cfggen.trafficPolicy().GuestVlanTimeout).To(Equal(30))
+	})
+	It("should drop the egress exceptions unless egress is dropped", func() {
+		cfggen.a11r.Spec.TrafficControl = &eapolv1.TrafficControl{
+			EgressExceptions: []eapolv1.TrafficException{{EtherType: 0x88cc}},
+		}
+		Expect(cfggen.trafficPolicy().EgressExceptions).To(BeEmpty())
 	})
 })
 
@@ -173,6 +473,92 @@ var _ = Describe("ConfigMap", func() {
 		Expect(err).NotTo(HaveOccurred())
 		Expect(cm.Data["hostapd.conf"]).To(ContainSubstring("\ninterface=nic1,nic2,nic3\n"))
 	})
+	It("should render the traffic policy as JSON", func() {
+		cm, err := cfggen.ConfigMap()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cm.Data["traffic-policy.json"]).To(MatchJSON(`{}`))
+
+		cfggen.a11r.Spec.TrafficControl = &eapolv1.TrafficControl{
+			UnprotectedPorts: &eapolv1.Ports{Udp: []int{67}},
+			Exceptions: []eapolv1.TrafficException{
+				{Protocol: eapolv1.IPProtocolUDP, Ports: []eapolv1.PortRange{{Port: 67}}},
+			},
+		}
+		cm, err = cfggen.ConfigMap()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cm.Data["traffic-policy.json"]).To(MatchJSON(
+			`{"unprotectedPorts":{"udp":[67]},"exceptions":[{"protocol":"udp","ports":[{"port":67}]}]}`))
+	})
+	It("should leave the interface to hostapd with interface selectors only", func() {
+		cfggen.a11r.Spec.Interfaces = nil
+		cfggen.a11r.Spec.InterfaceSelectors = []eapolv1.InterfaceSelector{{NamePattern: "ens*f0"}}
+		cm, err := cfggen.ConfigMap()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cm.Data["hostapd.conf"]).NotTo(ContainSubstring("\ninterface="))
+	})
+	It("should render a configuration for each overridden interface", func() {
+		period, vlan := 600, 10
+		cfggen.a11r.Spec.Interfaces = []string{"eth0", "eth1"}
+		cfggen.a11r.Spec.Authentication.Radius = &eapolv1.Radius{
+			AuthServers: []eapolv1.RadiusServer{{Address: "1.1.1.1"}},
+		}
+		cfggen.a11r.Spec.InterfaceOverrides = []eapolv1.InterfaceOverride{{
+			Interface:          "eth1",
+			EapReauthPeriod:    &period,
+			DynamicVlan:        eapolv1.DynamicVlanRequired,
+			UnprotectedPorts:   &eapolv1.Ports{Udp: []int{67}},
+			AuthenticationMode: eapolv1.AuthenticationModePerVF,
+			GuestVlan:          &vlan,
+		}}
+		cm, err := cfggen.ConfigMap()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cm.Data).To(HaveKey("hostapd.conf"))
+		Expect(cm.Data).To(HaveKey("traffic-policy.json"))
+		Expect(cm.Data["hostapd.conf"]).To(ContainSubstring("\ninterface=eth0,eth1\n"))
+		Expect(cm.Data["hostapd.conf"]).To(ContainSubstring("\neap_reauth_period=3600\n"))
+		Expect(cm.Data["hostapd.conf"]).To(ContainSubstring("\n#dynamic_vlan=0\n"))
+		Expect(cm.Data["traffic-policy.json"]).To(MatchJSON(`{}`))
+		Expect(cm.Data["hostapd-eth1.conf"]).To(ContainSubstring("\ninterface=eth1\n"))
+		Expect(cm.Data["hostapd-eth1.conf"]).To(ContainSubstring("\neap_reauth_period=600\n"))
+		Expect(cm.Data["hostapd-eth1.conf"]).To(ContainSubstring("\ndynamic_vlan=2\n"))
+		Expect(cm.Data["traffic-policy-eth1.json"]).To(MatchJSON(`{"unprotectedPorts":{"udp":[67]},"authenticationMode":"per-vf","guestVlan":10}`))
+		// The overrides do not leak into the Authenticator
+		Expect(cfggen.a11r.Spec.Configuration).To(BeNil())
+	})
+	It("should hash the rendered configuration", func() {
+		cm, err := cfggen.ConfigMap()
+		Expect(err).NotTo(HaveOccurred())
+		hash := ConfigHash(cm)
+		Expect(hash).To(HaveLen(64))
+		Expect(ConfigHash(cm)).To(Equal(hash))
+
+		cfggen.a11r.Spec.Interfaces = []string{"eth1"}
+		cm, err = cfggen.ConfigMap()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ConfigHash(cm)).NotTo(Equal(hash))
+	})
+	It("should only change the config_id with the settings sessions depend on", func() {
+		cfggen.a11r.Spec.Authentication.Radius = &eapolv1.Radius{
+			AuthServers: []eapolv1.RadiusServer{{Address: "1.1.1.1"}},
+		}
+		cm, err := cfggen.ConfigMap()
+		Expect(err).NotTo(HaveOccurred())
+		id := regexp.MustCompile("\nconfig_id=([0-9a-f]{16})\n").FindStringSubmatch(cm.Data["hostapd.conf"])
+		Expect(id).To(HaveLen(2))
+
+		cfggen.a11r.Spec.Configuration = &eapolv1.Config{EapReauthPeriod: 42}
+		cfggen.a11r.Spec.Authentication.Radius.Accounting = &eapolv1.RadiusAccounting{
+			Servers: []eapolv1.RadiusServer{{Address: "2.2.2.2"}},
+		}
+		cm, err = cfggen.ConfigMap()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cm.Data["hostapd.conf"]).To(ContainSubstring("\nconfig_id=" + id[1] + "\n"))
+
+		cfggen.a11r.Spec.Authentication.Radius.AuthServers[0].Address = "3.3.3.3"
+		cm, err = cfggen.ConfigMap()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cm.Data["hostapd.conf"]).NotTo(ContainSubstring("\nconfig_id=" + id[1] + "\n"))
+	})
 	It("should configure the eap_reauth_period correctly when no configuration is provided", func() {
 		cm, err := cfggen.ConfigMap()
 		Expect(err).NotTo(HaveOccurred())
@@ -211,4 +597,185 @@ var _ = Describe("ConfigMap", func() {
 		Expect(cm.Data["hostapd.conf"]).To(ContainSubstring("\nauth_server_addr=1.1.1.1\n"))
 		Expect(cm.Data["hostapd.conf"]).To(ContainSubstring("\nauth_server_port=8080\n"))
 	})
+	It("should only reference the RADIUS shared secret by placeholder", func() {
+		cfggen.a11r.Spec.Authentication.Radius = &eapolv1.Radius{
+			AuthServer: "1.1.1.1",
+			AuthPort:   1812,
+			AuthSecret: "radius-secret",
+		}
+		cm, err := cfggen.ConfigMap()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cm.Data["hostapd.conf"]).To(ContainSubstring("\nauth_server_shared_secret=$SECRET{auth-0}\n"))
+	})
+	It("should configure multiple RADIUS servers in failover order", func() {
+		cfggen.a11r.Spec.Authentication.Radius = &eapolv1.Radius{
+			AuthServers: []eapolv1.RadiusServer{{
+				Address: "10.0.0.1",
+				Secret:  eapolv1.SecretKeyRef{Name: "primary"},
+			}, {
+				Address: "10.0.0.2",
+				Port:    1645,
+				Secret:  eapolv1.SecretKeyRef{Name: "secondary", Key: "shared"},
+			}},
+			RetryPrimaryInterval: 600,
+		}
+		cm, err := cfggen.ConfigMap()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cm.Data["hostapd.conf"]).To(ContainSubstring(
+			"\nauth_server_addr=10.0.0.1\nauth_server_port=1812\nauth_server_shared_secret=$SECRET{auth-0}\n" +
+				"auth_server_addr=10.0.0.2\nauth_server_port=1645\nauth_server_shared_secret=$SECRET{auth-1}\n"))
+		Expect(cm.Data["hostapd.conf"]).To(ContainSubstring("\nradius_retry_primary_interval=600\n"))
+	})
+	It("should point hostapd at the RadSec proxy when the TLS transport is used", func() {
+		cfggen.a11r.Spec.Authentication.Radius = &eapolv1.Radius{
+			AuthServers: []eapolv1.RadiusServer{{Address: "10.0.0.1"}, {Address: "10.0.0.2"}},
+			Transport:   eapolv1.RadiusTransportTLS,
+		}
+		cm, err := cfggen.ConfigMap()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cm.Data["hostapd.conf"]).To(ContainSubstring(
+			"\nauth_server_addr=127.0.0.1\nauth_server_port=18120\nauth_server_shared_secret=radsec\n" +
+				"auth_server_addr=127.0.0.1\nauth_server_port=18121\nauth_server_shared_secret=radsec\n"))
+	})
+	It("should not configure RADIUS accounting unless requested", func() {
+		cm, err := cfggen.ConfigMap()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cm.Data["hostapd.conf"]).NotTo(ContainSubstring("\nacct_server_addr="))
+		Expect(cm.Data["hostapd.conf"]).NotTo(ContainSubstring("\nradius_acct_interim_interval="))
+	})
+	It("should configure RADIUS accounting when requested", func() {
+		cfggen.a11r.Spec.Authentication.Radius = &eapolv1.Radius{
+			AuthServers: []eapolv1.RadiusServer{{
+				Address: "10.0.0.1",
+				Secret:  eapolv1.SecretKeyRef{Name: "auth"},
+			}},
+			Accounting: &eapolv1.RadiusAccounting{
+				Servers: []eapolv1.RadiusServer{{
+					Address: "10.0.0.3",
+					Secret:  eapolv1.SecretKeyRef{Name: "acct"},
+				}},
+				InterimInterval: 300,
+			},
+		}
+		cm, err := cfggen.ConfigMap()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cm.Data["hostapd.conf"]).To(ContainSubstring(
+			"\nacct_server_addr=10.0.0.3\nacct_server_port=1813\nacct_server_shared_secret=$SECRET{acct-0}\n"))
+		Expect(cm.Data["hostapd.conf"]).To(ContainSubstring("\nradius_acct_interim_interval=300\n"))
+		Expect(cfggen.RadiusSecretRefs()).To(Equal([]eapolv1.SecretKeyRef{
+			{Name: "auth", Key: "secret"},
+			{Name: "acct", Key: "secret"},
+		}))
+	})
+})
+
+var _ = Describe("DynamicVlan", func() {
+	var cfggen *ConfigGenerator
+	BeforeEach(func() {
+		cfggen = New(NewA11r(), "")
+	})
+	It("should not enable dynamic VLANs by default", func() {
+		cm, err := cfggen.ConfigMap()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cm.Data["hostapd.conf"]).To(ContainSubstring("\n#dynamic_vlan=0\n"))
+	})
+	It("should configure the dynamic VLAN mode", func() {
+		cfggen.a11r.Spec.Authentication.Radius.DynamicVlan = eapolv1.DynamicVlanOptional
+		cm, err := cfggen.ConfigMap()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cm.Data["hostapd.conf"]).To(ContainSubstring("\ndynamic_vlan=1\n"))
+		cfggen.a11r.Spec.Authentication.Radius.DynamicVlan = eapolv1.DynamicVlanRequired
+		cm, err = cfggen.ConfigMap()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cm.Data["hostapd.conf"]).To(ContainSubstring("\ndynamic_vlan=2\n"))
+	})
+})
+
+var _ = Describe("MACsec", func() {
+	var cfggen *ConfigGenerator
+	BeforeEach(func() {
+		cfggen = New(NewA11r(), "")
+	})
+	It("should use the wired driver without MACsec", func() {
+		cm, err := cfggen.ConfigMap()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cm.Data["hostapd.conf"]).To(ContainSubstring("\ndriver=wired\n"))
+		Expect(cm.Data["hostapd.conf"]).NotTo(ContainSubstring("\nmacsec_policy="))
+		Expect(cfggen.MACsecSecretRefs()).To(BeEmpty())
+	})
+	It("should derive the CAK from EAP by default", func() {
+		cfggen.a11r.Spec.MACsec = &eapolv1.MACsec{
+			CipherSuite:   eapolv1.MACsecCipherSuiteGcmAes256,
+			ReplayProtect: true,
+			ReplayWindow:  16,
+		}
+		cm, err := cfggen.ConfigMap()
+		Expect(err).NotTo(HaveOccurred())
+		conf := cm.Data["hostapd.conf"]
+		Expect(conf).To(ContainSubstring("\ndriver=macsec_linux\n"))
+		Expect(conf).To(ContainSubstring("\nmacsec_policy=1\n"))
+		Expect(conf).To(ContainSubstring("\nmacsec_integ_only=0\n"))
+		Expect(conf).To(ContainSubstring("\nmacsec_replay_protect=1\nmacsec_replay_window=16\n"))
+		Expect(conf).To(ContainSubstring("\nmacsec_csindex=1\n"))
+		Expect(conf).To(ContainSubstring("\nmka_priority=255\n"))
+		Expect(conf).NotTo(ContainSubstring("\nmka_cak="))
+	})
+	It("should make the authenticator the key server with priority 0", func() {
+		priority := 0
+		cfggen.a11r.Spec.MACsec = &eapolv1.MACsec{Priority: &priority}
+		cm, err := cfggen.ConfigMap()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cm.Data["hostapd.conf"]).To(ContainSubstring("\nmka_priority=0\n"))
+	})
+	It("should only reference a pre-shared CAK and CKN by placeholder", func() {
+		cfggen.a11r.Spec.MACsec = &eapolv1.MACsec{
+			IntegrityOnly: true,
+			PreSharedKey:  &eapolv1.MACsecPreSharedKey{SecretName: "mka", CknKey: "name"},
+		}
+		cm, err := cfggen.ConfigMap()
+		Expect(err).NotTo(HaveOccurred())
+		conf := cm.Data["hostapd.conf"]
+		Expect(conf).To(ContainSubstring("\nmacsec_integ_only=1\n"))
+		Expect(conf).To(ContainSubstring("\nmka_cak=$SECRET{mka-cak}\nmka_ckn=$SECRET{mka-ckn}\n"))
+		Expect(cfggen.MACsecSecretRefs()).To(Equal([]eapolv1.SecretKeyRef{
+			{Name: "mka", Key: "cak"},
+			{Name: "mka", Key: "name"},
+		}))
+	})
+})
+
+var _ = Describe("RadiusSecretRefs", func() {
+	var cfggen *ConfigGenerator
+	BeforeEach(func() {
+		cfggen = New(NewA11r(), "")
+	})
+	It("should return nothing when no secret is configured", func() {
+		Expect(cfggen.RadiusSecretRefs()).To(BeEmpty())
+	})
+	It("should default the secret key", func() {
+		cfggen.a11r.Spec.Authentication.Radius.AuthServer = "1.1.1.1"
+		cfggen.a11r.Spec.Authentication.Radius.AuthSecret = "radius-secret"
+		Expect(cfggen.RadiusSecretRefs()).To(Equal([]eapolv1.SecretKeyRef{{Name: "radius-secret", Key: "secret"}}))
+	})
+	It("should return one secret per server in order", func() {
+		cfggen.a11r.Spec.Authentication.Radius = &eapolv1.Radius{
+			AuthServers: []eapolv1.RadiusServer{{
+				Address: "10.0.0.1",
+				Secret:  eapolv1.SecretKeyRef{Name: "primary"},
+			}, {
+				Address: "10.0.0.2",
+				Secret:  eapolv1.SecretKeyRef{Name: "secondary", Key: "shared"},
+			}},
+		}
+		Expect(cfggen.RadiusSecretRefs()).To(Equal([]eapolv1.SecretKeyRef{
+			{Name: "primary", Key: "secret"},
+			{Name: "secondary", Key: "shared"},
+		}))
+	})
+	It("should honor an explicit secret key", func() {
+		cfggen.a11r.Spec.Authentication.Radius.AuthServer = "1.1.1.1"
+		cfggen.a11r.Spec.Authentication.Radius.AuthSecret = "radius-secret"
+		cfggen.a11r.Spec.Authentication.Radius.AuthSecretKey = "shared"
+		Expect(cfggen.RadiusSecretRefs()).To(Equal([]eapolv1.SecretKeyRef{{Name: "radius-secret", Key: "shared"}}))
+	})
 })
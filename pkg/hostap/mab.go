@@ -0,0 +1,263 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hostap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"sort"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"golang.org/x/sys/unix"
+	kapi "k8s.io/api/core/v1"
+
+	eapolv1 "github.com/openshift-kni/eapol-operator/api/v1"
+	"github.com/openshift-kni/eapol-operator/internal/trafficcontrol"
+)
+
+const (
+	// maxMabCandidates bounds the number of source MAC addresses waiting
+	// for MAB, so that a flood of spoofed addresses cannot exhaust memory
+	maxMabCandidates = 1024
+	// mabRejectHoldoff is how long a rejected MAC address waits before it
+	// is authorized again
+	mabRejectHoldoff = time.Minute
+	ethHeaderLen     = 14
+)
+
+func (m *InterfaceMonitor) initMab() {
+	m.mabAddrs = make(map[string]interface{})
+	m.resetMabCandidates()
+}
+
+// resetMabCandidates forgets the source MAC addresses seen so far, for when
+// another device may be attached.
+func (m *InterfaceMonitor) resetMabCandidates() {
+	m.mabCandidates = make(map[string]int64)
+	m.eapolAddrs = make(map[string]interface{})
+}
+
+// sniffFrames watches the source MAC addresses of frames received on the
+// interface.  Packet sockets see frames before the traffic control ingress
+// hook, so traffic from unauthenticated devices is seen while it is dropped.
+func (m *InterfaceMonitor) sniffFrames() {
+	defer m.stopWg.Done()
+	link, err := m.LinkMgr.LinkByName(m.IfName)
+	if err != nil {
+		level.Error(m.Logger).Log("mab", "error looking up interface", m.IfName, err)
+		return
+	}
+	proto := htons(unix.ETH_P_ALL)
+	fd, err := unix.Socket(unix.AF_PACKET, unix.SOCK_RAW, int(proto))
+	if err != nil {
+		level.Error(m.Logger).Log("mab", "error opening packet socket", m.IfName, err)
+		return
+	}
+	defer unix.Close(fd)
+	if err := unix.Bind(fd, &unix.SockaddrLinklayer{Protocol: proto, Ifindex: link.Attrs().Index}); err != nil {
+		level.Error(m.Logger).Log("mab", "error binding packet socket", m.IfName, err)
+		return
+	}
+	tv := unix.Timeval{Sec: 1}
+	if err := unix.SetsockoptTimeval(fd, unix.SOL_SOCKET, unix.SO_RCVTIMEO, &tv); err != nil {
+		level.Error(m.Logger).Log("mab", "error setting packet socket timeout", m.IfName, err)
+		return
+	}
+	// Only the Ethernet header is needed, the rest of the frame is truncated
+	buf := make([]byte, ethHeaderLen)
+	for {
+		select {
+		case <-m.stop:
+			return
+		default:
+			size, from, err := unix.Recvfrom(fd, buf, 0)
+			if err != nil {
+				if err == unix.EAGAIN || err == unix.EINTR {
+					continue
+				}
+				level.Error(m.Logger).Log("mab", "error reading packet socket", m.IfName, err)
+				return
+			}
+			if ll, ok := from.(*unix.SockaddrLinklayer); !ok || ll.Pkttype == unix.PACKET_OUTGOING || size < ethHeaderLen {
+				continue
+			}
+			m.handleFrame(net.HardwareAddr(buf[6:12]), binary.BigEndian.Uint16(buf[12:14]))
+		}
+	}
+}
+
+// handleFrame records the source of a received frame.  Sources which send
+// EAPOL are supplicants and left to hostapd, others become MAB candidates
+// once seen.
+func (m *InterfaceMonitor) handleFrame(src net.HardwareAddr, ethType uint16) {
+	if src[0]&0x01 != 0 {
+		// Group addresses are never a frame source
+		return
+	}
+	mac := src.String()
+	m.addrMutex.Lock()
+	defer m.addrMutex.Unlock()
+	if ethType == unix.ETH_P_PAE {
+		m.markEapol(mac)
+		return
+	}
+	if _, ok := m.eapolAddrs[mac]; ok {
+		return
+	}
+	if _, ok := m.PfInfo.AuthenticatedAddrs[mac]; ok || m.isStaticMac(src) {
+		return
+	}
+	if _, ok := m.mabCandidates[mac]; ok || len(m.mabCandidates) >= maxMabCandidates {
+		return
+	}
+	m.mabCandidates[mac] = getCurrentTimestamp()
+}
+
+// isStaticMac returns whether traffic from a MAC address is always allowed
+// or denied, regardless of MAB.
+func (m *InterfaceMonitor) isStaticMac(mac net.HardwareAddr) bool {
+	for _, macs := range [][]net.HardwareAddr{m.AllowedMacs, m.DeniedMacs} {
+		for _, static := range macs {
+			if bytes.Equal(static, mac) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// markEapol records a supplicant, which is not authorized by MAB.  The
+// caller holds addrMutex.
+func (m *InterfaceMonitor) markEapol(mac string) {
+	m.eapolAddrs[mac] = nil
+	delete(m.mabCandidates, mac)
+}
+
+// forgetMab drops the MAB state of a deauthenticated MAC address, returning
+// whether it was authorized by MAB.  The caller holds addrMutex.
+func (m *InterfaceMonitor) forgetMab(mac string) bool {
+	if _, ok := m.mabAddrs[mac]; !ok {
+		return false
+	}
+	delete(m.mabAddrs, mac)
+	stats.DeAuthenticated(m.IfName)
+	return true
+}
+
+// handleMab authorizes MAB candidates no EAPOL was received from within the
+// MAB timeout.
+func (m *InterfaceMonitor) handleMab() {
+	defer m.stopWg.Done()
+	for {
+		select {
+		case <-m.stop:
+			return
+		default:
+			for _, mac := range m.dueMabCandidates(getCurrentTimestamp()) {
+				m.authorizeMab(mac)
+			}
+			time.Sleep(1 * time.Second)
+		}
+	}
+}
+
+func (m *InterfaceMonitor) dueMabCandidates(now int64) []string {
+	m.addrMutex.Lock()
+	defer m.addrMutex.Unlock()
+	var due []string
+	for mac, seen := range m.mabCandidates {
+		if now-seen >= m.MABTimeout.Microseconds() {
+			due = append(due, mac)
+		}
+	}
+	sort.Strings(due)
+	return due
+}
+
+// authorizeMab asks the MAB authorizer about a candidate, which may take a
+// while with RADIUS, so addrMutex is only taken for the outcome.
+func (m *InterfaceMonitor) authorizeMab(mac string) {
+	hwAddr, err := net.ParseMAC(mac)
+	if err != nil {
+		return
+	}
+	result, err := m.MABAuthorizer.Authorize(m.IfName, hwAddr)
+	m.addrMutex.Lock()
+	if _, ok := m.mabCandidates[mac]; !ok {
+		// EAPOL was received meanwhile
+		m.addrMutex.Unlock()
+		return
+	}
+	if err != nil {
+		level.Error(m.Logger).Log("mab", "error authorizing", m.IfName, mac, "error", err)
+		// Try again after another timeout
+		m.mabCandidates[mac] = getCurrentTimestamp()
+		m.addrMutex.Unlock()
+		return
+	}
+	if !result.Accept {
+		m.mabCandidates[mac] = getCurrentTimestamp() + mabRejectHoldoff.Microseconds()
+		m.logEvent(kapi.EventTypeWarning, "MAB rejected device %s", mac)
+		stats.AuthFailed(m.IfName)
+		// Rejected devices are moved to the auth-fail VLAN as well
+		if _, err := m.PfInfo.EAPFailed(mac); err != nil {
+			level.Error(m.Logger).Log("mab", "error applying auth-fail vlan", m.IfName, mac, "error", err)
+		}
+		m.addrMutex.Unlock()
+		m.updateStatus()
+		return
+	}
+	delete(m.mabCandidates, mac)
+	m.PfInfo.AuthenticatedAddrs[mac] = nil
+	m.mabAddrs[mac] = nil
+	delete(m.deauthRequests, mac)
+	// The MAB RADIUS servers are not hostapd's
+	m.startSession(mac, "")
+	if err := trafficcontrol.AllowTrafficFromMac(m.PfInfo, mac, m.LinkMgr); err != nil {
+		level.Error(m.Logger).Log("mab", "error applying allow traffic", m.IfName, mac, "error", err)
+	}
+	if result.Vlan != 0 {
+		if err := m.PfInfo.AssignVlan(mac, result.Vlan); err != nil {
+			level.Error(m.Logger).Log("mab", "error assigning vlan", m.IfName, mac, "vlan", result.Vlan, "error", err)
+		}
+	}
+	m.logEvent(kapi.EventTypeNormal, "authenticated device %s by MAB", mac)
+	stats.Authenticated(m.IfName)
+	m.addrMutex.Unlock()
+	m.updateStatus()
+}
+
+// authMethod returns how an authenticated MAC address was authorized.  The
+// caller holds addrMutex.
+func (m *InterfaceMonitor) authMethod(mac string) eapolv1.AuthMethod {
+	if _, ok := m.mabAddrs[mac]; ok {
+		return eapolv1.AuthMethodMAB
+	}
+	return eapolv1.AuthMethodEAP
+}
+
+func (m *InterfaceMonitor) updateStatus() {
+	if err := m.updateInterfaceStatus(); err != nil {
+		level.Info(m.Logger).Log("op", "monitor", "error updating interface status", err)
+	}
+}
+
+func htons(v uint16) uint16 {
+	return v<<8 | v>>8
+}
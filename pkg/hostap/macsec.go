@@ -0,0 +1,55 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hostap
+
+import (
+	"strings"
+
+	eapolv1 "github.com/openshift-kni/eapol-operator/api/v1"
+)
+
+const kayStatusField = "PAE KaY status"
+
+// parseKaYStatus extracts the MKA key agreement entity state from a hostapd
+// STATUS reply, returning nil when the interface does not run MACsec.
+func parseKaYStatus(reply string) *eapolv1.MACsecStatus {
+	var status *eapolv1.MACsecStatus
+	for _, line := range strings.Split(reply, "\n") {
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		if parts[0] == kayStatusField {
+			status = &eapolv1.MACsecStatus{KaYStatus: parts[1]}
+			continue
+		}
+		if status == nil {
+			continue
+		}
+		switch parts[0] {
+		case "Authenticated":
+			status.Authenticated = parts[1] == "Yes"
+		case "Secured":
+			status.Secured = parts[1] == "Yes"
+		case "Failed":
+			status.Failed = parts[1] == "Yes"
+		case "Is Key Server":
+			status.KeyServer = parts[1] == "Yes"
+		}
+	}
+	return status
+}
@@ -0,0 +1,60 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hostap
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	eapolv1 "github.com/openshift-kni/eapol-operator/api/v1"
+)
+
+var kayStatusReplyStr = `state=ENABLED
+phy=ens1f0
+freq=0
+PAE KaY status=Active
+Authenticated=Yes
+Secured=Yes
+Failed=No
+Actor Priority=255
+Key Server Priority=16
+Is Key Server=No
+Number of Keys Distributed=0
+Number of Keys Received=1
+MKA Hello Time=2000
+`
+
+var _ = Describe("MACsec", func() {
+	It("parses the KaY status", func() {
+		Expect(parseKaYStatus(kayStatusReplyStr)).To(Equal(&eapolv1.MACsecStatus{
+			KaYStatus:     "Active",
+			Authenticated: true,
+			Secured:       true,
+		}))
+	})
+
+	It("ignores a STATUS reply without a KaY", func() {
+		Expect(parseKaYStatus("state=ENABLED\nphy=ens1f0\n")).To(BeNil())
+	})
+
+	It("handles a KaY status reply as a solicited event", func() {
+		intfMonitor := NewInterfaceMonitor(nil, "ens1f0")
+		Expect(intfMonitor.handleHostapdEvent(kayStatusReplyStr)).To(Succeed())
+		Expect(intfMonitor.ifEAPState).To(Equal(eapolv1.IfStateEnabled))
+		Expect(intfMonitor.macsecStatus.Secured).To(BeTrue())
+	})
+})
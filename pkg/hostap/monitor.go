@@ -18,11 +18,15 @@ package hostap
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net"
 	"os"
 	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -32,11 +36,12 @@ import (
 	"github.com/vishvananda/netlink"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/tools/record"
-	"k8s.io/client-go/util/retry"
 
 	"github.com/go-kit/log/level"
 	eapolv1 "github.com/openshift-kni/eapol-operator/api/v1"
+	"github.com/openshift-kni/eapol-operator/internal/k8s"
 	"github.com/openshift-kni/eapol-operator/internal/trafficcontrol"
+	"github.com/openshift-kni/eapol-operator/pkg/mab"
 	hostapif "github.com/openshift-kni/eapol-operator/pkg/netlink"
 	kapi "k8s.io/api/core/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -47,50 +52,85 @@ const (
 	eapSuccessEvent       = "CTRL-EVENT-EAP-SUCCESS"
 	staDisconnectedEvent  = "AP-STA-DISCONNECTED"
 	eapFailureEvent       = "CTRL-EVENT-EAP-FAILURE"
+	eapStartedEvent       = "CTRL-EVENT-EAP-STARTED"
 	pingCommand           = "PING"
 	attachCommand         = "ATTACH"
 	statusCommand         = "STATUS"
+	mibCommand            = "MIB"
+	staCommand            = "STA"
 	deauthenticateCommand = "DEAUTHENTICATE"
+	reloadConfigCommand   = "RELOAD_CONFIG"
 	unixDgramProtocol     = "unixgram"
 	sockReadBufSize       = 4096
+	// mibPollInterval is the number of keepalive periods between MIB queries
+	mibPollInterval = 10
 )
 
 var (
 	hostapdSocketDir = "/var/run/hostapd/"
 	statusReply      = "state="
-	solicitedEvents  = []string{"PONG\n", "OK\n", statusReply}
+	mibReply         = "dot1xPaeSystemAuthControl="
+	staReply         = "\nflags="
+	solicitedEvents  = []string{"PONG\n", "OK\n", statusReply, mibReply, staReply}
 	requestTimeout   = int(2 * time.Second / time.Microsecond)
 )
 
 type Opts func(intfMonitor *InterfaceMonitor)
 
 type InterfaceMonitor struct {
-	Logger         log.Logger
-	Client         client.Client
-	Recorder       record.EventRecorder
-	AuthNsName     *types.NamespacedName
+	Logger     log.Logger
+	Client     client.Client
+	Recorder   record.EventRecorder
+	AuthNsName *types.NamespacedName
+	// NodeName is the node the interface status is reported under
+	NodeName       string
 	IfName         string
 	PfInfo         *trafficcontrol.PFInfo
 	IfEventHandler hostapif.LinkEventHandler
 	LinkMgr        utils.NetlinkManager
+	TrafficCtl     trafficcontrol.TrafficController
+	MACsecPolicy   eapolv1.MACsecPolicy
+	// AuthenticationMode and VFSupplicants select per-VF authentication
+	// of SR-IOV ports
+	AuthenticationMode eapolv1.AuthenticationMode
+	VFSupplicants      map[string]int
+	// GuestVlan and AuthFailVlan release VFs of unauthenticated SR-IOV
+	// ports onto a restricted network, the guest VLAN once no EAPOL was
+	// received for GuestVlanTimeout
+	GuestVlan        int
+	GuestVlanTimeout time.Duration
+	AuthFailVlan     int
+	// AllowedMacs and DeniedMacs are the source MAC addresses always
+	// allowed and denied by the static traffic control rules
+	AllowedMacs []net.HardwareAddr
+	DeniedMacs  []net.HardwareAddr
+	// MABAuthorizer, if set, authorizes devices no EAPOL was received from
+	// within MABTimeout by their MAC address
+	MABAuthorizer mab.Authorizer
+	MABTimeout    time.Duration
+	// EgressDrop opens egress traffic to each authenticated peer
+	EgressDrop     bool
 	ifEventCh      chan netlink.LinkUpdate
 	hostApdConn    net.Conn
+	connMutex      sync.RWMutex
 	deauthRequests map[string]int64
 	addrMutex      sync.Mutex
 	stopWg         sync.WaitGroup
 	stop           chan interface{}
 	operState      netlink.LinkOperState
 	ifEAPState     eapolv1.IfState
+	radiusStats    []radiusServerStats
+	activeServer   string
+	macsecStatus   *eapolv1.MACsecStatus
+	guestDeadline  int64
+	mabCandidates  map[string]int64
+	eapolAddrs     map[string]interface{}
+	mabAddrs       map[string]interface{}
+	sessions       map[string]*session
 }
 
 func (m *InterfaceMonitor) StartMonitor() error {
-	local, err := ioutil.TempFile(hostapdSocketDir, "hostapd_monitor_client")
-	if err != nil {
-		return err
-	}
-	os.Remove(local.Name())
-	conn, err := net.DialUnix(unixDgramProtocol, &net.UnixAddr{Name: local.Name(), Net: unixDgramProtocol},
-		&net.UnixAddr{Name: filepath.Join(hostapdSocketDir, m.IfName), Net: unixDgramProtocol})
+	conn, err := m.dialHostapd()
 	if err != nil {
 		return err
 	}
@@ -98,11 +138,21 @@ func (m *InterfaceMonitor) StartMonitor() error {
 	m.stop = make(chan interface{})
 	m.stopWg.Add(4)
 	m.deauthRequests = make(map[string]int64)
+	m.sessions = make(map[string]*session)
+	m.initMab()
 	m.ifEventCh = make(chan netlink.LinkUpdate)
 	pfInfo, err := trafficcontrol.GetSriovPFInfo(m.IfName, m.LinkMgr)
 	if err != nil {
 		return err
 	}
+	pfInfo.TrafficCtl = m.TrafficCtl
+	pfInfo.MACsecRequired = m.MACsecPolicy == eapolv1.MACsecPolicyMustSecure
+	pfInfo.EgressDrop = m.EgressDrop
+	pfInfo.PerVF = m.AuthenticationMode == eapolv1.AuthenticationModePerVF
+	pfInfo.VFSupplicants = m.VFSupplicants
+	pfInfo.GuestVlan = m.GuestVlan
+	pfInfo.AuthFailVlan = m.AuthFailVlan
+	m.startGuestTimer()
 	err = pfInfo.ConfigureVlanStateForVFs()
 	if err != nil {
 		return err
@@ -113,6 +163,11 @@ func (m *InterfaceMonitor) StartMonitor() error {
 	go m.handleIfEvents()
 	go m.sendKeepAlive()
 	go m.handleRequestsTimeout()
+	if m.MABAuthorizer != nil {
+		m.stopWg.Add(2)
+		go m.sniffFrames()
+		go m.handleMab()
+	}
 	err = m.attachHostapd()
 	if err != nil {
 		m.StopMonitor()
@@ -127,16 +182,15 @@ func (m *InterfaceMonitor) StartMonitor() error {
 }
 
 func (m *InterfaceMonitor) StopMonitor() {
-	if m.PfInfo != nil && !m.PfInfo.Authenticated {
-		m.PfInfo.Authenticated = true
-		err := m.PfInfo.ConfigureVlanStateForVFs()
+	if m.PfInfo != nil && (!m.PfInfo.Authenticated || m.PfInfo.PerVF) {
+		err := m.PfInfo.ReleaseVFs()
 		if err != nil {
 			level.Error(m.Logger).Log("error resoring vf state and vlan configuration", m.IfName, "error", err)
 		}
 	}
 	close(m.stop)
 	m.IfEventHandler.Unsubscribe(m.IfName)
-	err := m.hostApdConn.Close()
+	err := m.conn().Close()
 	if err != nil {
 		level.Error(m.Logger).Log("sockread", "error closing connection", m.IfName, err)
 	}
@@ -151,14 +205,19 @@ func (m *InterfaceMonitor) handleHostapdReply() {
 		case <-m.stop:
 			return
 		default:
-			m.hostApdConn.SetReadDeadline(time.Now().Add(1 * time.Second))
-			size, err := m.hostApdConn.Read(receivedByteArr)
+			conn := m.conn()
+			conn.SetReadDeadline(time.Now().Add(1 * time.Second))
+			size, err := conn.Read(receivedByteArr)
 			if err != nil {
 				if opErr, ok := err.(*net.OpError); ok && opErr.Timeout() {
 					continue
 				}
-				level.Error(m.Logger).Log("sockread", "error reading from connection", m.IfName, err)
-				return
+				// Reattach closes the connection it replaced
+				if !errors.Is(err, net.ErrClosed) {
+					level.Error(m.Logger).Log("sockread", "error reading from connection", m.IfName, err)
+					time.Sleep(1 * time.Second)
+				}
+				continue
 			}
 			if size == 0 {
 				continue
@@ -173,17 +232,29 @@ func (m *InterfaceMonitor) handleHostapdReply() {
 }
 
 func (m *InterfaceMonitor) handleHostapdEvent(eventStr string) error {
-	eventStrSlice := strings.Split(eventStr, " ")
-	if len(eventStrSlice) < 2 {
-		if isSolicitedEvent(eventStr) {
-			if strings.Contains(eventStr, statusReply) {
-				m.ifEAPState = getIfState(eventStr)
-				if err := m.updateInterfaceStatus(); err != nil {
-					level.Info(m.Logger).Log("op", "monitor", "error updating interface status", err)
-				}
+	// Solicited replies are checked first, as the KaY fields of a STATUS
+	// reply contain spaces.
+	if isSolicitedEvent(eventStr) {
+		var (
+			changed bool
+			err     error
+		)
+		if strings.Contains(eventStr, mibReply) {
+			changed = m.handleMibReply(eventStr)
+		} else if strings.Contains(eventStr, staReply) {
+			changed, err = m.handleStaReply(eventStr)
+		} else if strings.Contains(eventStr, statusReply) {
+			changed = m.handleStatusReply(eventStr)
+		}
+		if changed {
+			if err := m.updateInterfaceStatus(); err != nil {
+				level.Info(m.Logger).Log("op", "monitor", "error updating interface status", err)
 			}
-			return nil
 		}
+		return err
+	}
+	eventStrSlice := strings.Split(eventStr, " ")
+	if len(eventStrSlice) < 2 {
 		level.Info(m.Logger).Log("hostapd-event", "unhandled event", m.IfName, eventStr)
 		return nil
 	}
@@ -199,6 +270,7 @@ func (m *InterfaceMonitor) handleHostapdEvent(eventStr string) error {
 	case eapSuccessEvent:
 		m.logEvent(kapi.EventTypeNormal, "authenticated supplicant %s", eventStrSlice[1])
 		stats.Authenticated(m.IfName)
+		m.handleEapSuccessEvent(eventStrSlice[1])
 	case staDisconnectedEvent:
 		m.logEvent(kapi.EventTypeNormal, "deauthenticated supplicant %s", eventStrSlice[1])
 		stats.DeAuthenticated(m.IfName)
@@ -206,6 +278,9 @@ func (m *InterfaceMonitor) handleHostapdEvent(eventStr string) error {
 	case eapFailureEvent:
 		m.logEvent(kapi.EventTypeWarning, "authentication failure for supplicant %s", eventStrSlice[1])
 		stats.AuthFailed(m.IfName)
+		return m.handleEapFailureEvent(eventStrSlice[1])
+	case eapStartedEvent:
+		return m.handleEapStartedEvent(eventStrSlice[1])
 	default:
 		level.Info(m.Logger).Log("hostapd-event", "unhandled event", m.IfName, eventStr)
 	}
@@ -214,29 +289,115 @@ func (m *InterfaceMonitor) handleHostapdEvent(eventStr string) error {
 
 func (m *InterfaceMonitor) sendKeepAlive() {
 	defer m.stopWg.Done()
-	for {
+	// unreachable is set while hostapd is down, so that the error is only
+	// logged once until Reattach reconnects
+	unreachable := false
+	for i := 0; ; i++ {
 		select {
 		case <-m.stop:
 			return
 		default:
 			time.Sleep(1 * time.Second)
-			m.hostApdConn.SetWriteDeadline(time.Now().Add(1 * time.Second))
-			_, err := m.hostApdConn.Write([]byte(pingCommand))
+			command := pingCommand
+			if i%mibPollInterval == 0 {
+				// The MIB reply doubles as the keepalive response
+				command = mibCommand
+			} else if m.MACsecPolicy != "" && i%mibPollInterval == mibPollInterval/2 {
+				// as does the STATUS reply carrying the MKA state
+				command = statusCommand
+			}
+			conn := m.conn()
+			conn.SetWriteDeadline(time.Now().Add(1 * time.Second))
+			_, err := conn.Write([]byte(command))
 			if err != nil {
 				if opErr, ok := err.(*net.OpError); ok && opErr.Timeout() {
 					continue
 				}
-				level.Error(m.Logger).Log("sockwrite", "error writing ping command to hostapd", m.IfName, err)
-				return
+				if !unreachable {
+					level.Error(m.Logger).Log("sockwrite", "error writing ping command to hostapd", m.IfName, err)
+				}
+				unreachable = true
+				continue
+			}
+			unreachable = false
+			if i%mibPollInterval == mibPollInterval-1 {
+				// Refresh the session details of authenticated stations
+				m.queryStations()
 			}
 		}
 	}
 }
 
+// handleMibReply tracks the RADIUS authentication server in use from the
+// MIB counters, returning true when it has changed.
+func (m *InterfaceMonitor) handleMibReply(reply string) bool {
+	servers := parseRadiusAuthMib(reply)
+	m.addrMutex.Lock()
+	defer m.addrMutex.Unlock()
+	active := activeRadiusServer(m.radiusStats, servers, m.activeServer)
+	m.radiusStats = servers
+	if active == m.activeServer {
+		return false
+	}
+	if m.activeServer != "" {
+		m.logEvent(kapi.EventTypeWarning, "RADIUS authentication server changed from %s to %s", m.activeServer, active)
+	}
+	m.activeServer = active
+	return true
+}
+
+// handleStaReply records the session details of a station and applies the
+// VLAN the RADIUS server assigned to it, returning true when either has
+// changed.
+func (m *InterfaceMonitor) handleStaReply(reply string) (bool, error) {
+	mac, attrs := parseStaReply(reply)
+	m.addrMutex.Lock()
+	defer m.addrMutex.Unlock()
+	if _, ok := m.PfInfo.AuthenticatedAddrs[mac]; !ok {
+		return false, nil
+	}
+	changed := false
+	if s, ok := m.sessions[mac]; ok {
+		details := parseStaDetails(attrs)
+		changed = details != s.details
+		s.details = details
+	}
+	vlan, err := strconv.Atoi(attrs["vlan_id"])
+	if err != nil || vlan <= 0 || m.PfInfo.StationVlans[mac] == vlan {
+		return changed, nil
+	}
+	if err := m.PfInfo.AssignVlan(mac, vlan); err != nil {
+		return changed, err
+	}
+	m.logEvent(kapi.EventTypeNormal, "assigned vlan %d to supplicant %s", vlan, mac)
+	return true, nil
+}
+
+// handleStatusReply tracks the interface and MKA state from a STATUS reply,
+// returning true when either has changed.
+func (m *InterfaceMonitor) handleStatusReply(reply string) bool {
+	ifState := getIfState(reply)
+	macsecStatus := parseKaYStatus(reply)
+	m.addrMutex.Lock()
+	defer m.addrMutex.Unlock()
+	changed := ifState != m.ifEAPState || !reflect.DeepEqual(macsecStatus, m.macsecStatus)
+	if m.macsecStatus != nil && macsecStatus != nil && m.macsecStatus.Secured != macsecStatus.Secured {
+		if macsecStatus.Secured {
+			m.logEvent(kapi.EventTypeNormal, "MACsec secure channel established")
+		} else {
+			m.logEvent(kapi.EventTypeWarning, "MACsec secure channel lost")
+		}
+	}
+	m.ifEAPState = ifState
+	m.macsecStatus = macsecStatus
+	return changed
+}
+
 func (m *InterfaceMonitor) attachHostapd() error {
-	m.hostApdConn.SetWriteDeadline(time.Now().Add(1 * time.Second))
+	conn := m.conn()
+	conn.SetWriteDeadline(time.Now().Add(1 * time.Second))
 	for {
-		_, err := m.hostApdConn.Write([]byte(attachCommand))
+		_, err := conn.Write([]byte(attachCommand))
 		if err != nil {
 			if opErr, ok := err.(*net.OpError); ok && opErr.Timeout() {
 				continue
@@ -287,11 +448,18 @@ func (m *InterfaceMonitor) handlePfEventForOpStateChange(linkUpdateEvent netlink
 			}
 			m.deauthRequests[addr] = getCurrentTimestamp()
 		}
+		// Another device may be attached when the link is back up
+		m.guestDeadline = 0
+		m.resetMabCandidates()
+		if err := m.PfInfo.ResetFallback(); err != nil {
+			level.Error(m.Logger).Log("interface", m.IfName, "error blocking fallback vlans", err)
+		}
 		m.logEvent(kapi.EventTypeWarning, "interface is down")
 	} else if m.operState == netlink.OperUp {
 		for addr := range m.PfInfo.AuthenticatedAddrs {
 			delete(m.deauthRequests, addr)
 		}
+		m.startGuestTimer()
 		m.logEvent(kapi.EventTypeNormal, "interface is up")
 	}
 	level.Info(m.Logger).Log("interface", m.IfName, "handleIfEvents", m.deauthRequests)
@@ -314,12 +482,18 @@ func (m *InterfaceMonitor) handleRequestsTimeout() {
 					break
 				}
 				delete(m.PfInfo.AuthenticatedAddrs, addr)
+				delete(m.sessions, addr)
+				m.forgetMab(addr)
 				err := trafficcontrol.DenyTrafficFromMac(m.PfInfo, addr, m.LinkMgr)
 				if err != nil {
 					level.Error(m.Logger).Log("interface", "addr", m.IfName, addr, "error applying deny traffic", err)
 				}
 				delete(m.deauthRequests, addr)
 			}
+			if m.guestDeadline != 0 && now >= m.guestDeadline {
+				m.guestDeadline = 0
+				m.handleGuestTimeout()
+			}
 			m.addrMutex.Unlock()
 			time.Sleep(1 * time.Second)
 		}
@@ -330,21 +504,161 @@ func (m *InterfaceMonitor) deauthenticate(addr string) error {
 	if addr == "" {
 		return nil
 	}
-	_, err := m.hostApdConn.Write([]byte(fmt.Sprintf("%s %s", deauthenticateCommand, addr)))
+	_, err := m.conn().Write([]byte(fmt.Sprintf("%s %s", deauthenticateCommand, addr)))
+	return err
+}
+
+// ReloadConfig has hostapd re-read its configuration file.  hostapd keeps
+// its stations when the config_id of the configuration is unchanged, and
+// flushes them otherwise, so unless keepSessions is set the traffic of the
+// supplicants authenticated so far is denied until they authenticate again.
+// Devices authorized by MAB are left alone, as the monitor authorizes them.
+func (m *InterfaceMonitor) ReloadConfig(keepSessions bool) error {
+	if err := m.writeCommand(reloadConfigCommand); err != nil {
+		return err
+	}
+	if !keepSessions {
+		m.flushSessions("configuration reloaded")
+	}
+	// Pick up the interface and MKA state of the new configuration
+	return m.writeCommand(statusCommand)
+}
+
+// flushSessions denies the traffic of every supplicant authenticated by
+// hostapd, reporting why in the event.
+func (m *InterfaceMonitor) flushSessions(reason string) {
+	m.addrMutex.Lock()
+	defer m.addrMutex.Unlock()
+	flushed := 0
+	for addr := range m.PfInfo.AuthenticatedAddrs {
+		if _, ok := m.mabAddrs[addr]; ok {
+			continue
+		}
+		delete(m.PfInfo.AuthenticatedAddrs, addr)
+		delete(m.deauthRequests, addr)
+		delete(m.sessions, addr)
+		err := trafficcontrol.DenyTrafficFromMac(m.PfInfo, addr, m.LinkMgr)
+		if err != nil {
+			level.Error(m.Logger).Log("interface", "addr", m.IfName, addr, "error applying deny traffic", err)
+		}
+		flushed++
+	}
+	if flushed == 0 {
+		return
+	}
+	m.logEvent(kapi.EventTypeNormal, "%s, %d supplicants must authenticate again", reason, flushed)
+	// updateInterfaceStatus takes addrMutex
+	go func() {
+		if err := m.updateInterfaceStatus(); err != nil {
+			level.Info(m.Logger).Log("op", "monitor", "error updating interface status", err)
+		}
+	}()
+}
+
+// SetStaticMacs replaces the source MAC addresses always allowed and denied
+// once their traffic control rules were updated, and reports them.
+func (m *InterfaceMonitor) SetStaticMacs(allowed, denied []net.HardwareAddr) {
+	m.addrMutex.Lock()
+	m.AllowedMacs = allowed
+	m.DeniedMacs = denied
+	m.addrMutex.Unlock()
+	if err := m.updateInterfaceStatus(); err != nil {
+		level.Info(m.Logger).Log("op", "monitor", "error updating interface status", err)
+	}
+}
+
+// SetSettings replaces the authentication mode, VF supplicants and fallback
+// VLANs, releasing the VFs of the authenticated supplicants and moving the
+// VFs on a fallback VLAN accordingly without ending any session, and reports
+// them.
+func (m *InterfaceMonitor) SetSettings(settings MonitorSettings) error {
+	m.addrMutex.Lock()
+	guestChanged := m.GuestVlan != settings.GuestVlan || m.GuestVlanTimeout != settings.GuestVlanTimeout
+	m.AuthenticationMode = settings.AuthenticationMode
+	m.VFSupplicants = settings.VFSupplicants
+	m.GuestVlan = settings.GuestVlan
+	m.GuestVlanTimeout = settings.GuestVlanTimeout
+	m.AuthFailVlan = settings.AuthFailVlan
+	var err error
+	if m.PfInfo != nil {
+		err = errors.Join(m.PfInfo.SetVFSupplicants(settings.VFSupplicants),
+			m.PfInfo.SetPerVF(settings.AuthenticationMode == eapolv1.AuthenticationModePerVF),
+			m.PfInfo.SetFallbackVlans(settings.GuestVlan, settings.AuthFailVlan))
+		// The guest timer restarts with the new VLAN and timeout unless
+		// the link is down, in which case it starts once it is up
+		if guestChanged && m.operState != netlink.OperDown {
+			m.guestDeadline = 0
+			m.startGuestTimer()
+		}
+	}
+	m.addrMutex.Unlock()
+	if err := m.updateInterfaceStatus(); err != nil {
+		level.Info(m.Logger).Log("op", "monitor", "error updating interface status", err)
+	}
 	return err
 }
 
 func (m *InterfaceMonitor) writeCommand(command string) error {
-	_, err := m.hostApdConn.Write([]byte(command))
+	_, err := m.conn().Write([]byte(command))
 	return err
 }
 
+// dialHostapd connects to the control interface hostapd created for the
+// interface.
+func (m *InterfaceMonitor) dialHostapd() (net.Conn, error) {
+	local, err := ioutil.TempFile(hostapdSocketDir, "hostapd_monitor_client")
+	if err != nil {
+		return nil, err
+	}
+	os.Remove(local.Name())
+	return net.DialUnix(unixDgramProtocol, &net.UnixAddr{Name: local.Name(), Net: unixDgramProtocol},
+		&net.UnixAddr{Name: filepath.Join(hostapdSocketDir, m.IfName), Net: unixDgramProtocol})
+}
+
+func (m *InterfaceMonitor) conn() net.Conn {
+	m.connMutex.RLock()
+	defer m.connMutex.RUnlock()
+	return m.hostApdConn
+}
+
+// Reattach connects to the control interface of a restarted hostapd and
+// attaches to its events.  The restarted hostapd has no stations, so the
+// traffic of the supplicants authenticated so far is denied until they
+// authenticate again.
+func (m *InterfaceMonitor) Reattach() error {
+	conn, err := m.dialHostapd()
+	if err != nil {
+		return err
+	}
+	m.connMutex.Lock()
+	old := m.hostApdConn
+	m.hostApdConn = conn
+	m.connMutex.Unlock()
+	old.Close()
+	if err := m.attachHostapd(); err != nil {
+		return err
+	}
+	m.flushSessions("hostapd restarted")
+	level.Info(m.Logger).Log("op", "monitor", "interface monitor reattached", m.IfName)
+	// Pick up the interface and MKA state of the restarted hostapd
+	return m.writeCommand(statusCommand)
+}
+
 func (m *InterfaceMonitor) handleAuthenticateEvent(addr string) error {
 	m.addrMutex.Lock()
 	defer m.addrMutex.Unlock()
 	m.PfInfo.AuthenticatedAddrs[addr] = nil
 	delete(m.deauthRequests, addr)
-	return trafficcontrol.AllowTrafficFromMac(m.PfInfo, addr, m.LinkMgr)
+	// A device authorized by MAB may have started EAP after all
+	m.forgetMab(addr)
+	m.markEapol(addr)
+	m.startSession(addr, m.activeServer)
+	err := trafficcontrol.AllowTrafficFromMac(m.PfInfo, addr, m.LinkMgr)
+	if err != nil {
+		return err
+	}
+	// The reply carries the VLAN assigned by the RADIUS server, if any
+	return m.writeCommand(fmt.Sprintf("%s %s", staCommand, addr))
 }
 
 func (m *InterfaceMonitor) handleDeAuthenticateEvent(addr string) error {
@@ -352,37 +666,130 @@ func (m *InterfaceMonitor) handleDeAuthenticateEvent(addr string) error {
 	defer m.addrMutex.Unlock()
 	delete(m.PfInfo.AuthenticatedAddrs, addr)
 	delete(m.deauthRequests, addr)
+	delete(m.sessions, addr)
+	m.forgetMab(addr)
 	return trafficcontrol.DenyTrafficFromMac(m.PfInfo, addr, m.LinkMgr)
 }
 
+// handleEapSuccessEvent records the reauthentication of an authenticated
+// supplicant.  A first authentication is recorded on AP-STA-CONNECTED,
+// which follows its EAP success.
+func (m *InterfaceMonitor) handleEapSuccessEvent(addr string) {
+	m.addrMutex.Lock()
+	defer m.addrMutex.Unlock()
+	if _, ok := m.PfInfo.AuthenticatedAddrs[addr]; ok {
+		m.reauthenticated(addr)
+	}
+}
+
+// handleEapStartedEvent takes the VFs of a supplicant off the guest VLAN, as
+// it is not a device without a supplicant.
+func (m *InterfaceMonitor) handleEapStartedEvent(addr string) error {
+	m.addrMutex.Lock()
+	defer m.addrMutex.Unlock()
+	m.markEapol(addr)
+	changed, err := m.PfInfo.EAPStarted(addr)
+	if changed {
+		m.logEvent(kapi.EventTypeNormal, "supplicant %s started authentication, leaving guest vlan", addr)
+	}
+	return err
+}
+
+func (m *InterfaceMonitor) handleEapFailureEvent(addr string) error {
+	m.addrMutex.Lock()
+	defer m.addrMutex.Unlock()
+	changed, err := m.PfInfo.EAPFailed(addr)
+	if changed {
+		m.logEvent(kapi.EventTypeWarning, "moved supplicant %s to auth-fail vlan %d", addr, m.AuthFailVlan)
+	}
+	return err
+}
+
+// handleGuestTimeout releases the VFs no EAPOL was received for onto the
+// guest VLAN.  The caller holds addrMutex.
+func (m *InterfaceMonitor) handleGuestTimeout() {
+	changed, err := m.PfInfo.GuestTimeout()
+	if err != nil {
+		level.Error(m.Logger).Log("interface", m.IfName, "error applying guest vlan", err)
+	}
+	if !changed {
+		return
+	}
+	m.logEvent(kapi.EventTypeNormal, "no EAPOL received, moved to guest vlan %d", m.GuestVlan)
+	// updateInterfaceStatus takes addrMutex
+	go func() {
+		if err := m.updateInterfaceStatus(); err != nil {
+			level.Info(m.Logger).Log("op", "monitor", "error updating interface status", err)
+		}
+	}()
+}
+
+// startGuestTimer starts waiting for EAPOL before releasing VFs onto the
+// guest VLAN.
+func (m *InterfaceMonitor) startGuestTimer() {
+	if m.GuestVlan == 0 {
+		return
+	}
+	m.guestDeadline = getCurrentTimestamp() + m.GuestVlanTimeout.Microseconds()
+}
+
 func (m *InterfaceMonitor) updateInterfaceStatus() error {
 	if m.Client == nil {
 		return nil
 	}
 	m.addrMutex.Lock()
 	defer m.addrMutex.Unlock()
-	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
-		authObj, err := m.getAuthObject()
-		if err != nil {
-			return err
-		}
-		var ifStatus *eapolv1.Interface
-		for i, iface := range authObj.Status.Interfaces {
-			if iface.Name == m.IfName {
-				ifStatus = authObj.Status.Interfaces[i]
-				break
-			}
-		}
-		if ifStatus == nil {
-			ifStatus = &eapolv1.Interface{Name: m.IfName}
-			authObj.Status.Interfaces = append(authObj.Status.Interfaces, ifStatus)
-		}
-		ifStatus.State = m.ifEAPState
-		ifStatus.AuthenticatedClients = []string{}
-		for sta := range m.PfInfo.AuthenticatedAddrs {
-			ifStatus.AuthenticatedClients = append(ifStatus.AuthenticatedClients, sta)
+	return k8s.UpdateNodeState(m.Client, *m.AuthNsName, m.NodeName, m.applyInterfaceStatus)
+}
+
+// applyInterfaceStatus updates the status of the interface in the state of
+// its node.  The caller holds addrMutex.
+func (m *InterfaceMonitor) applyInterfaceStatus(status *eapolv1.AuthenticatorNodeStateStatus) {
+	var ifStatus *eapolv1.Interface
+	for i, iface := range status.Interfaces {
+		if iface.Name == m.IfName {
+			ifStatus = status.Interfaces[i]
+			break
 		}
-		return m.Client.Status().Update(context.Background(), authObj, &client.SubResourceUpdateOptions{})
+	}
+	if ifStatus == nil {
+		ifStatus = &eapolv1.Interface{Name: m.IfName}
+		status.Interfaces = append(status.Interfaces, ifStatus)
+		sort.Slice(status.Interfaces, func(i, j int) bool {
+			return status.Interfaces[i].Name < status.Interfaces[j].Name
+		})
+	}
+	ifStatus.State = m.ifEAPState
+	ifStatus.ActiveAuthServer = m.activeServer
+	ifStatus.MACsec = m.macsecStatus
+	ifStatus.AssignedVlans = nil
+	for sta, vlan := range m.PfInfo.StationVlans {
+		ifStatus.AssignedVlans = append(ifStatus.AssignedVlans, eapolv1.AssignedVlan{MAC: sta, Vlan: vlan})
+	}
+	sort.Slice(ifStatus.AssignedVlans, func(i, j int) bool {
+		return ifStatus.AssignedVlans[i].MAC < ifStatus.AssignedVlans[j].MAC
+	})
+	ifStatus.VFs = nil
+	for index, vf := range m.PfInfo.VFs {
+		state, vlan := vf.State()
+		ifStatus.VFs = append(ifStatus.VFs, eapolv1.VFStatus{VF: index,
+			State: eapolv1.VFPortState(state), Vlan: vlan})
+	}
+	sort.Slice(ifStatus.VFs, func(i, j int) bool {
+		return ifStatus.VFs[i].VF < ifStatus.VFs[j].VF
+	})
+	ifStatus.AllowedMacs = macStrings(m.AllowedMacs)
+	ifStatus.DeniedMacs = macStrings(m.DeniedMacs)
+	ifStatus.AuthenticatedClients = []string{}
+	for sta := range m.PfInfo.AuthenticatedAddrs {
+		ifStatus.AuthenticatedClients = append(ifStatus.AuthenticatedClients, sta)
+	}
+	ifStatus.Clients = nil
+	for sta := range m.PfInfo.AuthenticatedAddrs {
+		ifStatus.Clients = append(ifStatus.Clients, m.clientStatus(sta))
+	}
+	sort.Slice(ifStatus.Clients, func(i, j int) bool {
+		return ifStatus.Clients[i].MAC < ifStatus.Clients[j].MAC
 	})
 }
 
@@ -456,6 +863,14 @@ func getIfState(eventStr string) eapolv1.IfState {
 	}
 }
 
+func macStrings(macs []net.HardwareAddr) []string {
+	var macStrs []string
+	for _, mac := range macs {
+		macStrs = append(macStrs, mac.String())
+	}
+	return macStrs
+}
+
 func getCurrentTimestamp() int64 {
 	return time.Now().UnixMicro()
 }
@@ -20,6 +20,7 @@ import (
 	"fmt"
 	"net"
 	"os"
+	"path/filepath"
 	"time"
 
 	"github.com/go-kit/log"
@@ -27,8 +28,10 @@ import (
 	mocks_utils "github.com/k8snetworkplumbingwg/sriov-cni/pkg/utils/mocks"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	eapolv1 "github.com/openshift-kni/eapol-operator/api/v1"
 	"github.com/openshift-kni/eapol-operator/internal/logging"
 	"github.com/openshift-kni/eapol-operator/internal/trafficcontrol"
+	"github.com/openshift-kni/eapol-operator/pkg/mab"
 	"github.com/openshift-kni/eapol-operator/pkg/netlink"
 	"github.com/stretchr/testify/mock"
 	vnetlink "github.com/vishvananda/netlink"
@@ -70,6 +73,7 @@ var _ = Describe("Hostap", func() {
 			fakeMac, err := net.ParseMAC("6e:16:06:0e:b7:e9")
 			Expect(err).NotTo(HaveOccurred())
 			mocked := &mocks_utils.NetlinkManager{}
+			fakeTC := trafficcontrol.NewFakeTrafficController()
 			fakeLink := &utils.FakeLink{LinkAttrs: vnetlink.LinkAttrs{
 				Index:        1000,
 				Name:         pfName,
@@ -84,6 +88,7 @@ var _ = Describe("Hostap", func() {
 			intfMonitor := NewInterfaceMonitor(logger, pfName, func(intfMonitor *InterfaceMonitor) {
 				intfMonitor.IfEventHandler = ifEventHandler
 				intfMonitor.LinkMgr = mocked
+				intfMonitor.TrafficCtl = fakeTC
 			})
 			err = intfMonitor.StartMonitor()
 			Expect(err).NotTo(HaveOccurred())
@@ -109,6 +114,7 @@ var _ = Describe("Hostap", func() {
 			fakeMac, err := net.ParseMAC("6e:16:06:0e:b7:e9")
 			Expect(err).NotTo(HaveOccurred())
 			mocked := &mocks_utils.NetlinkManager{}
+			fakeTC := trafficcontrol.NewFakeTrafficController()
 			fakeLink := &utils.FakeLink{LinkAttrs: vnetlink.LinkAttrs{
 				Index:        1000,
 				Name:         pfName,
@@ -123,6 +129,7 @@ var _ = Describe("Hostap", func() {
 			intfMonitor := NewInterfaceMonitor(logger, pfName, func(intfMonitor *InterfaceMonitor) {
 				intfMonitor.IfEventHandler = ifEventHandler
 				intfMonitor.LinkMgr = mocked
+				intfMonitor.TrafficCtl = fakeTC
 			})
 			err = intfMonitor.StartMonitor()
 			Expect(err).NotTo(HaveOccurred())
@@ -130,18 +137,14 @@ var _ = Describe("Hostap", func() {
 			mocked.On("LinkSetVfVlan", fakeLink, 0, 100).Return(nil)
 			mocked.On("LinkSetVfState", fakeLink, 0, vnetlink.VF_LINK_STATE_AUTO).Return(nil)
 			err = intfMonitor.handleAuthenticateEvent("6e:16:06:0e:b7:e2")
-			if err != nil {
-				// Ignore if the error occurred while running tc command.
-				Expect(err.Error()).To(Equal("exit status 1"))
-			}
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeTC.Interface(pfName).Macs["6e:16:06:0e:b7:e2"].Allow).To(BeTrue())
 			// Deauthenticate mac address 6e:16:06:0e:b7:e2.
 			mocked.On("LinkSetVfVlan", fakeLink, 0, trafficcontrol.ReservedVlan).Return(nil)
 			mocked.On("LinkSetVfState", fakeLink, 0, vnetlink.VF_LINK_STATE_DISABLE).Return(nil)
 			err = intfMonitor.handleDeAuthenticateEvent("6e:16:06:0e:b7:e2")
-			if err != nil {
-				// Ignore if the error occurred while running tc command.
-				Expect(err.Error()).To(Equal("exit status 1"))
-			}
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeTC.Interface(pfName).Macs["6e:16:06:0e:b7:e2"].Allow).To(BeFalse())
 			mocked.On("LinkSetVfVlan", fakeLink, 0, 100).Return(nil)
 			mocked.On("LinkSetVfState", fakeLink, 0, vnetlink.VF_LINK_STATE_AUTO).Return(nil)
 			ch := make(chan struct{})
@@ -164,6 +167,7 @@ var _ = Describe("Hostap", func() {
 			fakeMac, err := net.ParseMAC("6e:16:06:0e:b7:e9")
 			Expect(err).NotTo(HaveOccurred())
 			mocked := &mocks_utils.NetlinkManager{}
+			fakeTC := trafficcontrol.NewFakeTrafficController()
 			fakeLink := &utils.FakeLink{LinkAttrs: vnetlink.LinkAttrs{
 				Index:        1000,
 				Name:         pfName,
@@ -178,6 +182,7 @@ var _ = Describe("Hostap", func() {
 			intfMonitor := NewInterfaceMonitor(logger, pfName, func(intfMonitor *InterfaceMonitor) {
 				intfMonitor.IfEventHandler = ifEventHandler
 				intfMonitor.LinkMgr = mocked
+				intfMonitor.TrafficCtl = fakeTC
 			})
 			err = intfMonitor.StartMonitor()
 			Expect(err).NotTo(HaveOccurred())
@@ -192,10 +197,7 @@ var _ = Describe("Hostap", func() {
 			mocked.On("LinkSetVfVlan", fakeLink, 0, 200).Return(nil)
 			mocked.On("LinkSetVfState", fakeLink, 0, vnetlink.VF_LINK_STATE_AUTO).Return(nil)
 			err = intfMonitor.handleAuthenticateEvent("6e:16:06:0e:b7:e2")
-			if err != nil {
-				// Ignore if the error occurred while running tc command.
-				Expect(err.Error()).To(Equal("exit status 1"))
-			}
+			Expect(err).NotTo(HaveOccurred())
 			fakeLink.Vfs[0].Vlan = 300
 			mocked.On("LinkSetVfVlan", fakeLink, 0, 300).Return(nil)
 			intfMonitor.handlePfEventForVfVlanChange(vnetlink.LinkUpdate{Link: fakeLink})
@@ -228,6 +230,7 @@ var _ = Describe("Hostap", func() {
 			fakeMac, err := net.ParseMAC("6e:16:06:0e:b7:e9")
 			Expect(err).NotTo(HaveOccurred())
 			mocked := &mocks_utils.NetlinkManager{}
+			fakeTC := trafficcontrol.NewFakeTrafficController()
 			fakeLink := &utils.FakeLink{LinkAttrs: vnetlink.LinkAttrs{
 				Index:        1000,
 				Name:         pfName,
@@ -242,6 +245,7 @@ var _ = Describe("Hostap", func() {
 			intfMonitor := NewInterfaceMonitor(logger, pfName, func(intfMonitor *InterfaceMonitor) {
 				intfMonitor.IfEventHandler = ifEventHandler
 				intfMonitor.LinkMgr = mocked
+				intfMonitor.TrafficCtl = fakeTC
 			})
 			err = intfMonitor.StartMonitor()
 			Expect(err).NotTo(HaveOccurred())
@@ -259,22 +263,146 @@ var _ = Describe("Hostap", func() {
 			mocked.On("LinkSetVfVlan", fakeLink, 0, 100).Return(nil)
 			mocked.On("LinkSetVfState", fakeLink, 0, vnetlink.VF_LINK_STATE_AUTO).Return(nil)
 			err = intfMonitor.handleHostapdEvent("AP-STA-CONNECTED 6e:16:06:0e:b7:e2")
-			if err != nil {
-				// Ignore if the error occurred while running tc command.
-				Expect(err.Error()).To(Equal("exit status 1"))
-			}
+			Expect(err).NotTo(HaveOccurred())
 
 			// Test ap disconnected event.
 			mocked.On("LinkSetVfVlan", fakeLink, 0, trafficcontrol.ReservedVlan).Return(nil)
 			mocked.On("LinkSetVfState", fakeLink, 0, vnetlink.VF_LINK_STATE_DISABLE).Return(nil)
 			err = intfMonitor.handleHostapdEvent("AP-STA-DISCONNECTED 6e:16:06:0e:b7:e2")
-			if err != nil {
-				// Ignore if the error occurred while running tc command.
-				Expect(err.Error()).To(Equal("exit status 1"))
+			Expect(err).NotTo(HaveOccurred())
+
+			mocked.On("LinkSetVfVlan", fakeLink, 0, 100).Return(nil)
+			mocked.On("LinkSetVfState", fakeLink, 0, vnetlink.VF_LINK_STATE_AUTO).Return(nil)
+			ch := make(chan struct{})
+			go func() {
+				intfMonitor.StopMonitor()
+				ifEventHandler.StopHandler()
+				close(ch)
+			}()
+			Eventually(func() bool {
+				select {
+				case <-ch:
+					return true
+				default:
+					return false
+				}
+			}, 5*time.Second, 500*time.Millisecond).Should(BeTrue())
+		})
+
+		It("Validate guest and auth-fail vlans while hostap monitor running", func() {
+			fakeMac, err := net.ParseMAC("6e:16:06:0e:b7:e9")
+			Expect(err).NotTo(HaveOccurred())
+			mocked := &mocks_utils.NetlinkManager{}
+			fakeLink := &utils.FakeLink{LinkAttrs: vnetlink.LinkAttrs{
+				Index:        1000,
+				Name:         pfName,
+				HardwareAddr: fakeMac,
+				Vfs:          []vnetlink.VfInfo{{ID: 0, Vlan: 100}},
+			}}
+			mocked.On("LinkByName", mock.AnythingOfType("string")).Return(fakeLink, nil)
+			mocked.On("LinkSetVfVlan", fakeLink, 0, trafficcontrol.ReservedVlan).Return(nil)
+			mocked.On("LinkSetVfState", fakeLink, 0, vnetlink.VF_LINK_STATE_DISABLE).Return(nil)
+			mocked.On("LinkSetVfVlan", fakeLink, 0, 10).Return(nil)
+			mocked.On("LinkSetVfVlan", fakeLink, 0, 20).Return(nil)
+			mocked.On("LinkSetVfState", fakeLink, 0, vnetlink.VF_LINK_STATE_AUTO).Return(nil)
+			ifEventHandler := netlink.LinkEventHandler{Logger: logger}
+			ifEventHandler.Start()
+			intfMonitor := NewInterfaceMonitor(logger, pfName, func(intfMonitor *InterfaceMonitor) {
+				intfMonitor.IfEventHandler = ifEventHandler
+				intfMonitor.LinkMgr = mocked
+				intfMonitor.TrafficCtl = trafficcontrol.NewFakeTrafficController()
+				intfMonitor.GuestVlan = 10
+				intfMonitor.AuthFailVlan = 20
+			})
+			err = intfMonitor.StartMonitor()
+			Expect(err).NotTo(HaveOccurred())
+			vfState := func() string {
+				intfMonitor.addrMutex.Lock()
+				defer intfMonitor.addrMutex.Unlock()
+				state, _ := intfMonitor.PfInfo.VFs[0].State()
+				return state
 			}
 
+			// No EAPOL within the guest vlan timeout.
+			Eventually(vfState, 5*time.Second, 500*time.Millisecond).Should(Equal(trafficcontrol.VFStateGuest))
+			mocked.AssertCalled(GinkgoT(), "LinkSetVfVlan", fakeLink, 0, 10)
+
+			err = intfMonitor.handleHostapdEvent("CTRL-EVENT-EAP-STARTED 6e:16:06:0e:b7:e2")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(vfState()).To(Equal(trafficcontrol.VFStateUnauthorized))
+
+			err = intfMonitor.handleHostapdEvent("CTRL-EVENT-EAP-FAILURE 6e:16:06:0e:b7:e2")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(vfState()).To(Equal(trafficcontrol.VFStateAuthFail))
+			mocked.AssertCalled(GinkgoT(), "LinkSetVfVlan", fakeLink, 0, 20)
+
+			mocked.On("LinkSetVfVlan", fakeLink, 0, 100).Return(nil)
+			ch := make(chan struct{})
+			go func() {
+				intfMonitor.StopMonitor()
+				ifEventHandler.StopHandler()
+				close(ch)
+			}()
+			Eventually(func() bool {
+				select {
+				case <-ch:
+					return true
+				default:
+					return false
+				}
+			}, 5*time.Second, 500*time.Millisecond).Should(BeTrue())
+		})
+
+		It("Validate configuration reload while hostap monitor running", func() {
+			fakeMac, err := net.ParseMAC("6e:16:06:0e:b7:e9")
+			Expect(err).NotTo(HaveOccurred())
+			mocked := &mocks_utils.NetlinkManager{}
+			fakeTC := trafficcontrol.NewFakeTrafficController()
+			fakeLink := &utils.FakeLink{LinkAttrs: vnetlink.LinkAttrs{
+				Index:        1000,
+				Name:         pfName,
+				HardwareAddr: fakeMac,
+				Vfs:          []vnetlink.VfInfo{{ID: 0, Vlan: 100}},
+			}}
+			mocked.On("LinkByName", mock.AnythingOfType("string")).Return(fakeLink, nil)
+			mocked.On("LinkSetVfVlan", fakeLink, 0, trafficcontrol.ReservedVlan).Return(nil)
+			mocked.On("LinkSetVfState", fakeLink, 0, vnetlink.VF_LINK_STATE_DISABLE).Return(nil)
 			mocked.On("LinkSetVfVlan", fakeLink, 0, 100).Return(nil)
 			mocked.On("LinkSetVfState", fakeLink, 0, vnetlink.VF_LINK_STATE_AUTO).Return(nil)
+			ifEventHandler := netlink.LinkEventHandler{Logger: logger}
+			ifEventHandler.Start()
+			intfMonitor := NewInterfaceMonitor(logger, pfName, func(intfMonitor *InterfaceMonitor) {
+				intfMonitor.IfEventHandler = ifEventHandler
+				intfMonitor.LinkMgr = mocked
+				intfMonitor.TrafficCtl = fakeTC
+			})
+			err = intfMonitor.StartMonitor()
+			Expect(err).NotTo(HaveOccurred())
+			err = intfMonitor.handleAuthenticateEvent("6e:16:06:0e:b7:e2")
+			Expect(err).NotTo(HaveOccurred())
+
+			configDir := GinkgoT().TempDir()
+			reloader := &ConfigReloader{
+				Logger:            logger,
+				ConfigFile:        filepath.Join(configDir, "hostapd.conf"),
+				RuntimeConfigFile: filepath.Join(configDir, "runtime.conf"),
+				Monitors:          []*InterfaceMonitor{intfMonitor},
+			}
+			Expect(os.WriteFile(filepath.Join(configDir, "runtime-"+pfName+".conf"), []byte("config_id=1\neap_reauth_period=3600\n"), 0600)).To(Succeed())
+			// A change keeping the config_id keeps the sessions.
+			Expect(os.WriteFile(reloader.ConfigFile, []byte("config_id=1\neap_reauth_period=60\n"), 0644)).To(Succeed())
+			reloaded, err := reloader.Reload()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(reloaded).To(BeTrue())
+			Expect(fakeTC.Interface(pfName).Macs["6e:16:06:0e:b7:e2"].Allow).To(BeTrue())
+			// A change of the config_id has supplicants authenticate again.
+			Expect(os.WriteFile(reloader.ConfigFile, []byte("config_id=2\neap_reauth_period=60\n"), 0644)).To(Succeed())
+			reloaded, err = reloader.Reload()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(reloaded).To(BeTrue())
+			Expect(fakeTC.Interface(pfName).Macs["6e:16:06:0e:b7:e2"].Allow).To(BeFalse())
+			Expect(intfMonitor.PfInfo.AuthenticatedAddrs).To(BeEmpty())
+
 			ch := make(chan struct{})
 			go func() {
 				intfMonitor.StopMonitor()
@@ -290,5 +418,172 @@ var _ = Describe("Hostap", func() {
 				}
 			}, 5*time.Second, 500*time.Millisecond).Should(BeTrue())
 		})
+
+		It("Validate reattaching to a restarted hostapd", func() {
+			fakeMac, err := net.ParseMAC("6e:16:06:0e:b7:e9")
+			Expect(err).NotTo(HaveOccurred())
+			mocked := &mocks_utils.NetlinkManager{}
+			fakeTC := trafficcontrol.NewFakeTrafficController()
+			fakeLink := &utils.FakeLink{LinkAttrs: vnetlink.LinkAttrs{
+				Index:        1000,
+				Name:         pfName,
+				HardwareAddr: fakeMac,
+				Vfs:          []vnetlink.VfInfo{{ID: 0, Vlan: 100}},
+			}}
+			mocked.On("LinkByName", mock.AnythingOfType("string")).Return(fakeLink, nil)
+			mocked.On("LinkSetVfVlan", fakeLink, 0, trafficcontrol.ReservedVlan).Return(nil)
+			mocked.On("LinkSetVfState", fakeLink, 0, vnetlink.VF_LINK_STATE_DISABLE).Return(nil)
+			mocked.On("LinkSetVfVlan", fakeLink, 0, 100).Return(nil)
+			mocked.On("LinkSetVfState", fakeLink, 0, vnetlink.VF_LINK_STATE_AUTO).Return(nil)
+			ifEventHandler := netlink.LinkEventHandler{Logger: logger}
+			ifEventHandler.Start()
+			intfMonitor := NewInterfaceMonitor(logger, pfName, func(intfMonitor *InterfaceMonitor) {
+				intfMonitor.IfEventHandler = ifEventHandler
+				intfMonitor.LinkMgr = mocked
+				intfMonitor.TrafficCtl = fakeTC
+			})
+			err = intfMonitor.StartMonitor()
+			Expect(err).NotTo(HaveOccurred())
+			err = intfMonitor.handleAuthenticateEvent("6e:16:06:0e:b7:e2")
+			Expect(err).NotTo(HaveOccurred())
+
+			// hostapd restarts with a new control interface.
+			conn.Close()
+			os.Remove(sockFile)
+			conn, err = net.ListenUnixgram(unixDgramProtocol, &net.UnixAddr{Name: sockFile, Net: unixDgramProtocol})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(intfMonitor.Reattach()).To(Succeed())
+			// Keepalives may come first
+			buf := make([]byte, sockReadBufSize)
+			conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+			for command := ""; command != attachCommand; {
+				size, err := conn.Read(buf)
+				Expect(err).NotTo(HaveOccurred())
+				command = string(buf[:size])
+			}
+			// The restarted hostapd has no stations.
+			Expect(fakeTC.Interface(pfName).Macs["6e:16:06:0e:b7:e2"].Allow).To(BeFalse())
+			Expect(intfMonitor.PfInfo.AuthenticatedAddrs).To(BeEmpty())
+
+			ch := make(chan struct{})
+			go func() {
+				intfMonitor.StopMonitor()
+				ifEventHandler.StopHandler()
+				close(ch)
+			}()
+			Eventually(func() bool {
+				select {
+				case <-ch:
+					return true
+				default:
+					return false
+				}
+			}, 5*time.Second, 500*time.Millisecond).Should(BeTrue())
+		})
+
+		It("Validate MAC authentication bypass while hostap monitor running", func() {
+			fakeMac, err := net.ParseMAC("6e:16:06:0e:b7:e9")
+			Expect(err).NotTo(HaveOccurred())
+			mocked := &mocks_utils.NetlinkManager{}
+			fakeTC := trafficcontrol.NewFakeTrafficController()
+			fakeLink := &utils.FakeLink{LinkAttrs: vnetlink.LinkAttrs{
+				Index:        1000,
+				Name:         pfName,
+				HardwareAddr: fakeMac,
+				Vfs:          []vnetlink.VfInfo{{ID: 0, Vlan: 100}},
+			}}
+			mocked.On("LinkByName", mock.AnythingOfType("string")).Return(fakeLink, nil)
+			mocked.On("LinkSetVfVlan", fakeLink, 0, trafficcontrol.ReservedVlan).Return(nil)
+			mocked.On("LinkSetVfState", fakeLink, 0, vnetlink.VF_LINK_STATE_DISABLE).Return(nil)
+			mocked.On("LinkSetVfVlan", fakeLink, 0, 100).Return(nil)
+			mocked.On("LinkSetVfState", fakeLink, 0, vnetlink.VF_LINK_STATE_AUTO).Return(nil)
+			authorizer, err := mab.NewLocalAuthorizer([]string{"6e:16:06:0e:b7:e2", "6e:16:06:0e:b7:e3", "6e:16:06:0e:b7:e5"})
+			static, _ := net.ParseMAC("6e:16:06:0e:b7:e5")
+			Expect(err).NotTo(HaveOccurred())
+			ifEventHandler := netlink.LinkEventHandler{Logger: logger}
+			ifEventHandler.Start()
+			intfMonitor := NewInterfaceMonitor(logger, pfName, func(intfMonitor *InterfaceMonitor) {
+				intfMonitor.IfEventHandler = ifEventHandler
+				intfMonitor.LinkMgr = mocked
+				intfMonitor.TrafficCtl = fakeTC
+				intfMonitor.MABAuthorizer = authorizer
+				intfMonitor.MABTimeout = time.Second
+				intfMonitor.AllowedMacs = []net.HardwareAddr{static}
+			})
+			err = intfMonitor.StartMonitor()
+			Expect(err).NotTo(HaveOccurred())
+			authMethod := func(mac string) eapolv1.AuthMethod {
+				intfMonitor.addrMutex.Lock()
+				defer intfMonitor.addrMutex.Unlock()
+				if _, ok := intfMonitor.PfInfo.AuthenticatedAddrs[mac]; !ok {
+					return ""
+				}
+				return intfMonitor.authMethod(mac)
+			}
+
+			// 6e:16:06:0e:b7:e2 sends no EAPOL and is allowed by MAB.
+			device, _ := net.ParseMAC("6e:16:06:0e:b7:e2")
+			intfMonitor.handleFrame(device, 0x0800)
+			// 6e:16:06:0e:b7:e3 is a supplicant and left to hostapd.
+			supplicant, _ := net.ParseMAC("6e:16:06:0e:b7:e3")
+			intfMonitor.handleFrame(supplicant, 0x888e)
+			intfMonitor.handleFrame(supplicant, 0x0800)
+			// 6e:16:06:0e:b7:e4 is not in the MAB list.
+			rejected, _ := net.ParseMAC("6e:16:06:0e:b7:e4")
+			intfMonitor.handleFrame(rejected, 0x0800)
+			// 6e:16:06:0e:b7:e5 is always allowed without MAB.
+			intfMonitor.handleFrame(static, 0x0800)
+
+			Eventually(func() eapolv1.AuthMethod {
+				return authMethod("6e:16:06:0e:b7:e2")
+			}, 5*time.Second, 500*time.Millisecond).Should(Equal(eapolv1.AuthMethodMAB))
+			Expect(fakeTC.Interface(pfName).Macs["6e:16:06:0e:b7:e2"].Allow).To(BeTrue())
+			Consistently(func() eapolv1.AuthMethod {
+				return authMethod("6e:16:06:0e:b7:e3")
+			}, 2*time.Second, 500*time.Millisecond).Should(BeEmpty())
+			Expect(authMethod("6e:16:06:0e:b7:e4")).To(BeEmpty())
+			Expect(authMethod("6e:16:06:0e:b7:e5")).To(BeEmpty())
+
+			err = intfMonitor.handleDeAuthenticateEvent("6e:16:06:0e:b7:e2")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fakeTC.Interface(pfName).Macs["6e:16:06:0e:b7:e2"].Allow).To(BeFalse())
+			Expect(authMethod("6e:16:06:0e:b7:e2")).To(BeEmpty())
+
+			ch := make(chan struct{})
+			go func() {
+				intfMonitor.StopMonitor()
+				ifEventHandler.StopHandler()
+				close(ch)
+			}()
+			Eventually(func() bool {
+				select {
+				case <-ch:
+					return true
+				default:
+					return false
+				}
+			}, 5*time.Second, 500*time.Millisecond).Should(BeTrue())
+		})
+	})
+})
+
+var _ = Describe("Node state", func() {
+	It("adds and updates the interfaces of the node in order", func() {
+		status := &eapolv1.AuthenticatorNodeStateStatus{}
+		for _, ifName := range []string{"ens3f1", "ens3f0", "ens3f1"} {
+			intfMonitor := NewInterfaceMonitor(nil, ifName, func(intfMonitor *InterfaceMonitor) {
+				intfMonitor.PfInfo = &trafficcontrol.PFInfo{Name: ifName, VFs: map[int]*trafficcontrol.VFInfo{},
+					AuthenticatedAddrs: map[string]interface{}{"6e:16:06:0e:b7:e2": nil}}
+			})
+			intfMonitor.ifEAPState = eapolv1.IfStateEnabled
+			intfMonitor.applyInterfaceStatus(status)
+		}
+		Expect(status.Interfaces).To(HaveLen(2))
+		Expect(status.Interfaces[0].Name).To(Equal("ens3f0"))
+		Expect(status.Interfaces[1].Name).To(Equal("ens3f1"))
+		Expect(status.Interfaces[1].State).To(Equal(eapolv1.IfStateEnabled))
+		Expect(status.Interfaces[1].Clients).To(Equal([]eapolv1.ClientStatus{
+			{MAC: "6e:16:06:0e:b7:e2", AuthMethod: eapolv1.AuthMethodEAP},
+		}))
 	})
 })
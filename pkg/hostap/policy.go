@@ -0,0 +1,337 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hostap
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/k8snetworkplumbingwg/sriov-cni/pkg/utils"
+	eapolv1 "github.com/openshift-kni/eapol-operator/api/v1"
+	"github.com/openshift-kni/eapol-operator/internal/trafficcontrol"
+	"github.com/openshift-kni/eapol-operator/pkg/configgen"
+)
+
+// MonitorSettings are the settings of an interface monitor which its
+// traffic policy file overrides.
+type MonitorSettings struct {
+	AuthenticationMode eapolv1.AuthenticationMode
+	VFSupplicants      map[string]int
+	GuestVlan          int
+	GuestVlanTimeout   time.Duration
+	AuthFailVlan       int
+}
+
+// PolicyReloader applies the traffic policy file projected from the
+// Authenticator, its unprotected ports, static MAC addresses and traffic
+// exceptions, to the traffic control rules of the protected interfaces and
+// their VFs, updating the rules in place whenever the kubelet updates it.
+// The authentication mode, VF supplicants and fallback VLANs of the policy
+// are applied to the monitors of the interfaces.  An interface uses the policy file named
+// after it beside PolicyFile if there is one.
+type PolicyReloader struct {
+	Logger     log.Logger
+	PolicyFile string
+	// Config is the traffic control configuration of the interfaces, which
+	// their policy file overrides
+	Config trafficcontrol.InterfaceConfig
+	// Settings are the monitor settings of the interfaces, which their
+	// policy file overrides
+	Settings   MonitorSettings
+	Interfaces []string
+	TrafficCtl trafficcontrol.TrafficController
+	LinkMgr    utils.NetlinkManager
+	Monitors   []*InterfaceMonitor
+	Interval   time.Duration
+	// configs and policies are the configuration applied to each interface
+	// and the policy it was read from.  partial holds the rules in place on
+	// the links which failed to update to the configuration of their
+	// interface, so that the next reload retries the rules which differ.
+	configs  map[string]trafficcontrol.InterfaceConfig
+	settings map[string]MonitorSettings
+	policies map[string][]byte
+	partial  map[string]trafficcontrol.InterfaceConfig
+	mutex    sync.Mutex
+	stop     chan interface{}
+	stopWg   sync.WaitGroup
+}
+
+// Load reads the policy file of each interface before the interfaces are
+// initialized.  Interfaces without a policy file keep Config.
+func (r *PolicyReloader) Load() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.configs = map[string]trafficcontrol.InterfaceConfig{}
+	r.settings = map[string]MonitorSettings{}
+	r.policies = map[string][]byte{}
+	r.partial = map[string]trafficcontrol.InterfaceConfig{}
+	for _, iface := range r.Interfaces {
+		policy, err := r.readPolicy(iface)
+		if err != nil {
+			return err
+		}
+		config, settings := r.Config, r.Settings
+		if policy != nil {
+			config, err = applyTrafficPolicy(r.Config, policy)
+			if err == nil {
+				settings, err = applyMonitorPolicy(r.Settings, policy)
+			}
+			if err != nil {
+				return fmt.Errorf("interface %s: %w", iface, err)
+			}
+		}
+		r.configs[iface] = config
+		r.settings[iface] = settings
+		r.policies[iface] = policy
+	}
+	return nil
+}
+
+// InterfaceConfig returns the traffic control configuration of an
+// interface.
+func (r *PolicyReloader) InterfaceConfig(ifName string) trafficcontrol.InterfaceConfig {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if config, ok := r.configs[ifName]; ok {
+		return config
+	}
+	return r.Config
+}
+
+// InterfaceSettings returns the monitor settings of an interface.
+func (r *PolicyReloader) InterfaceSettings(ifName string) MonitorSettings {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if settings, ok := r.settings[ifName]; ok {
+		return settings
+	}
+	return r.Settings
+}
+
+// readPolicy reads the policy file of an interface, or nil if there is
+// none.
+func (r *PolicyReloader) readPolicy(ifName string) ([]byte, error) {
+	policy, err := os.ReadFile(configgen.InterfaceFile(r.PolicyFile, ifName))
+	if errors.Is(err, fs.ErrNotExist) {
+		policy, err = os.ReadFile(r.PolicyFile)
+	}
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	return policy, err
+}
+
+// Start polls the policy file until Stop is called.
+func (r *PolicyReloader) Start() {
+	if r.Interval == 0 {
+		r.Interval = defaultReloadInterval
+	}
+	r.stop = make(chan interface{})
+	r.stopWg.Add(1)
+	go func() {
+		defer r.stopWg.Done()
+		ticker := time.NewTicker(r.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-r.stop:
+				return
+			case <-ticker.C:
+				if _, err := r.Reload(); err != nil {
+					level.Error(r.Logger).Log("op", "reload", "policy", r.PolicyFile, "error", err)
+				}
+			}
+		}
+	}()
+}
+
+// Stop stops polling the policy file.
+func (r *PolicyReloader) Stop() {
+	close(r.stop)
+	r.stopWg.Wait()
+}
+
+// Reload reads the policy file of each interface and, if it changed,
+// updates the rules which differ on the interface and its VFs, and the
+// static MAC addresses and settings of its monitor.  It returns whether the policy of any
+// interface was reloaded.
+func (r *PolicyReloader) Reload() (bool, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.configs == nil {
+		r.configs = map[string]trafficcontrol.InterfaceConfig{}
+		r.settings = map[string]MonitorSettings{}
+		r.policies = map[string][]byte{}
+		r.partial = map[string]trafficcontrol.InterfaceConfig{}
+	}
+	reloaded := false
+	var errs []error
+	for _, iface := range r.Interfaces {
+		changed, err := r.reloadInterface(iface)
+		reloaded = reloaded || changed
+		if err != nil {
+			errs = append(errs, fmt.Errorf("interface %s: %w", iface, err))
+		}
+	}
+	return reloaded, errors.Join(errs...)
+}
+
+func (r *PolicyReloader) reloadInterface(iface string) (bool, error) {
+	policy, err := r.readPolicy(iface)
+	if err != nil || policy == nil || bytes.Equal(policy, r.policies[iface]) {
+		return false, err
+	}
+	old, ok := r.configs[iface]
+	if !ok {
+		old = r.Config
+	}
+	config, err := applyTrafficPolicy(r.Config, policy)
+	if err != nil {
+		return false, err
+	}
+	settings, err := applyMonitorPolicy(r.Settings, policy)
+	if err != nil {
+		return false, err
+	}
+	level.Info(r.Logger).Log("op", "reload", "policy", r.PolicyFile, "interface", iface)
+	var errs []error
+	pfvfs, err := trafficcontrol.GetAssociatedInterfaces(iface, r.LinkMgr)
+	if err != nil {
+		return false, err
+	}
+	for _, linkName := range pfvfs {
+		linkOld, ok := r.partial[linkName]
+		if !ok {
+			linkOld = old
+		}
+		applied, err := trafficcontrol.UpdateInterfaceConfig(r.Logger, r.TrafficCtl, linkName, linkOld, config)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("interface %s: %w", linkName, err))
+			r.partial[linkName] = applied
+		} else {
+			delete(r.partial, linkName)
+		}
+	}
+	oldSettings, ok := r.settings[iface]
+	if !ok {
+		oldSettings = r.Settings
+	}
+	settingsChanged := !reflect.DeepEqual(settings, oldSettings)
+	for _, m := range r.Monitors {
+		if m.IfName != iface {
+			continue
+		}
+		m.SetStaticMacs(config.AllowedMacs, config.DeniedMacs)
+		if !settingsChanged {
+			continue
+		}
+		if err := m.SetSettings(settings); err != nil {
+			errs = append(errs, fmt.Errorf("monitor: %w", err))
+		}
+	}
+	r.settings[iface] = settings
+	// The links which updated now implement config, while the policy is
+	// only recorded once all did so that the next reload retries the others
+	r.configs[iface] = config
+	if len(errs) == 0 {
+		r.policies[iface] = policy
+	}
+	return true, errors.Join(errs...)
+}
+
+// applyTrafficPolicy overrides the settings of config the JSON traffic
+// policy holds.  The egress exceptions are only kept when egress traffic is
+// dropped.
+func applyTrafficPolicy(config trafficcontrol.InterfaceConfig, data []byte) (trafficcontrol.InterfaceConfig, error) {
+	var policy eapolv1.TrafficControl
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return config, fmt.Errorf("invalid traffic policy: %w", err)
+	}
+	config.UnprotectedTcpPorts, config.UnprotectedUdpPorts = nil, nil
+	if policy.UnprotectedPorts != nil {
+		config.UnprotectedTcpPorts = policy.UnprotectedPorts.Tcp
+		config.UnprotectedUdpPorts = policy.UnprotectedPorts.Udp
+	}
+	var err error
+	if config.AllowedMacs, err = parseMacs(policy.AllowedMacs); err != nil {
+		return config, err
+	}
+	if config.DeniedMacs, err = parseMacs(policy.DeniedMacs); err != nil {
+		return config, err
+	}
+	if config.EtherTypes, config.IPRules, err = trafficcontrol.ParseExceptions(policy.Exceptions); err != nil {
+		return config, err
+	}
+	config.EgressEtherTypes, config.EgressIPRules = nil, nil
+	if config.EgressDrop {
+		if config.EgressEtherTypes, config.EgressIPRules, err = trafficcontrol.ParseExceptions(policy.EgressExceptions); err != nil {
+			return config, err
+		}
+	}
+	return config, nil
+}
+
+// applyMonitorPolicy overrides the settings the JSON traffic policy holds.
+// An empty authentication mode or a guest VLAN timeout of 0 keeps the one of
+// settings.
+func applyMonitorPolicy(settings MonitorSettings, data []byte) (MonitorSettings, error) {
+	var policy eapolv1.TrafficControl
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return settings, fmt.Errorf("invalid traffic policy: %w", err)
+	}
+	if policy.AuthenticationMode != "" {
+		settings.AuthenticationMode = policy.AuthenticationMode
+	}
+	settings.VFSupplicants = map[string]int{}
+	for _, vf := range policy.VFSupplicants {
+		for _, macStr := range vf.MACs {
+			mac, err := net.ParseMAC(macStr)
+			if err != nil {
+				return settings, err
+			}
+			settings.VFSupplicants[mac.String()] = vf.VF
+		}
+	}
+	settings.GuestVlan = policy.GuestVlan
+	if policy.GuestVlanTimeout != 0 {
+		settings.GuestVlanTimeout = time.Duration(policy.GuestVlanTimeout) * time.Second
+	}
+	settings.AuthFailVlan = policy.AuthFailVlan
+	return settings, nil
+}
+
+func parseMacs(macStrs []string) ([]net.HardwareAddr, error) {
+	var macs []net.HardwareAddr
+	for _, macStr := range macStrs {
+		mac, err := net.ParseMAC(macStr)
+		if err != nil {
+			return nil, err
+		}
+		macs = append(macs, mac)
+	}
+	return macs, nil
+}
@@ -0,0 +1,158 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hostap
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/go-kit/log"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	eapolv1 "github.com/openshift-kni/eapol-operator/api/v1"
+	"github.com/openshift-kni/eapol-operator/internal/trafficcontrol"
+	"golang.org/x/sys/unix"
+)
+
+var _ = Describe("Traffic policy", func() {
+	var (
+		reloader *PolicyReloader
+		fakeTC   *trafficcontrol.FakeTrafficController
+		monitor  *InterfaceMonitor
+	)
+	BeforeEach(func() {
+		fakeTC = trafficcontrol.NewFakeTrafficController()
+		monitor = NewInterfaceMonitor(log.NewNopLogger(), "eth0")
+		reloader = &PolicyReloader{
+			Logger:     log.NewNopLogger(),
+			PolicyFile: filepath.Join(GinkgoT().TempDir(), "traffic-policy.json"),
+			Config:     trafficcontrol.InterfaceConfig{UnprotectedTcpPorts: []int{22}},
+			Interfaces: []string{"eth0"},
+			TrafficCtl: fakeTC,
+			Monitors:   []*InterfaceMonitor{monitor},
+		}
+	})
+	It("keeps the configuration without a policy file", func() {
+		Expect(reloader.Load()).To(Succeed())
+		Expect(reloader.InterfaceConfig("eth0").UnprotectedTcpPorts).To(Equal([]int{22}))
+		reloaded, err := reloader.Reload()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reloaded).To(BeFalse())
+	})
+	It("rejects an invalid policy", func() {
+		Expect(os.WriteFile(reloader.PolicyFile, []byte(`{"allowedMacs":["not-a-mac"]}`), 0644)).To(Succeed())
+		Expect(reloader.Load()).NotTo(Succeed())
+		Expect(reloader.InterfaceConfig("eth0").UnprotectedTcpPorts).To(Equal([]int{22}))
+	})
+	It("updates the rules which changed in the policy", func() {
+		Expect(os.WriteFile(reloader.PolicyFile, []byte(`{"unprotectedPorts":{"tcp":[53]},"allowedMacs":["6e:16:06:0e:b7:e2"]}`), 0644)).To(Succeed())
+		Expect(reloader.Load()).To(Succeed())
+		Expect(trafficcontrol.InitInterfaceForEAPTraffic(reloader.Logger, fakeTC, "eth0", reloader.InterfaceConfig("eth0"))).To(Succeed())
+		Expect(fakeTC.Interface("eth0").TcpPorts).To(Equal([]int{53}))
+
+		reloaded, err := reloader.Reload()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reloaded).To(BeFalse())
+
+		Expect(os.WriteFile(reloader.PolicyFile, []byte(`{"unprotectedPorts":{"udp":[67]},"deniedMacs":["6e:16:06:0e:b7:e2"],"egressExceptions":[{"etherType":35020}]}`), 0644)).To(Succeed())
+		reloaded, err = reloader.Reload()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reloaded).To(BeTrue())
+		iface := fakeTC.Interface("eth0")
+		Expect(iface.TcpPorts).To(BeEmpty())
+		Expect(iface.UdpPorts).To(Equal([]int{67}))
+		Expect(iface.AllowedMacs).To(BeEmpty())
+		Expect(iface.DeniedMacs).To(Equal([]string{"6e:16:06:0e:b7:e2"}))
+		// Egress is not dropped, so its exceptions do not apply
+		Expect(iface.EgressEtherTypes).To(BeEmpty())
+		Expect(reloader.InterfaceConfig("eth0").EgressEtherTypes).To(BeEmpty())
+
+		mac, _ := net.ParseMAC("6e:16:06:0e:b7:e2")
+		Expect(monitor.AllowedMacs).To(BeEmpty())
+		Expect(monitor.DeniedMacs).To(Equal([]net.HardwareAddr{mac}))
+	})
+	It("applies the authentication mode, VF supplicants and fallback VLANs to the monitor", func() {
+		reloader.Settings = MonitorSettings{GuestVlanTimeout: 90 * time.Second}
+		Expect(os.WriteFile(reloader.PolicyFile, []byte(`{"guestVlan":10}`), 0644)).To(Succeed())
+		Expect(reloader.Load()).To(Succeed())
+		Expect(reloader.InterfaceSettings("eth0")).To(Equal(MonitorSettings{
+			VFSupplicants:    map[string]int{},
+			GuestVlan:        10,
+			GuestVlanTimeout: 90 * time.Second,
+		}))
+
+		Expect(os.WriteFile(reloader.PolicyFile, []byte(
+			`{"authenticationMode":"per-vf","vfSupplicants":[{"vf":1,"macs":["6E:16:06:0E:B7:E2"]}],"guestVlan":20,"guestVlanTimeout":30,"authFailVlan":30}`), 0644)).To(Succeed())
+		reloaded, err := reloader.Reload()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reloaded).To(BeTrue())
+		Expect(monitor.AuthenticationMode).To(Equal(eapolv1.AuthenticationModePerVF))
+		Expect(monitor.VFSupplicants).To(Equal(map[string]int{"6e:16:06:0e:b7:e2": 1}))
+		Expect(monitor.GuestVlan).To(Equal(20))
+		Expect(monitor.GuestVlanTimeout).To(Equal(30 * time.Second))
+		Expect(monitor.AuthFailVlan).To(Equal(30))
+		Expect(reloader.InterfaceSettings("eth0").GuestVlan).To(Equal(20))
+	})
+	It("retries the rules which failed to update", func() {
+		Expect(os.WriteFile(reloader.PolicyFile, []byte(`{"unprotectedPorts":{"tcp":[53]}}`), 0644)).To(Succeed())
+		Expect(reloader.Load()).To(Succeed())
+		Expect(trafficcontrol.InitInterfaceForEAPTraffic(reloader.Logger, fakeTC, "eth0", reloader.InterfaceConfig("eth0"))).To(Succeed())
+
+		Expect(os.WriteFile(reloader.PolicyFile, []byte(`{"unprotectedPorts":{"tcp":[80]}}`), 0644)).To(Succeed())
+		fakeTC.Fail("eth0", unix.ENOBUFS)
+		reloaded, err := reloader.Reload()
+		Expect(err).To(HaveOccurred())
+		Expect(reloaded).To(BeTrue())
+		Expect(fakeTC.Interface("eth0").TcpPorts).To(Equal([]int{53}))
+
+		fakeTC.Fail("eth0", nil)
+		reloaded, err = reloader.Reload()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reloaded).To(BeTrue())
+		Expect(fakeTC.Interface("eth0").TcpPorts).To(Equal([]int{80}))
+
+		reloaded, err = reloader.Reload()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reloaded).To(BeFalse())
+	})
+	It("prefers the policy of the interface", func() {
+		eth1 := NewInterfaceMonitor(log.NewNopLogger(), "eth1")
+		reloader.Interfaces = append(reloader.Interfaces, "eth1")
+		reloader.Monitors = append(reloader.Monitors, eth1)
+		eth1Policy := filepath.Join(filepath.Dir(reloader.PolicyFile), "traffic-policy-eth1.json")
+		Expect(os.WriteFile(reloader.PolicyFile, []byte(`{"unprotectedPorts":{"tcp":[53]}}`), 0644)).To(Succeed())
+		Expect(os.WriteFile(eth1Policy, []byte(`{"unprotectedPorts":{"tcp":[443]}}`), 0644)).To(Succeed())
+		Expect(reloader.Load()).To(Succeed())
+		Expect(reloader.InterfaceConfig("eth0").UnprotectedTcpPorts).To(Equal([]int{53}))
+		Expect(reloader.InterfaceConfig("eth1").UnprotectedTcpPorts).To(Equal([]int{443}))
+		for _, iface := range reloader.Interfaces {
+			Expect(trafficcontrol.InitInterfaceForEAPTraffic(reloader.Logger, fakeTC, iface, reloader.InterfaceConfig(iface))).To(Succeed())
+		}
+
+		Expect(os.WriteFile(eth1Policy, []byte(`{"unprotectedPorts":{"tcp":[443]},"allowedMacs":["6e:16:06:0e:b7:e2"]}`), 0644)).To(Succeed())
+		reloaded, err := reloader.Reload()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reloaded).To(BeTrue())
+		Expect(fakeTC.Interface("eth0").AllowedMacs).To(BeEmpty())
+		Expect(fakeTC.Interface("eth1").AllowedMacs).To(Equal([]string{"6e:16:06:0e:b7:e2"}))
+		Expect(fakeTC.Interface("eth1").TcpPorts).To(Equal([]int{443}))
+		Expect(monitor.AllowedMacs).To(BeEmpty())
+		Expect(eth1.AllowedMacs).To(HaveLen(1))
+	})
+})
@@ -0,0 +1,94 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hostap
+
+import (
+	"net"
+	"strconv"
+	"strings"
+)
+
+// radiusServerStats holds the RADIUS client MIB counters hostapd reports for
+// a single authentication server.
+type radiusServerStats struct {
+	Address   string
+	Responses uint64
+	Timeouts  uint64
+}
+
+// parseRadiusAuthMib extracts the per-server RADIUS authentication client
+// counters from a hostapd MIB reply, in the configured failover order.
+func parseRadiusAuthMib(reply string) []radiusServerStats {
+	var (
+		servers []radiusServerStats
+		addr    string
+	)
+	for _, line := range strings.Split(reply, "\n") {
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		if parts[0] == "radiusAuthServerIndex" {
+			servers = append(servers, radiusServerStats{})
+			continue
+		}
+		if len(servers) == 0 {
+			continue
+		}
+		server := &servers[len(servers)-1]
+		value, _ := strconv.ParseUint(parts[1], 10, 64)
+		switch parts[0] {
+		case "radiusAuthServerAddress":
+			addr = parts[1]
+		case "radiusAuthClientServerPortNumber":
+			server.Address = net.JoinHostPort(addr, parts[1])
+		case "radiusAuthClientAccessAccepts", "radiusAuthClientAccessRejects",
+			"radiusAuthClientAccessChallenges":
+			server.Responses += value
+		case "radiusAuthClientTimeouts":
+			server.Timeouts += value
+		}
+	}
+	return servers
+}
+
+// activeRadiusServer infers which server hostapd is currently using.  hostapd
+// does not report this directly, so the server that answered since the last
+// sample wins; otherwise a timeout on the active server means hostapd failed
+// over to the next server in the list.
+func activeRadiusServer(prev, cur []radiusServerStats, active string) string {
+	if len(cur) == 0 {
+		return ""
+	}
+	if len(prev) != len(cur) {
+		return cur[0].Address
+	}
+	for i := range cur {
+		if cur[i].Responses > prev[i].Responses && cur[i].Timeouts == prev[i].Timeouts {
+			return cur[i].Address
+		}
+	}
+	for i := range cur {
+		if cur[i].Address == active && cur[i].Timeouts > prev[i].Timeouts {
+			return cur[(i+1)%len(cur)].Address
+		}
+	}
+	if active == "" {
+		return cur[0].Address
+	}
+	return active
+}
@@ -0,0 +1,83 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hostap
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var mibReplyStr = `dot1xPaeSystemAuthControl=enabled
+radiusAuthServerIndex=1
+radiusAuthServerAddress=10.0.0.1
+radiusAuthClientServerPortNumber=1812
+radiusAuthClientRoundTripTime=0
+radiusAuthClientAccessRequests=4
+radiusAuthClientAccessRetransmissions=0
+radiusAuthClientAccessAccepts=1
+radiusAuthClientAccessRejects=0
+radiusAuthClientAccessChallenges=3
+radiusAuthClientMalformedAccessResponses=0
+radiusAuthClientBadAuthenticators=0
+radiusAuthClientPendingRequests=0
+radiusAuthClientTimeouts=2
+radiusAuthClientUnknownTypes=0
+radiusAuthClientPacketsDropped=0
+radiusAuthServerIndex=2
+radiusAuthServerAddress=10.0.0.2
+radiusAuthClientServerPortNumber=1645
+radiusAuthClientAccessAccepts=0
+radiusAuthClientAccessRejects=0
+radiusAuthClientAccessChallenges=0
+radiusAuthClientTimeouts=0
+`
+
+var _ = Describe("Radius", func() {
+	It("parses the RADIUS client MIB in server order", func() {
+		servers := parseRadiusAuthMib(mibReplyStr)
+		Expect(servers).To(Equal([]radiusServerStats{
+			{Address: "10.0.0.1:1812", Responses: 4, Timeouts: 2},
+			{Address: "10.0.0.2:1645", Responses: 0, Timeouts: 0},
+		}))
+	})
+
+	It("parses a MIB without RADIUS servers", func() {
+		Expect(parseRadiusAuthMib("dot1xPaeSystemAuthControl=enabled\n")).To(BeEmpty())
+	})
+
+	It("defaults to the primary server", func() {
+		servers := parseRadiusAuthMib(mibReplyStr)
+		Expect(activeRadiusServer(nil, servers, "")).To(Equal("10.0.0.1:1812"))
+	})
+
+	It("fails over to the next server on timeout", func() {
+		prev := []radiusServerStats{{Address: "a:1812"}, {Address: "b:1812"}}
+		cur := []radiusServerStats{{Address: "a:1812", Timeouts: 1}, {Address: "b:1812"}}
+		Expect(activeRadiusServer(prev, cur, "a:1812")).To(Equal("b:1812"))
+	})
+
+	It("follows the server that answered", func() {
+		prev := []radiusServerStats{{Address: "a:1812"}, {Address: "b:1812", Responses: 5}}
+		cur := []radiusServerStats{{Address: "a:1812", Responses: 1}, {Address: "b:1812", Responses: 5}}
+		Expect(activeRadiusServer(prev, cur, "b:1812")).To(Equal("a:1812"))
+	})
+
+	It("keeps the active server when idle", func() {
+		prev := []radiusServerStats{{Address: "a:1812"}, {Address: "b:1812"}}
+		Expect(activeRadiusServer(prev, prev, "b:1812")).To(Equal("b:1812"))
+	})
+})
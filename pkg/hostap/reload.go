@@ -0,0 +1,217 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hostap
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/openshift-kni/eapol-operator/pkg/configgen"
+)
+
+const (
+	secretPlaceholder     = "$SECRET{"
+	configIDKey           = "config_id="
+	defaultReloadInterval = 5 * time.Second
+)
+
+// ConfigReloader renders the projected hostapd configuration of each
+// interface into the runtime copy hostapd reads, substituting the secret
+// placeholders, and has hostapd reload it in place whenever the kubelet
+// updates the projection.
+type ConfigReloader struct {
+	Logger log.Logger
+	// ConfigFile is the projected configuration, SecretsDir the projected
+	// secrets it refers to and RuntimeConfigFile the rendered copy.  An
+	// interface uses the configuration named after it beside ConfigFile if
+	// there is one, and always has its own copy named after it beside
+	// RuntimeConfigFile.
+	ConfigFile        string
+	SecretsDir        string
+	RuntimeConfigFile string
+	Monitors          []*InterfaceMonitor
+	Interval          time.Duration
+	mutex             sync.Mutex
+	stop              chan interface{}
+	stopWg            sync.WaitGroup
+}
+
+// Start polls the projected configuration until Stop is called.
+func (r *ConfigReloader) Start() {
+	if r.Interval == 0 {
+		r.Interval = defaultReloadInterval
+	}
+	r.stop = make(chan interface{})
+	r.stopWg.Add(1)
+	go func() {
+		defer r.stopWg.Done()
+		ticker := time.NewTicker(r.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-r.stop:
+				return
+			case <-ticker.C:
+				if _, err := r.Reload(); err != nil {
+					level.Error(r.Logger).Log("op", "reload", "config", r.ConfigFile, "error", err)
+				}
+			}
+		}
+	}()
+}
+
+// Stop stops polling the projected configuration.
+func (r *ConfigReloader) Stop() {
+	close(r.stop)
+	r.stopWg.Wait()
+}
+
+// Reload renders the projected configuration of every monitored interface
+// and, where it differs from the runtime copy, replaces the copy and has
+// hostapd reload it.  Sessions are kept unless the config_id changed.  It
+// returns whether the configuration of any interface was reloaded.
+func (r *ConfigReloader) Reload() (bool, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	reloaded := false
+	var errs []error
+	for _, m := range r.Monitors {
+		changed, keepSessions, err := r.render(m.IfName)
+		if err == nil && changed {
+			reloaded = true
+			err = m.ReloadConfig(keepSessions)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("interface %s: %w", m.IfName, err))
+		}
+	}
+	return reloaded, errors.Join(errs...)
+}
+
+// render renders the projected configuration of an interface into its
+// runtime copy, returning whether the copy changed and whether the sessions
+// survive the change.
+func (r *ConfigReloader) render(ifName string) (bool, bool, error) {
+	runtimeConfigFile := configgen.InterfaceFile(r.RuntimeConfigFile, ifName)
+	current, err := os.ReadFile(runtimeConfigFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		// hostapd was not started with it yet
+		return false, false, nil
+	} else if err != nil {
+		return false, false, err
+	}
+	configFile := interfaceConfigFile(r.ConfigFile, ifName)
+	config, err := renderConfig(configFile, r.SecretsDir)
+	if err != nil {
+		return false, false, err
+	}
+	if bytes.Equal(config, current) {
+		return false, false, nil
+	}
+	if err := writeFileAtomic(runtimeConfigFile, config); err != nil {
+		return false, false, err
+	}
+	oldID, newID := configID(current), configID(config)
+	keepSessions := oldID != "" && oldID == newID
+	level.Info(r.Logger).Log("op", "reload", "config", configFile, "interface", ifName, "config_id", newID, "keep-sessions", keepSessions)
+	return true, keepSessions, nil
+}
+
+// interfaceConfigFile returns the configuration of an interface, named
+// after it beside configFile if there is one and configFile otherwise.
+func interfaceConfigFile(configFile, ifName string) string {
+	if file := configgen.InterfaceFile(configFile, ifName); fileExists(file) {
+		return file
+	}
+	return configFile
+}
+
+func fileExists(name string) bool {
+	_, err := os.Stat(name)
+	return err == nil
+}
+
+// renderConfig replaces each '$SECRET{name}' placeholder of the config
+// with the contents of the file name in secretsDir.  Trailing newlines of
+// the files are dropped and the config ends with a single newline.
+func renderConfig(configFile, secretsDir string) ([]byte, error) {
+	data, err := os.ReadFile(configFile)
+	if err != nil {
+		return nil, err
+	}
+	config := strings.TrimRight(string(data), "\n")
+	if secretsDir != "" {
+		entries, err := os.ReadDir(secretsDir)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			// Projected files are symlinks into a hidden directory
+			if strings.HasPrefix(entry.Name(), ".") {
+				continue
+			}
+			secret, err := os.ReadFile(filepath.Join(secretsDir, entry.Name()))
+			if err != nil {
+				continue
+			}
+			config = strings.ReplaceAll(config, secretPlaceholder+entry.Name()+"}", strings.TrimRight(string(secret), "\n"))
+		}
+	}
+	if strings.Contains(config, secretPlaceholder) {
+		return nil, fmt.Errorf("unresolved secret placeholder in %s", configFile)
+	}
+	return []byte(config + "\n"), nil
+}
+
+// configID returns the config_id of a hostapd configuration.
+func configID(config []byte) string {
+	scanner := bufio.NewScanner(bytes.NewReader(config))
+	for scanner.Scan() {
+		if line := scanner.Text(); strings.HasPrefix(line, configIDKey) {
+			return strings.TrimPrefix(line, configIDKey)
+		}
+	}
+	return ""
+}
+
+// writeFileAtomic replaces name with data, readable by the owner only, so
+// that hostapd never reads a partial configuration.
+func writeFileAtomic(name string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(name), "."+filepath.Base(name))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
@@ -0,0 +1,94 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hostap
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/go-kit/log"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Reload", func() {
+	var (
+		reloader *ConfigReloader
+		dir      string
+	)
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+		Expect(os.Mkdir(filepath.Join(dir, "secrets"), 0755)).To(Succeed())
+		reloader = &ConfigReloader{
+			Logger:            log.NewNopLogger(),
+			ConfigFile:        filepath.Join(dir, "hostapd.conf"),
+			SecretsDir:        filepath.Join(dir, "secrets"),
+			RuntimeConfigFile: filepath.Join(dir, "runtime.conf"),
+		}
+	})
+	It("substitutes the secrets into the config", func() {
+		Expect(os.WriteFile(reloader.ConfigFile, []byte("config_id=abc\nauth_server_shared_secret=$SECRET{auth-0}\n\n"), 0644)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(reloader.SecretsDir, "auth-0"), []byte("s3cr3t\n"), 0644)).To(Succeed())
+		config, err := renderConfig(reloader.ConfigFile, reloader.SecretsDir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(config)).To(Equal("config_id=abc\nauth_server_shared_secret=s3cr3t\n"))
+		Expect(configID(config)).To(Equal("abc"))
+	})
+	It("fails on an unresolved secret", func() {
+		Expect(os.WriteFile(reloader.ConfigFile, []byte("auth_server_shared_secret=$SECRET{auth-1}\n"), 0644)).To(Succeed())
+		_, err := renderConfig(reloader.ConfigFile, reloader.SecretsDir)
+		Expect(err).To(HaveOccurred())
+	})
+	It("waits for the supervisor to render the runtime config", func() {
+		Expect(os.WriteFile(reloader.ConfigFile, []byte("config_id=abc\n"), 0644)).To(Succeed())
+		reloaded, _, err := reloader.render("eth0")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reloaded).To(BeFalse())
+		Expect(filepath.Join(dir, "runtime-eth0.conf")).NotTo(BeAnExistingFile())
+	})
+	It("only rewrites the runtime config when it changed", func() {
+		runtimeConfigFile := filepath.Join(dir, "runtime-eth0.conf")
+		Expect(os.WriteFile(reloader.ConfigFile, []byte("config_id=abc\n"), 0644)).To(Succeed())
+		Expect(os.WriteFile(runtimeConfigFile, []byte("config_id=abc\n"), 0600)).To(Succeed())
+		reloaded, _, err := reloader.render("eth0")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reloaded).To(BeFalse())
+
+		Expect(os.WriteFile(reloader.ConfigFile, []byte("config_id=def\n"), 0644)).To(Succeed())
+		reloaded, keepSessions, err := reloader.render("eth0")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reloaded).To(BeTrue())
+		Expect(keepSessions).To(BeFalse())
+		Expect(os.ReadFile(runtimeConfigFile)).To(Equal([]byte("config_id=def\n")))
+		info, err := os.Stat(runtimeConfigFile)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.Mode().Perm()).To(Equal(os.FileMode(0600)))
+	})
+	It("prefers the configuration of the interface", func() {
+		Expect(os.WriteFile(reloader.ConfigFile, []byte("config_id=abc\neap_reauth_period=3600\n"), 0644)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(dir, "hostapd-eth1.conf"), []byte("config_id=abc\neap_reauth_period=60\n"), 0644)).To(Succeed())
+		for _, ifName := range []string{"eth0", "eth1"} {
+			Expect(os.WriteFile(filepath.Join(dir, "runtime-"+ifName+".conf"), []byte("config_id=abc\n"), 0600)).To(Succeed())
+			reloaded, keepSessions, err := reloader.render(ifName)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(reloaded).To(BeTrue())
+			Expect(keepSessions).To(BeTrue())
+		}
+		Expect(os.ReadFile(filepath.Join(dir, "runtime-eth0.conf"))).To(Equal([]byte("config_id=abc\neap_reauth_period=3600\n")))
+		Expect(os.ReadFile(filepath.Join(dir, "runtime-eth1.conf"))).To(Equal([]byte("config_id=abc\neap_reauth_period=60\n")))
+	})
+})
@@ -0,0 +1,173 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hostap
+
+import (
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	eapolv1 "github.com/openshift-kni/eapol-operator/api/v1"
+)
+
+// Names of the IEEE 802.1X MIB authenticator PAE and backend authentication
+// states, which hostapd reports by number starting from 1.
+var (
+	paeStates = []string{"Initialize", "Disconnected", "Connecting", "Authenticating", "Authenticated",
+		"Aborting", "Held", "ForceAuth", "ForceUnauth", "Restart"}
+	backendStates = []string{"Request", "Response", "Success", "Fail", "Timeout", "Idle", "Initialize", "Ignore"}
+)
+
+// session is what is known about the session of an authenticated station,
+// from the events and STA replies of hostapd.
+type session struct {
+	authenticatedAt   time.Time
+	reauthenticatedAt time.Time
+	authServer        string
+	details           staDetails
+}
+
+// staDetails are the session details reported in a STA reply.
+type staDetails struct {
+	identity       string
+	eapMethod      string
+	sessionTimeout int
+	paeState       string
+	backendState   string
+}
+
+// parseStaReply parses the reply to a STA command, which is the station MAC
+// address followed by its attributes, one name=value pair per line.
+func parseStaReply(reply string) (string, map[string]string) {
+	lines := strings.Split(reply, "\n")
+	mac, err := net.ParseMAC(strings.TrimSpace(lines[0]))
+	if err != nil {
+		return "", nil
+	}
+	attrs := map[string]string{}
+	for _, line := range lines[1:] {
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) == 2 {
+			attrs[parts[0]] = parts[1]
+		}
+	}
+	return mac.String(), attrs
+}
+
+// parseStaDetails extracts the session details from the attributes of a
+// STA reply.
+func parseStaDetails(attrs map[string]string) staDetails {
+	details := staDetails{
+		identity:     attrs["dot1xAuthSessionUserName"],
+		eapMethod:    eapMethodName(attrs["last_eap_type_as"]),
+		paeState:     mibStateName(attrs["dot1xAuthPaeState"], paeStates),
+		backendState: mibStateName(attrs["dot1xAuthBackendAuthState"], backendStates),
+	}
+	if attrs["dot1xAuthReAuthEnabled"] == "TRUE" {
+		details.sessionTimeout, _ = strconv.Atoi(attrs["dot1xAuthReAuthPeriod"])
+	}
+	return details
+}
+
+// eapMethodName returns the method name of a "type (name)" EAP type, or the
+// type number when hostapd has no name for it.
+func eapMethodName(eapType string) string {
+	if eapType == "" || strings.HasPrefix(eapType, "0 ") {
+		return ""
+	}
+	start, end := strings.Index(eapType, "("), strings.LastIndex(eapType, ")")
+	if start < 0 || end < start {
+		return eapType
+	}
+	return eapType[start+1 : end]
+}
+
+func mibStateName(state string, names []string) string {
+	index, err := strconv.Atoi(state)
+	if err != nil {
+		return state
+	}
+	if index < 1 || index > len(names) {
+		return ""
+	}
+	return names[index-1]
+}
+
+// startSession records the authentication of a station by authServer.  The
+// caller holds addrMutex.
+func (m *InterfaceMonitor) startSession(mac, authServer string) {
+	if m.sessions == nil {
+		m.sessions = make(map[string]*session)
+	}
+	m.sessions[mac] = &session{authenticatedAt: time.Now(), authServer: authServer}
+}
+
+// reauthenticated records a reauthentication of an authenticated station.
+// The caller holds addrMutex.
+func (m *InterfaceMonitor) reauthenticated(mac string) {
+	if s, ok := m.sessions[mac]; ok {
+		s.reauthenticatedAt = time.Now()
+	}
+}
+
+// queryStations asks hostapd for the details of the stations it
+// authenticated, like hostapd_cli all_sta, one STA command per station.
+func (m *InterfaceMonitor) queryStations() {
+	m.addrMutex.Lock()
+	var macs []string
+	for mac := range m.PfInfo.AuthenticatedAddrs {
+		if _, ok := m.mabAddrs[mac]; !ok {
+			macs = append(macs, mac)
+		}
+	}
+	m.addrMutex.Unlock()
+	sort.Strings(macs)
+	for _, mac := range macs {
+		m.writeCommand(staCommand + " " + mac)
+	}
+}
+
+// clientStatus returns the status of an authenticated station.  The caller
+// holds addrMutex.
+func (m *InterfaceMonitor) clientStatus(mac string) eapolv1.ClientStatus {
+	status := eapolv1.ClientStatus{MAC: mac, AuthMethod: m.authMethod(mac)}
+	s, ok := m.sessions[mac]
+	if !ok {
+		return status
+	}
+	status.AuthenticatedAt = metaTime(s.authenticatedAt)
+	status.LastReauthenticatedAt = metaTime(s.reauthenticatedAt)
+	status.AuthServer = s.authServer
+	status.Identity = s.details.identity
+	status.EAPMethod = s.details.eapMethod
+	status.SessionTimeout = s.details.sessionTimeout
+	status.PAEState = s.details.paeState
+	status.BackendState = s.details.backendState
+	return status
+}
+
+func metaTime(t time.Time) *metav1.Time {
+	if t.IsZero() {
+		return nil
+	}
+	mt := metav1.NewTime(t.Truncate(time.Second))
+	return &mt
+}
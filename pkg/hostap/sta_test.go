@@ -0,0 +1,148 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hostap
+
+import (
+	"github.com/k8snetworkplumbingwg/sriov-cni/pkg/utils"
+	mocks_utils "github.com/k8snetworkplumbingwg/sriov-cni/pkg/utils/mocks"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/stretchr/testify/mock"
+	vnetlink "github.com/vishvananda/netlink"
+
+	eapolv1 "github.com/openshift-kni/eapol-operator/api/v1"
+	"github.com/openshift-kni/eapol-operator/internal/trafficcontrol"
+)
+
+var staReplyStr = `6e:16:06:0e:b7:e2
+flags=[AUTH][ASSOC][AUTHORIZED]
+aid=0
+capability=0x0
+listen_interval=0
+supported_rates=
+timeout_next=NULLFUNC POLL
+dot1xAuthPaeState=AUTHENTICATED
+vlan_id=300
+`
+
+var staSessionReplyStr = `6e:16:06:0e:b7:e3
+flags=[AUTH][ASSOC][AUTHORIZED]
+aid=0
+dot1xPaePortNumber=0
+dot1xAuthPaeState=5
+dot1xAuthBackendAuthState=6
+dot1xAuthReAuthPeriod=3600
+dot1xAuthReAuthEnabled=TRUE
+dot1xAuthSessionTime=42
+dot1xAuthSessionUserName=user@example.com
+last_eap_type_as=13 (TLS)
+last_eap_type_sta=13 (TLS)
+`
+
+var _ = Describe("Sta", func() {
+	It("parses a STA reply", func() {
+		mac, attrs := parseStaReply(staReplyStr)
+		Expect(mac).To(Equal("6e:16:06:0e:b7:e2"))
+		Expect(attrs).To(HaveKeyWithValue("vlan_id", "300"))
+		Expect(attrs).To(HaveKeyWithValue("timeout_next", "NULLFUNC POLL"))
+	})
+
+	It("ignores a reply for an unknown station", func() {
+		mac, attrs := parseStaReply("FAIL\n")
+		Expect(mac).To(BeEmpty())
+		Expect(attrs).To(BeNil())
+	})
+
+	It("parses the session details of a STA reply", func() {
+		_, attrs := parseStaReply(staSessionReplyStr)
+		Expect(parseStaDetails(attrs)).To(Equal(staDetails{
+			identity:       "user@example.com",
+			eapMethod:      "TLS",
+			sessionTimeout: 3600,
+			paeState:       "Authenticated",
+			backendState:   "Idle",
+		}))
+		Expect(eapMethodName("0 (unknown)")).To(BeEmpty())
+		Expect(eapMethodName("254")).To(Equal("254"))
+		Expect(mibStateName("11", paeStates)).To(BeEmpty())
+	})
+
+	It("reports the session of an authenticated station", func() {
+		pfInfo := &trafficcontrol.PFInfo{Name: pfName, VFs: map[int]*trafficcontrol.VFInfo{},
+			AuthenticatedAddrs: map[string]interface{}{"6e:16:06:0e:b7:e3": nil}}
+		intfMonitor := NewInterfaceMonitor(nil, pfName, func(intfMonitor *InterfaceMonitor) {
+			intfMonitor.PfInfo = pfInfo
+		})
+		intfMonitor.startSession("6e:16:06:0e:b7:e3", "10.0.0.1:1812")
+		changed, err := intfMonitor.handleStaReply(staSessionReplyStr)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(changed).To(BeTrue())
+		// Unchanged details do not update the status again
+		changed, err = intfMonitor.handleStaReply(staSessionReplyStr)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(changed).To(BeFalse())
+
+		status := intfMonitor.clientStatus("6e:16:06:0e:b7:e3")
+		Expect(status.AuthMethod).To(Equal(eapolv1.AuthMethodEAP))
+		Expect(status.Identity).To(Equal("user@example.com"))
+		Expect(status.EAPMethod).To(Equal("TLS"))
+		Expect(status.SessionTimeout).To(Equal(3600))
+		Expect(status.PAEState).To(Equal("Authenticated"))
+		Expect(status.BackendState).To(Equal("Idle"))
+		Expect(status.AuthServer).To(Equal("10.0.0.1:1812"))
+		Expect(status.AuthenticatedAt).NotTo(BeNil())
+		Expect(status.LastReauthenticatedAt).To(BeNil())
+
+		intfMonitor.handleEapSuccessEvent("6e:16:06:0e:b7:e3")
+		Expect(intfMonitor.clientStatus("6e:16:06:0e:b7:e3").LastReauthenticatedAt).NotTo(BeNil())
+	})
+
+	It("applies the assigned VLAN to the VFs of an authenticated station", func() {
+		mocked := &mocks_utils.NetlinkManager{}
+		fakeLink := &utils.FakeLink{LinkAttrs: vnetlink.LinkAttrs{
+			Index: 1000,
+			Name:  pfName,
+			Vfs:   []vnetlink.VfInfo{{ID: 0, Vlan: 100}},
+		}}
+		mocked.On("LinkByName", mock.AnythingOfType("string")).Return(fakeLink, nil)
+		pfInfo := &trafficcontrol.PFInfo{Name: pfName, Authenticated: true, VFs: map[int]*trafficcontrol.VFInfo{},
+			AuthenticatedAddrs: map[string]interface{}{"6e:16:06:0e:b7:e2": nil},
+			StationVlans:       map[string]int{}, NetLinkMgr: mocked,
+			TrafficCtl: trafficcontrol.NewFakeTrafficController()}
+		pfInfo.VFs[0] = &trafficcontrol.VFInfo{Parent: pfInfo, Index: 0, Vlan: 100}
+		intfMonitor := NewInterfaceMonitor(nil, pfName, func(intfMonitor *InterfaceMonitor) {
+			intfMonitor.PfInfo = pfInfo
+			intfMonitor.LinkMgr = mocked
+		})
+
+		mocked.On("LinkSetVfVlan", fakeLink, 0, 300).Return(nil).Once()
+		mocked.On("LinkSetVfState", fakeLink, 0, vnetlink.VF_LINK_STATE_AUTO).Return(nil).Once()
+		Expect(intfMonitor.handleHostapdEvent(staReplyStr)).To(Succeed())
+		// A repeated reply does not reconfigure the VF
+		Expect(intfMonitor.handleHostapdEvent(staReplyStr)).To(Succeed())
+		Expect(pfInfo.StationVlans).To(Equal(map[string]int{"6e:16:06:0e:b7:e2": 300}))
+		mocked.AssertExpectations(GinkgoT())
+
+		// The original VLAN is restored once the VF is disabled
+		mocked.On("LinkSetVfVlan", fakeLink, 0, trafficcontrol.ReservedVlan).Return(nil).Once()
+		mocked.On("LinkSetVfState", fakeLink, 0, vnetlink.VF_LINK_STATE_DISABLE).Return(nil).Once()
+		Expect(intfMonitor.handleDeAuthenticateEvent("6e:16:06:0e:b7:e2")).To(Succeed())
+		Expect(pfInfo.StationVlans).To(BeEmpty())
+		Expect(pfInfo.VFs[0].AssignedVlan).To(BeZero())
+		mocked.AssertExpectations(GinkgoT())
+	})
+})
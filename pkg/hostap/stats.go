@@ -37,16 +37,34 @@ var stats = metrics{
 		Name:      authmetrics.AuthFailed.Name,
 		Help:      authmetrics.AuthFailed.Help,
 	}, labels),
+
+	up: prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: authmetrics.Namespace,
+		Subsystem: authmetrics.Subsystem,
+		Name:      authmetrics.HostapdUp.Name,
+		Help:      authmetrics.HostapdUp.Help,
+	}),
+
+	restarts: prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: authmetrics.Namespace,
+		Subsystem: authmetrics.Subsystem,
+		Name:      authmetrics.HostapdRestarts.Name,
+		Help:      authmetrics.HostapdRestarts.Help,
+	}),
 }
 
 type metrics struct {
 	authSuccess *prometheus.GaugeVec
 	authFailed  *prometheus.CounterVec
+	up          prometheus.Gauge
+	restarts    prometheus.Counter
 }
 
 func init() {
 	prometheus.MustRegister(stats.authSuccess)
 	prometheus.MustRegister(stats.authFailed)
+	prometheus.MustRegister(stats.up)
+	prometheus.MustRegister(stats.restarts)
 }
 
 func (m *metrics) Authenticated(iface string) {
@@ -60,3 +78,15 @@ func (m *metrics) DeAuthenticated(iface string) {
 func (m *metrics) AuthFailed(iface string) {
 	m.authFailed.WithLabelValues(iface).Inc()
 }
+
+func (m *metrics) HostapdUp(up bool) {
+	if up {
+		m.up.Set(1)
+	} else {
+		m.up.Set(0)
+	}
+}
+
+func (m *metrics) HostapdRestarted() {
+	m.restarts.Inc()
+}
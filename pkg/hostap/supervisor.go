@@ -0,0 +1,309 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hostap
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/openshift-kni/eapol-operator/pkg/configgen"
+)
+
+const (
+	defaultMinBackoff = 1 * time.Second
+	defaultMaxBackoff = 1 * time.Minute
+	// socketPollInterval is how often the control interfaces of a started
+	// hostapd are looked for
+	socketPollInterval = 100 * time.Millisecond
+	// maxOutputLine is the longest line of hostapd output which is logged,
+	// such as a hex dump of a large EAP message at debug level
+	maxOutputLine = 1024 * 1024
+)
+
+// Supervisor runs hostapd on the protected interfaces, each with its own
+// configuration rendered the same way ConfigReloader renders it, and
+// restarts hostapd with exponential backoff whenever it exits.  The output of
+// hostapd is logged line by line, and once a restarted hostapd has created
+// its control interfaces the monitors reattach to them.
+type Supervisor struct {
+	Logger log.Logger
+	// Command is the hostapd binary
+	Command    string
+	Interfaces []string
+	// ConfigFile, SecretsDir and RuntimeConfigFile are as in ConfigReloader
+	ConfigFile        string
+	SecretsDir        string
+	RuntimeConfigFile string
+	// MinBackoff is the delay before the first restart, doubled on each
+	// restart up to MaxBackoff.  It is reset once hostapd ran for
+	// MaxBackoff.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	monitors   []*InterfaceMonitor
+	// starts counts the times hostapd created its control interfaces
+	starts int
+	cmd    *exec.Cmd
+	up     chan interface{}
+	mutex  sync.Mutex
+	stop   chan interface{}
+	stopWg sync.WaitGroup
+}
+
+// Start runs hostapd until Stop is called, unless the configurations cannot
+// be rendered.
+func (s *Supervisor) Start() error {
+	if s.MinBackoff == 0 {
+		s.MinBackoff = defaultMinBackoff
+	}
+	if s.MaxBackoff == 0 {
+		s.MaxBackoff = defaultMaxBackoff
+	}
+	configs, err := s.render()
+	if err != nil {
+		return err
+	}
+	s.stop = make(chan interface{})
+	s.up = make(chan interface{})
+	s.stopWg.Add(1)
+	go func() {
+		defer s.stopWg.Done()
+		s.supervise(configs)
+	}()
+	return nil
+}
+
+// Up is closed once hostapd first created its control interfaces.
+func (s *Supervisor) Up() <-chan interface{} {
+	return s.up
+}
+
+// Stop stops hostapd without restarting it.
+func (s *Supervisor) Stop() {
+	s.mutex.Lock()
+	close(s.stop)
+	if s.cmd != nil {
+		s.cmd.Process.Signal(syscall.SIGTERM)
+	}
+	s.mutex.Unlock()
+	s.stopWg.Wait()
+}
+
+// SetMonitors sets the monitors reattached to hostapd after it restarted.
+// The monitors are expected to have connected to hostapd once Up was closed,
+// so they are reattached right away if it restarted since.
+func (s *Supervisor) SetMonitors(monitors []*InterfaceMonitor) {
+	s.mutex.Lock()
+	s.monitors = monitors
+	restarted := s.starts > 1
+	s.mutex.Unlock()
+	if restarted {
+		s.reattach(monitors)
+	}
+}
+
+// supervise runs hostapd with configs and restarts it until stopped.
+func (s *Supervisor) supervise(configs []string) {
+	backoff := s.MinBackoff
+	for {
+		started := time.Now()
+		err := s.run(configs)
+		stats.HostapdUp(false)
+		select {
+		case <-s.stop:
+			level.Info(s.Logger).Log("op", "hostapd", "msg", "hostapd stopped")
+			return
+		default:
+		}
+		if time.Since(started) >= s.MaxBackoff {
+			backoff = s.MinBackoff
+		}
+		level.Error(s.Logger).Log("op", "hostapd", "error", err, "restart-in", backoff)
+		select {
+		case <-s.stop:
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > s.MaxBackoff {
+			backoff = s.MaxBackoff
+		}
+		stats.HostapdRestarted()
+		// Pick up the configurations the monitor reloaded hostapd with
+		// meanwhile, keeping the last ones if they cannot be rendered
+		if rendered, err := s.render(); err != nil {
+			level.Error(s.Logger).Log("op", "hostapd", "render", s.ConfigFile, "error", err)
+		} else {
+			configs = rendered
+		}
+	}
+}
+
+// run runs hostapd until it exits, and has the monitors reattach to it once
+// it created its control interfaces.
+func (s *Supervisor) run(configs []string) error {
+	// A hostapd which was killed leaves its control interfaces behind
+	for _, iface := range s.Interfaces {
+		os.Remove(filepath.Join(hostapdSocketDir, iface))
+	}
+	args := append([]string{"-i", strings.Join(s.Interfaces, ",")}, configs...)
+	cmd := exec.Command(s.Command, args...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	// Both streams are logged the same way
+	cmd.Stderr = cmd.Stdout
+	s.mutex.Lock()
+	select {
+	case <-s.stop:
+		s.mutex.Unlock()
+		return nil
+	default:
+	}
+	if err := cmd.Start(); err != nil {
+		s.mutex.Unlock()
+		return err
+	}
+	s.cmd = cmd
+	s.mutex.Unlock()
+	level.Info(s.Logger).Log("op", "hostapd", "msg", "hostapd started", "pid", cmd.Process.Pid)
+
+	exited := make(chan interface{})
+	attached := make(chan interface{})
+	go func() {
+		defer close(attached)
+		if !s.waitControlInterfaces(exited) {
+			return
+		}
+		stats.HostapdUp(true)
+		s.mutex.Lock()
+		s.starts++
+		monitors := s.monitors
+		s.mutex.Unlock()
+		s.reattach(monitors)
+		select {
+		case <-s.up:
+		default:
+			close(s.up)
+		}
+	}()
+	// The output is read to the end before waiting, as Wait closes the pipe
+	s.logOutput(stdout)
+	err = cmd.Wait()
+	close(exited)
+	<-attached
+	s.mutex.Lock()
+	s.cmd = nil
+	s.mutex.Unlock()
+	if err != nil {
+		return fmt.Errorf("hostapd exited: %w", err)
+	}
+	return errors.New("hostapd exited")
+}
+
+// waitControlInterfaces waits for hostapd to create the control interface
+// of every interface, returning false if it exited first.
+func (s *Supervisor) waitControlInterfaces(exited chan interface{}) bool {
+	ticker := time.NewTicker(socketPollInterval)
+	defer ticker.Stop()
+	for {
+		ready := true
+		for _, iface := range s.Interfaces {
+			if !fileExists(filepath.Join(hostapdSocketDir, iface)) {
+				ready = false
+				break
+			}
+		}
+		if ready {
+			return true
+		}
+		select {
+		case <-exited:
+			return false
+		case <-ticker.C:
+		}
+	}
+}
+
+// reattach has every monitor reattach to the restarted hostapd.  There are
+// none until hostapd first started.
+func (s *Supervisor) reattach(monitors []*InterfaceMonitor) {
+	for _, m := range monitors {
+		if err := m.Reattach(); err != nil {
+			level.Error(s.Logger).Log("op", "hostapd", "reattach", m.IfName, "error", err)
+		}
+	}
+}
+
+// render renders the configuration of every interface, returning the
+// rendered files in the order of Interfaces.
+func (s *Supervisor) render() ([]string, error) {
+	var configs []string
+	for _, iface := range s.Interfaces {
+		config, err := renderConfig(interfaceConfigFile(s.ConfigFile, iface), s.SecretsDir)
+		if err != nil {
+			return nil, err
+		}
+		runtimeConfigFile := configgen.InterfaceFile(s.RuntimeConfigFile, iface)
+		if err := writeFileAtomic(runtimeConfigFile, config); err != nil {
+			return nil, err
+		}
+		configs = append(configs, runtimeConfigFile)
+	}
+	return configs, nil
+}
+
+// logOutput logs each line hostapd writes, with the interface it concerns if
+// it names one.  hostapd does not tell the level of what it writes, and
+// routine events such as EAP failures read like errors, so every line is
+// logged at info level.  Its exit is logged as an error.  Once a line is too
+// long to log, the rest of the output is discarded rather than left to fill
+// the pipe, which would block hostapd.
+func (s *Supervisor) logOutput(output io.Reader) {
+	scanner := bufio.NewScanner(output)
+	scanner.Buffer(nil, maxOutputLine)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		keyvals := []interface{}{"op", "hostapd"}
+		for _, iface := range s.Interfaces {
+			if strings.HasPrefix(line, iface+": ") {
+				keyvals = append(keyvals, "interface", iface)
+				line = strings.TrimPrefix(line, iface+": ")
+				break
+			}
+		}
+		level.Info(s.Logger).Log(append(keyvals, "msg", line)...)
+	}
+	if err := scanner.Err(); err != nil {
+		level.Error(s.Logger).Log("op", "hostapd", "msg", "discarding output", "error", err)
+		io.Copy(io.Discard, output)
+	}
+}
@@ -0,0 +1,143 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package hostap
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-kit/log"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Supervisor", func() {
+	var (
+		supervisor *Supervisor
+		dir        string
+		output     *bytes.Buffer
+	)
+	// fakeHostapd records its arguments, creates the control interfaces and
+	// exits after the given script
+	fakeHostapd := func(script string) {
+		Expect(os.WriteFile(supervisor.Command, []byte(`#!/bin/sh
+echo "$@" >>`+filepath.Join(dir, "args")+`
+for config in "$@"; do echo "Configuration file: $config"; done
+touch `+filepath.Join(hostapdSocketDir, "eth0")+` `+filepath.Join(hostapdSocketDir, "eth1")+`
+`+script+"\n"), 0755)).To(Succeed())
+	}
+	runs := func() int {
+		args, err := os.ReadFile(filepath.Join(dir, "args"))
+		if err != nil {
+			return 0
+		}
+		return strings.Count(string(args), "\n")
+	}
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+		DeferCleanup(func(dir string) { hostapdSocketDir = dir }, hostapdSocketDir)
+		hostapdSocketDir = filepath.Join(dir, "sockets")
+		Expect(os.Mkdir(hostapdSocketDir, 0755)).To(Succeed())
+		Expect(os.Mkdir(filepath.Join(dir, "secrets"), 0755)).To(Succeed())
+		output = &bytes.Buffer{}
+		supervisor = &Supervisor{
+			Logger:            log.NewLogfmtLogger(log.NewSyncWriter(output)),
+			Command:           filepath.Join(dir, "hostapd"),
+			Interfaces:        []string{"eth0", "eth1"},
+			ConfigFile:        filepath.Join(dir, "hostapd.conf"),
+			SecretsDir:        filepath.Join(dir, "secrets"),
+			RuntimeConfigFile: filepath.Join(dir, "runtime.conf"),
+			MinBackoff:        50 * time.Millisecond,
+			MaxBackoff:        200 * time.Millisecond,
+		}
+		Expect(os.WriteFile(supervisor.ConfigFile, []byte("auth_server_shared_secret=$SECRET{auth-0}\n"), 0644)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(dir, "hostapd-eth1.conf"), []byte("eap_reauth_period=600\n"), 0644)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(supervisor.SecretsDir, "auth-0"), []byte("s3cr3t\n"), 0644)).To(Succeed())
+	})
+	It("runs hostapd with the rendered configuration of each interface", func() {
+		fakeHostapd("exec sleep 60")
+		Expect(supervisor.Start()).To(Succeed())
+		Eventually(supervisor.Up(), 5*time.Second).Should(BeClosed())
+		supervisor.Stop()
+		Expect(runs()).To(Equal(1))
+		runtimeEth0, runtimeEth1 := filepath.Join(dir, "runtime-eth0.conf"), filepath.Join(dir, "runtime-eth1.conf")
+		Expect(os.ReadFile(filepath.Join(dir, "args"))).To(Equal([]byte("-i eth0,eth1 " + runtimeEth0 + " " + runtimeEth1 + "\n")))
+		Expect(os.ReadFile(runtimeEth0)).To(Equal([]byte("auth_server_shared_secret=s3cr3t\n")))
+		Expect(os.ReadFile(runtimeEth1)).To(Equal([]byte("eap_reauth_period=600\n")))
+		Expect(output.String()).To(ContainSubstring("msg=\"Configuration file: " + runtimeEth0 + "\""))
+		Expect(output.String()).To(ContainSubstring("msg=\"hostapd stopped\""))
+	})
+	It("fails to start on an unresolved secret", func() {
+		Expect(os.Remove(filepath.Join(supervisor.SecretsDir, "auth-0"))).To(Succeed())
+		Expect(supervisor.Start()).NotTo(Succeed())
+	})
+	It("restarts hostapd with backoff when it exits", func() {
+		fakeHostapd("echo 'eth0: interface state ENABLED->DISABLED'; exit 1")
+		Expect(supervisor.Start()).To(Succeed())
+		Eventually(runs, 5*time.Second).Should(BeNumerically(">=", 4))
+		supervisor.Stop()
+		Expect(output.String()).To(ContainSubstring("level=error op=hostapd error=\"hostapd exited: exit status 1\" restart-in=50ms"))
+		Expect(output.String()).To(ContainSubstring("restart-in=100ms"))
+		Expect(output.String()).To(ContainSubstring("restart-in=200ms"))
+		Expect(output.String()).NotTo(ContainSubstring("restart-in=400ms"))
+		Expect(output.String()).To(ContainSubstring("level=info op=hostapd interface=eth0 msg=\"interface state ENABLED->DISABLED\""))
+	})
+	It("reattaches monitors set after hostapd restarted", func() {
+		// hostapd exits once after creating its control interfaces
+		fakeHostapd(`if [ -e ` + filepath.Join(dir, "started") + ` ]; then exec sleep 60; fi
+touch ` + filepath.Join(dir, "started") + `
+sleep 0.5
+exit 1`)
+		Expect(supervisor.Start()).To(Succeed())
+		defer supervisor.Stop()
+		Eventually(func() int {
+			supervisor.mutex.Lock()
+			defer supervisor.mutex.Unlock()
+			return supervisor.starts
+		}, 5*time.Second).Should(Equal(2))
+		// The monitor cannot connect to the fake control interface, but
+		// tries to
+		supervisor.SetMonitors([]*InterfaceMonitor{{IfName: "eth0", Logger: supervisor.Logger}})
+		Expect(output.String()).To(ContainSubstring("reattach=eth0"))
+	})
+	It("logs the output of hostapd at info level", func() {
+		for _, line := range []string{
+			"eth0: AP-ENABLED",
+			"eth0: CTRL-EVENT-EAP-FAILURE 6e:16:06:0e:b7:e2",
+			"Unknown EAPOL type 4",
+		} {
+			output.Reset()
+			supervisor.logOutput(strings.NewReader(line + "\n"))
+			Expect(output.String()).To(HavePrefix("level=info op=hostapd"))
+		}
+	})
+	It("logs long lines and drains the output past a line too long", func() {
+		long := strings.Repeat("0", 128*1024)
+		supervisor.logOutput(strings.NewReader("eth0: " + long + "\n"))
+		Expect(output.String()).To(ContainSubstring(long))
+
+		output.Reset()
+		rest := strings.NewReader(strings.Repeat("0", maxOutputLine+1) + "\neth0: AP-ENABLED\n")
+		supervisor.logOutput(rest)
+		Expect(output.String()).To(HavePrefix("level=error op=hostapd"))
+		Expect(output.String()).NotTo(ContainSubstring("AP-ENABLED"))
+		Expect(rest.Len()).To(BeZero())
+	})
+})
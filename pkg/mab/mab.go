@@ -0,0 +1,63 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package mab authorizes devices without a supplicant by their MAC address
+// (MAC Authentication Bypass).
+package mab
+
+import (
+	"fmt"
+	"net"
+)
+
+// Result is the outcome of a MAB authorization.
+type Result struct {
+	Accept bool
+	// Vlan is the VLAN assigned by the RADIUS server, if any
+	Vlan int
+}
+
+// Authorizer decides whether a MAC address seen on an interface is allowed.
+type Authorizer interface {
+	Authorize(ifName string, mac net.HardwareAddr) (Result, error)
+}
+
+// LocalAuthorizer accepts the MAC addresses of a fixed list.
+type LocalAuthorizer struct {
+	macs map[string]interface{}
+}
+
+func NewLocalAuthorizer(macs []string) (*LocalAuthorizer, error) {
+	a := &LocalAuthorizer{macs: make(map[string]interface{}, len(macs))}
+	for _, mac := range macs {
+		hwAddr, err := net.ParseMAC(mac)
+		if err != nil {
+			return nil, fmt.Errorf("invalid MAB MAC address %q: %w", mac, err)
+		}
+		a.macs[hwAddr.String()] = nil
+	}
+	return a, nil
+}
+
+func (a *LocalAuthorizer) Authorize(ifName string, mac net.HardwareAddr) (Result, error) {
+	_, ok := a.macs[mac.String()]
+	return Result{Accept: ok}, nil
+}
+
+// userName formats a MAC address as hostapd does for RADIUS MAC ACLs.
+func userName(mac net.HardwareAddr) string {
+	return fmt.Sprintf("%02X-%02X-%02X-%02X-%02X-%02X", mac[0], mac[1], mac[2], mac[3], mac[4], mac[5])
+}
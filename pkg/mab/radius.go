@@ -0,0 +1,263 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mab
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RADIUS codes and attribute types (RFC 2865, RFC 2868, RFC 3579)
+const (
+	codeAccessRequest = 1
+	codeAccessAccept  = 2
+	codeAccessReject  = 3
+
+	attrUserName             = 1
+	attrUserPassword         = 2
+	attrServiceType          = 6
+	attrCallingStationID     = 31
+	attrNASPortType          = 61
+	attrTunnelPrivateGroupID = 81
+	attrMessageAuthenticator = 80
+	attrNASPortID            = 87
+
+	serviceTypeCallCheck = 10
+	nasPortTypeEthernet  = 15
+
+	headerLen        = 20
+	authenticatorLen = 16
+	maxPacketLen     = 4096
+
+	defaultTimeout = 3 * time.Second
+	defaultRetries = 2
+)
+
+var errNoServers = errors.New("no RADIUS servers configured for MAB")
+
+// RadiusServer is a RADIUS authentication server and its shared secret.
+// When SecretFile is set, the shared secret is read from it on every
+// authorization instead, so that a rotated secret applies right away.
+type RadiusServer struct {
+	Address    string
+	Secret     string
+	SecretFile string
+}
+
+// secret returns the shared secret of the server.
+func (s RadiusServer) secret() (string, error) {
+	if s.SecretFile == "" {
+		return s.Secret, nil
+	}
+	secret, err := os.ReadFile(s.SecretFile)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(secret), "\n"), nil
+}
+
+// RadiusAuthorizer authorizes MAC addresses with RADIUS Call-Check
+// Access-Requests, using the MAC address as both user name and password.
+// Servers are tried in order, failing over when one does not answer.
+type RadiusAuthorizer struct {
+	Servers []RadiusServer
+	Timeout time.Duration
+	Retries int
+}
+
+func NewRadiusAuthorizer(servers []RadiusServer) *RadiusAuthorizer {
+	return &RadiusAuthorizer{Servers: servers, Timeout: defaultTimeout, Retries: defaultRetries}
+}
+
+func (a *RadiusAuthorizer) Authorize(ifName string, mac net.HardwareAddr) (Result, error) {
+	if len(mac) != 6 {
+		return Result{}, fmt.Errorf("unsupported MAC address %s", mac)
+	}
+	err := errNoServers
+	for _, server := range a.Servers {
+		var result Result
+		result, err = a.authorize(server, ifName, mac)
+		if err == nil {
+			return result, nil
+		}
+	}
+	return Result{}, err
+}
+
+func (a *RadiusAuthorizer) authorize(server RadiusServer, ifName string, mac net.HardwareAddr) (Result, error) {
+	secret, err := server.secret()
+	if err != nil {
+		return Result{}, err
+	}
+	conn, err := net.Dial("udp", server.Address)
+	if err != nil {
+		return Result{}, err
+	}
+	defer conn.Close()
+	request, err := accessRequest(secret, ifName, mac)
+	if err != nil {
+		return Result{}, err
+	}
+	reply := make([]byte, maxPacketLen)
+	for i := 0; i <= a.Retries; i++ {
+		if _, err = conn.Write(request); err != nil {
+			return Result{}, err
+		}
+		conn.SetReadDeadline(time.Now().Add(a.Timeout))
+		var size int
+		for {
+			size, err = conn.Read(reply)
+			if err != nil {
+				break
+			}
+			// Late replies to an earlier attempt carry the same identifier
+			// and authenticator, so any valid reply will do.
+			if result, ok := parseReply(reply[:size], request, secret); ok {
+				return result, nil
+			}
+		}
+		if opErr, ok := err.(*net.OpError); !ok || !opErr.Timeout() {
+			return Result{}, err
+		}
+	}
+	return Result{}, fmt.Errorf("no reply from RADIUS server %s", server.Address)
+}
+
+// accessRequest encodes a MAB Access-Request.
+func accessRequest(secret, ifName string, mac net.HardwareAddr) ([]byte, error) {
+	header := make([]byte, headerLen)
+	header[0] = codeAccessRequest
+	if _, err := rand.Read(header[1:2]); err != nil {
+		return nil, err
+	}
+	if _, err := rand.Read(header[4:headerLen]); err != nil {
+		return nil, err
+	}
+	name := userName(mac)
+	var attrs bytes.Buffer
+	appendAttr(&attrs, attrUserName, []byte(name))
+	appendAttr(&attrs, attrUserPassword, hidePassword([]byte(name), secret, header[4:headerLen]))
+	appendAttr(&attrs, attrServiceType, uint32Value(serviceTypeCallCheck))
+	appendAttr(&attrs, attrCallingStationID, []byte(name))
+	appendAttr(&attrs, attrNASPortType, uint32Value(nasPortTypeEthernet))
+	if ifName != "" {
+		appendAttr(&attrs, attrNASPortID, []byte(ifName))
+	}
+	// The Message-Authenticator is computed over the packet with the
+	// attribute value zeroed, then filled in.
+	msgAuthOffset := headerLen + attrs.Len() + 2
+	appendAttr(&attrs, attrMessageAuthenticator, make([]byte, authenticatorLen))
+	packet := append(header, attrs.Bytes()...)
+	binary.BigEndian.PutUint16(packet[2:4], uint16(len(packet)))
+	mh := hmac.New(md5.New, []byte(secret))
+	mh.Write(packet)
+	copy(packet[msgAuthOffset:], mh.Sum(nil))
+	return packet, nil
+}
+
+// parseReply validates a reply to request against the response
+// authenticator, returning false for anything else.
+func parseReply(reply, request []byte, secret string) (Result, bool) {
+	if len(reply) < headerLen || reply[1] != request[1] {
+		return Result{}, false
+	}
+	length := int(binary.BigEndian.Uint16(reply[2:4]))
+	if length < headerLen || length > len(reply) {
+		return Result{}, false
+	}
+	reply = reply[:length]
+	h := md5.New()
+	h.Write(reply[:4])
+	h.Write(request[4:headerLen])
+	h.Write(reply[headerLen:])
+	h.Write([]byte(secret))
+	if !hmac.Equal(h.Sum(nil), reply[4:headerLen]) {
+		return Result{}, false
+	}
+	switch reply[0] {
+	case codeAccessAccept:
+		return Result{Accept: true, Vlan: tunnelVlan(reply[headerLen:])}, true
+	case codeAccessReject:
+		return Result{}, true
+	}
+	return Result{}, false
+}
+
+// tunnelVlan returns the VLAN from a Tunnel-Private-Group-ID attribute,
+// skipping its optional tag.
+func tunnelVlan(attrs []byte) int {
+	for len(attrs) >= 2 {
+		attrType, attrLen := attrs[0], int(attrs[1])
+		if attrLen < 2 || attrLen > len(attrs) {
+			return 0
+		}
+		value := attrs[2:attrLen]
+		attrs = attrs[attrLen:]
+		if attrType != attrTunnelPrivateGroupID || len(value) == 0 {
+			continue
+		}
+		if value[0] < 0x20 {
+			value = value[1:]
+		}
+		vlan, err := strconv.Atoi(strings.TrimSpace(string(value)))
+		if err == nil && vlan > 0 {
+			return vlan
+		}
+	}
+	return 0
+}
+
+// hidePassword obfuscates a User-Password as described in RFC 2865,
+// section 5.2.
+func hidePassword(password []byte, secret string, authenticator []byte) []byte {
+	padded := make([]byte, (len(password)+15)/16*16)
+	copy(padded, password)
+	last := authenticator
+	for i := 0; i < len(padded); i += 16 {
+		h := md5.New()
+		h.Write([]byte(secret))
+		h.Write(last)
+		b := h.Sum(nil)
+		for j := 0; j < 16; j++ {
+			padded[i+j] ^= b[j]
+		}
+		last = padded[i : i+16]
+	}
+	return padded
+}
+
+func appendAttr(buf *bytes.Buffer, attrType byte, value []byte) {
+	buf.WriteByte(attrType)
+	buf.WriteByte(byte(len(value) + 2))
+	buf.Write(value)
+}
+
+func uint32Value(value uint32) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, value)
+	return b
+}
@@ -0,0 +1,185 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mab
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"encoding/binary"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+const testSecret = "testing123"
+
+// fakeRadiusServer accepts the MAC addresses in accept, assigning vlan, and
+// rejects all others.
+func fakeRadiusServer(accept string, vlan string) (*net.UDPConn, chan map[byte][]byte) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	Expect(err).NotTo(HaveOccurred())
+	requests := make(chan map[byte][]byte, 10)
+	go func() {
+		defer GinkgoRecover()
+		buf := make([]byte, maxPacketLen)
+		for {
+			size, addr, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			request := append([]byte{}, buf[:size]...)
+			attrs := map[byte][]byte{}
+			for rest := request[headerLen:]; len(rest) >= 2; rest = rest[rest[1]:] {
+				attrs[rest[0]] = rest[2:rest[1]]
+			}
+			// Like a real server, silently drop requests with an invalid
+			// Message-Authenticator
+			msgAuth := append([]byte{}, attrs[attrMessageAuthenticator]...)
+			copy(attrs[attrMessageAuthenticator], make([]byte, authenticatorLen))
+			mh := hmac.New(md5.New, []byte(testSecret))
+			mh.Write(request)
+			if !hmac.Equal(mh.Sum(nil), msgAuth) {
+				continue
+			}
+			requests <- attrs
+
+			code := byte(codeAccessReject)
+			var replyAttrs bytes.Buffer
+			password := revealPassword(attrs[attrUserPassword], testSecret, request[4:headerLen])
+			if string(bytes.TrimRight(password, "\x00")) == accept {
+				code = codeAccessAccept
+				if vlan != "" {
+					appendAttr(&replyAttrs, attrTunnelPrivateGroupID, append([]byte{1}, vlan...))
+				}
+			}
+			reply := append([]byte{code, request[1], 0, 0}, request[4:headerLen]...)
+			reply = append(reply, replyAttrs.Bytes()...)
+			binary.BigEndian.PutUint16(reply[2:4], uint16(len(reply)))
+			h := md5.New()
+			h.Write(reply)
+			h.Write([]byte(testSecret))
+			copy(reply[4:headerLen], h.Sum(nil))
+			conn.WriteToUDP(reply, addr)
+		}
+	}()
+	return conn, requests
+}
+
+func revealPassword(hidden []byte, secret string, authenticator []byte) []byte {
+	password := make([]byte, len(hidden))
+	last := authenticator
+	for i := 0; i+16 <= len(hidden); i += 16 {
+		h := md5.New()
+		h.Write([]byte(secret))
+		h.Write(last)
+		b := h.Sum(nil)
+		for j := 0; j < 16; j++ {
+			password[i+j] = hidden[i+j] ^ b[j]
+		}
+		last = hidden[i : i+16]
+	}
+	return password
+}
+
+var _ = Describe("RADIUS MAB", func() {
+	var mac net.HardwareAddr
+	BeforeEach(func() {
+		var err error
+		mac, err = net.ParseMAC("6e:16:06:0e:b7:e2")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("sends a Call-Check request and accepts with the assigned vlan", func() {
+		server, requests := fakeRadiusServer("6E-16-06-0E-B7-E2", "300")
+		defer server.Close()
+		authorizer := NewRadiusAuthorizer([]RadiusServer{{Address: server.LocalAddr().String(), Secret: testSecret}})
+		result, err := authorizer.Authorize("enp175s0f1", mac)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result).To(Equal(Result{Accept: true, Vlan: 300}))
+		attrs := <-requests
+		Expect(string(attrs[attrUserName])).To(Equal("6E-16-06-0E-B7-E2"))
+		Expect(string(attrs[attrCallingStationID])).To(Equal("6E-16-06-0E-B7-E2"))
+		Expect(attrs[attrServiceType]).To(Equal(uint32Value(serviceTypeCallCheck)))
+		Expect(string(attrs[attrNASPortID])).To(Equal("enp175s0f1"))
+	})
+
+	It("rejects other MAC addresses", func() {
+		server, _ := fakeRadiusServer("6E-16-06-0E-B7-E3", "")
+		defer server.Close()
+		authorizer := NewRadiusAuthorizer([]RadiusServer{{Address: server.LocalAddr().String(), Secret: testSecret}})
+		result, err := authorizer.Authorize("enp175s0f1", mac)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Accept).To(BeFalse())
+	})
+
+	It("ignores replies with the wrong shared secret and fails over", func() {
+		bad, _ := fakeRadiusServer("6E-16-06-0E-B7-E2", "")
+		defer bad.Close()
+		good, _ := fakeRadiusServer("6E-16-06-0E-B7-E2", "")
+		defer good.Close()
+		authorizer := NewRadiusAuthorizer([]RadiusServer{
+			{Address: bad.LocalAddr().String(), Secret: "wrong"},
+			{Address: good.LocalAddr().String(), Secret: testSecret},
+		})
+		authorizer.Timeout = 100 * time.Millisecond
+		authorizer.Retries = 0
+		result, err := authorizer.Authorize("enp175s0f1", mac)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Accept).To(BeTrue())
+	})
+
+	It("reads the shared secret file on every authorization", func() {
+		server, _ := fakeRadiusServer("6E-16-06-0E-B7-E2", "")
+		defer server.Close()
+		secretFile := filepath.Join(GinkgoT().TempDir(), "auth-0")
+		Expect(os.WriteFile(secretFile, []byte("wrong\n"), 0600)).To(Succeed())
+		authorizer := NewRadiusAuthorizer([]RadiusServer{{Address: server.LocalAddr().String(), SecretFile: secretFile}})
+		authorizer.Timeout = 100 * time.Millisecond
+		authorizer.Retries = 0
+		_, err := authorizer.Authorize("enp175s0f1", mac)
+		Expect(err).To(HaveOccurred())
+
+		By("Rotating the shared secret")
+		Expect(os.WriteFile(secretFile, []byte(testSecret+"\n"), 0600)).To(Succeed())
+		result, err := authorizer.Authorize("enp175s0f1", mac)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Accept).To(BeTrue())
+	})
+
+	It("fails without servers", func() {
+		_, err := NewRadiusAuthorizer(nil).Authorize("enp175s0f1", mac)
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+var _ = Describe("local MAB", func() {
+	It("accepts listed MAC addresses only", func() {
+		authorizer, err := NewLocalAuthorizer([]string{"6E:16:06:0E:B7:E2"})
+		Expect(err).NotTo(HaveOccurred())
+		mac, _ := net.ParseMAC("6e:16:06:0e:b7:e2")
+		Expect(authorizer.Authorize("enp175s0f1", mac)).To(Equal(Result{Accept: true}))
+		mac, _ = net.ParseMAC("6e:16:06:0e:b7:e3")
+		Expect(authorizer.Authorize("enp175s0f1", mac)).To(Equal(Result{}))
+		_, err = NewLocalAuthorizer([]string{"not-a-mac"})
+		Expect(err).To(HaveOccurred())
+	})
+})
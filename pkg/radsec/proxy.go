@@ -0,0 +1,362 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package radsec
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	kapi "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	eapolv1 "github.com/openshift-kni/eapol-operator/api/v1"
+	"github.com/openshift-kni/eapol-operator/internal/k8s"
+)
+
+const (
+	// SharedSecret is the RADIUS shared secret mandated for RadSec (RFC 6614, section 2.3)
+	SharedSecret = "radsec"
+
+	headerLen      = 4
+	minPacketLen   = 20
+	maxPacketLen   = 4096
+	dialTimeout    = 10 * time.Second
+	writeTimeout   = 5 * time.Second
+	minRedialDelay = 1 * time.Second
+	maxRedialDelay = 30 * time.Second
+)
+
+type Opts func(proxy *Proxy)
+
+// Upstream maps a loopback UDP address that hostapd sends RADIUS packets to
+// onto the RadSec server the packets are relayed to.  Replies are matched to
+// requests by RADIUS identifier only, so each listener must serve a single
+// RADIUS client.
+type Upstream struct {
+	Listen string
+	Server string
+}
+
+// Proxy relays hostapd's plain RADIUS/UDP traffic to RadSec servers over TLS.
+// Since RadSec uses the fixed shared secret "radsec", packets are relayed
+// unmodified in both directions.
+type Proxy struct {
+	Logger     log.Logger
+	Client     client.Client
+	Recorder   record.EventRecorder
+	AuthNsName *types.NamespacedName
+	// NodeName is the node the connection status is reported under
+	NodeName    string
+	TLSConfig   *tls.Config
+	Upstreams   []Upstream
+	conns       []*upstreamConn
+	statusMutex sync.Mutex
+	stopWg      sync.WaitGroup
+	stop        chan interface{}
+}
+
+type upstreamConn struct {
+	Upstream
+	proxy     *Proxy
+	udpConn   *net.UDPConn
+	mutex     sync.Mutex
+	tlsConn   net.Conn
+	clients   map[byte]*net.UDPAddr
+	connected bool
+	lastError string
+}
+
+func NewProxy(logger log.Logger, upstreams []Upstream, tlsConfig *tls.Config, opts ...Opts) *Proxy {
+	proxy := &Proxy{Logger: logger, Upstreams: upstreams, TLSConfig: tlsConfig}
+	for _, opt := range opts {
+		opt(proxy)
+	}
+	return proxy
+}
+
+func (p *Proxy) Start() error {
+	p.stop = make(chan interface{})
+	for _, upstream := range p.Upstreams {
+		addr, err := net.ResolveUDPAddr("udp", upstream.Listen)
+		if err != nil {
+			p.Stop()
+			return err
+		}
+		udpConn, err := net.ListenUDP("udp", addr)
+		if err != nil {
+			p.Stop()
+			return err
+		}
+		conn := &upstreamConn{Upstream: upstream, proxy: p, udpConn: udpConn,
+			clients: make(map[byte]*net.UDPAddr)}
+		p.conns = append(p.conns, conn)
+		p.stopWg.Add(2)
+		go conn.handleRequests()
+		go conn.maintainConnection()
+		level.Info(p.Logger).Log("op", "radsec", "listen", upstream.Listen, "server", upstream.Server)
+	}
+	return nil
+}
+
+func (p *Proxy) Stop() {
+	close(p.stop)
+	for _, conn := range p.conns {
+		conn.udpConn.Close()
+		conn.mutex.Lock()
+		if conn.tlsConn != nil {
+			conn.tlsConn.Close()
+		}
+		conn.mutex.Unlock()
+	}
+	p.stopWg.Wait()
+}
+
+func (p *Proxy) stopped() bool {
+	select {
+	case <-p.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+func (p *Proxy) dial(server string) (net.Conn, error) {
+	config := p.TLSConfig.Clone()
+	if config.ServerName == "" {
+		host, _, err := net.SplitHostPort(server)
+		if err != nil {
+			return nil, err
+		}
+		config.ServerName = host
+	}
+	return tls.DialWithDialer(&net.Dialer{Timeout: dialTimeout}, "tcp", server, config)
+}
+
+// maintainConnection keeps a TLS connection to the RadSec server open,
+// redialing with backoff, and relays replies back to hostapd.
+func (c *upstreamConn) maintainConnection() {
+	defer c.proxy.stopWg.Done()
+	delay := minRedialDelay
+	for {
+		conn, err := c.proxy.dial(c.Server)
+		if err == nil {
+			c.mutex.Lock()
+			if c.proxy.stopped() {
+				c.mutex.Unlock()
+				conn.Close()
+				return
+			}
+			c.tlsConn = conn
+			c.mutex.Unlock()
+			delay = minRedialDelay
+			c.setState(true, nil)
+			err = c.handleReplies(conn)
+			c.mutex.Lock()
+			c.tlsConn = nil
+			c.mutex.Unlock()
+			conn.Close()
+		}
+		if c.proxy.stopped() {
+			return
+		}
+		c.setState(false, err)
+		select {
+		case <-c.proxy.stop:
+			return
+		case <-time.After(delay):
+		}
+		delay *= 2
+		if delay > maxRedialDelay {
+			delay = maxRedialDelay
+		}
+	}
+}
+
+func (c *upstreamConn) handleReplies(conn net.Conn) error {
+	for {
+		packet, err := readPacket(conn)
+		if err != nil {
+			return err
+		}
+		c.mutex.Lock()
+		addr, ok := c.clients[packet[1]]
+		c.mutex.Unlock()
+		if !ok {
+			level.Debug(c.proxy.Logger).Log("op", "radsec", "server", c.Server, "msg", "dropping unsolicited reply", "id", packet[1])
+			continue
+		}
+		_, err = c.udpConn.WriteToUDP(packet, addr)
+		if err != nil {
+			level.Error(c.proxy.Logger).Log("op", "radsec", "server", c.Server, "error writing reply to hostapd", err)
+		}
+	}
+}
+
+func (c *upstreamConn) handleRequests() {
+	defer c.proxy.stopWg.Done()
+	buf := make([]byte, maxPacketLen)
+	for {
+		c.udpConn.SetReadDeadline(time.Now().Add(1 * time.Second))
+		size, addr, err := c.udpConn.ReadFromUDP(buf)
+		if c.proxy.stopped() {
+			return
+		}
+		if err != nil {
+			if opErr, ok := err.(*net.OpError); ok && opErr.Timeout() {
+				continue
+			}
+			level.Error(c.proxy.Logger).Log("op", "radsec", "listen", c.Listen, "error reading request", err)
+			return
+		}
+		packet, err := validatePacket(buf[:size])
+		if err != nil {
+			level.Info(c.proxy.Logger).Log("op", "radsec", "listen", c.Listen, "dropping request", err)
+			continue
+		}
+		c.mutex.Lock()
+		conn := c.tlsConn
+		c.clients[packet[1]] = addr
+		c.mutex.Unlock()
+		if conn == nil {
+			// hostapd retransmits, and fails over to the next server if
+			// this one stays unreachable.
+			level.Debug(c.proxy.Logger).Log("op", "radsec", "server", c.Server, "msg", "not connected, dropping request")
+			continue
+		}
+		conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+		_, err = conn.Write(packet)
+		if err != nil {
+			level.Error(c.proxy.Logger).Log("op", "radsec", "server", c.Server, "error writing request", err)
+			// Closing makes handleReplies return so the connection is redialed
+			conn.Close()
+		}
+	}
+}
+
+func (c *upstreamConn) setState(connected bool, err error) {
+	lastError := ""
+	if err != nil && err != io.EOF {
+		lastError = err.Error()
+		stats.Error(c.Server)
+		level.Error(c.proxy.Logger).Log("op", "radsec", "server", c.Server, "error", err)
+	}
+	if connected {
+		stats.Connected(c.Server)
+	} else {
+		stats.Disconnected(c.Server)
+	}
+	c.mutex.Lock()
+	changed := c.connected != connected || c.lastError != lastError
+	c.connected = connected
+	if lastError != "" || connected {
+		c.lastError = lastError
+	}
+	c.mutex.Unlock()
+	if !changed {
+		return
+	}
+	if connected {
+		c.proxy.logEvent(kapi.EventTypeNormal, "connected to RadSec server %s", c.Server)
+	} else {
+		c.proxy.logEvent(kapi.EventTypeWarning, "disconnected from RadSec server %s: %s", c.Server, lastError)
+	}
+	if err := c.proxy.updateStatus(c.Server, connected, lastError); err != nil {
+		level.Info(c.proxy.Logger).Log("op", "radsec", "error updating status", err)
+	}
+}
+
+func (p *Proxy) updateStatus(server string, connected bool, lastError string) error {
+	if p.Client == nil {
+		return nil
+	}
+	p.statusMutex.Lock()
+	defer p.statusMutex.Unlock()
+	return k8s.UpdateNodeState(p.Client, *p.AuthNsName, p.NodeName, func(status *eapolv1.AuthenticatorNodeStateStatus) {
+		var serverStatus *eapolv1.RadSecServer
+		for i, s := range status.RadSec {
+			if s.Server == server {
+				serverStatus = status.RadSec[i]
+				break
+			}
+		}
+		if serverStatus == nil {
+			serverStatus = &eapolv1.RadSecServer{Server: server}
+			status.RadSec = append(status.RadSec, serverStatus)
+		}
+		serverStatus.Connected = connected
+		if lastError != "" || connected {
+			serverStatus.LastError = lastError
+		}
+	})
+}
+
+func (p *Proxy) logEvent(eventType, messageFmt string, args ...interface{}) {
+	if p.Client == nil {
+		return
+	}
+	authObj := &eapolv1.Authenticator{}
+	err := p.Client.Get(context.Background(), *p.AuthNsName, authObj)
+	if err != nil {
+		level.Error(p.Logger).Log("record-event", "error recording event", "radsec", err)
+		return
+	}
+	p.Recorder.Eventf(authObj, eventType, "RadSec", messageFmt, args...)
+}
+
+// readPacket reads one RADIUS packet from a RadSec stream, which is framed
+// by the length field of the RADIUS header.
+func readPacket(r io.Reader) ([]byte, error) {
+	header := make([]byte, headerLen)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	length := int(binary.BigEndian.Uint16(header[2:]))
+	if length < minPacketLen || length > maxPacketLen {
+		return nil, fmt.Errorf("invalid RADIUS packet length %d", length)
+	}
+	packet := make([]byte, length)
+	copy(packet, header)
+	if _, err := io.ReadFull(r, packet[headerLen:]); err != nil {
+		return nil, err
+	}
+	return packet, nil
+}
+
+// validatePacket checks a RADIUS datagram and strips any trailing padding,
+// which would otherwise corrupt the RadSec stream framing.
+func validatePacket(datagram []byte) ([]byte, error) {
+	if len(datagram) < minPacketLen {
+		return nil, fmt.Errorf("short RADIUS packet of %d bytes", len(datagram))
+	}
+	length := int(binary.BigEndian.Uint16(datagram[2:]))
+	if length < minPacketLen || length > len(datagram) {
+		return nil, fmt.Errorf("invalid RADIUS packet length %d", length)
+	}
+	packet := make([]byte, length)
+	copy(packet, datagram)
+	return packet, nil
+}
@@ -0,0 +1,156 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package radsec
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"math/big"
+	"net"
+	"time"
+
+	"github.com/go-kit/log"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/openshift-kni/eapol-operator/internal/logging"
+)
+
+// newTestCert returns a self-signed certificate valid for 127.0.0.1.
+func newTestCert() (tls.Certificate, *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).NotTo(HaveOccurred())
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "radsec-test"},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	Expect(err).NotTo(HaveOccurred())
+	parsed, err := x509.ParseCertificate(der)
+	Expect(err).NotTo(HaveOccurred())
+	pool := x509.NewCertPool()
+	pool.AddCert(parsed)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, pool
+}
+
+func radiusPacket(code, id byte) []byte {
+	packet := make([]byte, minPacketLen)
+	packet[0] = code
+	packet[1] = id
+	binary.BigEndian.PutUint16(packet[2:], minPacketLen)
+	return packet
+}
+
+var _ = Describe("RadSec", func() {
+	var (
+		logger log.Logger
+	)
+	BeforeEach(func() {
+		var err error
+		logger, err = logging.Init("info")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	Context("Packet framing", func() {
+		It("strips padding from datagrams", func() {
+			packet, err := validatePacket(append(radiusPacket(1, 7), 0, 0, 0))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(packet).To(HaveLen(minPacketLen))
+		})
+		It("rejects truncated datagrams", func() {
+			_, err := validatePacket(radiusPacket(1, 7)[:10])
+			Expect(err).To(HaveOccurred())
+			packet := radiusPacket(1, 7)
+			binary.BigEndian.PutUint16(packet[2:], 40)
+			_, err = validatePacket(packet)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("Proxying", func() {
+		var (
+			listener net.Listener
+			proxy    *Proxy
+		)
+		BeforeEach(func() {
+			cert, pool := newTestCert()
+			var err error
+			listener, err = tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+				Certificates: []tls.Certificate{cert},
+				ClientCAs:    pool,
+				ClientAuth:   tls.RequireAndVerifyClientCert,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			// Answer every request with an Access-Accept carrying the same id
+			go func() {
+				defer GinkgoRecover()
+				for {
+					conn, err := listener.Accept()
+					if err != nil {
+						return
+					}
+					go func(conn net.Conn) {
+						defer conn.Close()
+						for {
+							packet, err := readPacket(conn)
+							if err != nil {
+								return
+							}
+							conn.Write(radiusPacket(2, packet[1]))
+						}
+					}(conn)
+				}
+			}()
+			proxy = NewProxy(logger, []Upstream{{Listen: "127.0.0.1:0", Server: listener.Addr().String()}},
+				&tls.Config{Certificates: []tls.Certificate{cert}, RootCAs: pool})
+			Expect(proxy.Start()).To(Succeed())
+		})
+		AfterEach(func() {
+			proxy.Stop()
+			listener.Close()
+		})
+		It("relays requests and replies", func() {
+			client, err := net.DialUDP("udp", nil, proxy.conns[0].udpConn.LocalAddr().(*net.UDPAddr))
+			Expect(err).NotTo(HaveOccurred())
+			defer client.Close()
+			reply := make([]byte, maxPacketLen)
+			Eventually(func() []byte {
+				client.Write(radiusPacket(1, 42))
+				client.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+				size, err := client.Read(reply)
+				if err != nil {
+					return nil
+				}
+				return reply[:size]
+			}, 5*time.Second, 100*time.Millisecond).Should(Equal(radiusPacket(2, 42)))
+			proxy.conns[0].mutex.Lock()
+			defer proxy.conns[0].mutex.Unlock()
+			Expect(proxy.conns[0].connected).To(BeTrue())
+		})
+	})
+})
@@ -0,0 +1,62 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package radsec
+
+import (
+	authmetrics "github.com/openshift-kni/eapol-operator/internal/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var labels = []string{"server"}
+
+var stats = metrics{
+	connected: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: authmetrics.Namespace,
+		Subsystem: authmetrics.RadSecSubsystem,
+		Name:      authmetrics.RadSecConnected.Name,
+		Help:      authmetrics.RadSecConnected.Help,
+	}, labels),
+
+	errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: authmetrics.Namespace,
+		Subsystem: authmetrics.RadSecSubsystem,
+		Name:      authmetrics.RadSecErrors.Name,
+		Help:      authmetrics.RadSecErrors.Help,
+	}, labels),
+}
+
+type metrics struct {
+	connected *prometheus.GaugeVec
+	errors    *prometheus.CounterVec
+}
+
+func init() {
+	prometheus.MustRegister(stats.connected)
+	prometheus.MustRegister(stats.errors)
+}
+
+func (m *metrics) Connected(server string) {
+	m.connected.WithLabelValues(server).Set(1)
+}
+
+func (m *metrics) Disconnected(server string) {
+	m.connected.WithLabelValues(server).Set(0)
+}
+
+func (m *metrics) Error(server string) {
+	m.errors.WithLabelValues(server).Inc()
+}